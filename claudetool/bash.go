@@ -29,12 +29,16 @@ type PermissionCallback func(command string) error
 type BashTool struct {
 	// CheckPermission is called before running any command, if set
 	CheckPermission PermissionCallback
+	// Rules checks commands before they run. If nil, bashkit's default rules are used.
+	Rules *bashkit.Checker
 	// EnableJITInstall enables just-in-time tool installation for missing commands
 	EnableJITInstall bool
 	// Timeouts holds the configurable timeout values (uses defaults if nil)
 	Timeouts *Timeouts
 	// Pwd is the working directory for the tool
 	Pwd string
+	// Jobs, if set, keeps track of background commands
+	Jobs *Jobs
 }
 
 const (
@@ -96,6 +100,10 @@ Bash state changes (working dir, variables, aliases) don't persist between calls
 With background=true, returns immediately, with output redirected to a file.
 Use background for servers/demos that need to stay running.
 
+With interactive=true, runs the command on a terminal, as a job that you can send input
+to with the jobs tool, and returns its output once it exits or pauses, e.g. at a prompt.
+Use interactive for commands that prompt: REPLs, database shells, npm init, git rebase -i.
+
 MUST set slow_ok=true for potentially slow commands: builds, downloads,
 installs, tests, or any other substantive operation.
 
@@ -119,6 +127,10 @@ installs, tests, or any other substantive operation.
       "type": "boolean",
       "description": "Execute in background"
     },
+    "interactive": {
+      "type": "boolean",
+      "description": "Execute on a terminal, accepting input through the jobs tool"
+    },
     "detect_ports": {
       "type": "boolean",
       "description": "Whether to detect open ports from this process (default: false for foreground, true for background)"
@@ -132,22 +144,28 @@ type bashInput struct {
 	Command     string `json:"command"`
 	SlowOK      bool   `json:"slow_ok,omitempty"`
 	Background  bool   `json:"background,omitempty"`
+	Interactive bool   `json:"interactive,omitempty"`
 	DetectPorts *bool  `json:"detect_ports,omitempty"`
 }
 
 type BackgroundResult struct {
 	PID     int
 	OutFile string
+	JobID   int // 0 if jobs aren't tracked
 }
 
 func (r *BackgroundResult) XMLish() string {
+	if r.JobID != 0 {
+		return fmt.Sprintf("<job_id>%d</job_id>\n<pid>%d</pid>\n<output_file>%s</output_file>\n<reminder>Use the jobs tool to wait for, tail, or stop this job.</reminder>\n",
+			r.JobID, r.PID, r.OutFile)
+	}
 	return fmt.Sprintf("<pid>%d</pid>\n<output_file>%s</output_file>\n<reminder>To stop the process: `kill -9 -%d`</reminder>\n",
 		r.PID, r.OutFile, r.PID)
 }
 
 func (i *bashInput) timeout(t *Timeouts) time.Duration {
 	switch {
-	case i.Background:
+	case i.Background && !i.Interactive:
 		return t.background()
 	case i.SlowOK:
 		return t.slow()
@@ -163,7 +181,7 @@ func (i *bashInput) shouldDetectPorts() bool {
 		return *i.DetectPorts
 	}
 	// Default behavior: detect ports for background tasks, don't detect for foreground
-	return i.Background
+	return i.Background || i.Interactive
 }
 
 func (b *BashTool) Run(ctx context.Context, m json.RawMessage) llm.ToolOut {
@@ -173,7 +191,11 @@ func (b *BashTool) Run(ctx context.Context, m json.RawMessage) llm.ToolOut {
 	}
 
 	// do a quick permissions check (NOT a security barrier)
-	err := bashkit.Check(req.Command)
+	rules := b.Rules
+	if rules == nil {
+		rules = bashkit.NewChecker(bashkit.Env{Dir: b.Pwd})
+	}
+	warnings, err := rules.Check(req.Command)
 	if err != nil {
 		return llm.ErrorToolOut(err)
 	}
@@ -195,13 +217,21 @@ func (b *BashTool) Run(ctx context.Context, m json.RawMessage) llm.ToolOut {
 
 	timeout := req.timeout(b.Timeouts)
 
+	if req.Interactive {
+		out, err := b.executeInteractiveBash(ctx, req, timeout)
+		if err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		return llm.ToolOut{LLMContent: llm.TextContent(withWarnings(warnings, out))}
+	}
+
 	// If Background is set to true, use executeBackgroundBash
 	if req.Background {
 		result, err := b.executeBackgroundBash(ctx, req, timeout)
 		if err != nil {
 			return llm.ErrorToolOut(err)
 		}
-		return llm.ToolOut{LLMContent: llm.TextContent(result.XMLish())}
+		return llm.ToolOut{LLMContent: llm.TextContent(withWarnings(warnings, result.XMLish()))}
 	}
 
 	// For foreground commands, use executeBash
@@ -209,7 +239,20 @@ func (b *BashTool) Run(ctx context.Context, m json.RawMessage) llm.ToolOut {
 	if execErr != nil {
 		return llm.ErrorToolOut(execErr)
 	}
-	return llm.ToolOut{LLMContent: llm.TextContent(out)}
+	return llm.ToolOut{LLMContent: llm.TextContent(withWarnings(warnings, out))}
+}
+
+// withWarnings prepends the warnings of bashkit rules to a command's output.
+func withWarnings(warnings []bashkit.Violation, out string) string {
+	if len(warnings) == 0 {
+		return out
+	}
+	var sb strings.Builder
+	for _, w := range warnings {
+		fmt.Fprintf(&sb, "<warning>%s</warning>\n", w.Message)
+	}
+	sb.WriteString(out)
+	return sb.String()
 }
 
 const maxBashOutputLength = 131072
@@ -261,10 +304,7 @@ func (b *BashTool) executeBash(ctx context.Context, req bashInput, timeout time.
 
 	output := new(bytes.Buffer)
 	cmd := b.makeBashCommand(execCtx, req.Command, output, req.shouldDetectPorts())
-	// TODO: maybe detect simple interactive git rebase commands and auto-background them?
-	// Would need to hint to the agent what is happening.
-	// We might also be able to do this for other simple interactive commands that use EDITOR.
-	cmd.Env = append(cmd.Env, `GIT_SEQUENCE_EDITOR=echo "To do an interactive rebase, run it as a background task and check the output file." && exit 1`)
+	cmd.Env = append(cmd.Env, `GIT_SEQUENCE_EDITOR=echo "To do an interactive rebase, run it with interactive=true." && exit 1`)
 	if err := cmd.Start(); err != nil {
 		return "", fmt.Errorf("command failed: %w", err)
 	}
@@ -312,18 +352,9 @@ func humanizeBytes(bytes int) string {
 
 // executeBackgroundBash executes a command in the background and returns the pid and output file locations
 func (b *BashTool) executeBackgroundBash(ctx context.Context, req bashInput, timeout time.Duration) (*BackgroundResult, error) {
-	// Create temp output files
-	tmpDir, err := os.MkdirTemp("", "sketch-bg-")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	// We can't really clean up tempDir, because we have no idea
-	// how far into the future the agent might want to read the output.
-
-	outFile := filepath.Join(tmpDir, "output")
-	out, err := os.Create(outFile)
+	tmpDir, outFile, out, err := createOutputFile()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create output file: %w", err)
+		return nil, err
 	}
 
 	execCtx, cancel := context.WithTimeout(context.Background(), timeout) // detach from tool use context
@@ -337,6 +368,16 @@ func (b *BashTool) executeBackgroundBash(ctx context.Context, req bashInput, tim
 		return nil, fmt.Errorf("failed to start background command: %w", err)
 	}
 
+	result := &BackgroundResult{
+		PID:     cmd.Process.Pid,
+		OutFile: outFile,
+	}
+	var jb *job
+	if b.Jobs != nil {
+		jb = b.Jobs.add(req.Command, cmd.Process.Pid, outFile, nil)
+		result.JobID = jb.id
+	}
+
 	// Wait for completion in the background, then do cleanup.
 	go func() {
 		err := cmdWait(cmd)
@@ -348,12 +389,29 @@ func (b *BashTool) executeBackgroundBash(ctx context.Context, req bashInput, tim
 		}
 		out.Close()
 		cancel()
+		if jb != nil {
+			b.Jobs.exited(jb, err)
+		}
 	}()
 
-	return &BackgroundResult{
-		PID:     cmd.Process.Pid,
-		OutFile: outFile,
-	}, nil
+	return result, nil
+}
+
+// createOutputFile creates a file in a new temporary directory for a background command's output.
+func createOutputFile() (tmpDir, outFile string, out *os.File, err error) {
+	tmpDir, err = os.MkdirTemp("", "sketch-bg-")
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	// We can't really clean up tempDir, because we have no idea
+	// how far into the future the agent might want to read the output.
+
+	outFile = filepath.Join(tmpDir, "output")
+	out, err = os.Create(outFile)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return tmpDir, outFile, out, nil
 }
 
 // checkAndInstallMissingTools analyzes a bash command and attempts to automatically install any missing tools.
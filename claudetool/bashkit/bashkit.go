@@ -8,16 +8,6 @@ import (
 	"mvdan.cc/sh/v3/syntax"
 )
 
-var checks = []func(*syntax.CallExpr) error{
-	noGitConfigUsernameEmailChanges,
-	noBlindGitAdd,
-}
-
-// Process-level checks that track state across calls
-var processAwareChecks = []func(*syntax.CallExpr) error{
-	noSketchWipBranchChangesOnce,
-}
-
 // Track whether sketch-wip branch warning has been shown in this process
 var (
 	sketchWipWarningMu    sync.Mutex
@@ -35,43 +25,11 @@ func ResetSketchWipWarning() {
 // Check DOES NOT PROVIDE SECURITY against malicious actors.
 // It is intended to catch straightforward mistakes in which a model
 // does things despite having been instructed not to do them.
+//
+// Check uses the DefaultRules, in the process's working directory, and so refuses commands that require approval.
+// Use a Checker to configure the rules, see warnings, and approve commands.
 func Check(bashScript string) error {
-	r := strings.NewReader(bashScript)
-	parser := syntax.NewParser()
-	file, err := parser.Parse(r, "")
-	if err != nil {
-		// Execution will fail, but we'll get a better error message from bash.
-		// Note that if this were security load bearing, this would be a terrible idea:
-		// You could smuggle stuff past Check by exploiting differences in what is considered syntactically valid.
-		// But it is not.
-		return nil
-	}
-
-	syntax.Walk(file, func(node syntax.Node) bool {
-		if err != nil {
-			return false
-		}
-		callExpr, ok := node.(*syntax.CallExpr)
-		if !ok {
-			return true
-		}
-		// Run regular checks
-		for _, check := range checks {
-			err = check(callExpr)
-			if err != nil {
-				return false
-			}
-		}
-		// Run process-aware checks
-		for _, check := range processAwareChecks {
-			err = check(callExpr)
-			if err != nil {
-				return false
-			}
-		}
-		return true
-	})
-
+	_, err := NewChecker(Env{}).Check(bashScript)
 	return err
 }
 
@@ -0,0 +1,259 @@
+package bashkit
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// This file has the built-in rules for destructive commands.
+// Like the other checks, they use simple heuristics, and have both false positives and false negatives.
+
+// flagsAndOperands splits args into flags and operands, honoring "--".
+func flagsAndOperands(args []string) (flags, operands []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return flags, append(operands, args[i+1:]...)
+		}
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			flags = append(flags, arg)
+		} else {
+			operands = append(operands, arg)
+		}
+	}
+	return flags, operands
+}
+
+// hasFlag reports whether flags include long, or a cluster of short flags that includes one of short.
+func hasFlag(flags []string, long, short string) bool {
+	return slices.ContainsFunc(flags, func(f string) bool {
+		if strings.HasPrefix(f, "--") {
+			return f == long
+		}
+		return short != "" && strings.ContainsAny(f[1:], short)
+	})
+}
+
+// rmRecursiveRoot matches recursive rm of the repo root, the home directory, or /, or their contents.
+func rmRecursiveRoot(cmd *Command) string {
+	args := cmd.Args()
+	if commandName(args) != "rm" {
+		return ""
+	}
+	flags, operands := flagsAndOperands(args[1:])
+	if !hasFlag(flags, "--recursive", "rR") {
+		return ""
+	}
+	protected := []struct{ name, dir string }{
+		{"the root directory", "/"},
+		{"the home directory", cmd.Env.Home},
+		{"the repo root", cmd.Env.RepoRoot},
+	}
+	for _, op := range operands {
+		target := op
+		switch {
+		case op == "":
+			continue // not expandable
+		case op == "*":
+			target = "."
+		case strings.HasSuffix(op, "/*"):
+			target = strings.TrimSuffix(op, "*")
+		}
+		abs := cmd.Env.abs(target)
+		for _, p := range protected {
+			if p.dir != "" && within(cmd.Env.abs(p.dir), abs) {
+				return fmt.Sprintf("rm -r %s would delete %s (%s); delete the specific files or directories you mean instead", op, p.name, p.dir)
+			}
+		}
+	}
+	return ""
+}
+
+// gitSubcommand returns git's subcommand and its arguments, and the directory git runs in, from -C.
+func gitSubcommand(args []string) (sub string, subArgs []string, dir string) {
+	if commandName(args) != "git" {
+		return "", nil, ""
+	}
+	for i := 1; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-C" || arg == "-c" || arg == "--git-dir" || arg == "--work-tree":
+			if arg == "-C" && i+1 < len(args) {
+				dir = args[i+1]
+			}
+			i++ // skip the value
+		case strings.HasPrefix(arg, "-"):
+		default:
+			return arg, args[i+1:], dir
+		}
+	}
+	return "", nil, dir
+}
+
+// gitEnv returns env, in dir if it's set.
+func gitEnv(env *Env, dir string) *Env {
+	if dir == "" {
+		return env
+	}
+	e := *env
+	e.Dir = env.abs(dir)
+	return &e
+}
+
+// forcePushProtected matches git push --force, or a forced refspec, to a protected branch.
+func forcePushProtected(cmd *Command) string {
+	sub, args, dir := gitSubcommand(cmd.Args())
+	if sub != "push" {
+		return ""
+	}
+	flags, operands := flagsAndOperands(args)
+	forceAll := hasFlag(flags, "--force", "f") || slices.ContainsFunc(flags, func(f string) bool {
+		return strings.HasPrefix(f, "--force-with-lease")
+	})
+	env := gitEnv(cmd.Env, dir)
+
+	var refspecs []string
+	if len(operands) > 1 {
+		refspecs = operands[1:] // after the remote
+	}
+	if len(refspecs) == 0 {
+		if hasFlag(flags, "--all", "") || hasFlag(flags, "--mirror", "") {
+			refspecs = env.ProtectedBranches
+		} else {
+			refspecs = []string{"HEAD"} // the current branch, by default
+		}
+	}
+	for _, spec := range refspecs {
+		forced := forceAll || strings.HasPrefix(spec, "+")
+		if !forced || spec == "" {
+			continue
+		}
+		spec = strings.TrimPrefix(spec, "+")
+		if _, dst, ok := strings.Cut(spec, ":"); ok {
+			spec = dst
+		}
+		branch := strings.TrimPrefix(spec, "refs/heads/")
+		if branch == "HEAD" {
+			current, err := env.git("rev-parse", "--abbrev-ref", "HEAD")
+			if err != nil {
+				continue
+			}
+			branch = current
+		}
+		if slices.ContainsFunc(env.ProtectedBranches, func(pattern string) bool {
+			ok, _ := path.Match(pattern, branch)
+			return ok
+		}) {
+			return fmt.Sprintf("git push --force to %s, a protected branch, would rewrite history that others may depend on", branch)
+		}
+	}
+	return ""
+}
+
+// resetHardUncommitted matches git reset --hard when there are uncommitted changes to tracked files.
+func resetHardUncommitted(cmd *Command) string {
+	sub, args, dir := gitSubcommand(cmd.Args())
+	if sub != "reset" || !slices.Contains(args, "--hard") {
+		return ""
+	}
+	status, err := gitEnv(cmd.Env, dir).git("status", "--porcelain", "--untracked-files=no")
+	if err != nil || status == "" {
+		return ""
+	}
+	files := strings.Count(status, "\n") + 1
+	return fmt.Sprintf("git reset --hard would discard uncommitted changes to %d files; commit or stash them first if they might be needed", files)
+}
+
+// chmodRecursive777 matches chmod -R with a mode that makes everything world-writable.
+func chmodRecursive777(cmd *Command) string {
+	args := cmd.Args()
+	if commandName(args) != "chmod" {
+		return ""
+	}
+	flags, operands := flagsAndOperands(args[1:])
+	if !hasFlag(flags, "--recursive", "R") || len(operands) == 0 {
+		return ""
+	}
+	switch operands[0] {
+	case "777", "0777", "a+rwx", "ugo+rwx", "a=rwx", "ugo=rwx":
+		return "chmod -R 777 makes every file world-writable and executable; grant only the permissions needed, e.g. chmod -R u+rwX,go+rX"
+	}
+	return ""
+}
+
+var (
+	downloaders = []string{"curl", "wget"}
+	shells      = []string{"sh", "bash", "zsh", "dash", "ksh"}
+)
+
+// curlPipeShell matches scripts downloaded by curl or wget and run by a shell,
+// by a pipe, or by command or process substitution.
+func curlPipeShell(cmd *Command) string {
+	shell := cmd.Name()
+	if !slices.Contains(shells, shell) {
+		return ""
+	}
+	isDownload := func(call *syntax.CallExpr) bool {
+		return slices.Contains(downloaders, commandName(cmd.Env.args(call)))
+	}
+	download := slices.IndexFunc(cmd.PipedFrom, isDownload) >= 0
+	for _, arg := range cmd.CallExpr.Args {
+		syntax.Walk(arg, func(node syntax.Node) bool {
+			if call, ok := node.(*syntax.CallExpr); ok && isDownload(call) {
+				download = true
+			}
+			return !download
+		})
+	}
+	if !download {
+		return ""
+	}
+	return fmt.Sprintf("running a script downloaded from the network with %s runs code nobody has reviewed; download it to a file and inspect it first", shell)
+}
+
+// fileWriters are commands that write to, create or delete their operands.
+// cp, mv, ln and install write only to the last.
+var (
+	fileWriters     = []string{"tee", "touch", "mkdir", "rm", "rmdir", "truncate"}
+	fileDestWriters = []string{"cp", "mv", "ln", "install"}
+)
+
+// writeOutsideRepo matches commands that write files outside the repo, other than in temporary directories.
+func writeOutsideRepo(cmd *Command) string {
+	env := cmd.Env
+	if env.RepoRoot == "" {
+		return ""
+	}
+	var targets []string
+	for _, r := range cmd.Redirs {
+		switch r.Op {
+		case syntax.RdrOut, syntax.AppOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll:
+			targets = append(targets, env.expand(r.Word))
+		}
+	}
+	args := cmd.Args()
+	name := commandName(args)
+	if len(args) > 0 {
+		_, operands := flagsAndOperands(args[1:])
+		switch {
+		case slices.Contains(fileWriters, name):
+			targets = append(targets, operands...)
+		case slices.Contains(fileDestWriters, name) && len(operands) > 1:
+			targets = append(targets, operands[len(operands)-1])
+		}
+	}
+	allowed := []string{env.RepoRoot, os.TempDir(), "/tmp", "/var/tmp", "/dev"}
+	for _, target := range targets {
+		if target == "" {
+			continue // not expandable
+		}
+		abs := env.abs(target)
+		if !slices.ContainsFunc(allowed, func(dir string) bool { return within(abs, env.abs(dir)) }) {
+			return fmt.Sprintf("this writes to %s, outside the repo (%s); make sure that's intended", abs, env.RepoRoot)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,457 @@
+package bashkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Severity is what happens to a command that matches a rule.
+type Severity string
+
+const (
+	// Warn runs the command, and tells the model why it might be a mistake.
+	Warn Severity = "warn"
+	// RequireApproval runs the command only once the user has approved it.
+	RequireApproval Severity = "require-approval"
+	// Block refuses to run the command.
+	Block Severity = "block"
+)
+
+func (s Severity) valid() bool {
+	return s == Warn || s == RequireApproval || s == Block
+}
+
+// A Rule inspects the commands in a script.
+type Rule struct {
+	Name     string // e.g. "rm-rf-root"
+	Severity Severity
+	// Match returns a message for the model explaining why cmd violates the rule,
+	// or the empty string if it doesn't.
+	Match func(cmd *Command) string
+}
+
+// A Command is a simple command in a script, with the context that rules need.
+type Command struct {
+	*syntax.CallExpr
+	Redirs    []*syntax.Redirect // of the command's statement
+	PipedFrom []*syntax.CallExpr // the commands whose output is piped into this one
+	Env       *Env
+}
+
+// Env describes where scripts run.
+type Env struct {
+	Dir      string // working directory, for relative paths; the process's if empty
+	RepoRoot string // git repo root, if any
+	Home     string // the user's home directory
+	// ProtectedBranches are path.Match patterns for branches that must not be force-pushed.
+	ProtectedBranches []string
+}
+
+// A Violation is a command's match of a rule.
+type Violation struct {
+	Rule     string
+	Severity Severity
+	Message  string
+	// Code identifies the script for approval, for RequireApproval violations: see Checker.Approve.
+	Code string
+}
+
+func (v Violation) Error() string {
+	switch v.Severity {
+	case Warn:
+		return "warning: " + v.Message
+	case RequireApproval:
+		return "approval required: " + v.Message + ". Ask the user whether to run this command, and end your turn. " +
+			fmt.Sprintf("It can run only if they reply %q; if they do, run exactly the same command again", "approve "+v.Code)
+	default:
+		return "permission denied: " + v.Message
+	}
+}
+
+// A Checker checks scripts against rules. It is safe for concurrent use,
+// but Rules and Env must not be changed once it is in use.
+type Checker struct {
+	Env   Env
+	Rules []Rule
+
+	mu       sync.Mutex
+	pending  map[string]string // scripts awaiting the user's approval, by approval code
+	approved map[string]bool   // scripts approved by the user, until they run
+}
+
+// NewChecker returns a Checker with DefaultRules.
+// Env's Home defaults to the user's home directory, and its ProtectedBranches to main and master.
+func NewChecker(env Env) *Checker {
+	if env.Home == "" {
+		env.Home, _ = os.UserHomeDir()
+	}
+	if env.ProtectedBranches == nil {
+		env.ProtectedBranches = []string{"main", "master"}
+	}
+	return &Checker{Env: env, Rules: DefaultRules()}
+}
+
+// DefaultRules returns the built-in rules.
+func DefaultRules() []Rule {
+	return []Rule{
+		{Name: "git-identity", Severity: Block, Match: callRule(noGitConfigUsernameEmailChanges)},
+		{Name: "blind-git-add", Severity: Block, Match: callRule(noBlindGitAdd)},
+		{Name: "sketch-wip-branch", Severity: Block, Match: callRule(noSketchWipBranchChangesOnce)},
+		{Name: "rm-rf-root", Severity: Block, Match: rmRecursiveRoot},
+		{Name: "force-push-protected", Severity: RequireApproval, Match: forcePushProtected},
+		{Name: "reset-hard-uncommitted", Severity: RequireApproval, Match: resetHardUncommitted},
+		{Name: "chmod-777", Severity: Warn, Match: chmodRecursive777},
+		{Name: "curl-pipe-shell", Severity: RequireApproval, Match: curlPipeShell},
+		{Name: "write-outside-repo", Severity: Warn, Match: writeOutsideRepo},
+	}
+}
+
+// callRule adapts a check on a single call, which returns a "permission denied" error, to a Rule's Match.
+func callRule(check func(*syntax.CallExpr) error) func(*Command) string {
+	return func(cmd *Command) string {
+		if err := check(cmd.CallExpr); err != nil {
+			return strings.TrimPrefix(err.Error(), "permission denied: ")
+		}
+		return ""
+	}
+}
+
+// Check checks script against c's rules. It returns an error, made of Violations,
+// if script must not run: it breaks a Block rule, or a RequireApproval rule without the user's approval.
+// Otherwise it returns the violations of Warn rules, for the model to see.
+// Like the package-level Check, it DOES NOT PROVIDE SECURITY.
+func (c *Checker) Check(script string) (warnings []Violation, err error) {
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), "")
+	if err != nil {
+		// See the package-level Check.
+		return nil, nil
+	}
+	var blocked, unapproved []error
+	for _, cmd := range c.commands(file) {
+		for _, rule := range c.Rules {
+			msg := rule.Match(cmd)
+			if msg == "" {
+				continue
+			}
+			v := Violation{Rule: rule.Name, Severity: rule.Severity, Message: msg}
+			switch rule.Severity {
+			case Warn:
+				warnings = append(warnings, v)
+			case RequireApproval:
+				v.Code = approvalCode(script)
+				unapproved = append(unapproved, v)
+			default:
+				blocked = append(blocked, v)
+			}
+		}
+	}
+	if len(blocked) > 0 {
+		return nil, errors.Join(blocked...)
+	}
+	if len(unapproved) > 0 {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if !c.approved[script] {
+			if c.pending == nil {
+				c.pending = make(map[string]string)
+			}
+			c.pending[approvalCode(script)] = script
+			return nil, errors.Join(unapproved...)
+		}
+		delete(c.approved, script) // approval is for one run
+	}
+	return warnings, nil
+}
+
+// approvalCode returns the code with which the user approves script.
+func approvalCode(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:3])
+}
+
+// approveRE matches an approval in a reply: "approve" and an approval code.
+var approveRE = regexp.MustCompile(`(?i)\bapprove\s+([0-9a-f]{6})\b`)
+
+// Approve approves the scripts, refused for lack of approval, whose codes the user's reply approves,
+// by containing "approve <code>", as the model was told to ask for. Any other reply approves nothing.
+// It returns the number of scripts approved.
+func (c *Checker) Approve(reply string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, m := range approveRE.FindAllStringSubmatch(reply, -1) {
+		code := strings.ToLower(m[1])
+		script, ok := c.pending[code]
+		if !ok {
+			continue
+		}
+		if c.approved == nil {
+			c.approved = make(map[string]bool)
+		}
+		c.approved[script] = true
+		delete(c.pending, code)
+		n++
+	}
+	return n
+}
+
+// commands returns the simple commands in file, including those in command substitutions.
+func (c *Checker) commands(file *syntax.File) []*Command {
+	var cmds []*Command
+	pipedFrom := make(map[*syntax.CallExpr][]*syntax.CallExpr)
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch node := node.(type) {
+		case *syntax.BinaryCmd:
+			// Pipelines are left-associative: the right side's input is everything on the left.
+			if node.Op != syntax.Pipe && node.Op != syntax.PipeAll {
+				break
+			}
+			if call, ok := node.Y.Cmd.(*syntax.CallExpr); ok {
+				syntax.Walk(node.X, func(n syntax.Node) bool {
+					if from, ok := n.(*syntax.CallExpr); ok {
+						pipedFrom[call] = append(pipedFrom[call], from)
+					}
+					return true
+				})
+			}
+		case *syntax.Stmt:
+			if call, ok := node.Cmd.(*syntax.CallExpr); ok {
+				cmds = append(cmds, &Command{CallExpr: call, Redirs: node.Redirs, Env: &c.Env})
+			}
+		}
+		return true
+	})
+	for _, cmd := range cmds {
+		cmd.PipedFrom = pipedFrom[cmd.CallExpr]
+	}
+	return cmds
+}
+
+// commandWrappers run the command that follows them, after their own flags.
+var commandWrappers = []string{"sudo", "command", "exec", "nohup", "time", "nice", "env"}
+
+// Args returns the command's arguments, after any wrappers such as sudo,
+// expanded where they are literal or refer to $HOME or $PWD.
+// Arguments that can't be expanded are empty strings.
+func (cmd *Command) Args() []string {
+	return cmd.Env.args(cmd.CallExpr)
+}
+
+// Name returns the base name of the command run, e.g. "rm" for "sudo /bin/rm -rf x".
+func (cmd *Command) Name() string {
+	return commandName(cmd.Args())
+}
+
+func commandName(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return path.Base(args[0])
+}
+
+func (e *Env) args(call *syntax.CallExpr) []string {
+	var args []string
+	for _, w := range call.Args {
+		args = append(args, e.expand(w))
+	}
+	for len(args) > 0 && slices.Contains(commandWrappers, commandName(args)) {
+		args = args[1:]
+		for len(args) > 0 && (strings.HasPrefix(args[0], "-") || strings.Contains(args[0], "=")) {
+			args = args[1:]
+		}
+	}
+	return args
+}
+
+// expand returns the value of w, if it's made of literals and $HOME, $PWD or a leading ~.
+// It returns the empty string otherwise.
+func (e *Env) expand(w *syntax.Word) string {
+	var sb strings.Builder
+	var expandParts func(parts []syntax.WordPart, quoted bool) bool
+	expandParts = func(parts []syntax.WordPart, quoted bool) bool {
+		for i, part := range parts {
+			switch p := part.(type) {
+			case *syntax.Lit:
+				v := p.Value
+				if i == 0 && !quoted && sb.Len() == 0 && (v == "~" || strings.HasPrefix(v, "~/")) {
+					if e.Home == "" {
+						return false
+					}
+					v = e.Home + v[1:]
+				}
+				sb.WriteString(v)
+			case *syntax.SglQuoted:
+				sb.WriteString(p.Value)
+			case *syntax.DblQuoted:
+				if !expandParts(p.Parts, true) {
+					return false
+				}
+			case *syntax.ParamExp:
+				v := e.param(p)
+				if v == "" {
+					return false
+				}
+				sb.WriteString(v)
+			default:
+				return false
+			}
+		}
+		return true
+	}
+	if !expandParts(w.Parts, false) {
+		return ""
+	}
+	return sb.String()
+}
+
+// param returns the value of a plain reference to $HOME or $PWD, or the empty string.
+func (e *Env) param(p *syntax.ParamExp) string {
+	if p.Param == nil || p.Excl || p.Length || p.Width || p.Index != nil || p.Slice != nil || p.Repl != nil || p.Exp != nil {
+		return ""
+	}
+	switch p.Param.Value {
+	case "HOME":
+		return e.Home
+	case "PWD":
+		return e.dir()
+	}
+	return ""
+}
+
+func (e *Env) dir() string {
+	if e.Dir != "" {
+		return e.Dir
+	}
+	wd, _ := os.Getwd()
+	return wd
+}
+
+// abs returns p as an absolute, clean path.
+func (e *Env) abs(p string) string {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(e.dir(), p)
+	}
+	return filepath.Clean(p)
+}
+
+// git runs git in the working directory, returning its trimmed output.
+func (e *Env) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = e.dir()
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// within reports whether p is dir or inside it. Both must be absolute and clean.
+func within(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// ConfigPath is where a repo declares its own bash rules, relative to the repo root.
+const ConfigPath = ".sketch/bash-rules.yaml"
+
+// config is the contents of ConfigPath. For example:
+//
+//	protected_branches: [main, release/*]
+//	disable: [write-outside-repo]
+//	rules:
+//	  - name: terraform-apply
+//	    command: terraform
+//	    args: [apply]
+//	    severity: require-approval
+//	    message: terraform apply changes production infrastructure
+type config struct {
+	// ProtectedBranches replaces the default protected branches, main and master.
+	ProtectedBranches []string `yaml:"protected_branches"`
+	// Disable lists built-in rules to turn off.
+	Disable []string     `yaml:"disable"`
+	Rules   []configRule `yaml:"rules"`
+}
+
+// configRule is a rule declared in config.
+type configRule struct {
+	Name string `yaml:"name"`
+	// Command is the base name of the command, e.g. "terraform".
+	Command string `yaml:"command"`
+	// Args are path.Match patterns, each of which must match one of the command's arguments.
+	Args     []string `yaml:"args"`
+	Severity Severity `yaml:"severity"`
+	// Message explains to the model why the command matches.
+	Message string `yaml:"message"`
+}
+
+// LoadConfig adds the rules declared in the config file named file, which has the format of ConfigPath.
+// A missing file is not an error.
+func (c *Checker) LoadConfig(file string) error {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var cfg config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	for _, name := range cfg.Disable {
+		if !slices.ContainsFunc(c.Rules, func(r Rule) bool { return r.Name == name }) {
+			return fmt.Errorf("%s: unknown rule %q in disable", file, name)
+		}
+	}
+	var rules []Rule
+	for i, cr := range cfg.Rules {
+		if cr.Name == "" || cr.Command == "" {
+			return fmt.Errorf("%s: rule %d needs a name and a command", file, i+1)
+		}
+		if !cr.Severity.valid() {
+			return fmt.Errorf("%s: rule %q has severity %q, want warn, require-approval or block", file, cr.Name, cr.Severity)
+		}
+		for _, pattern := range cr.Args {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s: rule %q has bad args pattern %q: %w", file, cr.Name, pattern, err)
+			}
+		}
+		rules = append(rules, Rule{Name: cr.Name, Severity: cr.Severity, Match: cr.match})
+	}
+
+	if cfg.ProtectedBranches != nil {
+		c.Env.ProtectedBranches = cfg.ProtectedBranches
+	}
+	c.Rules = slices.DeleteFunc(c.Rules, func(r Rule) bool { return slices.Contains(cfg.Disable, r.Name) })
+	c.Rules = append(c.Rules, rules...)
+	return nil
+}
+
+func (cr configRule) match(cmd *Command) string {
+	args := cmd.Args()
+	if commandName(args) != cr.Command {
+		return ""
+	}
+	for _, pattern := range cr.Args {
+		if !slices.ContainsFunc(args[1:], func(arg string) bool {
+			ok, _ := path.Match(pattern, arg)
+			return ok
+		}) {
+			return ""
+		}
+	}
+	if cr.Message == "" {
+		return fmt.Sprintf("the command matches the repo's %q rule", cr.Name)
+	}
+	return cr.Message
+}
@@ -0,0 +1,231 @@
+package codereview
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"sketch.dev/experiment"
+)
+
+// This file compares Go benchmark results between the initial commit and HEAD, in the manner of benchstat.
+
+const (
+	benchCount     = 6       // runs of each benchmark, in each state
+	benchTime      = "100ms" // per run
+	benchAlpha     = 0.05    // significance level
+	benchThreshold = 5.0     // smallest slowdown reported, in percent
+)
+
+// benchUnits are the benchmark units compared, all of which are better when lower.
+// Custom metrics, such as MB/s, can go either way.
+var benchUnits = []string{"ns/op", "B/op", "allocs/op"}
+
+// A benchmarkRegression is a benchmark that got significantly worse in some unit.
+type benchmarkRegression struct {
+	Name          string // package and benchmark, e.g. "sketch.dev/p.BenchmarkSum-8"
+	Unit          string
+	Before, After float64 // medians
+	P             float64
+	N             int // runs in each state
+}
+
+// benchmarksEnabled reports whether the review should run benchmarks,
+// as enabled by the repo's review config or the benchmarks experiment.
+func (r *CodeReviewer) benchmarksEnabled() bool {
+	return (r.config != nil && r.config.Benchmarks) || experiment.Enabled("benchmarks")
+}
+
+var benchmarkFunc = regexp.MustCompile(`(?m)^func Benchmark([^a-z]\w*)?\(`)
+
+// benchmarkDirs returns the directories, relative to the repo root, of the packages in pkgs
+// that contain changed files and have benchmarks.
+func (r *CodeReviewer) benchmarkDirs(pkgs map[string]*packages.Package, changedFiles []string) []string {
+	var dirs []string
+	for _, pkg := range pkgs {
+		files := allFiles(pkg)
+		if len(pkg.GoFiles) == 0 || !slices.ContainsFunc(changedFiles, func(f string) bool { return files[f] }) {
+			continue
+		}
+		dir := filepath.Dir(pkg.GoFiles[0])
+		tests, _ := filepath.Glob(filepath.Join(dir, "*_test.go"))
+		if !slices.ContainsFunc(tests, func(f string) bool {
+			src, err := os.ReadFile(f)
+			return err == nil && benchmarkFunc.Match(src)
+		}) {
+			continue
+		}
+		if rel, err := filepath.Rel(r.repoRoot, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			dirs = append(dirs, rel)
+		}
+	}
+	slices.Sort(dirs)
+	return slices.Compact(dirs)
+}
+
+// checkBenchmarks runs the benchmarks in dirs in the initial and current state,
+// and reports those that are significantly slower, or allocate significantly more, at HEAD.
+func (r *CodeReviewer) checkBenchmarks(ctx context.Context, dirs []string) ([]benchmarkRegression, error) {
+	ctx, span := tracer.Start(ctx, "codereview.checkBenchmarks")
+	defer span.End()
+
+	if err := r.initializeInitialCommitWorktree(ctx); err != nil {
+		return nil, err
+	}
+	run := func(root string) (map[string]map[string][]float64, error) {
+		var pkgs []string
+		for _, d := range dirs {
+			if fileExists(filepath.Join(root, d)) {
+				pkgs = append(pkgs, "./"+filepath.ToSlash(d))
+			}
+		}
+		if len(pkgs) == 0 {
+			// Without package args, go test would benchmark the root package.
+			return nil, nil
+		}
+		args := append([]string{"test", "-run=^$", "-bench=.", "-benchmem", "-count=" + strconv.Itoa(benchCount), "-benchtime=" + benchTime}, pkgs...)
+		out, err := checkCommand(ctx, root, "go", args...).Output()
+		// Benchmarks that fail or don't build exit with an error, which the tests report.
+		if _, err := checkExitCode(ctx, err); err != nil {
+			return nil, err
+		}
+		return parseBenchmarks(out), nil
+	}
+	before, err := run(r.initialWorktree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run benchmarks in initial commit: %w", err)
+	}
+	after, err := run(r.repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run benchmarks: %w", err)
+	}
+	return compareBenchmarks(before, after), nil
+}
+
+// parseBenchmarks parses go test -bench output into values by benchmark and unit.
+// Benchmarks are named by package, e.g. "sketch.dev/p.BenchmarkSum-8".
+func parseBenchmarks(output []byte) map[string]map[string][]float64 {
+	results := make(map[string]map[string][]float64)
+	var pkg string
+	for line := range strings.Lines(string(output)) {
+		if p, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = strings.TrimSpace(p)
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue // not a result line, e.g. output from the benchmark
+		}
+		name := pkg + "." + fields[0]
+		if results[name] == nil {
+			results[name] = make(map[string][]float64)
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			if v, err := strconv.ParseFloat(fields[i], 64); err == nil {
+				results[name][fields[i+1]] = append(results[name][fields[i+1]], v)
+			}
+		}
+	}
+	return results
+}
+
+// compareBenchmarks returns the benchmarks in both before and after whose benchUnits got significantly worse,
+// by a Mann-Whitney U test, and by at least benchThreshold percent.
+func compareBenchmarks(before, after map[string]map[string][]float64) []benchmarkRegression {
+	var regressions []benchmarkRegression
+	for _, name := range slices.Sorted(maps.Keys(after)) {
+		for _, unit := range benchUnits {
+			xs, ys := before[name][unit], after[name][unit]
+			if len(xs) == 0 || len(ys) == 0 {
+				continue
+			}
+			b, a := median(xs), median(ys)
+			if a <= b || (b > 0 && 100*(a-b)/b < benchThreshold) {
+				continue
+			}
+			if p := mannWhitneyU(xs, ys); p < benchAlpha {
+				regressions = append(regressions, benchmarkRegression{Name: name, Unit: unit, Before: b, After: a, P: p, N: min(len(xs), len(ys))})
+			}
+		}
+	}
+	return regressions
+}
+
+func median(xs []float64) float64 {
+	s := slices.Sorted(slices.Values(xs))
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test
+// that xs and ys come from the same distribution, as benchstat uses.
+// It uses the normal approximation, with corrections for ties and continuity.
+func mannWhitneyU(xs, ys []float64) float64 {
+	n1, n2 := float64(len(xs)), float64(len(ys))
+	all := slices.Sorted(slices.Values(slices.Concat(xs, ys)))
+
+	// The rank of a value is the average of the ranks of the values equal to it.
+	ranks := make(map[float64]float64)
+	var ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j] == all[i] {
+			j++
+		}
+		ranks[all[i]] = float64(i+j+1) / 2 // ranks are 1-based
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+	var r1 float64
+	for _, x := range xs {
+		r1 += ranks[x]
+	}
+	u := r1 - n1*(n1+1)/2
+
+	n := n1 + n2
+	variance := n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1)))
+	if variance <= 0 {
+		return 1 // all values are equal
+	}
+	z := max(math.Abs(u-n1*n2/2)-0.5, 0) / math.Sqrt(variance)
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// formatBenchmarkRegressions generates a human-readable summary of benchmark regressions, like benchstat's,
+// and records them as findings.
+func (r *CodeReviewer) formatBenchmarkRegressions(regressions []benchmarkRegression) string {
+	if len(regressions) == 0 {
+		return ""
+	}
+
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "Benchmark regressions detected between initial commit (%s) and HEAD:\n\n", r.sketchBaseRef)
+
+	for i, reg := range regressions {
+		delta := "+Inf%"
+		if reg.Before > 0 {
+			delta = fmt.Sprintf("%+.1f%%", 100*(reg.After-reg.Before)/reg.Before)
+		}
+		msg := fmt.Sprintf("%s went from %.4g to %.4g (%s, p=%.3f n=%d)", reg.Unit, reg.Before, reg.After, delta, reg.P, reg.N)
+		fmt.Fprintf(buf, "%d: %s: %s\n", i+1, reg.Name, msg)
+		r.record(Finding{Tool: "Go benchmarks", Rule: "benchmark-regression", Severity: SeverityWarning, Message: reg.Name + ": " + msg})
+	}
+
+	buf.WriteString("\nIf the slowdown is expected, explain why to the user; otherwise, fix it.\n")
+	return buf.String()
+}
@@ -0,0 +1,143 @@
+package codereview
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		name   string
+		xs, ys []float64
+		want   float64
+	}{
+		{"separated", []float64{1, 2, 3, 4, 5, 6}, []float64{7, 8, 9, 10, 11, 12}, 0.0051},
+		{"interleaved", []float64{1, 3, 5, 7, 9, 11}, []float64{2, 4, 6, 8, 10, 12}, 0.6889},
+		{"tied groups", []float64{10, 10, 10, 10, 10, 10}, []float64{12, 12, 12, 12, 12, 12}, 0.0013},
+		{"all equal", []float64{5, 5, 5}, []float64{5, 5, 5}, 1},
+	}
+	for _, tt := range tests {
+		if got := mannWhitneyU(tt.xs, tt.ys); math.Abs(got-tt.want) > 0.0001 {
+			t.Errorf("%s: mannWhitneyU() = %.4f, want %.4f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompareBenchmarks(t *testing.T) {
+	before := parseBenchmarks([]byte(`goos: linux
+pkg: sketch.dev/p
+BenchmarkFast-8   	 1000000	      100 ns/op	      0 B/op	       0 allocs/op
+BenchmarkFast-8   	 1000000	      101 ns/op	      0 B/op	       0 allocs/op
+BenchmarkFast-8   	 1000000	       99 ns/op	      0 B/op	       0 allocs/op
+BenchmarkFast-8   	 1000000	      100 ns/op	      0 B/op	       0 allocs/op
+BenchmarkNoisy-8  	 1000000	      100 ns/op
+BenchmarkNoisy-8  	 1000000	      200 ns/op
+BenchmarkNoisy-8  	 1000000	      100 ns/op
+BenchmarkNoisy-8  	 1000000	      200 ns/op
+PASS
+`))
+	after := parseBenchmarks([]byte(`pkg: sketch.dev/p
+BenchmarkFast-8   	 1000000	      150 ns/op	      8 B/op	       1 allocs/op
+BenchmarkFast-8   	 1000000	      151 ns/op	      8 B/op	       1 allocs/op
+BenchmarkFast-8   	 1000000	      149 ns/op	      8 B/op	       1 allocs/op
+BenchmarkFast-8   	 1000000	      152 ns/op	      8 B/op	       1 allocs/op
+BenchmarkNoisy-8  	 1000000	      200 ns/op
+BenchmarkNoisy-8  	 1000000	      100 ns/op
+BenchmarkNoisy-8  	 1000000	      210 ns/op
+BenchmarkNoisy-8  	 1000000	      100 ns/op
+BenchmarkNew-8    	 1000000	      500 ns/op
+PASS
+`))
+	regressions := compareBenchmarks(before, after)
+	r := &CodeReviewer{sketchBaseRef: "base"}
+	got := r.formatBenchmarkRegressions(regressions)
+	want := `Benchmark regressions detected between initial commit (base) and HEAD:
+
+1: sketch.dev/p.BenchmarkFast-8: ns/op went from 100 to 150.5 (+50.5%, p=0.029 n=4)
+2: sketch.dev/p.BenchmarkFast-8: B/op went from 0 to 8 (+Inf%, p=0.013 n=4)
+3: sketch.dev/p.BenchmarkFast-8: allocs/op went from 0 to 1 (+Inf%, p=0.013 n=4)
+
+If the slowdown is expected, explain why to the user; otherwise, fix it.
+`
+	if got != want {
+		t.Errorf("formatBenchmarkRegressions() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCheckBenchmarks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs benchmarks")
+	}
+	dir := resolveRealPath(t.TempDir())
+	files := map[string]string{
+		"go.mod":              "module sketch.dev\n",
+		".sketch/review.yaml": "benchmarks: true\n",
+		"p.go":                "package p\n\nfunc Work() {}\n",
+		"p_test.go":           "package p\n\nimport \"testing\"\n\nfunc TestWork(t *testing.T) { Work() }\n\nfunc BenchmarkWork(b *testing.B) {\n\tfor b.Loop() {\n\t\tWork()\n\t}\n}\n",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o700)
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600)
+	}
+	if err := initGitRepo(dir); err != nil {
+		t.Fatal(err)
+	}
+	initial, err := makeGitCommit(dir, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewer, err := NewCodeReviewer(context.Background(), dir, initial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "p.go"), []byte("package p\n\nimport \"time\"\n\nfunc Work() { time.Sleep(50 * time.Microsecond) }\n"), 0o600)
+	if _, err := makeGitCommit(dir, "Slow down Work", map[string]bool{"p.go": true}); err != nil {
+		t.Fatal(err)
+	}
+	out := reviewer.Run(context.Background(), nil)
+	if out.Error != nil {
+		t.Fatal(out.Error)
+	}
+	if got := out.LLMContent[0].Text; !strings.Contains(got, "1: sketch.dev.BenchmarkWork") || !strings.Contains(got, "ns/op went from") {
+		t.Errorf("review doesn't report the benchmark regression:\n%s", got)
+	}
+}
+
+func TestCheckBenchmarksMissingDirs(t *testing.T) {
+	dir := resolveRealPath(t.TempDir())
+	marker := filepath.Join(t.TempDir(), "ran")
+	t.Setenv("BENCH_MARKER", marker)
+	files := map[string]string{
+		"go.mod":    "module sketch.dev\n",
+		"p.go":      "package p\n",
+		"p_test.go": "package p\n\nimport (\n\t\"os\"\n\t\"testing\"\n)\n\nfunc BenchmarkRoot(b *testing.B) { os.WriteFile(os.Getenv(\"BENCH_MARKER\"), nil, 0o600) }\n",
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600)
+	}
+	if err := initGitRepo(dir); err != nil {
+		t.Fatal(err)
+	}
+	initial, err := makeGitCommit(dir, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewer, err := NewCodeReviewer(context.Background(), dir, initial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The changed package is gone, e.g. deleted, so there's nothing to benchmark.
+	regressions, err := reviewer.checkBenchmarks(context.Background(), []string{"gone"})
+	if err != nil || len(regressions) != 0 {
+		t.Errorf("checkBenchmarks() = %v, %v; want nothing", regressions, err)
+	}
+	if fileExists(marker) {
+		t.Errorf("checkBenchmarks() benchmarked the root package")
+	}
+}
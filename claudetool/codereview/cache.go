@@ -0,0 +1,170 @@
+package codereview
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// This file caches baselines, the results of checks on the initial commit, on disk,
+// so that sessions reviewing changes to the same commit reuse them instead of running the checks again.
+//
+// Entries are keyed by the initial commit's SHA, the version of the tool that produced them, and the check's arguments.
+// Only deterministic checks are cached: benchmarks, which depend on the machine's load, are not,
+// nor are checks whose tool versions we don't know, such as the repo's own review steps.
+
+const (
+	cacheFormat = "1"                 // bump when the format of cached values changes
+	cacheMaxAge = 30 * 24 * time.Hour // entries not used for this long are removed
+)
+
+// DefaultCacheDir returns the default directory for the baseline cache:
+// $SKETCH_CODEREVIEW_CACHE if set, and otherwise sketch/codereview in the user's cache directory.
+func DefaultCacheDir() string {
+	if dir := os.Getenv("SKETCH_CODEREVIEW_CACHE"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "sketch", "codereview")
+}
+
+// SetCacheDir makes the reviewer keep baselines in dir, which may be shared by concurrent sessions.
+// An empty dir, the default, disables the cache.
+func (r *CodeReviewer) SetCacheDir(dir string) {
+	r.cacheDir = dir
+	if dir != "" {
+		go pruneCache(dir)
+	}
+}
+
+// baselineKey returns the cache key for a baseline of the initial commit produced by tool with the given arguments.
+// tool is a command that prints the tool's version, e.g. ["gopls", "version"].
+// It returns the empty string if the cache is disabled or the key can't be computed.
+func (r *CodeReviewer) baselineKey(ctx context.Context, tool []string, args ...string) string {
+	if r.cacheDir == "" {
+		return ""
+	}
+	commit, err := r.ResolveCommit(ctx, r.sketchBaseRef)
+	if err != nil {
+		return ""
+	}
+	version := r.toolVersion(ctx, tool)
+	if version == "" {
+		return ""
+	}
+	h := sha256.New()
+	for _, part := range append([]string{cacheFormat, commit, version}, args...) {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// goVersion is the command whose output identifies the Go toolchain and the configuration that affects builds.
+var goVersion = []string{"go", "env", "GOVERSION", "GOOS", "GOARCH", "GOFLAGS", "GOEXPERIMENT", "CGO_ENABLED"}
+
+// toolVersion returns the output of the version command tool, or the empty string if it fails.
+// Versions are computed once per reviewer.
+func (r *CodeReviewer) toolVersion(ctx context.Context, tool []string) string {
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
+	id := strings.Join(tool, " ")
+	if v, ok := r.toolVersions[id]; ok {
+		return v
+	}
+	out, err := checkCommand(ctx, r.repoRoot, tool[0], tool[1:]...).Output()
+	v := strings.TrimSpace(string(out))
+	if err != nil {
+		slog.DebugContext(ctx, "CodeReviewer.toolVersion: failed to get version", "tool", id, "err", err)
+		v = ""
+	}
+	if r.toolVersions == nil {
+		r.toolVersions = make(map[string]string)
+	}
+	r.toolVersions[id] = v
+	return v
+}
+
+// cachePath returns the file that holds the cache entry for key.
+func (r *CodeReviewer) cachePath(key string) string {
+	return filepath.Join(r.cacheDir, key[:2], key+".json")
+}
+
+// loadBaseline reads the baseline for key into v, reporting whether it was found.
+func (r *CodeReviewer) loadBaseline(ctx context.Context, key string, v any) bool {
+	if key == "" {
+		return false
+	}
+	path := r.cachePath(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		slog.WarnContext(ctx, "CodeReviewer.loadBaseline: bad cache entry", "path", path, "err", err)
+		return false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now) // keep it from being pruned
+	slog.DebugContext(ctx, "CodeReviewer.loadBaseline: using cached baseline", "path", path)
+	return true
+}
+
+// storeBaseline writes v as the baseline for key. It is best-effort only.
+func (r *CodeReviewer) storeBaseline(ctx context.Context, key string, v any) {
+	if key == "" || ctx.Err() != nil {
+		return // a canceled check's results may be incomplete
+	}
+	path := r.cachePath(key)
+	data, err := json.Marshal(v)
+	if err == nil {
+		err = writeFileAtomic(path, data)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "CodeReviewer.storeBaseline: failed to write cache entry", "path", path, "err", err)
+	}
+}
+
+// writeFileAtomic writes data to path, so that concurrent readers see either all of it or none of it.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // fails harmlessly after the rename
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// pruneCache removes the entries in dir that haven't been used for cacheMaxAge.
+func pruneCache(dir string) {
+	cutoff := time.Now().Add(-cacheMaxAge)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
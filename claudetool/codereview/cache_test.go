@@ -0,0 +1,62 @@
+package codereview
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBaselineCache(t *testing.T) {
+	dir := resolveRealPath(t.TempDir())
+	files := map[string]string{
+		"go.mod":    "module sketch.dev\n",
+		"p.go":      "package p\n\nfunc Two() int { return 2 }\n",
+		"p_test.go": "package p\n\nimport \"testing\"\n\nfunc TestTwo(t *testing.T) {\n\tif Two() != 2 {\n\t\tt.Fatal(\"not two\")\n\t}\n}\n",
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600)
+	}
+	if err := initGitRepo(dir); err != nil {
+		t.Fatal(err)
+	}
+	initial, err := makeGitCommit(dir, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "p.go"), []byte("package p\n\nfunc Two() int { return 3 }\n"), 0o600)
+	if _, err := makeGitCommit(dir, "Break Two", map[string]bool{"p.go": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	cacheDir := t.TempDir()
+	review := func() *CodeReviewer {
+		t.Helper()
+		reviewer, err := NewCodeReviewer(context.Background(), dir, initial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reviewer.SetCacheDir(cacheDir)
+		out := reviewer.Run(context.Background(), nil)
+		if out.Error != nil {
+			t.Fatal(out.Error)
+		}
+		if got := out.LLMContent[0].Text; !strings.Contains(got, "sketch.dev.TestTwo: Was passing, now failing") {
+			t.Errorf("review doesn't report the test regression:\n%s", got)
+		}
+		return reviewer
+	}
+
+	if first := review(); first.initialWorktree == "" {
+		t.Fatal("first review didn't check out the initial commit")
+	}
+	entries, _ := filepath.Glob(filepath.Join(cacheDir, "*", "*.json"))
+	if len(entries) == 0 {
+		t.Fatal("first review didn't cache any baselines")
+	}
+	// A later session uses the cached baselines, without checking out the initial commit.
+	if second := review(); second.initialWorktree != "" {
+		t.Errorf("second review checked out the initial commit, despite cached baselines")
+	}
+}
@@ -0,0 +1,329 @@
+package codereview
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// A checker runs the code review steps for one language.
+type checker interface {
+	// name identifies the checker in the review config.
+	name() string
+	// formatters returns the formatters for file, from strictest to least strict,
+	// or nil if the checker doesn't handle file.
+	formatters(r *CodeReviewer, file string) []formatter
+	// review runs differential checks for the changed files (absolute paths),
+	// comparing HEAD to the initial commit.
+	// It returns info for the agent to consider, and errors for it to fix.
+	// A returned error aborts the code review; checkers should prefer
+	// to log and skip steps whose tools are missing or misbehave.
+	review(ctx context.Context, r *CodeReviewer, changedFiles []string) (info, errs []string, err error)
+}
+
+// defaultCheckers are the checkers used by a new CodeReviewer.
+var defaultCheckers = []checker{
+	goChecker{},
+	pythonChecker{},
+	typeScriptChecker{},
+	rustChecker{},
+}
+
+// isCheckerName reports whether name is the name of a built-in checker.
+func isCheckerName(name string) bool {
+	return slices.ContainsFunc(defaultCheckers, func(c checker) bool { return c.name() == name })
+}
+
+// A formatter rewrites the source code it reads from stdin, writing the result to stdout.
+type formatter struct {
+	name string   // command to run
+	args []string // "{file}" is replaced with the path of the file being formatted
+	dir  string   // working directory; the repo root if empty
+}
+
+// command returns the command that runs f on the content of file.
+func (f *formatter) command(ctx context.Context, root, file string, content []byte) *exec.Cmd {
+	args := make([]string, len(f.args))
+	for i, arg := range f.args {
+		args[i] = strings.ReplaceAll(arg, "{file}", file)
+	}
+	cmd := exec.CommandContext(ctx, f.name, args...)
+	cmd.Dir = cmp.Or(f.dir, root)
+	cmd.Stdin = bytes.NewReader(content)
+	return cmd
+}
+
+// formatters returns the formatters for file from the first checker that handles it.
+func (r *CodeReviewer) formatters(file string) []formatter {
+	for _, c := range r.checkers {
+		if fs := c.formatters(r, file); len(fs) > 0 {
+			return fs
+		}
+	}
+	return nil
+}
+
+// filesWithExt returns the files that have one of exts and still exist.
+func filesWithExt(files []string, exts ...string) []string {
+	var matched []string
+	for _, file := range files {
+		if !slices.Contains(exts, filepath.Ext(file)) {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			continue // deleted
+		}
+		matched = append(matched, file)
+	}
+	return matched
+}
+
+// projectDir returns the project that file belongs to: the nearest enclosing directory,
+// within the repo, that contains one of markers (e.g. package.json), or the empty string if there is none.
+func (r *CodeReviewer) projectDir(file string, markers ...string) string {
+	for dir := filepath.Dir(file); strings.HasPrefix(dir, r.repoRoot); dir = filepath.Dir(dir) {
+		for _, m := range markers {
+			if _, err := os.Stat(filepath.Join(dir, m)); err == nil {
+				return dir
+			}
+		}
+		if dir == r.repoRoot {
+			break
+		}
+	}
+	return ""
+}
+
+// projectDirs groups files by projectDir, in order.
+// Files outside any project are grouped under fallback, unless it is empty.
+func (r *CodeReviewer) projectDirs(files []string, fallback string, markers ...string) iter.Seq2[string, []string] {
+	projects := make(map[string][]string)
+	for _, file := range files {
+		project := cmp.Or(r.projectDir(file, markers...), fallback)
+		if project != "" {
+			projects[project] = append(projects[project], file)
+		}
+	}
+	return func(yield func(string, []string) bool) {
+		for _, project := range slices.Sorted(maps.Keys(projects)) {
+			if !yield(project, projects[project]) {
+				return
+			}
+		}
+	}
+}
+
+// findTool returns the path of the executable name to use for project:
+// the project's own copy, from node_modules (here or in an enclosing directory) or a virtualenv,
+// or else the one in $PATH. It returns the empty string if there is none.
+func (r *CodeReviewer) findTool(project, name string) string {
+	var dirs []string
+	for dir := project; strings.HasPrefix(dir, r.repoRoot); dir = filepath.Dir(dir) {
+		dirs = append(dirs, filepath.Join(dir, "node_modules", ".bin"))
+		if dir == r.repoRoot {
+			break
+		}
+	}
+	dirs = append(dirs, filepath.Join(project, ".venv", "bin"), filepath.Join(r.repoRoot, ".venv", "bin"))
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() && fi.Mode()&0o111 != 0 {
+			return path
+		}
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// existingFiles returns the files, relative to project, that exist in dir.
+func existingFiles(project, dir string, files []string) []string {
+	var existing []string
+	for _, file := range files {
+		rel := relOr(project, file)
+		if _, err := os.Stat(filepath.Join(dir, rel)); err == nil {
+			existing = append(existing, rel)
+		}
+	}
+	return existing
+}
+
+// beforeDir returns the directory in the initial commit's worktree that corresponds to dir,
+// creating the worktree if needed. It returns the empty string if dir didn't exist then.
+func (r *CodeReviewer) beforeDir(ctx context.Context, dir string) (string, error) {
+	if err := r.initializeInitialCommitWorktree(ctx); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(r.repoRoot, dir)
+	if err != nil {
+		return "", err
+	}
+	before := filepath.Join(r.initialWorktree, rel)
+	if _, err := os.Stat(before); err != nil {
+		return "", nil
+	}
+	return before, nil
+}
+
+// checkCommand returns a command that runs a check in dir,
+// with an environment that keeps it from leaving files behind in the repo.
+func checkCommand(ctx context.Context, dir, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "SKETCH_IGNORE_PORTS=1", "PYTHONDONTWRITEBYTECODE=1", "NO_COLOR=1", "CI=1")
+	return cmd
+}
+
+// Issue formats describe the output of linters, one issue per line.
+// They have named groups file, line, col and msg.
+var (
+	// colonIssueFormat matches the common file:line:col: message format.
+	colonIssueFormat = regexp.MustCompile(`^(?P<file>[^\s:][^:]*):(?P<line>\d+):(?P<col>\d+):\s*(?P<msg>.+)$`)
+	// tscIssueFormat matches tsc's file(line,col): error TS1234: message format.
+	tscIssueFormat = regexp.MustCompile(`^(?P<file>[^\s(][^(]*)\((?P<line>\d+),(?P<col>\d+)\):\s*(?:error|warning)\s+(?P<msg>TS\d+:.+)$`)
+	// rustcIssueFormat matches rustc's short message format.
+	rustcIssueFormat = regexp.MustCompile(`^(?P<file>[^\s:][^:]*):(?P<line>\d+):(?P<col>\d+):\s*(?:error|warning)(?:\[[^\]]+\])?:\s*(?P<msg>.+)$`)
+)
+
+// parseIssues parses linter output into issues.
+// File names in the output are relative to dir; positions in the issues are relative to root.
+func parseIssues(root, dir string, output []byte, re *regexp.Regexp) []Issue {
+	var issues []Issue
+	for line := range strings.Lines(string(output)) {
+		m := re.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		file := m[re.SubexpIndex("file")]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		if rel, err := filepath.Rel(root, file); err == nil {
+			file = rel
+		}
+		msg := m[re.SubexpIndex("msg")]
+		if shouldIgnoreDiagnostic(msg) {
+			continue
+		}
+		issues = append(issues, Issue{
+			Position: fmt.Sprintf("%s:%s:%s", file, m[re.SubexpIndex("line")], m[re.SubexpIndex("col")]),
+			Message:  msg,
+		})
+	}
+	return issues
+}
+
+// lintRegressions runs lint in project and in its counterpart in the initial commit,
+// and returns the issues that are new. lint is given the repo root (or initial worktree) and the project directory,
+// and reports issues with positions relative to the root.
+// A nil error from lint with no issues means the project is clean; a non-nil error skips the check.
+func (r *CodeReviewer) lintRegressions(ctx context.Context, project string, lint func(ctx context.Context, root, dir string) ([]Issue, error)) ([]Issue, error) {
+	return r.cachedLintRegressions(ctx, "", project, lint)
+}
+
+// cachedLintRegressions is like lintRegressions, but caches the initial commit's issues under key, from baselineKey.
+func (r *CodeReviewer) cachedLintRegressions(ctx context.Context, key, project string, lint func(ctx context.Context, root, dir string) ([]Issue, error)) ([]Issue, error) {
+	after, err := lint(ctx, r.repoRoot, project)
+	if err != nil || len(after) == 0 {
+		return nil, err
+	}
+	var before []Issue
+	if r.loadBaseline(ctx, key, &before) {
+		return findIssueRegressions(before, after), nil
+	}
+	beforeProject, err := r.beforeDir(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	if beforeProject != "" {
+		before, err = lint(ctx, r.initialWorktree, beforeProject)
+		if err != nil {
+			// Be conservative: report everything, as checkGopls does.
+			slog.WarnContext(ctx, "CodeReviewer.lintRegressions: lint failed on initial commit", "project", project, "err", err)
+		}
+	}
+	if err == nil {
+		r.storeBaseline(ctx, key, before)
+	}
+	return findIssueRegressions(before, after), nil
+}
+
+// testRegressions runs tests in project and in its counterpart in the initial commit,
+// and reports regressions, formatted like Go test regressions.
+// run reports test results as go test -json events.
+func (r *CodeReviewer) testRegressions(ctx context.Context, tool, project string, run func(ctx context.Context, dir string) ([]testJSON, error)) (string, error) {
+	after, err := run(ctx, project)
+	if err != nil {
+		return "", err
+	}
+	var before []testJSON
+	beforeProject, err := r.beforeDir(ctx, project)
+	if err != nil {
+		return "", err
+	}
+	if beforeProject != "" {
+		if before, err = run(ctx, beforeProject); err != nil {
+			return "", err
+		}
+	}
+	regressions, err := r.compareTestResults(before, after)
+	if err != nil {
+		return "", err
+	}
+	return r.formatTestRegressions(tool, regressions), nil
+}
+
+// checkExitCode returns the exit code of a check command that returned err.
+// It returns an error if the command didn't run to completion.
+func checkExitCode(ctx context.Context, err error) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// linkNodeModules makes project's node_modules available in its counterpart in the initial commit,
+// which, being a fresh git worktree, has none.
+func linkNodeModules(project, beforeProject string) {
+	src := filepath.Join(project, "node_modules")
+	dst := filepath.Join(beforeProject, "node_modules")
+	if _, err := os.Stat(src); err != nil {
+		return
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return
+	}
+	os.Symlink(src, dst)
+}
+
+// fileExists reports whether path exists.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// relOr returns target relative to base, or target itself if that fails.
+func relOr(base, target string) string {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return target
+	}
+	return rel
+}
@@ -0,0 +1,131 @@
+package codereview
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestParseIssues(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		format *regexp.Regexp
+		want   []Issue
+	}{
+		{
+			name:   "ruff",
+			output: "pkg/mod.py:3:8: F401 [*] `os` imported but unused\nFound 1 error.\n",
+			format: colonIssueFormat,
+			want:   []Issue{{Position: "app/pkg/mod.py:3:8", Message: "F401 [*] `os` imported but unused"}},
+		},
+		{
+			name:   "tsc",
+			output: "src/index.ts(12,5): error TS2322: Type 'string' is not assignable to type 'number'.\n",
+			format: tscIssueFormat,
+			want:   []Issue{{Position: "app/src/index.ts:12:5", Message: "TS2322: Type 'string' is not assignable to type 'number'."}},
+		},
+		{
+			name:   "clippy",
+			output: "warning: `adder` (lib) generated 1 warning\nsrc/lib.rs:2:5: warning: unneeded `return` statement\n",
+			format: rustcIssueFormat,
+			want:   []Issue{{Position: "app/src/lib.rs:2:5", Message: "unneeded `return` statement"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseIssues("/repo", "/repo/app", []byte(tt.output), tt.format)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIssues() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPytestEvents(t *testing.T) {
+	report := `<?xml version="1.0" encoding="utf-8"?>
+<testsuites><testsuite name="pytest" errors="0" failures="1" skipped="1" tests="3">
+<testcase classname="tests.test_calc" name="test_add" file="tests/test_calc.py" line="3" time="0.001"/>
+<testcase classname="tests.test_calc.TestCalc" name="test_sub" file="tests/test_calc.py" line="8" time="0.001"><failure message="assert 1 == 2">assert 1 == 2</failure></testcase>
+<testcase classname="tests.test_calc" name="test_later" file="tests/test_calc.py" line="12" time="0.001"><skipped message="todo"/></testcase>
+</testsuite></testsuites>`
+	got := pytestEvents("py", 1, []byte(report), nil)
+	want := []testJSON{
+		{Package: "py/tests/test_calc.py", Test: "py/tests/test_calc.py::test_add", Action: "pass"},
+		{Package: "py/tests/test_calc.py", Test: "py/tests/test_calc.py::TestCalc::test_sub", Action: "fail", Output: "assert 1 == 2"},
+		{Package: "py/tests/test_calc.py", Test: "py/tests/test_calc.py::test_later", Action: "skip"},
+		{Package: "py (pytest)", Action: "fail"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pytestEvents() = %+v\nwant %+v", got, want)
+	}
+
+	collectionError := `<testsuites><testsuite><testcase classname="" name="tests.test_calc"><error message="collection failure">SyntaxError</error></testcase></testsuite></testsuites>`
+	got = pytestEvents(".", 2, []byte(collectionError), []byte("ERROR collecting tests/test_calc.py"))
+	want = []testJSON{{Package: "pytest", Action: "fail", FailedBuild: "pytest", Output: "ERROR collecting tests/test_calc.py"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pytestEvents() with collection error = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestJavaScriptTestEvents(t *testing.T) {
+	report := `{
+  "success": false,
+  "testResults": [
+    {
+      "name": "/work/web/src/sum.test.ts",
+      "status": "failed",
+      "message": "",
+      "assertionResults": [
+        {"fullName": "sum adds", "status": "passed", "failureMessages": []},
+        {"fullName": "sum subtracts", "status": "failed", "failureMessages": ["expected 1 to be 2"]},
+        {"fullName": "sum later", "status": "todo", "failureMessages": []}
+      ]
+    },
+    {
+      "name": "/work/web/src/broken.test.ts",
+      "status": "failed",
+      "message": "SyntaxError: Unexpected token",
+      "assertionResults": []
+    }
+  ]
+}`
+	got := javaScriptTestEvents("vitest", "web", "/work/web", []byte(report), nil)
+	want := []testJSON{
+		{Package: "web/src/sum.test.ts", Test: "web/src/sum.test.ts > sum adds", Action: "pass"},
+		{Package: "web/src/sum.test.ts", Test: "web/src/sum.test.ts > sum subtracts", Action: "fail", Output: "expected 1 to be 2\n"},
+		{Package: "web/src/sum.test.ts", Test: "web/src/sum.test.ts > sum later", Action: "skip"},
+		{Package: "web/src/sum.test.ts", Action: "fail"},
+		{Package: "web/src/broken.test.ts", Action: "fail", FailedBuild: "web/src/broken.test.ts", Output: "SyntaxError: Unexpected token"},
+		{Package: "web (vitest)", Action: "fail"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("javaScriptTestEvents() = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestCargoTestEvents(t *testing.T) {
+	output := `running 2 tests
+test tests::adds ... ok
+test tests::subtracts ... FAILED
+test tests::slow ... ignored
+
+failures:
+`
+	got := cargoTestEvents(".", "adder", 101, []byte(output))
+	want := []testJSON{
+		{Package: "adder", Test: "adder::tests::adds", Action: "pass"},
+		{Package: "adder", Test: "adder::tests::subtracts", Action: "fail"},
+		{Package: "adder", Test: "adder::tests::slow", Action: "skip"},
+		{Package: "adder", Action: "fail"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cargoTestEvents() = %+v\nwant %+v", got, want)
+	}
+
+	got = cargoTestEvents("crates/adder", "", 101, []byte("error[E0425]: cannot find value `b`"))
+	want = []testJSON{{Package: "crates/adder (cargo test)", Action: "fail", FailedBuild: "crates/adder (cargo test)", Output: "error[E0425]: cannot find value `b`"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cargoTestEvents() with build error = %+v\nwant %+v", got, want)
+	}
+}
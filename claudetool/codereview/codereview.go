@@ -13,8 +13,11 @@ import (
 	"sync"
 
 	"sketch.dev/claudetool"
+	"sketch.dev/skribe"
 )
 
+var tracer = skribe.Tracer("sketch.dev/claudetool/codereview")
+
 // A CodeReviewer manages quality checks.
 type CodeReviewer struct {
 	repoRoot        string
@@ -22,6 +25,27 @@ type CodeReviewer struct {
 	initialStatus   []fileStatus // git status of files at initial commit, absolute paths
 	reviewed        []string     // history of all commits which have been reviewed
 	initialWorktree string       // git worktree at initial commit, absolute path
+	checkers        []checker    // per-language formatters and checks
+	config          *reviewConfig
+	configErr       error // from loading config, reported by Run
+	// Review config steps with blocks_done
+	blockingCommit   string   // commit most recently reviewed by Run
+	blockingFailures []string // names of blocking steps with regressions in blockingCommit
+	// Semantic review
+	guidanceFiles  []string  // repo-relative paths of guidance files, from the codebase analysis
+	findings       []Finding // from the most recent semantic review, of findingsCommit
+	findingsCommit string
+	findingSeq     int       // for finding IDs
+	dismissed      []Finding // all findings dismissed by the agent, for the reviewer to skip
+	// Structured findings
+	recorded   []Finding  // by the review in progress
+	reportMu   sync.Mutex // protects report
+	report     Report     // of the most recent review
+	reportPath string     // where to write report, if set
+	// On-disk cache of baselines
+	cacheDir     string            // disabled if empty
+	cacheMu      sync.Mutex        // protects toolVersions
+	toolVersions map[string]string // version command -> output
 	// "Related files" caching
 	processedChangedFileSets map[string]bool // hash of sorted changedFiles -> processed
 	reportedRelatedFiles     map[string]bool // file path -> reported
@@ -60,6 +84,12 @@ func NewCodeReviewer(ctx context.Context, repoRoot, sketchBaseRef string) (*Code
 		return nil, err
 	}
 	r.initialStatus = status
+
+	r.config, r.configErr = loadConfig(r.repoRoot)
+	if r.configErr != nil {
+		slog.WarnContext(ctx, "NewCodeReviewer: invalid review config", "err", r.configErr)
+	}
+	r.checkers = r.config.checkers()
 	return r, nil
 }
 
@@ -67,6 +97,9 @@ func NewCodeReviewer(ctx context.Context, repoRoot, sketchBaseRef string) (*Code
 // It returns a list of all files that were formatted.
 // It is best-effort only.
 func (r *CodeReviewer) autoformat(ctx context.Context) []string {
+	ctx, span := tracer.Start(ctx, "codereview.autoformat")
+	defer span.End()
+
 	// Refuse to format if initial commit is not an ancestor of HEAD
 	err := r.requireHEADDescendantOfSketchBaseRef(ctx)
 	if err != nil {
@@ -94,11 +127,11 @@ func (r *CodeReviewer) autoformat(ctx context.Context) []string {
 
 	// General strategy: For all changed files,
 	// run the strictest formatter that passes on the original version.
-	// TODO: add non-Go formatters?
 	// TODO: at a minimum, for common file types, ensure trailing newlines and maybe trim trailing whitespace per line?
 	var fmtFiles []string
 	for _, file := range changedFiles {
-		if !strings.HasSuffix(file, ".go") {
+		formatters := r.formatters(file)
+		if len(formatters) == 0 {
 			continue
 		}
 		fileStatus, err := r.gitFileStatus(ctx, file)
@@ -114,7 +147,7 @@ func (r *CodeReviewer) autoformat(ctx context.Context) []string {
 			slog.WarnContext(ctx, "CodeReviewer.Autoformat unable to get file content at head", "file", file, "err", err)
 			continue
 		}
-		if claudetool.IsAutogeneratedGoFile(code) { // leave autogenerated files alone
+		if strings.HasSuffix(file, ".go") && claudetool.IsAutogeneratedGoFile(code) { // leave autogenerated files alone
 			continue
 		}
 		onDisk, err := os.ReadFile(file)
@@ -126,20 +159,20 @@ func (r *CodeReviewer) autoformat(ctx context.Context) []string {
 			slog.WarnContext(ctx, "CodeReviewer.Autoformat file modified since HEAD", "file", file, "err", err)
 			continue
 		}
-		var formatterToUse string
+		var formatterToUse *formatter
 		if fileStatus == "A" {
-			formatterToUse = "gofumpt" // newly added, so we can format how we please: use gofumpt
+			formatterToUse = &formatters[0] // newly added, so we can format how we please: use the strictest
 		} else {
 			prev, err := r.getFileContentAtCommit(ctx, file, parent)
 			if err != nil {
 				slog.WarnContext(ctx, "CodeReviewer.Autoformat unable to get file content at parent", "file", file, "err", err)
 				continue
 			}
-			formatterToUse = r.pickFormatter(ctx, prev) // pick the strictest formatter that passes on the original version
+			formatterToUse = r.pickFormatter(ctx, formatters, file, prev) // pick the strictest formatter that passes on the original version
 		}
 
 		// Apply the chosen formatter to the current file
-		newCode := r.runFormatter(ctx, formatterToUse, code)
+		newCode := r.runFormatter(ctx, formatterToUse, file, code)
 		if newCode == nil { // no changes made
 			continue
 		}
@@ -292,17 +325,14 @@ func (r *CodeReviewer) getFileContentAtCommit(ctx context.Context, file, commit
 	return out, nil
 }
 
-// runFormatter runs the specified formatter on a file and returns the results.
+// runFormatter runs the specified formatter on the content of file and returns the results.
 // A nil result indicates that the file is unchanged, or that an error occurred.
-func (r *CodeReviewer) runFormatter(ctx context.Context, formatter string, content []byte) []byte {
-	if formatter == "" {
+func (r *CodeReviewer) runFormatter(ctx context.Context, f *formatter, file string, content []byte) []byte {
+	if f == nil {
 		return nil // no formatter
 	}
 	// Run the formatter and capture the output
-	cmd := exec.CommandContext(ctx, formatter)
-	cmd.Dir = r.repoRoot
-	cmd.Stdin = bytes.NewReader(content)
-	out, err := cmd.CombinedOutput()
+	out, err := f.command(ctx, r.repoRoot, file, content).Output()
 	if err != nil {
 		// probably a parse error, err on the side of safety
 		return nil
@@ -313,37 +343,24 @@ func (r *CodeReviewer) runFormatter(ctx context.Context, formatter string, conte
 	return out
 }
 
-// formatterWouldChange reports whether a formatter would make changes to the content.
-// If the contents are invalid, it returns false.
-// It works by piping the content to the formatter with the -l flag.
-func (r *CodeReviewer) formatterWouldChange(ctx context.Context, formatter string, content []byte) bool {
-	cmd := exec.CommandContext(ctx, formatter, "-l")
-	cmd.Dir = r.repoRoot
-	cmd.Stdin = bytes.NewReader(content)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		// probably a parse error, err on the side of safety
-		return false
-	}
-
-	// If the output is empty, the file passes the formatter
-	// If the output contains "<standard input>", the file would be changed
-	return len(bytes.TrimSpace(out)) > 0
+// formatterPasses reports whether a formatter would leave the content of file unchanged.
+// If the contents are invalid, or the formatter fails to run, it returns false.
+func (r *CodeReviewer) formatterPasses(ctx context.Context, f *formatter, file string, content []byte) bool {
+	out, err := f.command(ctx, r.repoRoot, file, content).Output()
+	return err == nil && bytes.Equal(content, out)
 }
 
-// pickFormatter picks a formatter to use for code.
-// If something goes wrong, it recommends no formatter (empty string).
-func (r *CodeReviewer) pickFormatter(ctx context.Context, code []byte) string {
+// pickFormatter picks a formatter to use for file, given its original contents, code.
+// If something goes wrong, it recommends no formatter (nil).
+func (r *CodeReviewer) pickFormatter(ctx context.Context, formatters []formatter, file string, code []byte) *formatter {
 	// Test each formatter from strictest to least strict.
 	// Keep the first one that doesn't make changes.
-	formatters := []string{"gofumpt", "goimports", "gofmt"}
-	for _, formatter := range formatters {
-		if r.formatterWouldChange(ctx, formatter, code) {
-			continue
+	for i := range formatters {
+		if r.formatterPasses(ctx, &formatters[i], file, code) {
+			return &formatters[i]
 		}
-		return formatter
 	}
-	return "" // no safe formatter found
+	return nil // no safe formatter found
 }
 
 // changedFiles retrieves a list of all files changed between two commits
@@ -372,6 +389,9 @@ func (r *CodeReviewer) changedFiles(ctx context.Context, fromCommit, toCommit st
 // runGenerate runs go generate on all packages and returns a list of files changed.
 // Errors returned will be reported to the LLM.
 func (r *CodeReviewer) runGenerate(ctx context.Context, packages []string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "codereview.runGenerate")
+	defer span.End()
+
 	if len(packages) == 0 {
 		return nil, nil
 	}
@@ -424,6 +444,9 @@ func (r *CodeReviewer) isGoRepository() bool {
 // ModTidy runs go mod tidy if go module files have changed.
 // Returns a list of files changed by go mod tidy (empty if none).
 func (r *CodeReviewer) ModTidy(ctx context.Context) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "codereview.ModTidy")
+	defer span.End()
+
 	err := r.requireHEADDescendantOfSketchBaseRef(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("cannot run ModTidy: %w", err)
@@ -489,6 +512,9 @@ func (r *CodeReviewer) ModTidy(ctx context.Context) ([]string, error) {
 
 // RunMechanicalChecks runs all mechanical checks and returns a message describing any changes made.
 func (r *CodeReviewer) RunMechanicalChecks(ctx context.Context) string {
+	ctx, span := tracer.Start(ctx, "codereview.RunMechanicalChecks")
+	defer span.End()
+
 	var actions []string
 
 	changed := r.autoformat(ctx)
@@ -135,6 +135,14 @@ func processTestFiles(t *testing.T, archive *txtar.Archive, dir string, update b
 				}
 			}
 
+		case ".requires":
+			// Tools the test needs, beyond Go and git.
+			for _, tool := range strings.Fields(string(file.Data)) {
+				if _, err := exec.LookPath(tool); err != nil {
+					t.Skipf("%s not found", tool)
+				}
+			}
+
 		case ".run_test":
 			if reviewer == nil {
 				return fmt.Errorf("no code reviewer available, need initial commit first")
@@ -0,0 +1,314 @@
+package codereview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configPath is where a repo declares its own review steps, relative to the repo root.
+const configPath = ".sketch/review.yaml"
+
+// reviewConfig is the contents of configPath. For example:
+//
+//	timeout: 5m
+//	disable: [python]
+//	formatters:
+//	  - glob: "**/*.proto"
+//	    run: buf format {file}
+//	lint:
+//	  - name: buf lint
+//	    glob: "**/*.proto"
+//	    run: buf lint
+//	tests:
+//	  - name: integration tests
+//	    run: ./scripts/integration.sh
+//	    timeout: 10m
+//	    blocks_done: true
+//	semantic_review: true
+//	benchmarks: true
+type reviewConfig struct {
+	// Timeout is the default timeout for the codereview tool, as a Go duration.
+	Timeout string `yaml:"timeout"`
+	// Disable lists built-in checkers to skip: go, python, typescript, rust.
+	Disable []string `yaml:"disable"`
+	// Formatters format files matching their globs, taking precedence over the built-in formatters.
+	// If several match a file, they are listed from strictest to least strict.
+	Formatters []configFormatter `yaml:"formatters"`
+	// Lint steps report issues; new issues are errors.
+	Lint []configStep `yaml:"lint"`
+	// Tests steps pass or fail; new failures are errors.
+	Tests []configStep `yaml:"tests"`
+	// SemanticReview asks an LLM to review the change, reporting findings that the agent must fix or dismiss.
+	SemanticReview bool `yaml:"semantic_review"`
+	// Benchmarks runs the Go benchmarks in changed packages, reporting significant slowdowns.
+	Benchmarks bool `yaml:"benchmarks"`
+}
+
+// configFormatter is a formatter declared in reviewConfig.
+type configFormatter struct {
+	Glob string `yaml:"glob"`
+	// Run is a shell command that reads the file's content on stdin and writes the formatted content to stdout.
+	// "{file}" is replaced with the file's path.
+	Run string `yaml:"run"`
+}
+
+// configStep is a lint or test step declared in reviewConfig.
+// Steps run in the repo and in the initial commit, and only regressions are reported.
+type configStep struct {
+	Name string `yaml:"name"`
+	// Run is a shell command, run in Dir.
+	Run string `yaml:"run"`
+	// Dir is the directory to run in, relative to the repo root. It defaults to the repo root.
+	Dir string `yaml:"dir"`
+	// Glob limits the step to changes that touch a matching file.
+	Glob string `yaml:"glob"`
+	// Timeout limits how long the step may run, as a Go duration.
+	Timeout string `yaml:"timeout"`
+	// Pattern, for lint steps, is a regexp that matches an issue in a line of output,
+	// with named groups file, line, col and msg. It defaults to file:line:col: msg.
+	// If the command fails and no line matches, its output is reported as a single issue.
+	Pattern string `yaml:"pattern"`
+	// Output, for test steps, is "exit-code" (the default), where the step passes if the command exits successfully,
+	// or "go-test-json", where the command writes go test -json events.
+	Output string `yaml:"output"`
+	// BlocksDone keeps the agent from finishing while the step has regressions.
+	BlocksDone bool `yaml:"blocks_done"`
+
+	timeout time.Duration
+	pattern *regexp.Regexp
+}
+
+// loadConfig reads the review config in repoRoot. It returns nil if there is none.
+func loadConfig(repoRoot string) (*reviewConfig, error) {
+	data, err := os.ReadFile(filepath.Join(repoRoot, configPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(reviewConfig)
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+	if cfg.Timeout != "" {
+		if _, err := time.ParseDuration(cfg.Timeout); err != nil {
+			return nil, fmt.Errorf("%s: invalid timeout: %w", configPath, err)
+		}
+	}
+	for _, name := range cfg.Disable {
+		if !isCheckerName(name) {
+			return nil, fmt.Errorf("%s: unknown checker %q in disable", configPath, name)
+		}
+	}
+	for i, f := range cfg.Formatters {
+		if f.Glob == "" || f.Run == "" {
+			return nil, fmt.Errorf("%s: formatter %d needs a glob and a run command", configPath, i+1)
+		}
+	}
+	for _, kind := range []struct {
+		name  string
+		steps []configStep
+	}{{"lint", cfg.Lint}, {"tests", cfg.Tests}} {
+		for i := range kind.steps {
+			s := &kind.steps[i]
+			if s.Run == "" {
+				return nil, fmt.Errorf("%s: %s step %d needs a run command", configPath, kind.name, i+1)
+			}
+			if s.Name == "" {
+				s.Name = s.Run
+			}
+			if s.Timeout != "" {
+				if s.timeout, err = time.ParseDuration(s.Timeout); err != nil {
+					return nil, fmt.Errorf("%s: %s step %q: invalid timeout: %w", configPath, kind.name, s.Name, err)
+				}
+			}
+			s.pattern = colonIssueFormat
+			if s.Pattern != "" {
+				if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+					return nil, fmt.Errorf("%s: %s step %q: invalid pattern: %w", configPath, kind.name, s.Name, err)
+				}
+				for _, group := range []string{"file", "line", "col", "msg"} {
+					if s.pattern.SubexpIndex(group) < 0 {
+						return nil, fmt.Errorf("%s: %s step %q: pattern has no %q group", configPath, kind.name, s.Name, group)
+					}
+				}
+			}
+			switch s.Output {
+			case "", "exit-code", "go-test-json":
+			default:
+				return nil, fmt.Errorf("%s: %s step %q: unknown output %q", configPath, kind.name, s.Name, s.Output)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// checkers returns the checkers to use with cfg: its own, followed by the built-in checkers it doesn't disable.
+func (cfg *reviewConfig) checkers() []checker {
+	if cfg == nil {
+		return defaultCheckers
+	}
+	checkers := []checker{configChecker{cfg}}
+	for _, c := range defaultCheckers {
+		if !slices.Contains(cfg.Disable, c.name()) {
+			checkers = append(checkers, c)
+		}
+	}
+	return checkers
+}
+
+// configChecker runs the steps declared in a repo's review config.
+type configChecker struct {
+	cfg *reviewConfig
+}
+
+func (configChecker) name() string { return "config" }
+
+func (c configChecker) formatters(r *CodeReviewer, file string) []formatter {
+	var fs []formatter
+	for _, f := range c.cfg.Formatters {
+		if matchGlob(f.Glob, relOr(r.repoRoot, file)) {
+			// Pass the file as an argument, so that it is quoted correctly.
+			run := strings.ReplaceAll(f.Run, "{file}", `"$1"`)
+			fs = append(fs, formatter{name: "sh", args: []string{"-c", run, "sh", "{file}"}})
+		}
+	}
+	return fs
+}
+
+func (c configChecker) review(ctx context.Context, r *CodeReviewer, changedFiles []string) (info, errs []string, err error) {
+	for _, step := range c.cfg.Lint {
+		if !step.touched(r, changedFiles) {
+			continue
+		}
+		issues, err := r.lintRegressions(ctx, filepath.Join(r.repoRoot, step.Dir), func(ctx context.Context, root, dir string) ([]Issue, error) {
+			out, exitCode, err := step.run(ctx, dir)
+			if err != nil {
+				return nil, err
+			}
+			issues := parseIssues(root, dir, out, step.pattern)
+			if len(issues) == 0 && exitCode != 0 {
+				issues = []Issue{{Message: fmt.Sprintf("failed with exit code %d:\n%s", exitCode, strings.TrimSpace(string(out)))}}
+			}
+			return issues, nil
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "CodeReviewer.Run: lint step failed", "step", step.Name, "err", err)
+		}
+		if msg := r.formatIssueRegressions(step.Name, issues); msg != "" {
+			errs = append(errs, msg)
+			if step.BlocksDone {
+				r.blockingFailures = append(r.blockingFailures, step.Name)
+			}
+		}
+	}
+
+	for _, step := range c.cfg.Tests {
+		if !step.touched(r, changedFiles) {
+			continue
+		}
+		msg, err := r.testRegressions(ctx, step.Name, filepath.Join(r.repoRoot, step.Dir), func(ctx context.Context, dir string) ([]testJSON, error) {
+			out, exitCode, err := step.run(ctx, dir)
+			if err != nil {
+				return nil, err
+			}
+			if step.Output == "go-test-json" {
+				return parseTestResults(out)
+			}
+			action := "pass"
+			if exitCode != 0 {
+				action = "fail"
+			}
+			// Report the step as a test, since only test-level failures count as regressions.
+			return []testJSON{{Package: step.Name, Test: step.Name, Action: action, Output: string(out)}}, nil
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "CodeReviewer.Run: test step failed", "step", step.Name, "err", err)
+		}
+		if msg != "" {
+			errs = append(errs, msg)
+			if step.BlocksDone {
+				r.blockingFailures = append(r.blockingFailures, step.Name)
+			}
+		}
+	}
+	return info, errs, nil
+}
+
+// touched reports whether the changed files are relevant to s.
+func (s *configStep) touched(r *CodeReviewer, changedFiles []string) bool {
+	if s.Glob == "" {
+		return true
+	}
+	for _, file := range changedFiles {
+		if matchGlob(s.Glob, relOr(r.repoRoot, file)) {
+			return true
+		}
+	}
+	return false
+}
+
+// run runs s in dir and returns its output (stdout only, for go-test-json) and exit code.
+func (s *configStep) run(ctx context.Context, dir string) ([]byte, int, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	cmd := checkCommand(ctx, dir, "sh", "-c", s.Run)
+	var out []byte
+	var err error
+	if s.Output == "go-test-json" {
+		out, err = cmd.Output()
+	} else {
+		out, err = cmd.CombinedOutput()
+	}
+	exitCode, err := checkExitCode(ctx, err)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	return out, exitCode, nil
+}
+
+// matchGlob reports whether name, a slash-separated path relative to the repo root, matches pattern.
+// A pattern without a slash matches the base name; "**" matches any number of directories.
+func matchGlob(pattern, name string) bool {
+	name = filepath.ToSlash(name)
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	ok, _ := regexp.MatchString(re.String(), name)
+	return ok
+}
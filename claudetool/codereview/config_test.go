@@ -0,0 +1,119 @@
+package codereview
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.proto", "api/v1/service.proto", true},
+		{"*.proto", "api/v1/service.go", false},
+		{"**/*.sql", "db/migrations/001.sql", true},
+		{"**/*.sql", "001.sql", true},
+		{"db/*.sql", "db/migrations/001.sql", false},
+		{"db/**", "db/migrations/001.sql", true},
+		{"api/v?/*.proto", "api/v1/service.proto", true},
+		{"api/v?/*.proto", "api/v10/service.proto", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name, config, wantErr string
+	}{
+		{"valid", "timeout: 5m\ndisable: [python]\nlint:\n  - run: buf lint\n    pattern: '(?P<file>[^:]+):(?P<line>\\d+):(?P<col>\\d+):(?P<msg>.*)'\n", ""},
+		{"unknown checker", "disable: [cobol]\n", `unknown checker "cobol"`},
+		{"missing run", "tests:\n  - name: unit\n", "tests step 1 needs a run command"},
+		{"bad timeout", "tests:\n  - run: make test\n    timeout: soon\n", "invalid timeout"},
+		{"bad pattern", "lint:\n  - run: buf lint\n    pattern: '(?P<file>.*)'\n", `pattern has no "line" group`},
+		{"bad output", "tests:\n  - run: make test\n    output: tap\n", `unknown output "tap"`},
+		{"formatter without glob", "formatters:\n  - run: buf format\n", "needs a glob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.MkdirAll(filepath.Join(dir, ".sketch"), 0o700)
+			if err := os.WriteFile(filepath.Join(dir, configPath), []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := loadConfig(dir)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cfg.Lint[0].Name != "buf lint" {
+					t.Errorf("lint step name = %q, want the run command", cfg.Lint[0].Name)
+				}
+				if names := checkerNames(cfg.checkers()); !slices.Equal(names, []string{"config", "go", "typescript", "rust"}) {
+					t.Errorf("checkers = %v", names)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	cfg, err := loadConfig(t.TempDir())
+	if cfg != nil || err != nil {
+		t.Errorf("loadConfig() without a config = %v, %v", cfg, err)
+	}
+}
+
+func checkerNames(checkers []checker) []string {
+	var names []string
+	for _, c := range checkers {
+		names = append(names, c.name())
+	}
+	return names
+}
+
+func TestConfigBlocksDone(t *testing.T) {
+	dir := resolveRealPath(t.TempDir())
+	config := "tests:\n  - name: blocker\n    run: test ! -e broken\n    blocks_done: true\n  - name: advisory\n    run: test ! -e broken\n"
+	os.MkdirAll(filepath.Join(dir, ".sketch"), 0o700)
+	if err := os.WriteFile(filepath.Join(dir, configPath), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := initGitRepo(dir); err != nil {
+		t.Fatal(err)
+	}
+	initial, err := makeGitCommit(dir, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewer, err := NewCodeReviewer(context.Background(), dir, initial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "broken"), nil, 0o600)
+	head, err := makeGitCommit(dir, "Break it", map[string]bool{"broken": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := reviewer.Run(context.Background(), nil)
+	if out.Error != nil {
+		t.Fatal(out.Error)
+	}
+	if got := reviewer.BlockingFailures(head); !slices.Equal(got, []string{"blocker"}) {
+		t.Errorf("BlockingFailures() = %v, want [blocker]\n%s", got, out.LLMContent[0].Text)
+	}
+	if got := reviewer.BlockingFailures(initial); got != nil {
+		t.Errorf("BlockingFailures(initial) = %v, want none", got)
+	}
+}
@@ -0,0 +1,259 @@
+package codereview
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/cover"
+	"golang.org/x/tools/go/packages"
+	"sketch.dev/claudetool"
+)
+
+// This file compares Go test coverage between the initial commit and HEAD,
+// using the coverage profiles written by checkTests.
+
+// coverageTool is the Tool of coverage findings.
+const coverageTool = "Go coverage"
+
+// A coverageRegression is a changed file with lines that no test covers,
+// or a package whose coverage dropped.
+type coverageRegression struct {
+	File          string // absolute path, for uncovered lines
+	Lines         []lineRange
+	Package       string  // import path, for a coverage drop
+	Before, After float64 // percentage of statements covered
+}
+
+// A lineRange is an inclusive range of line numbers.
+type lineRange struct{ start, end int }
+
+func (lr lineRange) String() string {
+	if lr.start == lr.end {
+		return strconv.Itoa(lr.start)
+	}
+	return fmt.Sprintf("%d-%d", lr.start, lr.end)
+}
+
+// checkCoverage compares the coverage profiles in beforeProfile and afterProfile,
+// and reports changed lines in pkgs that no test covers at HEAD, and packages whose coverage dropped.
+// Only packages that have tests are reported: code in a package without tests is expected to be uncovered.
+// Missing profiles, for example because the tests didn't build, are treated as empty.
+func (r *CodeReviewer) checkCoverage(ctx context.Context, pkgs map[string]*packages.Package, changedFiles []string, beforeProfile, afterProfile string) ([]coverageRegression, error) {
+	ctx, span := tracer.Start(ctx, "codereview.checkCoverage")
+	defer span.End()
+
+	before, err := readProfiles(beforeProfile)
+	if err != nil {
+		return nil, err
+	}
+	after, err := readProfiles(afterProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Profiles name files by import path; map them back to the files in the repo.
+	files := make(map[string]string) // absolute path -> profile file name
+	tested := make(map[string]bool)  // import paths of packages with tests
+	for _, pkg := range pkgs {
+		if !hasTests(pkg) {
+			continue
+		}
+		tested[pkg.PkgPath] = true
+		for _, f := range pkg.GoFiles {
+			files[f] = path.Join(pkg.PkgPath, filepath.Base(f))
+		}
+	}
+	var goFiles []string
+	for _, f := range changedFiles {
+		if _, ok := files[f]; ok && !strings.HasSuffix(f, "_test.go") {
+			goFiles = append(goFiles, f)
+		}
+	}
+	changed, err := r.changedLines(ctx, goFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var regressions []coverageRegression
+	for _, f := range slices.Sorted(maps.Keys(changed)) {
+		profile := after[files[f]]
+		if profile == nil {
+			continue // no tests were run, or they didn't build, which the tests report
+		}
+		if uncovered := uncoveredLines(profile, changed[f]); len(uncovered) > 0 {
+			regressions = append(regressions, coverageRegression{File: f, Lines: uncovered})
+		}
+	}
+
+	beforePct, afterPct := packageCoverage(before), packageCoverage(after)
+	for _, pkg := range slices.Sorted(maps.Keys(afterPct)) {
+		b, ok := beforePct[pkg]
+		a := afterPct[pkg]
+		// Ignore differences that don't show up in the report.
+		if ok && tested[pkg] && fmt.Sprintf("%.1f", a) != fmt.Sprintf("%.1f", b) && a < b {
+			regressions = append(regressions, coverageRegression{Package: pkg, Before: b, After: a})
+		}
+	}
+	return regressions, nil
+}
+
+// hasTests reports whether pkg has test files at HEAD.
+func hasTests(pkg *packages.Package) bool {
+	if len(pkg.GoFiles) == 0 {
+		return false
+	}
+	tests, _ := filepath.Glob(filepath.Join(filepath.Dir(pkg.GoFiles[0]), "*_test.go"))
+	return len(tests) > 0
+}
+
+// readProfiles reads the coverage profile at name, keyed by file name.
+// A missing or empty profile has no files.
+func readProfiles(name string) (map[string]*cover.Profile, error) {
+	if fi, err := os.Stat(name); err != nil || fi.Size() == 0 {
+		return nil, nil
+	}
+	profiles, err := cover.ParseProfiles(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse coverage profile: %w", err)
+	}
+	m := make(map[string]*cover.Profile)
+	for _, p := range profiles {
+		m[p.FileName] = p
+	}
+	return m, nil
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -\S+ \+(\d+)(?:,(\d+))? @@`)
+
+// changedLines returns the lines of files added or changed from the initial commit to HEAD,
+// leaving out autogenerated files.
+func (r *CodeReviewer) changedLines(ctx context.Context, files []string) (map[string][]int, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	args := append([]string{"diff", "--no-color", "--no-ext-diff", "-U0", r.sketchBaseRef, "HEAD", "--"}, files...)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = r.repoRoot
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changed lines: %w", err)
+	}
+	changed := make(map[string][]int)
+	var file string
+	for line := range strings.Lines(string(out)) {
+		if name, ok := strings.CutPrefix(line, "+++ "); ok {
+			file = ""
+			if name, ok := strings.CutPrefix(strings.TrimSpace(name), "b/"); ok {
+				file = r.absPath(name)
+			}
+			continue
+		}
+		m := hunkHeader.FindStringSubmatch(line)
+		if m == nil || file == "" {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		n := 1
+		if m[2] != "" {
+			n, _ = strconv.Atoi(m[2])
+		}
+		for l := start; l < start+n; l++ {
+			changed[file] = append(changed[file], l)
+		}
+	}
+	for f := range changed {
+		code, err := os.ReadFile(f)
+		if err != nil || claudetool.IsAutogeneratedGoFile(code) {
+			delete(changed, f)
+		}
+	}
+	return changed, nil
+}
+
+// uncoveredLines returns the ranges of lines that contain statements in profile, none of which are covered.
+func uncoveredLines(profile *cover.Profile, lines []int) []lineRange {
+	var ranges []lineRange
+	for _, l := range lines {
+		hasStmt, covered := false, false
+		for _, b := range profile.Blocks {
+			if b.NumStmt == 0 || l < b.StartLine || l > b.EndLine {
+				continue
+			}
+			hasStmt = true
+			covered = covered || b.Count > 0
+		}
+		if !hasStmt || covered {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].end == l-1 {
+			ranges[n-1].end = l
+		} else {
+			ranges = append(ranges, lineRange{l, l})
+		}
+	}
+	return ranges
+}
+
+// packageCoverage returns the percentage of statements covered in each package of profiles.
+func packageCoverage(profiles map[string]*cover.Profile) map[string]float64 {
+	total, covered := make(map[string]int), make(map[string]int)
+	for name, p := range profiles {
+		pkg := path.Dir(name)
+		for _, b := range p.Blocks {
+			total[pkg] += b.NumStmt
+			if b.Count > 0 {
+				covered[pkg] += b.NumStmt
+			}
+		}
+	}
+	pct := make(map[string]float64)
+	for pkg, n := range total {
+		if n > 0 {
+			pct[pkg] = 100 * float64(covered[pkg]) / float64(n)
+		}
+	}
+	return pct
+}
+
+// formatCoverageRegressions generates a human-readable summary of coverage regressions,
+// and records them as findings.
+func (r *CodeReviewer) formatCoverageRegressions(regressions []coverageRegression) string {
+	if len(regressions) == 0 {
+		return ""
+	}
+
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "Coverage regressions detected between initial commit (%s) and HEAD:\n\n", r.sketchBaseRef)
+
+	for i, reg := range regressions {
+		if reg.File != "" {
+			var lines []string
+			for _, lr := range reg.Lines {
+				lines = append(lines, lr.String())
+			}
+			fmt.Fprintf(buf, "%d: %s:%s: Changed lines are not covered by any test\n", i+1, reg.File, strings.Join(lines, ","))
+			for _, lr := range reg.Lines {
+				r.record(Finding{
+					Tool: coverageTool, Rule: "uncovered-lines", Severity: SeverityWarning,
+					File: filepath.ToSlash(relOr(r.repoRoot, reg.File)), Line: lr.start, EndLine: lr.end,
+					Message: "Changed lines are not covered by any test",
+				})
+			}
+			continue
+		}
+		msg := fmt.Sprintf("Coverage dropped from %.1f%% to %.1f%%", reg.Before, reg.After)
+		fmt.Fprintf(buf, "%d: %s: %s\n", i+1, reg.Package, msg)
+		r.record(Finding{Tool: coverageTool, Rule: "coverage-drop", Severity: SeverityWarning, Message: reg.Package + ": " + msg})
+	}
+
+	return buf.String()
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -23,6 +24,7 @@ import (
 
 	"golang.org/x/tools/go/packages"
 	"sketch.dev/llm"
+	"sketch.dev/llm/conversation"
 )
 
 // This file does differential quality analysis of a commit relative to a base commit.
@@ -40,6 +42,18 @@ func (r *CodeReviewer) Tool() *llm.Tool {
 					"type": "string",
 					"description": "Timeout as a Go duration string (default: 1m)",
 					"default": "1m"
+				},
+				"dismiss": {
+					"type": "array",
+					"description": "Semantic review findings to dismiss as wrong or not worth fixing",
+					"items": {
+						"type": "object",
+						"required": ["id", "reason"],
+						"properties": {
+							"id": {"type": "string", "description": "Finding ID, e.g. R1"},
+							"reason": {"type": "string", "description": "Why the finding doesn't need a fix"}
+						}
+					}
 				}
 			}
 		}`),
@@ -52,6 +66,10 @@ func (r *CodeReviewer) Run(ctx context.Context, m json.RawMessage) llm.ToolOut {
 	// Parse input to get timeout
 	var input struct {
 		Timeout string `json:"timeout"`
+		Dismiss []struct {
+			ID     string `json:"id"`
+			Reason string `json:"reason"`
+		} `json:"dismiss"`
 	}
 	if len(m) > 0 {
 		if err := json.Unmarshal(m, &input); err != nil {
@@ -60,6 +78,9 @@ func (r *CodeReviewer) Run(ctx context.Context, m json.RawMessage) llm.ToolOut {
 	}
 	if input.Timeout == "" {
 		input.Timeout = "1m" // default timeout
+		if r.config != nil && r.config.Timeout != "" {
+			input.Timeout = r.config.Timeout
+		}
 	}
 
 	// Parse timeout duration
@@ -94,9 +115,31 @@ func (r *CodeReviewer) Run(ctx context.Context, m json.RawMessage) llm.ToolOut {
 		return llm.ErrorToolOut(fmt.Errorf("no new commits have been added, nothing to review"))
 	}
 
+	if len(input.Dismiss) > 0 {
+		var errs []error
+		for _, d := range input.Dismiss {
+			errs = append(errs, r.dismissFinding(d.ID, d.Reason))
+		}
+		if err := errors.Join(errs...); err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		if rep := r.Report(); rep.Commit == currentCommit {
+			findings := slices.DeleteFunc(rep.Findings, func(f Finding) bool { return f.Tool == semanticReviewTool })
+			r.setReport(currentCommit, append(findings, r.semanticFindings(currentCommit)...))
+		}
+		if r.HasReviewed(currentCommit) {
+			// Nothing new to review.
+			if msg := r.formatFindings(r.OpenFindings(currentCommit)); msg != "" {
+				return llm.ToolOut{LLMContent: llm.TextContent("# Errors\n\n" + msg + "\n\nPlease fix before proceeding.\n")}
+			}
+			return llm.ToolOut{LLMContent: llm.TextContent("OK")}
+		}
+	}
+
 	// No matter what failures happen from here out, we will declare this to have been reviewed.
 	// This should help avoid the model getting blocked by a broken code review tool.
 	r.reviewed = append(r.reviewed, currentCommit)
+	r.recorded = nil
 
 	changedFiles, err := r.changedFiles(timeoutCtx, r.sketchBaseRef, currentCommit)
 	if err != nil {
@@ -104,41 +147,37 @@ func (r *CodeReviewer) Run(ctx context.Context, m json.RawMessage) llm.ToolOut {
 		return llm.ErrorToolOut(err)
 	}
 
-	// Prepare to analyze before/after for the impacted files.
-	// We use the current commit to determine what packages exist and are impacted.
-	// The packages in the initial commit may be different.
-	// Good enough for now.
-	// TODO: do better
-	allPkgs, err := r.packagesForFiles(timeoutCtx, changedFiles)
-	if err != nil {
-		// TODO: log and skip to stuff that doesn't require packages
-		slog.DebugContext(ctx, "CodeReviewer.Run: failed to get packages for files", "err", err)
-		return llm.ErrorToolOut(err)
-	}
-	allPkgList := slices.Collect(maps.Keys(allPkgs))
-
 	var errorMessages []string // problems we want the model to address
 	var infoMessages []string  // info the model should consider
 
-	// Run 'go generate' early, so that it can potentially fix tests that would otherwise fail.
-	generateChanges, err := r.runGenerate(timeoutCtx, allPkgList)
-	if err != nil {
-		errorMessages = append(errorMessages, err.Error())
-	}
-	if len(generateChanges) > 0 {
-		buf := new(strings.Builder)
-		buf.WriteString("The following files were changed by running `go generate`:\n\n")
-		for _, f := range generateChanges {
-			buf.WriteString(f)
-			buf.WriteString("\n")
+	if r.configErr != nil {
+		infoMessages = append(infoMessages, fmt.Sprintf("The repo's review config is invalid, so its steps were skipped: %v", r.configErr))
+	}
+
+	r.blockingCommit, r.blockingFailures = currentCommit, nil
+	for _, c := range r.checkers {
+		info, errs, err := c.review(timeoutCtx, r, changedFiles)
+		if err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		infoMessages = append(infoMessages, info...)
+		errorMessages = append(errorMessages, errs...)
+	}
+
+	if r.semanticReviewEnabled() {
+		if convo := conversation.ToolCallInfoFromContext(ctx).Convo; convo != nil {
+			findings, err := r.semanticReview(timeoutCtx, convo, currentCommit, changedFiles)
+			if err != nil {
+				slog.WarnContext(ctx, "CodeReviewer.Run: semantic review failed", "err", err)
+			}
+			if msg := r.formatFindings(findings); msg != "" {
+				errorMessages = append(errorMessages, msg)
+			}
 		}
-		buf.WriteString("\nPlease amend your latest git commit with these changes.\n")
-		infoMessages = append(infoMessages, buf.String())
 	}
 
 	// Find potentially related files that should also be considered
 	// TODO: add some caching here, since this depends only on the initial commit and the changed files, not the details of the changes
-	// TODO: arrange for this to run even in non-Go repos!
 	relatedFiles, err := r.findRelatedFiles(timeoutCtx, changedFiles)
 	if err != nil {
 		slog.DebugContext(ctx, "CodeReviewer.Run: failed to find related files", "err", err)
@@ -149,23 +188,7 @@ func (r *CodeReviewer) Run(ctx context.Context, m json.RawMessage) llm.ToolOut {
 		}
 	}
 
-	testMsg, err := r.checkTests(timeoutCtx, allPkgList)
-	if err != nil {
-		slog.DebugContext(ctx, "CodeReviewer.Run: failed to check tests", "err", err)
-		return llm.ErrorToolOut(err)
-	}
-	if testMsg != "" {
-		errorMessages = append(errorMessages, testMsg)
-	}
-
-	goplsMsg, err := r.checkGopls(timeoutCtx, changedFiles) // includes vet checks
-	if err != nil {
-		slog.DebugContext(ctx, "CodeReviewer.Run: failed to check gopls", "err", err)
-		return llm.ErrorToolOut(err)
-	}
-	if goplsMsg != "" {
-		errorMessages = append(errorMessages, goplsMsg)
-	}
+	r.setReport(currentCommit, slices.Concat(r.recorded, r.semanticFindings(currentCommit)))
 
 	// NOTE: If you change this output format, update the corresponding UI parsing in:
 	// webui/src/web-components/sketch-tool-card.ts (SketchToolCardCodeReview.getStatusIcon)
@@ -204,29 +227,30 @@ func (r *CodeReviewer) initializeInitialCommitWorktree(ctx context.Context) erro
 	return nil
 }
 
-func (r *CodeReviewer) checkTests(ctx context.Context, pkgList []string) (string, error) {
+// checkTests runs the tests in pkgList in the current and initial state, and reports test regressions.
+// It writes coverage profiles to before.cover and after.cover in coverDir, for checkCoverage.
+func (r *CodeReviewer) checkTests(ctx context.Context, pkgList []string, coverDir string) (string, error) {
+	ctx, span := tracer.Start(ctx, "codereview.checkTests")
+	defer span.End()
+
 	// 'gopls check' covers everything that 'go vet' covers.
 	// Disabling vet here speeds things up, and allows more precise filtering and reporting.
 	goTestArgs := []string{"test", "-json", "-v", "-vet=off"}
-	goTestArgs = append(goTestArgs, pkgList...)
+	afterArgs := append(slices.Clone(goTestArgs), "-coverprofile="+filepath.Join(coverDir, "after.cover"))
+	afterArgs = append(afterArgs, pkgList...)
 
-	afterTestCmd := exec.CommandContext(ctx, "go", goTestArgs...)
+	afterTestCmd := exec.CommandContext(ctx, "go", afterArgs...)
 	afterTestCmd.Dir = r.repoRoot
 	afterTestCmd.Env = append(os.Environ(), "SKETCH_IGNORE_PORTS=1")
 	afterTestOut, _ := afterTestCmd.Output()
 	// unfortunately, we can't short-circuit here even if all tests pass,
 	// because we need to check for skipped tests.
 
-	err := r.initializeInitialCommitWorktree(ctx)
+	beforeTestOut, err := r.testBaseline(ctx, goTestArgs, pkgList, filepath.Join(coverDir, "before.cover"))
 	if err != nil {
 		return "", err
 	}
 
-	beforeTestCmd := exec.CommandContext(ctx, "go", goTestArgs...)
-	beforeTestCmd.Dir = r.initialWorktree
-	beforeTestCmd.Env = append(os.Environ(), "SKETCH_IGNORE_PORTS=1")
-	beforeTestOut, _ := beforeTestCmd.Output() // ignore error, interesting info is in the output
-
 	// Parse the jsonl test results
 	beforeResults, beforeParseErr := parseTestResults(beforeTestOut)
 	if beforeParseErr != nil {
@@ -241,12 +265,43 @@ func (r *CodeReviewer) checkTests(ctx context.Context, pkgList []string) (string
 		return "", fmt.Errorf("failed to compare test results: %w", err)
 	}
 	// TODO: better output formatting?
-	res := r.formatTestRegressions(testRegressions)
+	res := r.formatTestRegressions("Go test", testRegressions)
 	return res, nil
 }
 
-// GoplsIssue represents a single issue reported by gopls check
-type GoplsIssue struct {
+// A testBaseline is the result of running the tests in the initial commit.
+type testBaseline struct {
+	Output []byte // go test -json output
+	Cover  []byte // coverage profile
+}
+
+// testBaseline runs go test with testArgs on pkgList in the initial commit, writing the coverage profile to coverProfile,
+// and returns its output. The results are cached across sessions.
+func (r *CodeReviewer) testBaseline(ctx context.Context, testArgs, pkgList []string, coverProfile string) ([]byte, error) {
+	key := r.baselineKey(ctx, goVersion, slices.Concat(testArgs, slices.Sorted(slices.Values(pkgList)))...)
+
+	var baseline testBaseline
+	if r.loadBaseline(ctx, key, &baseline) {
+		return baseline.Output, os.WriteFile(coverProfile, baseline.Cover, 0o644)
+	}
+
+	if err := r.initializeInitialCommitWorktree(ctx); err != nil {
+		return nil, err
+	}
+	args := slices.Concat(testArgs, []string{"-coverprofile=" + coverProfile}, pkgList)
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = r.initialWorktree
+	cmd.Env = append(os.Environ(), "SKETCH_IGNORE_PORTS=1")
+	baseline.Output, _ = cmd.Output() // ignore error, interesting info is in the output
+	baseline.Cover, _ = os.ReadFile(coverProfile)
+	if _, err := parseTestResults(baseline.Output); err == nil {
+		r.storeBaseline(ctx, key, baseline)
+	}
+	return baseline.Output, nil
+}
+
+// Issue represents a single issue reported by a linter, such as gopls check
+type Issue struct {
 	Position string // File position in format "file:line:col-range"
 	Message  string // Description of the issue
 }
@@ -261,10 +316,13 @@ var goplsIgnore = []string{
 }
 
 // checkGopls runs gopls check on the provided files in both the current and initial state,
-// compares the results, and reports any new issues introduced in the current state.
-func (r *CodeReviewer) checkGopls(ctx context.Context, changedFiles []string) (string, error) {
+// compares the results, and returns any new issues introduced in the current state.
+func (r *CodeReviewer) checkGopls(ctx context.Context, changedFiles []string) ([]Issue, error) {
+	ctx, span := tracer.Start(ctx, "codereview.checkGopls")
+	defer span.End()
+
 	if len(changedFiles) == 0 {
-		return "", nil // no files to check
+		return nil, nil // no files to check
 	}
 
 	// Filter out non-Go files as gopls only works on Go files
@@ -284,7 +342,7 @@ func (r *CodeReviewer) checkGopls(ctx context.Context, changedFiles []string) (s
 	}
 
 	if len(goFiles) == 0 {
-		return "", nil // no Go files to check
+		return nil, nil // no Go files to check
 	}
 
 	// Run gopls check on the current state
@@ -297,7 +355,7 @@ func (r *CodeReviewer) checkGopls(ctx context.Context, changedFiles []string) (s
 		// Check if the output looks like real gopls issues or if it's just error output
 		if !looksLikeGoplsIssues(afterGoplsOut) {
 			slog.WarnContext(ctx, "CodeReviewer.checkGopls: gopls check failed to run properly", "err", err, "output", string(afterGoplsOut))
-			return "", nil // Skip rather than failing the entire code review
+			return nil, nil // Skip rather than failing the entire code review
 		}
 	}
 
@@ -306,17 +364,12 @@ func (r *CodeReviewer) checkGopls(ctx context.Context, changedFiles []string) (s
 
 	// If no issues were found, we're done
 	if len(afterIssues) == 0 {
-		return "", nil
-	}
-
-	// Gopls detected issues in the current state, check if they existed in the initial state
-	initErr := r.initializeInitialCommitWorktree(ctx)
-	if initErr != nil {
-		return "", err
+		return nil, nil
 	}
 
+	// Gopls detected issues in the current state, check if they existed in the initial state.
 	// For each file that exists in the initial commit, run gopls check
-	var initialFilesToCheck []string
+	var initialFiles []string // relative to the repo root
 	for _, file := range goFiles {
 		// Get relative path for git operations
 		relFile, err := filepath.Rel(r.repoRoot, file)
@@ -329,43 +382,43 @@ func (r *CodeReviewer) checkGopls(ctx context.Context, changedFiles []string) (s
 		checkCmd := exec.CommandContext(ctx, "git", "cat-file", "-e", fmt.Sprintf("%s:%s", r.sketchBaseRef, relFile))
 		checkCmd.Dir = r.repoRoot
 		if err := checkCmd.Run(); err == nil {
-			// File exists in initial commit
-			initialFilePath := filepath.Join(r.initialWorktree, relFile)
-			initialFilesToCheck = append(initialFilesToCheck, initialFilePath)
+			initialFiles = append(initialFiles, relFile)
 		}
 	}
 
 	// Run gopls check on the files that existed in the initial commit
-	var beforeIssues []GoplsIssue
-	if len(initialFilesToCheck) > 0 {
-		beforeGoplsArgs := append([]string{"check"}, initialFilesToCheck...)
+	var beforeIssues []Issue
+	key := r.baselineKey(ctx, []string{"gopls", "version"}, append([]string{"gopls check"}, initialFiles...)...)
+	if len(initialFiles) > 0 && !r.loadBaseline(ctx, key, &beforeIssues) {
+		if err := r.initializeInitialCommitWorktree(ctx); err != nil {
+			return nil, err
+		}
+		beforeGoplsArgs := []string{"check"}
+		for _, relFile := range initialFiles {
+			beforeGoplsArgs = append(beforeGoplsArgs, filepath.Join(r.initialWorktree, relFile))
+		}
 		beforeGoplsCmd := exec.CommandContext(ctx, "gopls", beforeGoplsArgs...)
 		beforeGoplsCmd.Dir = r.initialWorktree
 		beforeGoplsOut, beforeCmdErr := beforeGoplsCmd.CombinedOutput()
 		if beforeCmdErr != nil && !looksLikeGoplsIssues(beforeGoplsOut) {
 			// If gopls fails to run properly on the initial commit, log a warning and continue
 			// with empty before issues - this will be conservative and report more issues
-			slog.WarnContext(ctx, "CodeReviewer.checkGopls: gopls check failed on initial commit", "err", err, "output", string(beforeGoplsOut))
+			slog.WarnContext(ctx, "CodeReviewer.checkGopls: gopls check failed on initial commit", "err", beforeCmdErr, "output", string(beforeGoplsOut))
 		} else {
 			beforeIssues = parseGoplsOutput(r.initialWorktree, beforeGoplsOut)
+			r.storeBaseline(ctx, key, beforeIssues)
 		}
 	}
 
 	// Find new issues that weren't present in the initial state
-	goplsRegressions := findGoplsRegressions(beforeIssues, afterIssues)
-	if len(goplsRegressions) == 0 {
-		return "", nil // no new issues
-	}
-
-	// Format the results
-	return r.formatGoplsRegressions(goplsRegressions), nil
+	return findIssueRegressions(beforeIssues, afterIssues), nil
 }
 
 // parseGoplsOutput parses the text output from gopls check.
 // It drops any that match the patterns in goplsIgnore.
 // Each line has the format: '/path/to/file.go:448:22-26: unused parameter: path'
-func parseGoplsOutput(root string, output []byte) []GoplsIssue {
-	var issues []GoplsIssue
+func parseGoplsOutput(root string, output []byte) []Issue {
+	var issues []Issue
 	for line := range strings.Lines(string(output)) {
 		line = strings.TrimSpace(line)
 		if line == "" {
@@ -418,7 +471,7 @@ func parseGoplsOutput(root string, output []byte) []GoplsIssue {
 			continue
 		}
 
-		issues = append(issues, GoplsIssue{
+		issues = append(issues, Issue{
 			Position: position,
 			Message:  message,
 		})
@@ -469,9 +522,9 @@ func normalizeGoplsPosition(position string) string {
 	return parts[0]
 }
 
-// findGoplsRegressions identifies gopls issues that are new in the after state
-func findGoplsRegressions(before, after []GoplsIssue) []GoplsIssue {
-	var regressions []GoplsIssue
+// findIssueRegressions identifies linter issues that are new in the after state
+func findIssueRegressions(before, after []Issue) []Issue {
+	var regressions []Issue
 
 	// Build map of before issues for easier lookup
 	beforeIssueMap := make(map[string]map[string]bool) // file -> message -> exists
@@ -518,28 +571,34 @@ func findGoplsRegressions(before, after []GoplsIssue) []GoplsIssue {
 	}
 
 	// Sort regressions for deterministic output
-	slices.SortFunc(regressions, func(a, b GoplsIssue) int {
+	slices.SortFunc(regressions, func(a, b Issue) int {
 		return strings.Compare(a.Position, b.Position)
 	})
 
 	return regressions
 }
 
-// formatGoplsRegressions generates a human-readable summary of gopls check regressions
-func (r *CodeReviewer) formatGoplsRegressions(regressions []GoplsIssue) string {
+// formatIssueRegressions generates a human-readable summary of regressions found by tool,
+// and records them as findings.
+func (r *CodeReviewer) formatIssueRegressions(tool string, regressions []Issue) string {
 	if len(regressions) == 0 {
 		return ""
 	}
+	r.record(issueFindings(tool, regressions)...)
 
 	var sb strings.Builder
-	sb.WriteString("Gopls check issues detected:\n\n")
+	sb.WriteString(tool + " issues detected:\n\n")
 
 	// Format each issue
 	for i, issue := range regressions {
+		if issue.Position == "" {
+			sb.WriteString(fmt.Sprintf("%d. %s\n", i+1, issue.Message))
+			continue
+		}
 		sb.WriteString(fmt.Sprintf("%d. %s: %s\n", i+1, filepath.Join(r.repoRoot, issue.Position), issue.Message))
 	}
 
-	sb.WriteString("\nIMPORTANT: Only fix new gopls check issues in parts of the code that you have already edited.")
+	sb.WriteString("\nIMPORTANT: Only fix new " + strings.ToLower(tool) + " issues in parts of the code that you have already edited.")
 	sb.WriteString(" Do not change existing code that was not part of your current edits.\n")
 	return sb.String()
 }
@@ -548,6 +607,15 @@ func (r *CodeReviewer) HasReviewed(commit string) bool {
 	return slices.Contains(r.reviewed, commit)
 }
 
+// BlockingFailures returns the names of the review steps that keep the agent from finishing:
+// steps that the repo's review config marks blocks_done, and that had regressions when commit was reviewed.
+func (r *CodeReviewer) BlockingFailures(commit string) []string {
+	if commit != r.blockingCommit {
+		return nil
+	}
+	return r.blockingFailures
+}
+
 func (r *CodeReviewer) IsInitialCommit(commit string) bool {
 	return commit == r.sketchBaseRef
 }
@@ -776,6 +844,10 @@ func (r *testRegression) Source() string {
 	if r.Test == "" {
 		return r.Package
 	}
+	// Test IDs from other languages' test runners already start with the package, a test file.
+	if strings.HasPrefix(r.Test, r.Package) {
+		return r.Test
+	}
 	return fmt.Sprintf("%s.%s", r.Package, r.Test)
 }
 
@@ -944,8 +1016,9 @@ func isRegression(before, after testStatus) bool {
 	return badnessLevels[after] > badnessLevels[before]
 }
 
-// formatTestRegressions generates a human-readable summary of test regressions
-func (r *CodeReviewer) formatTestRegressions(regressions []testRegression) string {
+// formatTestRegressions generates a human-readable summary of test regressions reported by tool,
+// and records them as findings.
+func (r *CodeReviewer) formatTestRegressions(tool string, regressions []testRegression) string {
 	if len(regressions) == 0 {
 		return ""
 	}
@@ -961,6 +1034,7 @@ func (r *CodeReviewer) formatTestRegressions(regressions []testRegression) strin
 			message = "Regression detected"
 		}
 		fmt.Fprintf(buf, "%s\n", message)
+		r.record(Finding{Tool: tool, Rule: "test-regression", Severity: SeverityError, Message: reg.Source() + ": " + message})
 	}
 
 	return buf.String()
@@ -993,6 +1067,9 @@ func (r *CodeReviewer) hashChangedFiles(changedFiles []string) string {
 // 2. If all related files have been previously reported, return nil, nil
 // 3. Otherwise, return the full set of related files and mark them as reported
 func (r *CodeReviewer) findRelatedFiles(ctx context.Context, changedFiles []string) ([]RelatedFile, error) {
+	ctx, span := tracer.Start(ctx, "codereview.findRelatedFiles")
+	defer span.End()
+
 	cf := r.hashChangedFiles(changedFiles)
 	if r.processedChangedFileSets[cf] {
 		return nil, nil
@@ -1249,7 +1326,7 @@ func (r *CodeReviewer) warmTestCache(ctx context.Context, modifiedFile string) e
 	}
 
 	// Avoid stressing the machine: max 2 concurrent processes.
-	args := []string{"test", "-c", "-p", "2", "-o", "/dev/null"}
+	args := []string{"test", "-c", "-cover", "-p", "2", "-o", "/dev/null"}
 	args = append(args, pkgPaths...)
 
 	cmd := exec.CommandContext(ctx, "go", args...)
@@ -0,0 +1,228 @@
+package codereview
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// This file is the structured form of what the review reports to the agent,
+// for export as JSON and SARIF.
+
+// Finding severities, which are also SARIF levels.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityNote    = "note"
+)
+
+// A Finding is an issue reported by the code review.
+type Finding struct {
+	// ID identifies semantic review findings, which the agent must fix or dismiss, e.g. "R3".
+	ID string `json:"id,omitempty"`
+	// Tool is the source of the finding, e.g. "Gopls check", "Go test" or "Semantic review".
+	Tool string `json:"tool"`
+	// Rule is the tool's name for the kind of issue, e.g. "SA1006" or "test-regression".
+	Rule     string `json:"rule,omitempty"`
+	Severity string `json:"severity"` // error, warning or note
+	// File is relative to the repo root. It is empty for findings about a package or test as a whole.
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	EndLine int    `json:"end_line,omitempty"`
+	Message string `json:"message"`
+	// Dismissed is the agent's reason for dismissing the finding.
+	Dismissed string `json:"dismissed,omitempty"`
+}
+
+// location returns the finding's file and lines.
+func (f *Finding) location() string {
+	if f.EndLine > f.Line {
+		return fmt.Sprintf("%s:%d-%d", f.File, f.Line, f.EndLine)
+	}
+	return fmt.Sprintf("%s:%d", f.File, f.Line)
+}
+
+// A Report is the findings of a review.
+type Report struct {
+	Commit   string    `json:"commit"` // the commit reviewed
+	Findings []Finding `json:"findings"`
+}
+
+// Report returns the findings of the most recent review.
+// It is safe to call concurrently with Run.
+func (r *CodeReviewer) Report() Report {
+	r.reportMu.Lock()
+	defer r.reportMu.Unlock()
+	return Report{Commit: r.report.Commit, Findings: slices.Clone(r.report.Findings)}
+}
+
+// SetReportPath makes the reviewer write its report to path after each review,
+// as SARIF if path ends in ".sarif", and as JSON otherwise.
+func (r *CodeReviewer) SetReportPath(path string) {
+	r.reportPath = path
+}
+
+// record adds findings to the report of the review in progress.
+func (r *CodeReviewer) record(findings ...Finding) {
+	r.recorded = append(r.recorded, findings...)
+}
+
+// setReport publishes the findings of the review of commit, and writes them to the report path.
+func (r *CodeReviewer) setReport(commit string, findings []Finding) {
+	if findings == nil {
+		findings = []Finding{}
+	}
+	r.reportMu.Lock()
+	r.report = Report{Commit: commit, Findings: findings}
+	r.reportMu.Unlock()
+
+	if r.reportPath == "" {
+		return
+	}
+	report := r.Report()
+	var data []byte
+	var err error
+	if strings.HasSuffix(r.reportPath, ".sarif") {
+		data, err = report.SARIF()
+	} else {
+		data, err = json.MarshalIndent(report, "", "  ")
+	}
+	if err == nil {
+		err = os.WriteFile(r.reportPath, data, 0o644)
+	}
+	if err != nil {
+		slog.Warn("CodeReviewer.setReport: failed to write report", "path", r.reportPath, "err", err)
+	}
+}
+
+var (
+	issuePosition = regexp.MustCompile(`^(.+?):(\d+)(?::|$)`)
+	issueRule     = regexp.MustCompile(`\s\(([A-Za-z][\w./-]*)\)$`)
+)
+
+// issueFindings converts issues reported by tool to findings.
+// Rules are taken from a trailing "(rule)" in the message, as staticcheck and golangci-lint write them.
+func issueFindings(tool string, issues []Issue) []Finding {
+	var findings []Finding
+	for _, issue := range issues {
+		f := Finding{Tool: tool, Severity: SeverityWarning, Message: issue.Message}
+		if m := issuePosition.FindStringSubmatch(issue.Position); m != nil {
+			f.File = filepath.ToSlash(m[1])
+			f.Line, _ = strconv.Atoi(m[2])
+		}
+		if m := issueRule.FindStringSubmatch(issue.Message); m != nil {
+			f.Rule = m[1]
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// sarifLog is the subset of SARIF 2.1.0 that we write.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver sarifDriver `json:"driver"`
+	} `json:"tool"`
+	Results    []sarifResult  `json:"results"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules,omitempty"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID       string             `json:"ruleId,omitempty"`
+	Level        string             `json:"level"`
+	Message      sarifMessage       `json:"message"`
+	Locations    []sarifLocation    `json:"locations,omitempty"`
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+	Properties   map[string]any     `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI       string `json:"uri"`
+			URIBaseID string `json:"uriBaseId"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+// SARIF returns the report as a SARIF 2.1.0 log, with a run for each tool.
+// Locations are relative to %SRCROOT%, the repo root. Dismissed findings are suppressed.
+func (rep Report) SARIF() ([]byte, error) {
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{},
+	}
+	runs := make(map[string]*sarifRun)
+	var tools []string
+	for _, f := range rep.Findings {
+		run := runs[f.Tool]
+		if run == nil {
+			run = &sarifRun{Results: []sarifResult{}, Properties: map[string]any{"commit": rep.Commit}}
+			run.Tool.Driver = sarifDriver{Name: f.Tool, InformationURI: "https://sketch.dev"}
+			runs[f.Tool] = run
+			tools = append(tools, f.Tool)
+		}
+		if f.Rule != "" && !slices.ContainsFunc(run.Tool.Driver.Rules, func(r sarifRule) bool { return r.ID == f.Rule }) {
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: f.Rule})
+		}
+		res := sarifResult{RuleID: f.Rule, Level: f.Severity, Message: sarifMessage{Text: f.Message}}
+		if f.File != "" {
+			var loc sarifLocation
+			loc.PhysicalLocation.ArtifactLocation.URI = f.File
+			loc.PhysicalLocation.ArtifactLocation.URIBaseID = "%SRCROOT%"
+			if f.Line > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line, EndLine: f.EndLine}
+			}
+			res.Locations = []sarifLocation{loc}
+		}
+		if f.Dismissed != "" {
+			res.Suppressions = []sarifSuppression{{Kind: "external", Justification: f.Dismissed}}
+		}
+		if f.ID != "" {
+			res.Properties = map[string]any{"id": f.ID}
+		}
+		run.Results = append(run.Results, res)
+	}
+	for _, tool := range tools {
+		log.Runs = append(log.Runs, *runs[tool])
+	}
+	return json.MarshalIndent(log, "", "  ")
+}
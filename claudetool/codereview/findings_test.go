@@ -0,0 +1,131 @@
+package codereview
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIssueFindings(t *testing.T) {
+	issues := []Issue{
+		{Position: "p.go:5:2-22", Message: "unreachable code"},
+		{Position: "sub/q.go:12:3", Message: "should use fmt.Errorf (SA1006)"},
+		{Position: "", Message: "failed with exit code 1:\nboom"},
+	}
+	want := []Finding{
+		{Tool: "Staticcheck", Severity: SeverityWarning, File: "p.go", Line: 5, Message: "unreachable code"},
+		{Tool: "Staticcheck", Rule: "SA1006", Severity: SeverityWarning, File: "sub/q.go", Line: 12, Message: "should use fmt.Errorf (SA1006)"},
+		{Tool: "Staticcheck", Severity: SeverityWarning, Message: "failed with exit code 1:\nboom"},
+	}
+	if got := issueFindings("Staticcheck", issues); !reflect.DeepEqual(got, want) {
+		t.Errorf("issueFindings() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestReportSARIF(t *testing.T) {
+	rep := Report{Commit: "abc123", Findings: []Finding{
+		{Tool: "Go vet", Severity: SeverityWarning, File: "p.go", Line: 4, Message: "bad printf"},
+		{Tool: "Go test", Rule: "test-regression", Severity: SeverityError, Message: "sketch.dev.TestP: Was passing, now failing"},
+		{ID: "R1", Tool: semanticReviewTool, Rule: "bug", Severity: SeverityWarning, File: "p.go", Line: 7, EndLine: 9, Message: "off by one", Dismissed: "intended"},
+	}}
+	data, err := rep.SARIF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine int `json:"startLine"`
+							EndLine   int `json:"endLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+				Suppressions []struct {
+					Justification string `json:"justification"`
+				} `json:"suppressions"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 3 {
+		t.Fatalf("SARIF has version %q and %d runs, want 2.1.0 and 3:\n%s", log.Version, len(log.Runs), data)
+	}
+	if got := log.Runs[1].Tool.Driver; got.Name != "Go test" || len(got.Rules) != 1 || got.Rules[0].ID != "test-regression" {
+		t.Errorf("second run's driver = %+v", got)
+	}
+	if got := log.Runs[1].Results[0]; got.Level != "error" || len(got.Locations) != 0 {
+		t.Errorf("test regression result = %+v, want an error without locations", got)
+	}
+	res := log.Runs[2].Results[0]
+	if loc := res.Locations[0].PhysicalLocation; loc.ArtifactLocation.URI != "p.go" || loc.Region.StartLine != 7 || loc.Region.EndLine != 9 {
+		t.Errorf("semantic review result location = %+v", loc)
+	}
+	if len(res.Suppressions) != 1 || res.Suppressions[0].Justification != "intended" {
+		t.Errorf("dismissed finding suppressions = %+v", res.Suppressions)
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	dir := resolveRealPath(t.TempDir())
+	config := "tests:\n  - name: smoke\n    run: test ! -e broken\n"
+	os.MkdirAll(filepath.Join(dir, ".sketch"), 0o700)
+	if err := os.WriteFile(filepath.Join(dir, configPath), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := initGitRepo(dir); err != nil {
+		t.Fatal(err)
+	}
+	initial, err := makeGitCommit(dir, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewer, err := NewCodeReviewer(context.Background(), dir, initial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reportPath := filepath.Join(t.TempDir(), "findings.json")
+	reviewer.SetReportPath(reportPath)
+
+	os.WriteFile(filepath.Join(dir, "broken"), nil, 0o600)
+	head, err := makeGitCommit(dir, "Break it", map[string]bool{"broken": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := reviewer.Run(context.Background(), nil); out.Error != nil {
+		t.Fatal(out.Error)
+	}
+	want := Report{Commit: head, Findings: []Finding{{Tool: "smoke", Rule: "test-regression", Severity: SeverityError, Message: "smoke: Was passing, now failing"}}}
+	if got := reviewer.Report(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Report() = %+v, want %+v", got, want)
+	}
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written Report
+	if err := json.Unmarshal(data, &written); err != nil || !reflect.DeepEqual(written, want) {
+		t.Errorf("written report = %+v, %v; want %+v", written, err, want)
+	}
+}
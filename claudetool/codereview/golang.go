@@ -0,0 +1,106 @@
+package codereview
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// goChecker formats Go files, runs go generate, and reports test and gopls regressions.
+type goChecker struct{}
+
+func (goChecker) name() string { return "go" }
+
+func (goChecker) formatters(r *CodeReviewer, file string) []formatter {
+	if filepath.Ext(file) != ".go" {
+		return nil
+	}
+	return []formatter{{name: "gofumpt"}, {name: "goimports"}, {name: "gofmt"}}
+}
+
+func (goChecker) review(ctx context.Context, r *CodeReviewer, changedFiles []string) (info, errs []string, err error) {
+	if !r.isGoRepository() {
+		return nil, nil, nil
+	}
+
+	// Prepare to analyze before/after for the impacted files.
+	// We use the current commit to determine what packages exist and are impacted.
+	// The packages in the initial commit may be different.
+	// Good enough for now.
+	// TODO: do better
+	allPkgs, err := r.packagesForFiles(ctx, changedFiles)
+	if err != nil {
+		// TODO: log and skip to stuff that doesn't require packages
+		slog.DebugContext(ctx, "CodeReviewer.Run: failed to get packages for files", "err", err)
+		return nil, nil, err
+	}
+	allPkgList := slices.Collect(maps.Keys(allPkgs))
+
+	// Run 'go generate' early, so that it can potentially fix tests that would otherwise fail.
+	generateChanges, err := r.runGenerate(ctx, allPkgList)
+	if err != nil {
+		errs = append(errs, err.Error())
+		r.record(Finding{Tool: "Go generate", Severity: SeverityError, Message: err.Error()})
+	}
+	if len(generateChanges) > 0 {
+		buf := new(strings.Builder)
+		buf.WriteString("The following files were changed by running `go generate`:\n\n")
+		for _, f := range generateChanges {
+			buf.WriteString(f)
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\nPlease amend your latest git commit with these changes.\n")
+		info = append(info, buf.String())
+	}
+
+	coverDir, err := os.MkdirTemp("", "sketch-codereview-cover")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(coverDir)
+	testMsg, err := r.checkTests(ctx, allPkgList, coverDir)
+	if err != nil {
+		slog.DebugContext(ctx, "CodeReviewer.Run: failed to check tests", "err", err)
+		return nil, nil, err
+	}
+	if testMsg != "" {
+		errs = append(errs, testMsg)
+	}
+
+	coverage, err := r.checkCoverage(ctx, allPkgs, changedFiles, filepath.Join(coverDir, "before.cover"), filepath.Join(coverDir, "after.cover"))
+	if err != nil {
+		// Coverage is advisory; don't let it break the review.
+		slog.WarnContext(ctx, "CodeReviewer.Run: failed to check coverage", "err", err)
+	}
+	if coverageMsg := r.formatCoverageRegressions(coverage); coverageMsg != "" {
+		info = append(info, coverageMsg) // informational: untested code is not an error
+	}
+
+	if r.benchmarksEnabled() {
+		if dirs := r.benchmarkDirs(allPkgs, changedFiles); len(dirs) > 0 {
+			benchmarks, err := r.checkBenchmarks(ctx, dirs)
+			if err != nil {
+				slog.WarnContext(ctx, "CodeReviewer.Run: failed to check benchmarks", "err", err)
+			}
+			if benchMsg := r.formatBenchmarkRegressions(benchmarks); benchMsg != "" {
+				errs = append(errs, benchMsg)
+			}
+		}
+	}
+
+	goplsIssues, err := r.checkGopls(ctx, changedFiles) // includes vet checks
+	if err != nil {
+		slog.DebugContext(ctx, "CodeReviewer.Run: failed to check gopls", "err", err)
+		return nil, nil, err
+	}
+	if goplsMsg := r.formatIssueRegressions("Gopls check", goplsIssues); goplsMsg != "" {
+		errs = append(errs, goplsMsg)
+	}
+
+	errs = append(errs, r.checkStaticAnalysis(ctx, allPkgs, goplsIssues)...)
+	return info, errs, nil
+}
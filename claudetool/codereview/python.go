@@ -0,0 +1,173 @@
+package codereview
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pythonChecker formats Python files with ruff format, and reports ruff check and pytest regressions.
+type pythonChecker struct{}
+
+var pythonProjectMarkers = []string{"pyproject.toml", "setup.py", "setup.cfg", "pytest.ini", "tox.ini"}
+
+var pythonExts = []string{".py", ".pyi"}
+
+func (pythonChecker) name() string { return "python" }
+
+func (pythonChecker) formatters(r *CodeReviewer, file string) []formatter {
+	if len(filesWithExt([]string{file}, pythonExts...)) == 0 {
+		return nil
+	}
+	project := r.projectDir(file, pythonProjectMarkers...)
+	if project == "" {
+		project = r.repoRoot
+	}
+	ruff := r.findTool(project, "ruff")
+	if ruff == "" {
+		return nil
+	}
+	return []formatter{{name: ruff, args: []string{"format", "--quiet", "--stdin-filename", "{file}", "-"}, dir: project}}
+}
+
+func (pythonChecker) review(ctx context.Context, r *CodeReviewer, changedFiles []string) (info, errs []string, err error) {
+	files := filesWithExt(changedFiles, pythonExts...)
+	for project, files := range r.projectDirs(files, r.repoRoot, pythonProjectMarkers...) {
+		if ruff := r.findTool(project, "ruff"); ruff != "" {
+			issues, err := r.lintRegressions(ctx, project, func(ctx context.Context, root, dir string) ([]Issue, error) {
+				existing := existingFiles(project, dir, files)
+				if len(existing) == 0 {
+					return nil, nil
+				}
+				args := append([]string{"check", "--output-format=concise", "--no-fix", "--exit-zero", "--quiet"}, existing...)
+				out, err := checkCommand(ctx, dir, ruff, args...).CombinedOutput()
+				if err != nil {
+					return nil, fmt.Errorf("ruff check failed: %w\n%s", err, out)
+				}
+				return parseIssues(root, dir, out, colonIssueFormat), nil
+			})
+			if err != nil {
+				slog.WarnContext(ctx, "CodeReviewer.Run: ruff check failed", "project", project, "err", err)
+			}
+			if msg := r.formatIssueRegressions("Ruff check", issues); msg != "" {
+				errs = append(errs, msg)
+			}
+		}
+
+		if pytest := r.findTool(project, "pytest"); pytest != "" {
+			projectRel := relOr(r.repoRoot, project)
+			msg, err := r.testRegressions(ctx, "Pytest", project, func(ctx context.Context, dir string) ([]testJSON, error) {
+				return runPytest(ctx, pytest, projectRel, dir)
+			})
+			if err != nil {
+				slog.WarnContext(ctx, "CodeReviewer.Run: pytest failed", "project", project, "err", err)
+			}
+			if msg != "" {
+				errs = append(errs, msg)
+			}
+		}
+	}
+	return info, errs, nil
+}
+
+// runPytest runs pytest in dir, the project at projectRel in the repo,
+// and reports the results as go test -json events.
+func runPytest(ctx context.Context, pytest, projectRel, dir string) ([]testJSON, error) {
+	report, err := os.CreateTemp("", "sketch-pytest-*.xml")
+	if err != nil {
+		return nil, err
+	}
+	report.Close()
+	defer os.Remove(report.Name())
+
+	cmd := checkCommand(ctx, dir, pytest, "-q", "-p", "no:cacheprovider", "-o", "junit_family=xunit1", "--junitxml="+report.Name())
+	out, err := cmd.CombinedOutput()
+	exitCode, err := checkExitCode(ctx, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run pytest: %w", err)
+	}
+	xmlReport, _ := os.ReadFile(report.Name())
+	return pytestEvents(projectRel, exitCode, xmlReport, out), nil
+}
+
+// junitTestCase is a test case in a JUnit XML report, as written by pytest --junitxml.
+type junitTestCase struct {
+	ClassName string       `xml:"classname,attr"`
+	Name      string       `xml:"name,attr"`
+	File      string       `xml:"file,attr"`
+	Failure   *junitResult `xml:"failure"`
+	Error     *junitResult `xml:"error"`
+	Skipped   *junitResult `xml:"skipped"`
+}
+
+type junitResult struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// pytestEvents converts pytest's exit code and JUnit XML report into go test -json events.
+// Each test file is a package, named by its path in the repo, with tests named by pytest node ID.
+// The project as a whole is also a package, named by testPackageLabel, which fails to build
+// if pytest couldn't collect or run the tests.
+func pytestEvents(projectRel string, exitCode int, report, output []byte) []testJSON {
+	label := testPackageLabel(projectRel, "pytest")
+	var suites struct {
+		Cases       []junitTestCase `xml:"testcase"`
+		SuitesCases []junitTestCase `xml:"testsuite>testcase"`
+	}
+	if err := xml.Unmarshal(report, &suites); err != nil && exitCode != 5 {
+		return []testJSON{{Package: label, Action: "fail", FailedBuild: label, Output: string(output)}}
+	}
+
+	var events []testJSON
+	broken := exitCode != 0 && exitCode != 1 && exitCode != 5 // interrupted, internal error, usage error
+	for _, tc := range append(suites.Cases, suites.SuitesCases...) {
+		if tc.File == "" {
+			// Collection errors aren't attributed to a test.
+			broken = broken || tc.Error != nil
+			continue
+		}
+		file := filepath.ToSlash(filepath.Join(projectRel, tc.File))
+		id := tc.File + "::"
+		// classname is the module, plus the class for test methods.
+		module := strings.ReplaceAll(strings.TrimSuffix(tc.File, ".py"), "/", ".")
+		if class := strings.TrimPrefix(strings.TrimPrefix(tc.ClassName, module), "."); class != "" && class != tc.ClassName {
+			id += class + "::"
+		}
+		id += tc.Name
+		event := testJSON{Package: file, Test: filepath.ToSlash(filepath.Join(projectRel, id)), Action: "pass"}
+		switch {
+		case tc.Failure != nil:
+			event.Action, event.Output = "fail", tc.Failure.Text
+		case tc.Error != nil:
+			event.Action, event.Output = "fail", tc.Error.Text
+		case tc.Skipped != nil:
+			event.Action = "skip"
+		}
+		events = append(events, event)
+	}
+
+	switch {
+	case broken:
+		events = append(events, testJSON{Package: label, Action: "fail", FailedBuild: label, Output: string(output)})
+	case exitCode == 5: // no tests collected
+		events = append(events, testJSON{Package: label, Action: "skip"})
+	case exitCode == 1:
+		events = append(events, testJSON{Package: label, Action: "fail"})
+	default:
+		events = append(events, testJSON{Package: label, Action: "pass"})
+	}
+	return events
+}
+
+// testPackageLabel names the package that stands for all of a project's tests run by runner.
+func testPackageLabel(projectRel, runner string) string {
+	if projectRel == "." {
+		return runner
+	}
+	return fmt.Sprintf("%s (%s)", filepath.ToSlash(projectRel), runner)
+}
@@ -0,0 +1,165 @@
+package codereview
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// rustChecker formats Rust files with rustfmt, and reports clippy and cargo test regressions.
+// It only handles files in a crate with a Cargo.toml.
+type rustChecker struct{}
+
+func (rustChecker) name() string { return "rust" }
+
+func (rustChecker) formatters(r *CodeReviewer, file string) []formatter {
+	if len(filesWithExt([]string{file}, ".rs")) == 0 {
+		return nil
+	}
+	project := r.projectDir(file, "Cargo.toml")
+	if project == "" {
+		return nil
+	}
+	rustfmt := r.findTool(project, "rustfmt")
+	if rustfmt == "" {
+		return nil
+	}
+	_, edition := cargoPackage(project)
+	return []formatter{{name: rustfmt, args: []string{"--edition", edition}, dir: project}}
+}
+
+func (rustChecker) review(ctx context.Context, r *CodeReviewer, changedFiles []string) (info, errs []string, err error) {
+	files := filesWithExt(changedFiles, ".rs")
+	for project := range r.projectDirs(files, "", "Cargo.toml") {
+		cargo := r.findTool(project, "cargo")
+		if cargo == "" {
+			continue
+		}
+
+		if r.findTool(project, "cargo-clippy") != "" {
+			issues, err := r.lintRegressions(ctx, project, func(ctx context.Context, root, dir string) ([]Issue, error) {
+				if !fileExists(filepath.Join(dir, "Cargo.toml")) {
+					return nil, nil
+				}
+				out, err := checkCommand(ctx, dir, cargo, "clippy", "--quiet", "--message-format=short", "--all-targets").CombinedOutput()
+				if _, err := checkExitCode(ctx, err); err != nil {
+					return nil, fmt.Errorf("cargo clippy failed: %w\n%s", err, out)
+				}
+				// rustc reports paths relative to the workspace root.
+				return parseIssues(root, cargoWorkspaceRoot(ctx, cargo, dir), out, rustcIssueFormat), nil
+			})
+			if err != nil {
+				slog.WarnContext(ctx, "CodeReviewer.Run: cargo clippy failed", "project", project, "err", err)
+			}
+			if msg := r.formatIssueRegressions("Clippy", issues); msg != "" {
+				errs = append(errs, msg)
+			}
+		}
+
+		projectRel := relOr(r.repoRoot, project)
+		msg, err := r.testRegressions(ctx, "Cargo test", project, func(ctx context.Context, dir string) ([]testJSON, error) {
+			out, err := checkCommand(ctx, dir, cargo, "test", "--no-fail-fast").CombinedOutput()
+			exitCode, err := checkExitCode(ctx, err)
+			if err != nil {
+				return nil, fmt.Errorf("failed to run cargo test: %w", err)
+			}
+			crate, _ := cargoPackage(dir)
+			return cargoTestEvents(projectRel, crate, exitCode, out), nil
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "CodeReviewer.Run: cargo test failed", "project", project, "err", err)
+		}
+		if msg != "" {
+			errs = append(errs, msg)
+		}
+	}
+	return info, errs, nil
+}
+
+// cargoPackage returns the package name and edition from the Cargo.toml in project.
+// The edition defaults to 2021.
+func cargoPackage(project string) (name, edition string) {
+	edition = "2021"
+	data, err := os.ReadFile(filepath.Join(project, "Cargo.toml"))
+	if err != nil {
+		return "", edition
+	}
+	section := ""
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			section = line
+			continue
+		}
+		if section != "[package]" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch strings.TrimSpace(key) {
+		case "name":
+			name = value
+		case "edition":
+			edition = value
+		}
+	}
+	return name, edition
+}
+
+// cargoWorkspaceRoot returns the root of the cargo workspace that dir belongs to, or dir if that fails.
+func cargoWorkspaceRoot(ctx context.Context, cargo, dir string) string {
+	out, err := checkCommand(ctx, dir, cargo, "locate-project", "--workspace", "--message-format", "plain").Output()
+	if err != nil {
+		return dir
+	}
+	return filepath.Dir(strings.TrimSpace(string(out)))
+}
+
+// cargoTestLine matches a test result in cargo test's output.
+var cargoTestLine = regexp.MustCompile(`^test (.+?) \.\.\. (ok|FAILED|ignored)`)
+
+// cargoTestEvents converts cargo test's exit code and output into go test -json events.
+// The crate is the package, named by testPackageLabel if the crate has no name,
+// and tests are named by the crate and their path within it.
+// The package fails to build if cargo test failed without running any tests.
+func cargoTestEvents(projectRel, crate string, exitCode int, output []byte) []testJSON {
+	label := cmp.Or(crate, testPackageLabel(projectRel, "cargo test"))
+	var events []testJSON
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		m := cargoTestLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		event := testJSON{Package: label, Test: label + "::" + m[1]}
+		switch m[2] {
+		case "ok":
+			event.Action = "pass"
+		case "FAILED":
+			event.Action = "fail"
+		case "ignored":
+			event.Action = "skip"
+		}
+		events = append(events, event)
+	}
+
+	switch {
+	case exitCode != 0 && len(events) == 0:
+		events = append(events, testJSON{Package: label, Action: "fail", FailedBuild: label, Output: string(output)})
+	case exitCode != 0:
+		events = append(events, testJSON{Package: label, Action: "fail"})
+	default:
+		events = append(events, testJSON{Package: label, Action: "pass"})
+	}
+	return events
+}
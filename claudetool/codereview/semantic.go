@@ -0,0 +1,211 @@
+package codereview
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"sketch.dev/claudetool/onstart"
+	"sketch.dev/experiment"
+	"sketch.dev/llm"
+	"sketch.dev/llm/conversation"
+)
+
+// This file does a semantic review of a commit relative to a base commit, by asking an LLM.
+
+//go:embed semantic_review_prompt.txt
+var semanticReviewPrompt string
+
+// semanticReviewTool is the Tool of semantic review findings.
+const semanticReviewTool = "Semantic review"
+
+const (
+	maxReviewDiffBytes     = 256 * 1024
+	maxReviewGuidanceBytes = 32 * 1024
+)
+
+// SetCodebase provides the codebase analysis, whose guidance files inform the semantic review.
+func (r *CodeReviewer) SetCodebase(codebase *onstart.Codebase) {
+	if codebase == nil {
+		return
+	}
+	r.guidanceFiles = slices.Concat(codebase.InjectFiles, codebase.GuidanceFiles)
+}
+
+// semanticReviewEnabled reports whether Run should ask an LLM to review the change,
+// as enabled by the repo's review config or the llm_review experiment.
+func (r *CodeReviewer) semanticReviewEnabled() bool {
+	return (r.config != nil && r.config.SemanticReview) || experiment.Enabled("llm_review")
+}
+
+// OpenFindings returns the findings from the semantic review of commit that have not been dismissed.
+func (r *CodeReviewer) OpenFindings(commit string) []Finding {
+	if commit != r.findingsCommit {
+		return nil
+	}
+	var open []Finding
+	for _, f := range r.findings {
+		if f.Dismissed == "" {
+			open = append(open, f)
+		}
+	}
+	return open
+}
+
+// semanticFindings returns all findings from the semantic review of commit, including dismissed ones.
+func (r *CodeReviewer) semanticFindings(commit string) []Finding {
+	if commit != r.findingsCommit {
+		return nil
+	}
+	return slices.Clone(r.findings)
+}
+
+// dismissFinding records the agent's reason for dismissing the finding with id.
+func (r *CodeReviewer) dismissFinding(id, reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("dismissing %s requires a reason", id)
+	}
+	i := slices.IndexFunc(r.findings, func(f Finding) bool { return f.ID == id })
+	if i < 0 {
+		return fmt.Errorf("no open finding %s", id)
+	}
+	if r.findings[i].Dismissed == "" {
+		r.findings[i].Dismissed = reason
+		r.dismissed = append(r.dismissed, r.findings[i])
+	}
+	return nil
+}
+
+// semanticReview asks an LLM, in a sub-conversation of convo, to review the changes from the base commit to commit,
+// and records its findings for commit.
+func (r *CodeReviewer) semanticReview(ctx context.Context, convo *conversation.Convo, commit string, changedFiles []string) ([]Finding, error) {
+	ctx, span := tracer.Start(ctx, "codereview.semanticReview")
+	defer span.End()
+
+	cmd := exec.CommandContext(ctx, "git", "diff", "--no-color", "--no-ext-diff", "-U5", r.sketchBaseRef, commit)
+	cmd.Dir = r.repoRoot
+	diff, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff: %w", err)
+	}
+	if len(diff) > maxReviewDiffBytes {
+		diff = append(diff[:maxReviewDiffBytes], "\n[diff truncated]\n"...)
+	}
+
+	var content []llm.Content
+	for _, g := range r.applicableGuidance(changedFiles) {
+		data, err := os.ReadFile(filepath.Join(r.repoRoot, g))
+		if err != nil {
+			continue
+		}
+		if len(data) > maxReviewGuidanceBytes {
+			data = data[:maxReviewGuidanceBytes]
+		}
+		content = append(content, llm.StringContent(fmt.Sprintf("<guidance file=%q>\n%s\n</guidance>", g, data)))
+	}
+	if len(r.dismissed) > 0 {
+		dismissed, _ := json.Marshal(r.dismissed)
+		content = append(content, llm.StringContent("<dismissed>\n"+string(dismissed)+"\n</dismissed>"))
+	}
+	content = append(content, llm.StringContent("<diff>\n"+string(diff)+"\n</diff>"))
+
+	sub := convo.SubConvo()
+	sub.SystemPrompt = strings.TrimSpace(semanticReviewPrompt)
+	sub.PromptCaching = false
+	resp, err := sub.SendMessageContext(ctx, llm.Message{Role: llm.MessageRoleUser, Content: content})
+	if err != nil {
+		return nil, fmt.Errorf("semantic review failed: %w", err)
+	}
+	var text strings.Builder
+	for _, c := range resp.Content {
+		text.WriteString(c.Text)
+	}
+	findings, err := parseFindings(text.String())
+	if err != nil {
+		return nil, err
+	}
+	for i := range findings {
+		r.findingSeq++
+		findings[i].ID = fmt.Sprintf("R%d", r.findingSeq)
+	}
+	r.findings, r.findingsCommit = findings, commit
+	return findings, nil
+}
+
+// applicableGuidance returns the guidance files that apply to the changed files:
+// those in the repo root, or in a directory that contains a changed file.
+func (r *CodeReviewer) applicableGuidance(changedFiles []string) []string {
+	var applicable []string
+	for _, g := range r.guidanceFiles {
+		dir := path.Dir(filepath.ToSlash(g))
+		applies := dir == "."
+		for _, file := range changedFiles {
+			if applies {
+				break
+			}
+			applies = strings.HasPrefix(filepath.ToSlash(relOr(r.repoRoot, file)), dir+"/")
+		}
+		if applies {
+			applicable = append(applicable, g)
+		}
+	}
+	return applicable
+}
+
+// parseFindings parses the reviewer's response, a JSON array of findings,
+// tolerating surrounding text such as a markdown code fence.
+func parseFindings(text string) ([]Finding, error) {
+	start, end := strings.Index(text, "["), strings.LastIndex(text, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("semantic review response has no JSON array: %q", text)
+	}
+	var reported []struct {
+		File     string `json:"file"`
+		Line     int    `json:"line"`
+		EndLine  int    `json:"end_line"`
+		Category string `json:"category"`
+		Message  string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &reported); err != nil {
+		return nil, fmt.Errorf("failed to parse semantic review response: %w", err)
+	}
+	var findings []Finding
+	for _, f := range reported {
+		if f.File == "" || f.Message == "" {
+			continue
+		}
+		findings = append(findings, Finding{
+			Tool:     semanticReviewTool,
+			Rule:     f.Category,
+			Severity: SeverityWarning,
+			File:     path.Clean(filepath.ToSlash(f.File)),
+			Line:     f.Line,
+			EndLine:  f.EndLine,
+			Message:  f.Message,
+		})
+	}
+	return findings, nil
+}
+
+// formatFindings generates a human-readable summary of open findings.
+func (r *CodeReviewer) formatFindings(findings []Finding) string {
+	if len(findings) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("Semantic review findings:\n\n")
+	for _, f := range findings {
+		fmt.Fprintf(&sb, "%s. %s: [%s] %s\n", f.ID, filepath.Join(r.repoRoot, f.location()), f.Rule, f.Message)
+	}
+	sb.WriteString("\nFix each finding and commit, or, if a finding is wrong, dismiss it by calling codereview with dismiss, e.g. ")
+	fmt.Fprintf(&sb, `[{"id": %q, "reason": "..."}].`, findings[0].ID)
+	sb.WriteString(" You can't be done until every finding is fixed or dismissed.\n")
+	return sb.String()
+}
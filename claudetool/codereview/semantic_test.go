@@ -0,0 +1,135 @@
+package codereview
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sketch.dev/claudetool/onstart"
+	"sketch.dev/llm"
+	"sketch.dev/llm/conversation"
+)
+
+// fakeReviewer is an llm.Service that responds to every request with response.
+type fakeReviewer struct {
+	response string
+	requests []*llm.Request
+}
+
+func (f *fakeReviewer) Do(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	f.requests = append(f.requests, req)
+	return &llm.Response{
+		Role:       llm.MessageRoleAssistant,
+		Content:    []llm.Content{llm.StringContent(f.response)},
+		StopReason: llm.StopReasonEndTurn,
+	}, nil
+}
+
+func (f *fakeReviewer) TokenContextWindow() int { return 200000 }
+
+func TestSemanticReview(t *testing.T) {
+	dir := resolveRealPath(t.TempDir())
+	files := map[string]string{
+		"AGENT.md":         "Root guidance.\n",
+		"api/AGENT.md":     "Every handler must check auth.\n",
+		"other/AGENT.md":   "Unrelated guidance.\n",
+		"api/handler.go":   "package api\n",
+		"other/helper.txt": "helper\n",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o700)
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600)
+	}
+	if err := initGitRepo(dir); err != nil {
+		t.Fatal(err)
+	}
+	initial, err := makeGitCommit(dir, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewer, err := NewCodeReviewer(context.Background(), dir, initial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewer.SetCodebase(&onstart.Codebase{InjectFiles: []string{"AGENT.md"}, GuidanceFiles: []string{"api/AGENT.md", "other/AGENT.md"}})
+
+	os.WriteFile(filepath.Join(dir, "api/handler.go"), []byte("package api\n\nfunc Handle() {}\n"), 0o600)
+	head, err := makeGitCommit(dir, "Add handler", map[string]bool{"api/handler.go": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &fakeReviewer{response: "```json\n" + `[{"file": "api/handler.go", "line": 3, "category": "guidance", "message": "Handle doesn't check auth."}]` + "\n```"}
+	convo := conversation.New(context.Background(), srv, nil)
+	findings, err := reviewer.semanticReview(context.Background(), convo, head, []string{filepath.Join(dir, "api/handler.go")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Finding{{ID: "R1", Tool: semanticReviewTool, Rule: "guidance", Severity: SeverityWarning, File: "api/handler.go", Line: 3, Message: "Handle doesn't check auth."}}
+	if !reflect.DeepEqual(findings, want) {
+		t.Errorf("findings = %+v, want %+v", findings, want)
+	}
+
+	var sent strings.Builder
+	for _, c := range srv.requests[0].Messages[0].Content {
+		sent.WriteString(c.Text)
+	}
+	for _, s := range []string{`<guidance file="AGENT.md">`, `<guidance file="api/AGENT.md">`, "+func Handle() {}"} {
+		if !strings.Contains(sent.String(), s) {
+			t.Errorf("review request doesn't contain %q", s)
+		}
+	}
+	if strings.Contains(sent.String(), "Unrelated guidance") {
+		t.Errorf("review request contains guidance for unchanged directories")
+	}
+
+	if open := reviewer.OpenFindings(head); len(open) != 1 {
+		t.Fatalf("OpenFindings() = %+v, want one", open)
+	}
+	if err := reviewer.dismissFinding("R1", ""); err == nil {
+		t.Error("dismissing without a reason succeeded")
+	}
+	if err := reviewer.dismissFinding("R9", "no such finding"); err == nil {
+		t.Error("dismissing an unknown finding succeeded")
+	}
+	if err := reviewer.dismissFinding("R1", "auth is checked by middleware"); err != nil {
+		t.Fatal(err)
+	}
+	if open := reviewer.OpenFindings(head); len(open) != 0 {
+		t.Errorf("OpenFindings() after dismissal = %+v", open)
+	}
+
+	// A later review is told what was dismissed, and numbers its findings after the earlier ones.
+	srv.response = `[{"file": "api/handler.go", "line": 3, "category": "test", "message": "Handle has no test."}]`
+	findings, err = reviewer.semanticReview(context.Background(), convo, head, []string{filepath.Join(dir, "api/handler.go")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].ID != "R2" {
+		t.Errorf("second review findings = %+v", findings)
+	}
+	if got := srv.requests[1].Messages[0].Content; !strings.Contains(got[len(got)-2].Text, "auth is checked by middleware") {
+		t.Errorf("second review request doesn't include the dismissed finding: %q", got[len(got)-2].Text)
+	}
+}
+
+func TestParseFindings(t *testing.T) {
+	findings, err := parseFindings(`[]`)
+	if err != nil || len(findings) != 0 {
+		t.Errorf("parseFindings([]) = %v, %v", findings, err)
+	}
+	findings, err = parseFindings(`Here you go: [{"file": "./a.go", "line": 1, "message": "m", "id": "X", "dismissed": "yes"}, {"file": "", "line": 2, "message": "no file"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Finding{{Tool: semanticReviewTool, Severity: SeverityWarning, File: "a.go", Line: 1, Message: "m"}}
+	if !reflect.DeepEqual(findings, want) {
+		t.Errorf("parseFindings() = %+v, want %+v", findings, want)
+	}
+	if _, err := parseFindings("No issues found."); err == nil {
+		t.Error("parseFindings() of a response without JSON succeeded")
+	}
+}
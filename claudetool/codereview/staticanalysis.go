@@ -0,0 +1,192 @@
+package codereview
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// A goAnalyzer is a Go static analysis tool, run on package directories.
+type goAnalyzer struct {
+	name    string   // for reporting, e.g. "Go vet"
+	cmd     string   // path of the executable
+	args    []string // arguments before the package directories
+	version []string // command that prints the tool's version, for the baseline cache
+	parse   func(root, dir string, output []byte) []Issue
+}
+
+// goAnalyzers returns the static analysis tools to run: go vet, and staticcheck and golangci-lint if installed.
+// golangci-lint only runs in repos that configure it.
+func (r *CodeReviewer) goAnalyzers(ctx context.Context) []goAnalyzer {
+	analyzers := []goAnalyzer{{name: "Go vet", cmd: "go", args: []string{"vet", "-json"}, version: goVersion, parse: parseVetJSON}}
+	if staticcheck := r.findTool(r.repoRoot, "staticcheck"); staticcheck != "" {
+		analyzers = append(analyzers, goAnalyzer{name: "Staticcheck", cmd: staticcheck, args: []string{"-f", "text"}, version: []string{staticcheck, "-version"}, parse: parseAnalyzerOutput})
+	}
+	if golangci := r.findTool(r.repoRoot, "golangci-lint"); golangci != "" && r.hasGolangciConfig() {
+		analyzers = append(analyzers, goAnalyzer{name: "Golangci-lint", cmd: golangci, args: golangciLintArgs(ctx, golangci), version: []string{golangci, "--version"}, parse: parseAnalyzerOutput})
+	}
+	return analyzers
+}
+
+// hasGolangciConfig reports whether the repo root has a golangci-lint config file.
+func (r *CodeReviewer) hasGolangciConfig() bool {
+	for _, ext := range []string{"yml", "yaml", "toml", "json"} {
+		if fileExists(filepath.Join(r.repoRoot, ".golangci."+ext)) {
+			return true
+		}
+	}
+	return false
+}
+
+var golangciVersion = regexp.MustCompile(`version v?(\d+)\.`)
+
+// golangciLintArgs returns arguments that make golangci-lint print one issue per line,
+// which are different for versions 1 and 2.
+func golangciLintArgs(ctx context.Context, golangci string) []string {
+	args := []string{"run", "--issues-exit-code=0"}
+	out, _ := checkCommand(ctx, "", golangci, "--version").Output()
+	if m := golangciVersion.FindSubmatch(out); m != nil {
+		if major, _ := strconv.Atoi(string(m[1])); major < 2 {
+			return append(args, "--out-format=line-number", "--print-issued-lines=false")
+		}
+	}
+	return append(args, "--output.text.path=stdout", "--output.text.print-issued-lines=false", "--output.text.colors=false", "--show-stats=false")
+}
+
+// checkStaticAnalysis runs the goAnalyzers on the directories of pkgs, in the current and initial state,
+// and reports new issues for each tool. Issues already reported, such as those from gopls, are left out.
+// Tools that fail to run are skipped.
+func (r *CodeReviewer) checkStaticAnalysis(ctx context.Context, pkgs map[string]*packages.Package, reported []Issue) []string {
+	ctx, span := tracer.Start(ctx, "codereview.checkStaticAnalysis")
+	defer span.End()
+
+	dirs := r.packageDirs(pkgs)
+	if len(dirs) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, issue := range reported {
+		seen[issueKey(issue)] = true
+	}
+
+	var msgs []string
+	for _, a := range r.goAnalyzers(ctx) {
+		key := r.baselineKey(ctx, a.version, slices.Concat([]string{a.name}, a.args, dirs)...)
+		issues, err := r.cachedLintRegressions(ctx, key, r.repoRoot, func(ctx context.Context, root, dir string) ([]Issue, error) {
+			args := slices.Clone(a.args)
+			for _, d := range dirs {
+				if fileExists(filepath.Join(dir, d)) {
+					args = append(args, "./"+filepath.ToSlash(d))
+				}
+			}
+			if len(args) == len(a.args) {
+				return nil, nil
+			}
+			// The tools exit with an error for findings and for build errors, which the tests report.
+			out, err := checkCommand(ctx, dir, a.cmd, args...).CombinedOutput()
+			if _, err := checkExitCode(ctx, err); err != nil {
+				return nil, err
+			}
+			return a.parse(root, dir, out), nil
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "CodeReviewer.checkStaticAnalysis: analysis failed", "tool", a.name, "err", err)
+			continue
+		}
+		issues = slices.DeleteFunc(issues, func(issue Issue) bool {
+			key := issueKey(issue)
+			dup := seen[key]
+			seen[key] = true
+			return dup
+		})
+		if msg := r.formatIssueRegressions(a.name, issues); msg != "" {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// parseVetJSON parses the output of go vet -json, which is a JSON object per package,
+// interleaved with build errors in text.
+func parseVetJSON(root, dir string, output []byte) []Issue {
+	var issues []Issue
+	var obj []byte
+	for line := range strings.Lines(string(output)) {
+		if obj == nil && line != "{\n" {
+			continue // not JSON
+		}
+		obj = append(obj, line...)
+		if line != "}\n" {
+			continue
+		}
+		var pkgs map[string]map[string]json.RawMessage // package -> analyzer -> diagnostics, or an error
+		if err := json.Unmarshal(obj, &pkgs); err != nil {
+			slog.Debug("parseVetJSON: bad output", "err", err)
+		}
+		obj = nil
+		for _, analyzers := range pkgs {
+			for _, raw := range analyzers {
+				var diags []struct {
+					Posn    string `json:"posn"`
+					Message string `json:"message"`
+				}
+				if json.Unmarshal(raw, &diags) != nil {
+					continue // analyzer error
+				}
+				for _, d := range diags {
+					if shouldIgnoreDiagnostic(d.Message) {
+						continue
+					}
+					issues = append(issues, Issue{Position: relOr(root, d.Posn), Message: d.Message})
+				}
+			}
+		}
+	}
+	slices.SortFunc(issues, func(a, b Issue) int { return strings.Compare(a.Position, b.Position) })
+	return issues
+}
+
+// parseAnalyzerOutput parses file:line:col: message output, as from staticcheck and golangci-lint,
+// leaving out build errors.
+func parseAnalyzerOutput(root, dir string, output []byte) []Issue {
+	return slices.DeleteFunc(parseIssues(root, dir, output, colonIssueFormat), func(issue Issue) bool {
+		return strings.HasSuffix(issue.Message, " (compile)") || strings.HasSuffix(issue.Message, " (typecheck)")
+	})
+}
+
+// packageDirs returns the directories of pkgs, relative to the repo root and sorted.
+func (r *CodeReviewer) packageDirs(pkgs map[string]*packages.Package) []string {
+	var dirs []string
+	for _, pkg := range pkgs {
+		files := append(slices.Clone(pkg.GoFiles), pkg.CompiledGoFiles...)
+		if len(files) == 0 {
+			continue
+		}
+		rel, err := filepath.Rel(r.repoRoot, filepath.Dir(files[0]))
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		dirs = append(dirs, rel)
+	}
+	slices.Sort(dirs)
+	return slices.Compact(dirs)
+}
+
+// issueKey identifies an issue by file, line and message, so that the same issue reported by different tools,
+// with different columns or a trailing check name, such as staticcheck's "(SA1006)", can be matched.
+func issueKey(issue Issue) string {
+	file, rest, _ := strings.Cut(issue.Position, ":")
+	line, _, _ := strings.Cut(rest, ":")
+	msg := issue.Message
+	if i := strings.LastIndex(msg, " ("); i > 0 && strings.HasSuffix(msg, ")") {
+		msg = msg[:i]
+	}
+	return file + ":" + line + ": " + msg
+}
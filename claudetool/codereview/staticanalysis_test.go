@@ -0,0 +1,55 @@
+package codereview
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVetJSON(t *testing.T) {
+	output := `# example.com/q
+vet: q/q.go:2:12: undefined: x
+{
+	"example.com/p": {
+		"printf": [
+			{
+				"posn": "/repo/p/p.go:3:24",
+				"end": "/repo/p/p.go:3:26",
+				"message": "fmt.Printf format %s has arg 1 of wrong type int"
+			}
+		],
+		"copylocks": {
+			"error": "analysis skipped due to errors in package"
+		}
+	}
+}
+`
+	got := parseVetJSON("/repo", "/repo", []byte(output))
+	want := []Issue{{Position: "p/p.go:3:24", Message: "fmt.Printf format %s has arg 1 of wrong type int"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseVetJSON() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseAnalyzerOutput(t *testing.T) {
+	output := `p/p.go:3:24: printf-style function with dynamic format string and no further arguments should use print-style function instead (SA1006)
+q/q.go:2:12: undefined: x (compile)
+`
+	got := parseAnalyzerOutput("/repo", "/repo", []byte(output))
+	want := []Issue{{Position: "p/p.go:3:24", Message: "printf-style function with dynamic format string and no further arguments should use print-style function instead (SA1006)"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAnalyzerOutput() = %+v, want %+v", got, want)
+	}
+}
+
+func TestIssueKey(t *testing.T) {
+	gopls := Issue{Position: "p.go:8:28-30", Message: "fmt.Printf format %s has arg 10 of wrong type int"}
+	vet := Issue{Position: "p.go:8:2", Message: "fmt.Printf format %s has arg 10 of wrong type int"}
+	staticcheck := Issue{Position: "p.go:8:2", Message: "fmt.Printf format %s has arg 10 of wrong type int (SA5009)"}
+	other := Issue{Position: "p.go:9:2", Message: "fmt.Printf format %s has arg 10 of wrong type int"}
+	if issueKey(gopls) != issueKey(vet) || issueKey(vet) != issueKey(staticcheck) {
+		t.Errorf("keys differ for the same issue: %q, %q, %q", issueKey(gopls), issueKey(vet), issueKey(staticcheck))
+	}
+	if issueKey(vet) == issueKey(other) {
+		t.Errorf("keys match for issues on different lines: %q", issueKey(vet))
+	}
+}
@@ -0,0 +1,240 @@
+package codereview
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// typeScriptChecker formats TypeScript and JavaScript files with prettier,
+// and reports eslint, tsc and vitest or jest regressions.
+// It only handles files in a project with a package.json.
+type typeScriptChecker struct{}
+
+var typeScriptExts = []string{".ts", ".tsx", ".mts", ".cts", ".js", ".jsx", ".mjs", ".cjs"}
+
+func (typeScriptChecker) name() string { return "typescript" }
+
+func (typeScriptChecker) formatters(r *CodeReviewer, file string) []formatter {
+	if len(filesWithExt([]string{file}, typeScriptExts...)) == 0 {
+		return nil
+	}
+	project := r.projectDir(file, "package.json")
+	if project == "" {
+		return nil
+	}
+	prettier := r.findTool(project, "prettier")
+	if prettier == "" {
+		return nil
+	}
+	return []formatter{{name: prettier, args: []string{"--stdin-filepath", "{file}"}, dir: project}}
+}
+
+func (typeScriptChecker) review(ctx context.Context, r *CodeReviewer, changedFiles []string) (info, errs []string, err error) {
+	files := filesWithExt(changedFiles, typeScriptExts...)
+	for project, files := range r.projectDirs(files, "", "package.json") {
+		if eslint := r.findTool(project, "eslint"); eslint != "" {
+			issues, err := r.lintRegressions(ctx, project, func(ctx context.Context, root, dir string) ([]Issue, error) {
+				existing := existingFiles(project, dir, files)
+				if len(existing) == 0 {
+					return nil, nil
+				}
+				linkNodeModules(project, dir)
+				args := append([]string{"--format", "json", "--no-color"}, existing...)
+				out, err := checkCommand(ctx, dir, eslint, args...).Output()
+				if code, err := checkExitCode(ctx, err); err != nil || code > 1 {
+					return nil, fmt.Errorf("eslint failed: exit code %d: %v", code, err)
+				}
+				return parseESLintIssues(root, out)
+			})
+			if err != nil {
+				slog.WarnContext(ctx, "CodeReviewer.Run: eslint failed", "project", project, "err", err)
+			}
+			if msg := r.formatIssueRegressions("ESLint", issues); msg != "" {
+				errs = append(errs, msg)
+			}
+		}
+
+		if tsc := r.findTool(project, "tsc"); tsc != "" && fileExists(filepath.Join(project, "tsconfig.json")) {
+			issues, err := r.lintRegressions(ctx, project, func(ctx context.Context, root, dir string) ([]Issue, error) {
+				if !fileExists(filepath.Join(dir, "tsconfig.json")) {
+					return nil, nil
+				}
+				linkNodeModules(project, dir)
+				out, err := checkCommand(ctx, dir, tsc, "--noEmit", "--pretty", "false").CombinedOutput()
+				if _, err := checkExitCode(ctx, err); err != nil {
+					return nil, fmt.Errorf("tsc failed: %w\n%s", err, out)
+				}
+				return parseIssues(root, dir, out, tscIssueFormat), nil
+			})
+			if err != nil {
+				slog.WarnContext(ctx, "CodeReviewer.Run: tsc failed", "project", project, "err", err)
+			}
+			if msg := r.formatIssueRegressions("TypeScript", issues); msg != "" {
+				errs = append(errs, msg)
+			}
+		}
+
+		runner, args := javaScriptTestRunner(project)
+		if runner == "" {
+			continue
+		}
+		bin := r.findTool(project, runner)
+		if bin == "" {
+			continue
+		}
+		projectRel := relOr(r.repoRoot, project)
+		msg, err := r.testRegressions(ctx, strings.ToUpper(runner[:1])+runner[1:], project, func(ctx context.Context, dir string) ([]testJSON, error) {
+			linkNodeModules(project, dir)
+			return runJavaScriptTests(ctx, runner, bin, args, projectRel, dir)
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "CodeReviewer.Run: tests failed", "runner", runner, "project", project, "err", err)
+		}
+		if msg != "" {
+			errs = append(errs, msg)
+		}
+	}
+	return info, errs, nil
+}
+
+// javaScriptTestRunner returns the test runner that project depends on, vitest or jest,
+// and the arguments that make it write a JSON report to the file named by a final argument.
+// It returns the empty string if the project uses neither.
+func javaScriptTestRunner(project string) (runner string, args []string) {
+	data, err := os.ReadFile(filepath.Join(project, "package.json"))
+	if err != nil {
+		return "", nil
+	}
+	var pkg struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if json.Unmarshal(data, &pkg) != nil {
+		return "", nil
+	}
+	has := func(name string) bool {
+		_, dep := pkg.Dependencies[name]
+		_, dev := pkg.DevDependencies[name]
+		return dep || dev
+	}
+	switch {
+	case has("vitest"):
+		return "vitest", []string{"run", "--reporter=json", "--outputFile"}
+	case has("jest"):
+		return "jest", []string{"--ci", "--json", "--outputFile"}
+	}
+	return "", nil
+}
+
+// runJavaScriptTests runs the tests in dir, the project at projectRel in the repo,
+// and reports the results as go test -json events.
+func runJavaScriptTests(ctx context.Context, runner, bin string, args []string, projectRel, dir string) ([]testJSON, error) {
+	report, err := os.CreateTemp("", "sketch-"+runner+"-*.json")
+	if err != nil {
+		return nil, err
+	}
+	report.Close()
+	defer os.Remove(report.Name())
+
+	out, err := checkCommand(ctx, dir, bin, append(args, report.Name())...).CombinedOutput()
+	if _, err := checkExitCode(ctx, err); err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", runner, err)
+	}
+	jsonReport, _ := os.ReadFile(report.Name())
+	return javaScriptTestEvents(runner, projectRel, dir, jsonReport, out), nil
+}
+
+// javaScriptTestEvents converts a jest-compatible JSON report, as written by jest --json and vitest's json reporter,
+// from a run in dir into go test -json events. Each test file is a package, named by its path in the repo,
+// with tests named by the file and the test's full name.
+// The project as a whole is also a package, named by testPackageLabel, which fails to build
+// if there is no report.
+func javaScriptTestEvents(runner, projectRel, dir string, report, output []byte) []testJSON {
+	label := testPackageLabel(projectRel, runner)
+	var results struct {
+		Success     bool `json:"success"`
+		TestResults []struct {
+			Name             string `json:"name"`
+			Status           string `json:"status"`
+			Message          string `json:"message"`
+			AssertionResults []struct {
+				FullName        string   `json:"fullName"`
+				Status          string   `json:"status"`
+				FailureMessages []string `json:"failureMessages"`
+			} `json:"assertionResults"`
+		} `json:"testResults"`
+	}
+	if err := json.Unmarshal(report, &results); err != nil {
+		return []testJSON{{Package: label, Action: "fail", FailedBuild: label, Output: string(output)}}
+	}
+
+	var events []testJSON
+	for _, file := range results.TestResults {
+		// Reports have absolute paths, which differ between the repo and the initial worktree.
+		pkg := filepath.ToSlash(filepath.Join(projectRel, relOr(dir, file.Name)))
+		if file.Status == "failed" && len(file.AssertionResults) == 0 {
+			// The file failed to load, e.g. with a syntax or type error.
+			events = append(events, testJSON{Package: pkg, Action: "fail", FailedBuild: pkg, Output: file.Message})
+			continue
+		}
+		fileAction := "pass"
+		for _, a := range file.AssertionResults {
+			event := testJSON{Package: pkg, Test: pkg + " > " + a.FullName}
+			switch a.Status {
+			case "passed":
+				event.Action = "pass"
+			case "failed":
+				event.Action = "fail"
+				fileAction = "fail"
+				for _, m := range a.FailureMessages {
+					event.Output += m + "\n"
+				}
+			default: // pending, skipped, todo, disabled
+				event.Action = "skip"
+			}
+			events = append(events, event)
+		}
+		events = append(events, testJSON{Package: pkg, Action: fileAction})
+	}
+	if results.Success {
+		events = append(events, testJSON{Package: label, Action: "pass"})
+	} else {
+		events = append(events, testJSON{Package: label, Action: "fail"})
+	}
+	return events
+}
+
+// parseESLintIssues parses eslint's JSON output into issues with positions relative to root.
+func parseESLintIssues(root string, output []byte) ([]Issue, error) {
+	var files []struct {
+		FilePath string `json:"filePath"`
+		Messages []struct {
+			RuleID  string `json:"ruleId"`
+			Message string `json:"message"`
+			Line    int    `json:"line"`
+			Column  int    `json:"column"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(output, &files); err != nil {
+		return nil, fmt.Errorf("failed to parse eslint output: %w", err)
+	}
+	var issues []Issue
+	for _, f := range files {
+		for _, m := range f.Messages {
+			msg := m.Message
+			if m.RuleID != "" {
+				msg += " (" + m.RuleID + ")"
+			}
+			issues = append(issues, Issue{
+				Position: fmt.Sprintf("%s:%d:%d", relOr(root, f.FilePath), m.Line, m.Column),
+				Message:  msg,
+			})
+		}
+	}
+	return issues, nil
+}
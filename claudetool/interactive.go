@@ -0,0 +1,305 @@
+package claudetool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/creack/pty"
+)
+
+// interactiveSettle is how long an interactive command's output must be quiet
+// before we consider it to be waiting, and hand control back to the agent.
+const interactiveSettle = 500 * time.Millisecond
+
+// interactiveEditor stands in for EDITOR and GIT_SEQUENCE_EDITOR in interactive commands.
+// It prints the file to edit and waits for the agent to send a line,
+// so that the agent can edit the file with its usual tools in the meantime.
+const interactiveEditor = `sh -c 'echo "Edit $1 now, then send a newline to continue."; read -r _' --`
+
+// executeInteractiveBash starts a command on a pseudo-terminal, as a job that the agent
+// can send input to, and returns its output once it exits or settles, e.g. at a prompt.
+func (b *BashTool) executeInteractiveBash(ctx context.Context, req bashInput, timeout time.Duration) (string, error) {
+	if b.Jobs == nil {
+		return "", fmt.Errorf("interactive commands are not available")
+	}
+	tmpDir, outFile, out, err := createOutputFile()
+	if err != nil {
+		return "", err
+	}
+
+	execCtx, cancel := context.WithTimeout(context.Background(), b.Timeouts.background()) // detach from tool use context
+	cmd := b.makeBashCommand(execCtx, req.Command, nil, req.shouldDetectPorts())
+	// pty.Start makes the command a session leader, which also gives it its own process group.
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	cmd.Env = append(cmd.Env,
+		"TERM=dumb", // discourage colors and cursor movement
+		"NO_COLOR=1",
+		"EDITOR="+interactiveEditor,
+		"GIT_SEQUENCE_EDITOR="+interactiveEditor,
+	)
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: 50, Cols: 200})
+	if err != nil {
+		cancel()
+		out.Close()
+		os.RemoveAll(tmpDir)
+		return "", fmt.Errorf("failed to start interactive command: %w", err)
+	}
+	jb := b.Jobs.add(req.Command, cmd.Process.Pid, outFile, ptmx)
+
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(out, ptmx)
+		close(copied)
+	}()
+	go func() {
+		err := cmdWait(cmd)
+		// Let the remaining output drain. Processes left in the background
+		// may keep the terminal open, so don't wait for them.
+		select {
+		case <-copied:
+		case <-time.After(time.Second):
+		}
+		ptmx.Close()
+		<-copied
+		if err != nil {
+			fmt.Fprintf(out, "\n\n[interactive process failed: %v]\n", err)
+		} else {
+			fmt.Fprintf(out, "\n\n[interactive process completed]\n")
+		}
+		out.Close()
+		cancel()
+		b.Jobs.exited(jb, err)
+	}()
+
+	output, result, err := b.Jobs.Read(ctx, jb.id, nil, timeout)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<job_id>%d</job_id>\n%s<reminder>Use the jobs tool to send input to this job (include \\n to press Enter) and to read its output.</reminder>\n",
+		jb.id, b.Jobs.readReport(jb.id, result, "", timeout, output)), nil
+}
+
+// Send writes input to interactive job id's terminal.
+func (j *Jobs) Send(id int, input string) error {
+	jb, err := j.get(id)
+	if err != nil {
+		return err
+	}
+	if jb.pty == nil {
+		return fmt.Errorf("job %d is not interactive; start it with interactive=true to send it input", id)
+	}
+	select {
+	case <-jb.done:
+		return fmt.Errorf("job %d is not running", id)
+	default:
+	}
+	if _, err := io.WriteString(jb.pty, input); err != nil {
+		return fmt.Errorf("failed to send input to job %d: %w", id, err)
+	}
+	return nil
+}
+
+// Read waits for new output from job id: until it matches pattern (if not nil),
+// or the job exits, or timeout passes, or (without a pattern) the output settles.
+// It returns the output written since the previous Read, cleaned of terminal escape sequences,
+// and reports which of those happened: "matched", "exited", "timeout", or "settled".
+func (j *Jobs) Read(ctx context.Context, id int, pattern *regexp.Regexp, timeout time.Duration) (output, result string, err error) {
+	jb, err := j.get(id)
+	if err != nil {
+		return "", "", err
+	}
+	j.mu.Lock()
+	offset := jb.readOffset
+	j.mu.Unlock()
+	// Input sent just before Read may not have been processed yet, so give it time.
+	start := time.Now()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	var out []byte
+	for result == "" {
+		out, err = readFrom(jb.outFile, offset)
+		if err != nil {
+			return "", "", err
+		}
+		select {
+		case <-jb.done:
+			// done is closed after all output is written.
+			if out, err = readFrom(jb.outFile, offset); err != nil {
+				return "", "", err
+			}
+			result = "exited"
+			if pattern != nil && pattern.Match(out) {
+				result = "matched"
+			}
+			continue
+		default:
+		}
+		switch {
+		case pattern != nil && pattern.Match(out):
+			result = "matched"
+		case pattern == nil && jb.settled(start) && (len(out) > 0 || jb.waitingForInput()):
+			result = "settled"
+		default:
+			select {
+			case <-timer.C:
+				result = "timeout"
+			case <-ctx.Done():
+				return "", "", ctx.Err()
+			case <-ticker.C:
+			}
+		}
+	}
+
+	j.mu.Lock()
+	jb.readOffset = offset + int64(len(out))
+	j.mu.Unlock()
+	return formatForegroundBashOutput(cleanTerminalOutput(string(out))), result, nil
+}
+
+// readReport formats the result of Read for the agent.
+func (j *Jobs) readReport(id int, result, pattern string, timeout time.Duration, output string) string {
+	var what string
+	switch result {
+	case "matched":
+		what = fmt.Sprintf("Output matched %q.\n", pattern)
+	case "timeout":
+		what = fmt.Sprintf("Timed out after %s.\n", timeout)
+	}
+	if output == "" {
+		output = "[no new output]\n"
+	} else if !strings.HasSuffix(output, "\n") {
+		output += "\n"
+	}
+	return fmt.Sprintf("%s%s\n<output>\n%s</output>\n", what, j.statusLine(id), output)
+}
+
+// readFrom returns the contents of the file at path from offset on.
+func readFrom(path string, offset int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(f)
+}
+
+// settled reports whether jb's output has been quiet for interactiveSettle,
+// counting from since at the earliest.
+func (jb *job) settled(since time.Time) bool {
+	fi, err := os.Stat(jb.outFile)
+	if err != nil {
+		return false
+	}
+	if mtime := fi.ModTime(); mtime.After(since) {
+		since = mtime
+	}
+	return time.Since(since) >= interactiveSettle
+}
+
+// waitingForInput reports whether interactive job jb looks like it is waiting for input:
+// its foreground process is blocked reading from the terminal, or its output has settled
+// on an unfinished line, like a prompt.
+func (jb *job) waitingForInput() bool {
+	if jb.pty == nil {
+		return false
+	}
+	select {
+	case <-jb.done:
+		return false
+	default:
+	}
+	if pgrp := foregroundProcessGroup(jb.pty); pgrp > 0 && slices.ContainsFunc(processGroupMembers(pgrp), readingTerminal) {
+		return true
+	}
+	if !jb.settled(time.Time{}) {
+		return false
+	}
+	tail, err := tailFile(jb.outFile, 1)
+	return err == nil && strings.TrimSpace(cleanTerminalOutput(tail)) != "" && !strings.HasSuffix(tail, "\n")
+}
+
+// foregroundProcessGroup returns the foreground process group of the terminal
+// whose controlling side is ptmx, or 0 if it is unknown.
+func foregroundProcessGroup(ptmx *os.File) int {
+	conn, err := ptmx.SyscallConn()
+	if err != nil {
+		return 0
+	}
+	var pgrp int32
+	var errno syscall.Errno
+	conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgrp)))
+	})
+	if errno != 0 {
+		return 0
+	}
+	return int(pgrp)
+}
+
+// processGroupMembers lists the processes in process group pgrp.
+// It relies on /proc, so it is always empty outside Linux.
+func processGroupMembers(pgrp int) []int {
+	entries, _ := os.ReadDir("/proc")
+	var pids []int
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			continue
+		}
+		// pid (comm) state ppid pgrp ...; comm may contain spaces and parentheses.
+		rest := b[bytes.LastIndexByte(b, ')')+1:]
+		if fields := strings.Fields(string(rest)); len(fields) > 2 && fields[2] == strconv.Itoa(pgrp) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// readingTerminal reports whether process pid is blocked in a read from a terminal.
+// It relies on /proc, so it is always false outside Linux.
+func readingTerminal(pid int) bool {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/syscall", pid))
+	if err != nil {
+		return false
+	}
+	// The syscall number, followed by its arguments in hex.
+	fields := strings.Fields(string(b))
+	if len(fields) < 2 || fields[0] != strconv.Itoa(syscall.SYS_READ) {
+		return false
+	}
+	fd, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "0x"), 16, 32)
+	if err != nil {
+		return false
+	}
+	file, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", pid, fd))
+	return err == nil && (strings.HasPrefix(file, "/dev/pts/") || strings.HasPrefix(file, "/dev/tty"))
+}
+
+// terminalEscapes matches ANSI CSI and OSC sequences, and other two-character escapes.
+var terminalEscapes = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[=>@-Z\\-_]`)
+
+// cleanTerminalOutput strips escape sequences and carriage returns from terminal output.
+func cleanTerminalOutput(s string) string {
+	s = terminalEscapes.ReplaceAllString(s, "")
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
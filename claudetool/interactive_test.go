@@ -0,0 +1,91 @@
+package claudetool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// startInteractive runs command as an interactive job of jobs and returns the bash tool's output.
+func startInteractive(t *testing.T, jobs *Jobs, command string) string {
+	t.Helper()
+	bash := &BashTool{Jobs: jobs}
+	input, _ := json.Marshal(bashInput{Command: command, Interactive: true})
+	out := bash.Run(context.Background(), input)
+	if out.Error != nil {
+		t.Fatal(out.Error)
+	}
+	return out.LLMContent[0].Text
+}
+
+func TestInteractiveBash(t *testing.T) {
+	jobs := NewJobs()
+	got := startInteractive(t, jobs, `read -p "name? " name; echo "hello $name"; read -p "continue? " x; echo bye`)
+	for _, want := range []string{"<job_id>1</job_id>", "[job 1: running, waiting for input]", "<output>\nname? \n</output>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("start output doesn't contain %q:\n%s", want, got)
+		}
+	}
+	info := jobs.List()[0]
+	if !info.Interactive || !info.WaitingForInput {
+		t.Errorf("job info = %+v, want interactive and waiting for input", info)
+	}
+
+	got = runJobsTool(t, jobs, `{"action": "send", "id": 1, "input": "gopher\n"}`)
+	if !strings.Contains(got, "gopher\nhello gopher\ncontinue? ") || !strings.Contains(got, "waiting for input") {
+		t.Errorf("send output = %q", got)
+	}
+
+	got = runJobsTool(t, jobs, `{"action": "send", "id": 1, "input": "\n", "pattern": "bye"}`)
+	if !strings.HasPrefix(got, `Output matched "bye".`) {
+		t.Errorf("send with pattern = %q", got)
+	}
+	got += runJobsTool(t, jobs, `{"action": "read", "id": 1, "timeout": "10s"}`)
+	if !strings.Contains(got, "[job 1: exited, exit code 0]") || !strings.Contains(got, "[interactive process completed]") {
+		t.Errorf("output until exit = %q", got)
+	}
+	if out := jobs.Run(context.Background(), json.RawMessage(`{"action": "send", "id": 1, "input": "x"}`)); out.Error == nil {
+		t.Error("sending to an exited job succeeded")
+	}
+}
+
+func TestInteractiveEditor(t *testing.T) {
+	jobs := NewJobs()
+	got := startInteractive(t, jobs, `eval "$GIT_SEQUENCE_EDITOR todo.txt"; echo edited`)
+	if !strings.Contains(got, "Edit todo.txt now, then send a newline to continue.") || !strings.Contains(got, "waiting for input") {
+		t.Errorf("editor output = %q", got)
+	}
+	got = runJobsTool(t, jobs, `{"action": "send", "id": 1, "input": "\n", "pattern": "edited"}`)
+	if !strings.HasPrefix(got, `Output matched "edited".`) {
+		t.Errorf("send = %q", got)
+	}
+}
+
+func TestSendToBackgroundJob(t *testing.T) {
+	jobs := NewJobs()
+	id := startJob(t, jobs, "sleep 60")
+	defer jobs.Kill(id)
+	out := jobs.Run(context.Background(), json.RawMessage(fmt.Sprintf(`{"action": "send", "id": %d, "input": "x"}`, id)))
+	if out.Error == nil || !strings.Contains(out.Error.Error(), "not interactive") {
+		t.Errorf("send to background job: %v", out.Error)
+	}
+}
+
+func TestCleanTerminalOutput(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain\r\ntext\r\n", "plain\ntext\n"},
+		{"\x1b[1;32mgreen\x1b[0m", "green"},
+		{"\x1b]0;title\x07prompt> ", "prompt> "},
+		{"\x1b[?2004hbracketed\x1b[?2004l", "bracketed"},
+		{"\x1b=keypad\x1b>", "keypad"},
+	}
+	for _, tt := range tests {
+		if got := cleanTerminalOutput(tt.in); got != tt.want {
+			t.Errorf("cleanTerminalOutput(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
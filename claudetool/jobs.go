@@ -0,0 +1,485 @@
+package claudetool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"tailscale.com/portlist"
+
+	"sketch.dev/llm"
+)
+
+// Jobs is a registry of the background commands started by BashTool,
+// and the jobs tool that lets the agent manage them.
+type Jobs struct {
+	// ListPorts returns the open TCP ports, to find the ones each job listens on. May be nil.
+	ListPorts func() []portlist.Port
+
+	mu     sync.Mutex
+	jobs   []*job
+	nextID int
+}
+
+// job is a background command.
+type job struct {
+	id      int
+	command string
+	pid     int // also the process group ID
+	started time.Time
+	outFile string
+	pty     *os.File      // the controlling side of the job's terminal, for interactive jobs
+	done    chan struct{} // closed when the command exits
+
+	readOffset int64 // how much output Read has returned
+
+	// Set when done is closed.
+	finished time.Time
+	exitCode int
+	err      error
+	killed   bool
+}
+
+// JobInfo describes a background job.
+type JobInfo struct {
+	ID         int        `json:"id"`
+	Command    string     `json:"command"`
+	Pid        int        `json:"pid"`
+	Status     string     `json:"status"` // "running", "exited", "failed", or "killed"
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	Started    time.Time  `json:"started"`
+	Finished   *time.Time `json:"finished,omitempty"`
+	OutputFile string     `json:"output_file"`
+	Ports      []uint16   `json:"ports,omitempty"`
+	// Interactive jobs run on a terminal, and accept input.
+	Interactive     bool `json:"interactive,omitempty"`
+	WaitingForInput bool `json:"waiting_for_input,omitempty"`
+}
+
+// NewJobs returns an empty job registry.
+func NewJobs() *Jobs {
+	return &Jobs{nextID: 1}
+}
+
+// add registers a started command; exited must be called when it exits.
+// ptmx is the command's terminal, if it is interactive.
+func (j *Jobs) add(command string, pid int, outFile string, ptmx *os.File) *job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jb := &job{
+		id:      j.nextID,
+		command: command,
+		pid:     pid,
+		started: time.Now(),
+		outFile: outFile,
+		pty:     ptmx,
+		done:    make(chan struct{}),
+	}
+	j.nextID++
+	j.jobs = append(j.jobs, jb)
+	return jb
+}
+
+// exited records the result of a job's command.
+func (j *Jobs) exited(jb *job, err error) {
+	j.mu.Lock()
+	jb.finished = time.Now()
+	jb.err = err
+	jb.exitCode = 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		jb.exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		jb.exitCode = -1
+	}
+	j.mu.Unlock()
+	close(jb.done)
+}
+
+func (j *Jobs) get(id int) (*job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, jb := range j.jobs {
+		if jb.id == id {
+			return jb, nil
+		}
+	}
+	return nil, fmt.Errorf("no job %d", id)
+}
+
+// List describes all jobs, oldest first.
+func (j *Jobs) List() []JobInfo {
+	var ports []portlist.Port
+	if j.ListPorts != nil {
+		ports = j.ListPorts()
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	infos := make([]JobInfo, 0, len(j.jobs))
+	for _, jb := range j.jobs {
+		infos = append(infos, jb.infoLocked(ports))
+	}
+	return infos
+}
+
+func (jb *job) infoLocked(ports []portlist.Port) JobInfo {
+	info := JobInfo{
+		ID:         jb.id,
+		Command:    jb.command,
+		Pid:        jb.pid,
+		Status:     "running",
+		Started:    jb.started,
+		OutputFile: jb.outFile,
+
+		Interactive: jb.pty != nil,
+	}
+	select {
+	case <-jb.done:
+		finished, exitCode := jb.finished, jb.exitCode
+		info.Finished, info.ExitCode = &finished, &exitCode
+		switch {
+		case jb.killed:
+			info.Status = "killed"
+		case jb.err != nil:
+			info.Status = "failed"
+		default:
+			info.Status = "exited"
+		}
+		return info
+	default:
+	}
+	info.WaitingForInput = jb.waitingForInput()
+	// The command runs in its own process group, so anything listening
+	// in that group belongs to the job.
+	for _, p := range ports {
+		if pgid, err := syscall.Getpgid(p.Pid); err == nil && pgid == jb.pid && !slices.Contains(info.Ports, p.Port) {
+			info.Ports = append(info.Ports, p.Port)
+		}
+	}
+	return info
+}
+
+// Kill stops job id's process group, with SIGTERM and then, if needed, SIGKILL.
+func (j *Jobs) Kill(id int) error {
+	jb, err := j.get(id)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-jb.done:
+		return fmt.Errorf("job %d is not running", id)
+	default:
+	}
+	j.mu.Lock()
+	jb.killed = true
+	j.mu.Unlock()
+	syscall.Kill(-jb.pid, syscall.SIGTERM)
+	select {
+	case <-jb.done:
+	case <-time.After(5 * time.Second):
+		syscall.Kill(-jb.pid, syscall.SIGKILL)
+		<-jb.done
+	}
+	return nil
+}
+
+// Tail returns the last n lines of job id's output.
+func (j *Jobs) Tail(id, n int) (string, error) {
+	jb, err := j.get(id)
+	if err != nil {
+		return "", err
+	}
+	return tailFile(jb.outFile, n)
+}
+
+// tailFile returns the last n lines of the file at path, reading at most the last 64kB.
+func tailFile(path string, n int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	const maxTail = 64 << 10
+	if fi, err := f.Stat(); err == nil && fi.Size() > maxTail {
+		f.Seek(-maxTail, io.SeekEnd)
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return string(bytes.Join(lines, nil)), nil
+}
+
+// waitTail is how much of the output already scanned Wait scans again with new output,
+// so that it finds matches split across reads.
+const waitTail = 4 << 10
+
+// Wait waits until job id's output matches pattern (if not nil), or the job exits,
+// or timeout passes. It reports which of those happened: "matched", "exited", or "timeout".
+func (j *Jobs) Wait(ctx context.Context, id int, pattern *regexp.Regexp, timeout time.Duration) (string, error) {
+	jb, err := j.get(id)
+	if err != nil {
+		return "", err
+	}
+	// Only the output written since the last check is scanned, after the tail of what came before.
+	var (
+		offset int64
+		tail   []byte
+	)
+	matches := func() (bool, error) {
+		out, err := readFrom(jb.outFile, offset)
+		if err != nil {
+			return false, err
+		}
+		offset += int64(len(out))
+		buf := append(tail, out...)
+		if pattern.Match(buf) {
+			return true, nil
+		}
+		tail = slices.Clone(buf[max(0, len(buf)-waitTail):])
+		return false, nil
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if pattern != nil {
+			if ok, err := matches(); err != nil {
+				return "", err
+			} else if ok {
+				return "matched", nil
+			}
+		}
+		select {
+		case <-jb.done:
+			if pattern != nil {
+				// Look once more: the output may have been written just before exiting.
+				if ok, err := matches(); err == nil && ok {
+					return "matched", nil
+				}
+			}
+			return "exited", nil
+		case <-timer.C:
+			return "timeout", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tool returns the jobs tool, which manages j's jobs.
+func (j *Jobs) Tool() *llm.Tool {
+	return &llm.Tool{
+		Name:        jobsName,
+		Description: strings.TrimSpace(jobsDescription),
+		InputSchema: llm.MustSchema(jobsInputSchema),
+		Run:         j.Run,
+	}
+}
+
+const (
+	jobsName        = "jobs"
+	jobsDescription = `
+Manages background commands started by the bash tool with background=true or interactive=true.
+
+Actions:
+- list: show all jobs, with status, exit code, output file, and the ports they listen on
+- tail: show the last lines of a job's output
+- wait: wait until a job's output matches a regular expression, or the job exits, or the timeout passes; then show the last lines of output.
+  Use this to wait for a server to be ready, e.g. pattern "listening on" with a 30s timeout.
+- send: type input into an interactive job's terminal, then show its new output once it settles, e.g. at the next prompt.
+  Include \n to press Enter. Control characters work too, e.g. \u0003 for Ctrl-C and \u0004 for Ctrl-D.
+- read: show a job's output since the last send or read, once it settles or matches pattern
+- kill: stop a job and everything it started
+
+Kill servers you started when you no longer need them.
+`
+	// If you modify this, update the termui template for prettier rendering.
+	jobsInputSchema = `
+{
+  "type": "object",
+  "required": ["action"],
+  "properties": {
+    "action": {
+      "type": "string",
+      "enum": ["list", "tail", "wait", "send", "read", "kill"]
+    },
+    "id": {
+      "type": "integer",
+      "description": "Job ID, for all actions but list"
+    },
+    "input": {
+      "type": "string",
+      "description": "For send: the text to type"
+    },
+    "lines": {
+      "type": "integer",
+      "description": "Number of output lines to show (default 50)"
+    },
+    "pattern": {
+      "type": "string",
+      "description": "For wait, send and read: Go regular expression to wait for in the output"
+    },
+    "timeout": {
+      "type": "string",
+      "description": "For wait, send and read: how long to wait, as a Go duration (default 30s, max 10m)"
+    }
+  }
+}
+`
+)
+
+type jobsInput struct {
+	Action  string `json:"action"`
+	ID      int    `json:"id,omitempty"`
+	Input   string `json:"input,omitempty"`
+	Lines   int    `json:"lines,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+const maxJobsWait = 10 * time.Minute
+
+// Run implements the jobs tool.
+func (j *Jobs) Run(ctx context.Context, m json.RawMessage) llm.ToolOut {
+	var req jobsInput
+	if err := json.Unmarshal(m, &req); err != nil {
+		return llm.ErrorfToolOut("failed to unmarshal jobs input: %w", err)
+	}
+	if req.Lines <= 0 {
+		req.Lines = 50
+	}
+
+	switch req.Action {
+	case "list":
+		infos := j.List()
+		if len(infos) == 0 {
+			return llm.ToolOut{LLMContent: llm.TextContent("No background jobs.")}
+		}
+		buf := new(strings.Builder)
+		for _, info := range infos {
+			fmt.Fprintf(buf, "<job id=\"%d\" pid=\"%d\" status=\"%s\"", info.ID, info.Pid, info.Status)
+			if info.ExitCode != nil {
+				fmt.Fprintf(buf, " exit_code=\"%d\"", *info.ExitCode)
+			}
+			fmt.Fprintf(buf, " started=\"%s\"", info.Started.Format(time.RFC3339))
+			if len(info.Ports) > 0 {
+				ports := make([]string, len(info.Ports))
+				for i, p := range info.Ports {
+					ports[i] = fmt.Sprint(p)
+				}
+				fmt.Fprintf(buf, " ports=\"%s\"", strings.Join(ports, ","))
+			}
+			fmt.Fprintf(buf, ">\n<command>%s</command>\n<output_file>%s</output_file>\n</job>\n", info.Command, info.OutputFile)
+		}
+		return llm.ToolOut{LLMContent: llm.TextContent(buf.String())}
+
+	case "tail":
+		out, err := j.Tail(req.ID, req.Lines)
+		if err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		return llm.ToolOut{LLMContent: llm.TextContent(j.statusLine(req.ID) + "\n" + out)}
+
+	case "wait":
+		pattern, timeout, err := req.waitParams()
+		if err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		result, err := j.Wait(ctx, req.ID, pattern, timeout)
+		if err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		out, err := j.Tail(req.ID, req.Lines)
+		if err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		var what string
+		switch result {
+		case "matched":
+			what = fmt.Sprintf("Output matched %q.", req.Pattern)
+		case "exited":
+			what = "Job exited."
+		case "timeout":
+			what = fmt.Sprintf("Timed out after %s.", timeout)
+		}
+		return llm.ToolOut{LLMContent: llm.TextContent(what + "\n" + j.statusLine(req.ID) + "\n" + out)}
+
+	case "send", "read":
+		pattern, timeout, err := req.waitParams()
+		if err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		if req.Action == "send" {
+			if err := j.Send(req.ID, req.Input); err != nil {
+				return llm.ErrorToolOut(err)
+			}
+		}
+		out, result, err := j.Read(ctx, req.ID, pattern, timeout)
+		if err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		return llm.ToolOut{LLMContent: llm.TextContent(j.readReport(req.ID, result, req.Pattern, timeout, out))}
+
+	case "kill":
+		if err := j.Kill(req.ID); err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		return llm.ToolOut{LLMContent: llm.TextContent(j.statusLine(req.ID))}
+	}
+	return llm.ErrorfToolOut("unknown action %q", req.Action)
+}
+
+// waitParams parses the pattern and timeout of a wait, send or read.
+func (req *jobsInput) waitParams() (pattern *regexp.Regexp, timeout time.Duration, err error) {
+	if req.Pattern != "" {
+		if pattern, err = regexp.Compile(req.Pattern); err != nil {
+			return nil, 0, fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	timeout = 30 * time.Second
+	if req.Timeout != "" {
+		if timeout, err = time.ParseDuration(req.Timeout); err != nil {
+			return nil, 0, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+	return pattern, min(timeout, maxJobsWait), nil
+}
+
+// statusLine is a one-line summary of job id, for tool output.
+func (j *Jobs) statusLine(id int) string {
+	for _, info := range j.List() {
+		if info.ID != id {
+			continue
+		}
+		line := fmt.Sprintf("[job %d: %s", info.ID, info.Status)
+		if info.ExitCode != nil {
+			line += fmt.Sprintf(", exit code %d", *info.ExitCode)
+		}
+		if info.WaitingForInput {
+			line += ", waiting for input"
+		}
+		return line + "]"
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package claudetool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/portlist"
+)
+
+// startJob runs command as a background job of jobs and returns its ID.
+func startJob(t *testing.T, jobs *Jobs, command string) int {
+	t.Helper()
+	bash := &BashTool{Jobs: jobs}
+	input, _ := json.Marshal(bashInput{Command: command, Background: true})
+	out := bash.Run(context.Background(), input)
+	if out.Error != nil {
+		t.Fatal(out.Error)
+	}
+	text := out.LLMContent[0].Text
+	if !strings.Contains(text, "<job_id>") || !strings.Contains(text, "jobs tool") {
+		t.Errorf("background result doesn't mention the job: %s", text)
+	}
+	infos := jobs.List()
+	return infos[len(infos)-1].ID
+}
+
+func runJobsTool(t *testing.T, jobs *Jobs, input string) string {
+	t.Helper()
+	out := jobs.Run(context.Background(), json.RawMessage(input))
+	if out.Error != nil {
+		t.Fatalf("jobs %s: %v", input, out.Error)
+	}
+	return out.LLMContent[0].Text
+}
+
+func TestJobs(t *testing.T) {
+	jobs := NewJobs()
+	if got := runJobsTool(t, jobs, `{"action": "list"}`); got != "No background jobs." {
+		t.Errorf("empty list = %q", got)
+	}
+
+	server := startJob(t, jobs, "for i in $(seq 1 100); do echo line $i; done; echo 'ready on :1234'; sleep 60")
+	failing := startJob(t, jobs, "echo oops; exit 3")
+
+	got := runJobsTool(t, jobs, fmt.Sprintf(`{"action": "wait", "id": %d, "pattern": "ready on :\\d+", "timeout": "10s"}`, server))
+	if !strings.HasPrefix(got, `Output matched "ready on :\\d+".`) || !strings.Contains(got, "[job 1: running]") {
+		t.Errorf("wait for pattern = %q", got)
+	}
+	got = runJobsTool(t, jobs, fmt.Sprintf(`{"action": "tail", "id": %d, "lines": 2}`, server))
+	if want := "[job 1: running]\nline 100\nready on :1234\n"; got != want {
+		t.Errorf("tail = %q, want %q", got, want)
+	}
+
+	got = runJobsTool(t, jobs, fmt.Sprintf(`{"action": "wait", "id": %d, "timeout": "10s"}`, failing))
+	if !strings.HasPrefix(got, "Job exited.\n[job 2: failed, exit code 3]\noops\n") {
+		t.Errorf("wait for exit = %q", got)
+	}
+
+	start := time.Now()
+	got = runJobsTool(t, jobs, fmt.Sprintf(`{"action": "wait", "id": %d, "pattern": "never", "timeout": "300ms"}`, server))
+	if !strings.HasPrefix(got, "Timed out after 300ms.") || time.Since(start) > 5*time.Second {
+		t.Errorf("wait with timeout = %q after %v", got, time.Since(start))
+	}
+
+	if got := runJobsTool(t, jobs, fmt.Sprintf(`{"action": "kill", "id": %d}`, server)); got != "[job 1: killed, exit code -1]" {
+		t.Errorf("kill = %q", got)
+	}
+	if out := jobs.Run(context.Background(), json.RawMessage(`{"action": "kill", "id": 1}`)); out.Error == nil {
+		t.Error("killing a job twice succeeded")
+	}
+	if out := jobs.Run(context.Background(), json.RawMessage(`{"action": "tail", "id": 99}`)); out.Error == nil {
+		t.Error("tailing an unknown job succeeded")
+	}
+
+	got = runJobsTool(t, jobs, `{"action": "list"}`)
+	for _, want := range []string{`<job id="1"`, `status="killed"`, `<job id="2"`, `exit_code="3"`, "<command>echo oops; exit 3</command>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("list doesn't contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestJobsWaitSplitOutput(t *testing.T) {
+	jobs := NewJobs()
+	// The match is written in two parts, which Wait reads separately.
+	id := startJob(t, jobs, "printf 'starting\\nrea'; sleep 1; echo 'dy on :1234'; sleep 60")
+	defer jobs.Kill(id)
+	state, err := jobs.Wait(context.Background(), id, regexp.MustCompile(`ready on :\d+`), 10*time.Second)
+	if err != nil || state != "matched" {
+		t.Errorf("Wait() = %q, %v; want matched", state, err)
+	}
+}
+
+func TestJobsPorts(t *testing.T) {
+	jobs := NewJobs()
+	id := startJob(t, jobs, "sleep 60")
+	defer jobs.Kill(id)
+	info := jobs.List()[0]
+	// Pretend the job's shell is listening on port 3000, and pid 1, which is not in the job, on 3001.
+	jobs.ListPorts = func() []portlist.Port {
+		return []portlist.Port{
+			{Proto: "tcp", Port: 3000, Pid: info.Pid},
+			{Proto: "tcp", Port: 3001, Pid: 1},
+		}
+	}
+	if got := jobs.List()[0].Ports; len(got) != 1 || got[0] != 3000 {
+		t.Errorf("job ports = %v, want [3000]", got)
+	}
+}
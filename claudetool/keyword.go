@@ -141,7 +141,7 @@ func keywordRun(ctx context.Context, m json.RawMessage) llm.ToolOut {
 		},
 	}
 
-	resp, err := convo.SendMessage(initialMessage)
+	resp, err := convo.SendMessageContext(ctx, initialMessage)
 	if err != nil {
 		return llm.ErrorfToolOut("failed to send relevance filtering message: %w", err)
 	}
@@ -17,6 +17,7 @@ import (
 	"sketch.dev/claudetool/editbuf"
 	"sketch.dev/claudetool/patchkit"
 	"sketch.dev/llm"
+	"sketch.dev/secrets"
 )
 
 // PatchCallback defines the signature for patch tool callbacks.
@@ -528,6 +529,9 @@ func (p *PatchTool) patchRun(ctx context.Context, input *PatchInput) llm.ToolOut
 	if autogenerated {
 		fmt.Fprintf(response, "<warning>%q appears to be autogenerated. Patches were applied anyway.</warning>\n", input.Path)
 	}
+	for _, f := range addedSecrets(string(orig), string(patched)) {
+		fmt.Fprintf(response, "<warning>line %d of %q appears to contain a %s. Don't commit credentials: load them from the environment or a file outside the repo instead. If it isn't really secret, add %q in a comment on the line.</warning>\n", f.Line, input.Path, f.Kind, secrets.AllowMarker)
+	}
 
 	diff := generateUnifiedDiff(input.Path, string(orig), string(patched))
 
@@ -538,6 +542,17 @@ func (p *PatchTool) patchRun(ctx context.Context, input *PatchInput) llm.ToolOut
 	}
 }
 
+// addedSecrets returns the secrets in patched that aren't in orig.
+func addedSecrets(orig, patched string) []secrets.Finding {
+	var added []secrets.Finding
+	for _, f := range secrets.Scan(patched) {
+		if !strings.Contains(orig, patched[f.Start:f.End]) {
+			added = append(added, f)
+		}
+	}
+	return added
+}
+
 // IsAutogeneratedGoFile reports whether a Go file has markers indicating it was autogenerated.
 func IsAutogeneratedGoFile(buf []byte) bool {
 	for _, sig := range autogeneratedSignals {
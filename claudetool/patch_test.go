@@ -396,6 +396,40 @@ func TestPatchTool_AutogeneratedDetection(t *testing.T) {
 	}
 }
 
+func TestPatchTool_SecretDetection(t *testing.T) {
+	tempDir := t.TempDir()
+	patch := &PatchTool{Pwd: tempDir}
+	ctx := context.Background()
+
+	key := "AKIA" + "Z7QPHN4KXM2JDW5V" // split so that this file doesn't contain a key
+	input := PatchInput{
+		Path: filepath.Join(tempDir, "config.go"),
+		Patches: []PatchRequest{{
+			Operation: "overwrite",
+			NewText:   "package config\n\nconst key = \"" + key + "\"\n",
+		}},
+	}
+	msg, _ := json.Marshal(input)
+	result := patch.Run(ctx, msg)
+	if result.Error != nil {
+		t.Fatalf("patch failed: %v", result.Error)
+	}
+	if !strings.Contains(result.LLMContent[0].Text, "line 3 of") || !strings.Contains(result.LLMContent[0].Text, "AWS access key ID") {
+		t.Errorf("expected a warning about the key, got %q", result.LLMContent[0].Text)
+	}
+
+	// Later edits to the file don't repeat the warning.
+	input.Patches = []PatchRequest{{Operation: "append_eof", NewText: "const region = \"us-east-1\"\n"}}
+	msg, _ = json.Marshal(input)
+	result = patch.Run(ctx, msg)
+	if result.Error != nil {
+		t.Fatalf("patch failed: %v", result.Error)
+	}
+	if strings.Contains(result.LLMContent[0].Text, "warning") {
+		t.Errorf("unexpected warning: %q", result.LLMContent[0].Text)
+	}
+}
+
 func TestPatchTool_MultiplePatches(t *testing.T) {
 	tempDir := t.TempDir()
 	patch := &PatchTool{Pwd: tempDir}
@@ -12,6 +12,7 @@ import (
 	"os"
 
 	"go.skia.org/infra/go/go2ts"
+	"sketch.dev/claudetool/codereview"
 	"sketch.dev/git_tools"
 	"sketch.dev/llm"
 	"sketch.dev/loop"
@@ -69,6 +70,7 @@ func TS() *go2ts.Go2TS {
 		server.GitPushResponse{},
 		git_tools.DiffFile{},
 		git_tools.GitLogEntry{},
+		codereview.Report{},
 	)
 
 	generator.GenerateNominalTypes = true
@@ -0,0 +1,32 @@
+// A command line tool for generating the OpenAPI document
+// describing sketch's /api/v1 HTTP API.
+//
+// Example:
+//
+//	go run ./cmd/openapi -o docs/openapi.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"sketch.dev/loop/server"
+)
+
+func main() {
+	outputPath := flag.String("o", "", "Path to the output JSON file.")
+	flag.Parse()
+
+	b, err := json.MarshalIndent(server.OpenAPI(), "", "  ")
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+	b = append(b, '\n')
+	if err := os.WriteFile(*outputPath, b, 0o644); err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -11,12 +11,14 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
@@ -24,6 +26,7 @@ import (
 	"golang.org/x/term"
 	"sketch.dev/browser"
 	"sketch.dev/claudetool"
+	"sketch.dev/claudetool/codereview"
 	"sketch.dev/dockerimg"
 	"sketch.dev/experiment"
 	"sketch.dev/llm"
@@ -34,6 +37,8 @@ import (
 	"sketch.dev/loop"
 	"sketch.dev/loop/server"
 	"sketch.dev/mcp"
+	"sketch.dev/notify"
+	"sketch.dev/prompthistory"
 	"sketch.dev/skabandclient"
 	"sketch.dev/skribe"
 	"sketch.dev/termui"
@@ -90,6 +95,11 @@ func main() {
 func run() error {
 	flagArgs := parseCLIFlags()
 
+	// Run by the pre-receive hook of the outtie's git server, so don't print anything else.
+	if flagArgs.checkPushSecrets {
+		return dockerimg.CheckPushSecrets(context.Background(), os.Stdin, os.Stderr)
+	}
+
 	// If not built with make, embedded assets will be missing.
 	if builtBy == "" {
 		// If your sketch binary isn't working and you are seeing this warning,
@@ -186,6 +196,47 @@ func run() error {
 	// Detect whether we're inside the sketch container
 	inInsideSketch := flagArgs.outsideHostname != ""
 
+	// Configure tracing. Inside the container, a collector on the host's localhost
+	// is reachable via host.docker.internal.
+	otelEndpoint := flagArgs.otelEndpoint
+	if inInsideSketch && otelEndpoint != "" {
+		otelEndpoint, err = skribe.OTLPTracesURL(otelEndpoint)
+		if err != nil {
+			return err
+		}
+		otelEndpoint, err = skabandclient.LocalhostToDockerInternal(otelEndpoint)
+		if err != nil {
+			return err
+		}
+	}
+	shutdownTracing, err := skribe.SetupTracing(ctx, skribe.TracingConfig{
+		Endpoint:    otelEndpoint,
+		ServiceName: "sketch",
+		SessionID:   flagArgs.sessionID,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			slog.WarnContext(ctx, "failed to flush traces", "err", err)
+		}
+	}()
+
+	// Resolve the findings path and cache dir before any chdir, so that they're relative to where sketch was run.
+	if flagArgs.reviewFindings != "" && !inInsideSketch {
+		if flagArgs.reviewFindings, err = filepath.Abs(flagArgs.reviewFindings); err != nil {
+			return fmt.Errorf("sketch: invalid -review-findings path: %w", err)
+		}
+	}
+	if flagArgs.reviewCacheDir != "" && flagArgs.reviewCacheDir != "none" && !inInsideSketch {
+		if flagArgs.reviewCacheDir, err = filepath.Abs(flagArgs.reviewCacheDir); err != nil {
+			return fmt.Errorf("sketch: invalid -review-cache-dir path: %w", err)
+		}
+	}
+
 	// Change to working directory if specified
 	// Delay chdir when running in container mode, so that container setup can happen first,
 	// which might be necessary for the requested working dir to exist.
@@ -277,29 +328,32 @@ func (f *StringSliceFlag) Get() any {
 }
 
 type CLIFlags struct {
-	addr          string
-	skabandAddr   string
-	unsafe        bool
-	openBrowser   bool
-	httprrFile    string
-	maxDollars    float64
-	oneShot       bool
-	prompt        string
-	modelName     string
-	llmAPIKey     string
-	listModels    bool
-	verbose       bool
-	version       bool
-	workingDir    string
-	dumpDist      string
-	sshPort       int
-	forceRebuild  bool
-	baseImage     string
-	linkToGitHub  bool
-	ignoreSig     bool
-	doUpdate      bool
-	checkVersion  bool
-	fetchOnLaunch bool
+	addr             string
+	skabandAddr      string
+	unsafe           bool
+	openBrowser      bool
+	httprrFile       string
+	maxDollars       float64
+	oneShot          bool
+	prompt           string
+	modelName        string
+	llmAPIKey        string
+	listModels       bool
+	verbose          bool
+	version          bool
+	workingDir       string
+	dumpDist         string
+	checkPushSecrets bool
+	sshPort          int
+	forwardPorts     string
+	forwardPortsDeny string
+	forceRebuild     bool
+	baseImage        string
+	linkToGitHub     bool
+	ignoreSig        bool
+	doUpdate         bool
+	checkVersion     bool
+	fetchOnLaunch    bool
 
 	gitUsername         string
 	gitEmail            string
@@ -315,6 +369,7 @@ type CLIFlags struct {
 	dockerArgs          string
 	mounts              StringSliceFlag
 	termUI              bool
+	fullScreen          bool
 	gitRemoteURL        string
 	originalGitOrigin   string
 	upstream            string
@@ -331,6 +386,17 @@ type CLIFlags struct {
 	passthroughUpstream   bool
 	// LLM debugging
 	dumpLLM bool
+	// OTLP/HTTP endpoint for exporting traces
+	otelEndpoint string
+	// Notification sinks and the events that trigger them
+	notify   StringSliceFlag
+	notifyOn string
+	// Auth tokens for the HTTP server, as secret or secret:scope,...
+	authTokens StringSliceFlag
+	// Where to write code review findings after each review
+	reviewFindings string
+	// Where to keep code review baselines across sessions
+	reviewCacheDir string
 }
 
 // parseCLIFlags parses all command-line flags and returns a CLIFlags struct
@@ -360,6 +426,8 @@ func parseCLIFlags() CLIFlags {
 	userFlags.BoolVar(&flags.checkVersion, "version-check", true, "do version upgrade check (please leave this on)")
 	userFlags.BoolVar(&flags.fetchOnLaunch, "fetch-on-launch", true, "do a git fetch when sketch starts")
 	userFlags.IntVar(&flags.sshPort, "ssh-port", 0, "the host port number that the container's ssh server will listen on, or a randomly chosen port if this value is 0")
+	userFlags.StringVar(&flags.forwardPorts, "forward-ports", "none", "container ports to forward to the same (or, if taken, another) localhost port on the host when they open, e.g. 3000,8000-8999 or 1024-65535 for all but system ports")
+	userFlags.StringVar(&flags.forwardPortsDeny, "forward-ports-deny", "", "container ports never to forward, in the same format as -forward-ports")
 	userFlags.BoolVar(&flags.forceRebuild, "force-rebuild-container", false, "rebuild Docker container")
 	userFlags.BoolVar(&flags.forceRebuild, "rebuild", false, "rebuild Docker container (alias for -force-rebuild-container)")
 	// Get the default image info for help text
@@ -370,12 +438,19 @@ func parseCLIFlags() CLIFlags {
 	userFlags.StringVar(&flags.dockerArgs, "docker-args", "", "additional arguments to pass to the docker create command (e.g., --memory=2g --cpus=2)")
 	userFlags.Var(&flags.mounts, "mount", "volume to mount in the container in format /path/on/host:/path/in/container (can be repeated)")
 	userFlags.BoolVar(&flags.termUI, "termui", true, "enable terminal UI")
+	userFlags.BoolVar(&flags.fullScreen, "fullscreen", false, "use a full-screen terminal UI with timeline, tool detail and diff panes instead of the line-based one")
 	userFlags.StringVar(&flags.branchPrefix, "branch-prefix", "sketch/", "prefix for git branches created by sketch")
 	userFlags.BoolVar(&flags.ignoreSig, "ignoresig", false, "ignore typical termination signals (SIGINT, SIGTERM)")
 	userFlags.Var(&flags.mcpServers, "mcp", "MCP server configuration as JSON (can be repeated). Schema: {\"name\": \"server-name\", \"type\": \"stdio|http|sse\", \"url\": \"...\", \"command\": \"...\", \"args\": [...], \"env\": {...}, \"headers\": {...}}")
 	userFlags.StringVar(&flags.bashFastTimeout, "bash-fast-timeout", "30s", "timeout for fast bash commands")
 	userFlags.StringVar(&flags.bashSlowTimeout, "bash-slow-timeout", "10m", "timeout for slow bash commands (downloads, builds, tests)")
 	userFlags.StringVar(&flags.bashBackgroundTimeout, "bash-background-timeout", "24h", "timeout for background bash commands")
+	userFlags.Var(&flags.notify, "notify", "send notifications about agent events to a sink: webhook:<url>, slack:<url>, or desktop (can be repeated)")
+	userFlags.StringVar(&flags.notifyOn, "notify-on", "all", "comma-separated events that trigger -notify notifications: end_of_turn, question, error, budget, commit, or all")
+	userFlags.Var(&flags.authTokens, "auth-token", "require this token to use the web UI and HTTP API: <secret> for full access, or <secret>:<scopes> with comma-separated scopes view, chat, terminal, git-write, admin (can be repeated; $SKETCH_AUTH_TOKENS adds space-separated tokens)")
+	userFlags.StringVar(&flags.reviewFindings, "review-findings", "", "write code review findings to this file after each review: SARIF if it ends in .sarif, JSON otherwise")
+	userFlags.StringVar(&flags.reviewCacheDir, "review-cache-dir", "", "directory in which code review keeps the results of checks on the initial commit, for reuse across sessions (default $SKETCH_CODEREVIEW_CACHE, the user cache dir, or in a container, a docker volume for the repo); \"none\" disables the cache")
+	userFlags.StringVar(&flags.otelEndpoint, "otel-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OpenTelemetry OTLP/HTTP collector endpoint for traces (e.g. http://localhost:4318); defaults to $OTEL_EXPORTER_OTLP_ENDPOINT")
 
 	// Internal flags (for sketch developers or internal use)
 	// Args to sketch innie:
@@ -406,6 +481,7 @@ func parseCLIFlags() CLIFlags {
 
 	// Internal flags for development/debugging
 	internalFlags.StringVar(&flags.dumpDist, "dump-dist", "", "(internal) dump embedded /dist/ filesystem to specified directory and exit")
+	internalFlags.BoolVar(&flags.checkPushSecrets, "check-push-secrets", false, "(internal) check the ref updates on stdin, from a git pre-receive hook, for secrets and exit")
 	internalFlags.StringVar(&flags.subtraceToken, "subtrace-token", "", "(development) run sketch under subtrace.dev with the provided token")
 	internalFlags.BoolVar(&flags.dumpLLM, "dump-llm", false, "(debugging) dump raw communications with LLM services to files in ~/.cache/sketch/")
 
@@ -503,6 +579,81 @@ func skabandMcpConfiguration(flags CLIFlags) string {
 	return string(out)
 }
 
+// terminalUI is implemented by termui.TermUI and termui.FullScreen.
+type terminalUI interface {
+	Run(ctx context.Context) error
+	RestoreOldState() error
+	AppendSystemMessage(fmtString string, args ...any)
+}
+
+// authTokenSpecs returns the -auth-token flags and the tokens in $SKETCH_AUTH_TOKENS.
+func authTokenSpecs(flags CLIFlags) []string {
+	return append(slices.Clone(flags.authTokens), strings.Fields(os.Getenv("SKETCH_AUTH_TOKENS"))...)
+}
+
+// reviewCacheDir returns the code review cache directory for the -review-cache-dir flag value.
+func reviewCacheDir(flag string) string {
+	switch flag {
+	case "none":
+		return ""
+	case "":
+		return codereview.DefaultCacheDir()
+	}
+	return flag
+}
+
+// setupAuthTokens parses the auth token specifications.
+// It returns nil if authentication is not required.
+func setupAuthTokens(flags CLIFlags) ([]server.Token, error) {
+	var tokens []server.Token
+	for _, spec := range authTokenSpecs(flags) {
+		tok, err := server.ParseToken(spec)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+	}
+	return tokens, nil
+}
+
+// withToken adds the first of tokens to the sketch web UI URL u, so that opening it logs the browser in.
+func withToken(u string, tokens []server.Token) string {
+	if u == "" || len(tokens) == 0 {
+		return u
+	}
+	return strings.TrimSuffix(u, "/") + "/?token=" + url.QueryEscape(tokens[0].Secret)
+}
+
+// setupNotifier creates a notifier from the -notify and -notify-on flags.
+// It returns nil if no sinks are configured.
+func setupNotifier(flags CLIFlags, inInsideSketch bool) (*notify.Notifier, error) {
+	kinds, err := notify.ParseKinds(flags.notifyOn)
+	if err != nil {
+		return nil, err
+	}
+	var sinks []notify.Sink
+	for _, spec := range flags.notify {
+		sink, err := notify.ParseSink(spec, flags.outsideHTTP)
+		if err != nil {
+			return nil, err
+		}
+		if inInsideSketch {
+			// Webhooks listening on the host's localhost are reachable via host.docker.internal.
+			switch sink := sink.(type) {
+			case *notify.Webhook:
+				sink.URL, err = skabandclient.LocalhostToDockerInternal(sink.URL)
+			case *notify.Slack:
+				sink.URL, err = skabandclient.LocalhostToDockerInternal(sink.URL)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		sinks = append(sinks, sink)
+	}
+	return notify.New(sinks, kinds), nil
+}
+
 // runAsOuttie handles execution on the host machine, which typically involves
 // checking host requirements and launching a Docker container.
 func runAsOuttie(ctx context.Context, flags CLIFlags) error {
@@ -535,6 +686,11 @@ func runAsOuttie(ctx context.Context, flags CLIFlags) error {
 		return fmt.Errorf("sketch: cannot resolve working directory symlinks: %v", err)
 	}
 
+	// Check the auth tokens here; the container would fail to start with bad ones.
+	if _, err := setupAuthTokens(flags); err != nil {
+		return err
+	}
+
 	// Configure and launch the container
 	config := dockerimg.ContainerConfig{
 		SessionID:         flags.sessionID,
@@ -566,6 +722,7 @@ func runAsOuttie(ctx context.Context, flags CLIFlags) error {
 		Mounts:              flags.mounts,
 		ExperimentFlag:      flags.experimentFlag.String(),
 		TermUI:              flags.termUI,
+		FullScreen:          flags.fullScreen,
 		MaxDollars:          flags.maxDollars,
 		BranchPrefix:        flags.branchPrefix,
 		LinkToGitHub:        flags.linkToGitHub,
@@ -574,6 +731,14 @@ func runAsOuttie(ctx context.Context, flags CLIFlags) error {
 		PassthroughUpstream: flags.passthroughUpstream,
 		DumpLLM:             flags.dumpLLM,
 		FetchOnLaunch:       flags.fetchOnLaunch,
+		OTelEndpoint:        flags.otelEndpoint,
+		ReviewFindings:      flags.reviewFindings,
+		ReviewCacheDir:      flags.reviewCacheDir,
+		Notify:              flags.notify,
+		NotifyOn:            flags.notifyOn,
+		AuthTokens:          authTokenSpecs(flags),
+		ForwardPorts:        flags.forwardPorts,
+		ForwardPortsDeny:    flags.forwardPortsDeny,
 	}
 
 	if err := dockerimg.LaunchContainer(ctx, config); err != nil {
@@ -724,6 +889,8 @@ func setupAndRunAgent(ctx context.Context, flags CLIFlags, spec modelSpec, pubKe
 		MCPServers:          flags.mcpServers,
 		PassthroughUpstream: flags.passthroughUpstream,
 		FetchOnLaunch:       flags.fetchOnLaunch,
+		ReviewReportPath:    flags.reviewFindings,
+		ReviewCacheDir:      reviewCacheDir(flags.reviewCacheDir),
 	}
 
 	// Parse timeout configuration
@@ -745,6 +912,12 @@ func setupAndRunAgent(ctx context.Context, flags CLIFlags, spec modelSpec, pubKe
 	}
 	agentConfig.BashTimeouts = &bashTimeouts
 
+	notifier, err := setupNotifier(flags, inInsideSketch)
+	if err != nil {
+		return err
+	}
+	agentConfig.Notifier = notifier
+
 	// Create SkabandClient if skaband address is provided
 	if flags.skabandAddr != "" && pubKey != "" {
 		agentConfig.SkabandClient = skabandclient.NewSkabandClient(flags.skabandAddr, pubKey)
@@ -756,6 +929,13 @@ func setupAndRunAgent(ctx context.Context, flags CLIFlags, spec modelSpec, pubKe
 	if err != nil {
 		return err
 	}
+	authTokens, err := setupAuthTokens(flags)
+	if err != nil {
+		return err
+	}
+	srv.SetTokens(authTokens)
+	// Don't leak the tokens to the agent's tools.
+	os.Unsetenv("SKETCH_AUTH_TOKENS")
 
 	// Initialize the agent (only needed when not inside sketch with outside hostname)
 	// In the innie case, outtie sends a POST /init
@@ -791,6 +971,9 @@ func setupAndRunAgent(ctx context.Context, flags CLIFlags, spec modelSpec, pubKe
 			ps1URL = agent.URL()
 		}
 	}
+	if flags.skabandAddr == "" {
+		ps1URL = withToken(ps1URL, authTokens)
+	}
 
 	// Use prompt if provided
 	if flags.prompt != "" {
@@ -821,9 +1004,13 @@ func setupAndRunAgent(ctx context.Context, flags CLIFlags, spec modelSpec, pubKe
 		// Version check hasn't responded yet, or never ran, or hit an error. Continue without it.
 	}
 
-	var s *termui.TermUI
-	if flags.termUI {
-		s = termui.New(agent, ps1URL)
+	var s terminalUI
+	if flags.termUI && flags.fullScreen {
+		s = termui.NewFullScreen(agent, ps1URL)
+	} else if flags.termUI {
+		ui := termui.New(agent, ps1URL)
+		ui.SetHistory(termui.NewHistory(historyStore(flags, agent.RepoRoot())))
+		s = ui
 	}
 
 	// Start skaband connection loop if needed
@@ -1218,3 +1405,17 @@ func findZombieProcesses() map[int]bool {
 
 	return zombies
 }
+
+// historyStore returns where termui keeps the prompt history.
+// Inside a container, the history lives with the outtie, so that it outlives the container.
+func historyStore(flags CLIFlags, repoRoot string) prompthistory.Store {
+	if flags.outsideHTTP != "" {
+		return &prompthistory.RemoteStore{URL: flags.outsideHTTP}
+	}
+	path, err := prompthistory.Path(repoRoot)
+	if err != nil {
+		slog.Warn("no prompt history", "err", err)
+		return nil
+	}
+	return &prompthistory.FileStore{Path: path}
+}
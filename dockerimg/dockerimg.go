@@ -4,6 +4,7 @@ package dockerimg
 import (
 	"archive/tar"
 	"bytes"
+	"cmp"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
@@ -14,10 +15,12 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -26,6 +29,8 @@ import (
 	"sketch.dev/browser"
 	"sketch.dev/embedded"
 	"sketch.dev/loop/server"
+	"sketch.dev/notify"
+	"sketch.dev/prompthistory"
 	"sketch.dev/skribe"
 )
 
@@ -111,6 +116,9 @@ type ContainerConfig struct {
 	// TermUI enables terminal UI
 	TermUI bool
 
+	// FullScreen selects the full-screen terminal UI
+	FullScreen bool
+
 	// Budget configuration
 	MaxDollars float64
 
@@ -148,6 +156,33 @@ type ContainerConfig struct {
 
 	// FetchOnLaunch enables git fetch during initialization
 	FetchOnLaunch bool
+
+	// OTelEndpoint is the OTLP/HTTP collector endpoint for traces, if any
+	OTelEndpoint string
+
+	// ReviewFindings is the host path to copy code review findings to on exit, if any.
+	// The findings are SARIF if it ends in ".sarif", and JSON otherwise.
+	ReviewFindings string
+
+	// ReviewCacheDir is the host directory in which code review keeps baselines across sessions.
+	// Empty means a docker volume shared by all sessions; "none" disables the cache.
+	ReviewCacheDir string
+
+	// Notify contains notification sink specifications (see notify.ParseSink)
+	Notify []string
+
+	// NotifyOn is the comma-separated list of events that trigger notifications
+	NotifyOn string
+
+	// AuthTokens contains auth token specifications for the container's HTTP server (see server.ParseToken)
+	AuthTokens []string
+
+	// ForwardPorts lists the container ports to forward to the host when they open,
+	// such as "3000,8000-8999". Empty means the default, none.
+	ForwardPorts string
+
+	// ForwardPortsDeny lists container ports never to forward, in the same format as ForwardPorts.
+	ForwardPortsDeny string
 }
 
 // LaunchContainer creates a docker container for a project, installs sketch and opens a connection to it.
@@ -173,6 +208,11 @@ func LaunchContainer(ctx context.Context, config ContainerConfig) error {
 	if err != nil {
 		return err
 	}
+	forwarder, err := newPortForwarder(cmp.Or(config.ForwardPorts, defaultForwardPorts), config.ForwardPortsDeny)
+	if err != nil {
+		return err
+	}
+
 	// Bail early if sketch was started from a path that isn't in a git repo.
 	err = requireGitRepo(ctx, config.Path)
 	if err != nil {
@@ -224,7 +264,8 @@ func LaunchContainer(ctx context.Context, config ContainerConfig) error {
 	}
 
 	// Start the git server
-	gitSrv, err := newGitServer(gitRoot, config.PassthroughUpstream, upstream)
+	desktopNotify := slices.Contains(config.Notify, "desktop")
+	gitSrv, err := newGitServer(gitRoot, config.PassthroughUpstream, upstream, desktopNotify)
 	if err != nil {
 		return fmt.Errorf("failed to start git server: %w", err)
 	}
@@ -271,8 +312,16 @@ func LaunchContainer(ctx context.Context, config ContainerConfig) error {
 	config.Upstream = upstream
 	config.Commit = commit
 
+	// If the container's HTTP server requires auth, we need a token of our own to /init it,
+	// which the port forwarder also uses.
+	var initToken string
+	if len(config.AuthTokens) > 0 {
+		initToken = server.NewSecret()
+		config.AuthTokens = append(slices.Clone(config.AuthTokens), initToken+":"+initTokenScopes)
+	}
+
 	// Create the sketch container, copy over linux sketch
-	if err := createDockerContainer(ctx, cntrName, hostPort, relPath, imgName, config); err != nil {
+	if err := createDockerContainer(ctx, cntrName, hostPort, gitRoot, relPath, imgName, config); err != nil {
 		return fmt.Errorf("failed to create docker container: %w", err)
 	}
 	if err := copyEmbeddedLinuxBinaryToContainer(ctx, cntrName); err != nil {
@@ -294,6 +343,18 @@ func LaunchContainer(ctx context.Context, config ContainerConfig) error {
 		return fmt.Errorf("docker start: %s, %w", out, err)
 	}
 
+	// Copies the code review findings from the container to the host.
+	copyReviewFindings := func() {
+		if config.ReviewFindings == "" {
+			return
+		}
+		srcPath := fmt.Sprintf("%s:%s", cntrName, containerReviewFindings(config.ReviewFindings))
+		if out, err := combinedOutput(ctx, "docker", "cp", srcPath, config.ReviewFindings); err != nil {
+			// There are no findings to copy until a review has run.
+			slog.DebugContext(ctx, "docker cp of review findings failed", "src", srcPath, "out", string(out), "err", err)
+		}
+	}
+
 	// Copies structured logs from the container to the host.
 	copyLogs := func() {
 		if config.ContainerLogDest == "" {
@@ -350,6 +411,8 @@ func LaunchContainer(ctx context.Context, config ContainerConfig) error {
 	if config.Verbose {
 		fmt.Fprintf(os.Stderr, "Host web server: http://%s/\n", localAddr)
 	}
+	forwarder.innieAddr = localAddr
+	forwarder.token = initToken
 
 	localSSHAddr, err := getContainerPort(ctx, cntrName, "22")
 	if err != nil {
@@ -383,7 +446,10 @@ func LaunchContainer(ctx context.Context, config ContainerConfig) error {
 🖥️  code --remote ssh-remote+root@%s /app -n
 🔗 vscode://vscode-remote/ssh-remote+root@%s/app?windowId=_blank
 `, cntrName, cntrName, cntrName)
-		sshUserIdentity = cst.userIdentity
+		sshUserIdentity, err = cst.AuthorizedKeys()
+		if err != nil {
+			return appendInternalErr(err)
+		}
 		sshServerIdentity = cst.serverIdentity
 
 		// Get the Container CA public key for mutual auth
@@ -415,13 +481,19 @@ func LaunchContainer(ctx context.Context, config ContainerConfig) error {
 		// the scrollback (which is not good, but also not fatal).  I can't see why it does this
 		// though, since none of the calls in postContainerInitConfig obviously write to stdout
 		// or stderr.
-		if err := postContainerInitConfig(ctx, localAddr, sshAvailable, sshErrMsg, sshServerIdentity, sshUserIdentity, containerCAPublicKey, hostCertificate); err != nil {
+		if err := postContainerInitConfig(ctx, localAddr, initToken, sshAvailable, sshErrMsg, sshServerIdentity, sshUserIdentity, containerCAPublicKey, hostCertificate); err != nil {
 			slog.ErrorContext(ctx, "LaunchContainer.postContainerInitConfig", slog.String("err", err.Error()))
 			errCh <- appendInternalErr(err)
+		} else {
+			go forwarder.run(ctx)
 		}
 
 		// We open the browser after the init config because the above waits for the web server to be serving.
 		ps1URL := "http://" + localAddr
+		if len(config.AuthTokens) > 0 {
+			secret, _, _ := strings.Cut(config.AuthTokens[0], ":")
+			ps1URL += "/?token=" + url.QueryEscape(secret)
+		}
 		if config.SkabandAddr != "" {
 			ps1URL = fmt.Sprintf("%s/s/%s", config.SkabandAddr, config.SessionID)
 		}
@@ -440,6 +512,7 @@ func LaunchContainer(ctx context.Context, config ContainerConfig) error {
 	}()
 
 	defer copyLogs()
+	defer copyReviewFindings()
 
 	for {
 		select {
@@ -454,6 +527,29 @@ func LaunchContainer(ctx context.Context, config ContainerConfig) error {
 	}
 }
 
+// initTokenScopes are the scopes of the outtie's own token for the container's HTTP server:
+// admin for /init and reporting port forwards, and view and terminal for the port forwarder's /state polling and /tunnel/ connections.
+var initTokenScopes = strings.Join([]string{string(server.ScopeView), string(server.ScopeTerminal), string(server.ScopeAdmin)}, ",")
+
+// containerReviewCacheDir is where the code review cache is mounted in the container.
+const containerReviewCacheDir = "/sketch-codereview-cache"
+
+// reviewCacheVolume returns the docker volume used by default for the code review cache of the repo at gitRoot.
+// The volume is per repo, since the container can write to it: a session can only affect the baselines of its own repo.
+func reviewCacheVolume(gitRoot string) string {
+	h := sha256.Sum256([]byte(gitRoot))
+	return "sketch-codereview-cache-" + hex.EncodeToString(h[:])[:12]
+}
+
+// containerReviewFindings returns where the container writes the code review findings
+// that are copied to hostPath, keeping its extension, which selects the format.
+func containerReviewFindings(hostPath string) string {
+	if strings.HasSuffix(hostPath, ".sarif") {
+		return "/tmp/sketch-review-findings.sarif"
+	}
+	return "/tmp/sketch-review-findings.json"
+}
+
 func combinedOutput(ctx context.Context, cmdName string, args ...string) ([]byte, error) {
 	cmd := exec.CommandContext(ctx, cmdName, args...)
 	start := time.Now()
@@ -484,11 +580,16 @@ type gitServer struct {
 	srv     *http.Server
 	pass    string
 	ps1URL  atomic.Pointer[string]
+	// hooksDir is the session's temporary git hooks directory, if any.
+	hooksDir string
 }
 
 func (gs *gitServer) shutdown(ctx context.Context) {
 	gs.srv.Shutdown(ctx)
 	gs.gitLn.Close()
+	if gs.hooksDir != "" {
+		os.RemoveAll(gs.hooksDir)
+	}
 }
 
 // Serve a git remote from the host for the container to fetch from and push to.
@@ -497,7 +598,9 @@ func (gs *gitServer) serve(ctx context.Context) error {
 	return gs.srv.Serve(gs.gitLn)
 }
 
-func newGitServer(gitRoot string, configureUpstreamPassthrough bool, upstream string) (*gitServer, error) {
+// newGitServer creates the outtie's HTTP server. If desktopNotify is set,
+// notifications posted by the innie to /notify are shown on the desktop.
+func newGitServer(gitRoot string, configureUpstreamPassthrough bool, upstream string, desktopNotify bool) (*gitServer, error) {
 	ret := &gitServer{
 		pass: rand.Text(),
 	}
@@ -516,15 +619,45 @@ func newGitServer(gitRoot string, configureUpstreamPassthrough bool, upstream st
 		}
 	}()
 
-	var hooksDir string
-	if configureUpstreamPassthrough {
-		hooksDir, err = setupHooksDir(upstream)
-		if err != nil {
-			return nil, fmt.Errorf("failed to setup hooks directory: %w", err)
+	var notifyC chan notify.Event // channel of desktop notification requests
+	if desktopNotify {
+		notifyC = make(chan notify.Event, 8)
+		go func() {
+			for ev := range notifyC {
+				if err := (notify.Desktop{}).Notify(context.Background(), ev); err != nil {
+					slog.Debug("desktop notification failed", "err", err)
+				}
+			}
+		}()
+	}
+
+	// With upstream passthrough, the hooks forward pushes to origin. Either way, they check pushes for secrets,
+	// which needs the sketch binary.
+	sketchBin, err := os.Executable()
+	if err != nil {
+		slog.Warn("not checking pushes for secrets: can't find the sketch binary", "err", err)
+		sketchBin = ""
+	}
+	switch {
+	case configureUpstreamPassthrough:
+		ret.hooksDir, err = setupHooksDir(upstream)
+	case sketchBin != "":
+		var repoHooks string
+		repoHooks, err = repoHooksDir(gitRoot)
+		if err == nil {
+			ret.hooksDir, err = setupSecretsHooksDir(repoHooks)
 		}
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup hooks directory: %w", err)
+	}
 
-	srv := http.Server{Handler: &gitHTTP{gitRepoRoot: gitRoot, hooksDir: hooksDir, pass: []byte(ret.pass), browserC: browserC}}
+	var history prompthistory.Store
+	if path, err := prompthistory.Path(gitRoot); err == nil {
+		history = &prompthistory.FileStore{Path: path}
+	}
+
+	srv := http.Server{Handler: &gitHTTP{gitRepoRoot: gitRoot, hooksDir: ret.hooksDir, pass: []byte(ret.pass), browserC: browserC, notifyC: notifyC, history: history, sketchBin: sketchBin, passthrough: configureUpstreamPassthrough}}
 	ret.srv = &srv
 
 	_, gitPort, err := net.SplitHostPort(gitLn.Addr().String())
@@ -535,7 +668,7 @@ func newGitServer(gitRoot string, configureUpstreamPassthrough bool, upstream st
 	return ret, nil
 }
 
-func createDockerContainer(ctx context.Context, cntrName, hostPort, relPath, imgName string, config ContainerConfig) error {
+func createDockerContainer(ctx context.Context, cntrName, hostPort, gitRoot, relPath, imgName string, config ContainerConfig) error {
 	cmdArgs := []string{
 		"create",
 		"-i",
@@ -559,6 +692,10 @@ func createDockerContainer(ctx context.Context, cntrName, hostPort, relPath, img
 	if config.SketchPubKey != "" {
 		cmdArgs = append(cmdArgs, "-e", "SKETCH_PUB_KEY="+config.SketchPubKey)
 	}
+	if len(config.AuthTokens) > 0 {
+		// Passed in the environment rather than as flags, so they don't show up in the container's process list.
+		cmdArgs = append(cmdArgs, "-e", "SKETCH_AUTH_TOKENS="+strings.Join(config.AuthTokens, " "))
+	}
 	if config.SSHPort > 0 {
 		cmdArgs = append(cmdArgs, "-p", fmt.Sprintf("%d:22", config.SSHPort)) // forward container ssh port to host ssh port
 	} else {
@@ -581,6 +718,17 @@ func createDockerContainer(ctx context.Context, cntrName, hostPort, relPath, img
 		cmdArgs = append(cmdArgs, "-e", "SUBTRACE_HTTP2=1")
 	}
 
+	// Mount the code review cache, so that sessions share baselines
+	if config.ReviewCacheDir != "none" {
+		src := config.ReviewCacheDir
+		if src == "" {
+			src = reviewCacheVolume(gitRoot)
+		} else if err := os.MkdirAll(src, 0o755); err != nil {
+			return fmt.Errorf("failed to create code review cache directory: %w", err)
+		}
+		cmdArgs = append(cmdArgs, "-v", src+":"+containerReviewCacheDir)
+	}
+
 	// Add volume mounts if specified
 	for _, mount := range config.Mounts {
 		if mount != "" {
@@ -609,6 +757,7 @@ func createDockerContainer(ctx context.Context, cntrName, hostPort, relPath, img
 		fmt.Sprintf("-max-dollars=%f", config.MaxDollars),
 		"-open=false",
 		"-termui="+fmt.Sprintf("%t", config.TermUI),
+		"-fullscreen="+fmt.Sprintf("%t", config.FullScreen),
 		"-verbose="+fmt.Sprintf("%t", config.Verbose),
 		"-x="+config.ExperimentFlag,
 		"-branch-prefix="+config.BranchPrefix,
@@ -657,6 +806,23 @@ func createDockerContainer(ctx context.Context, cntrName, hostPort, relPath, img
 	if !config.FetchOnLaunch {
 		cmdArgs = append(cmdArgs, "-fetch-on-launch=false")
 	}
+	if config.OTelEndpoint != "" {
+		cmdArgs = append(cmdArgs, "-otel-endpoint="+config.OTelEndpoint)
+	}
+	for _, sink := range config.Notify {
+		cmdArgs = append(cmdArgs, "-notify", sink)
+	}
+	if config.NotifyOn != "" {
+		cmdArgs = append(cmdArgs, "-notify-on="+config.NotifyOn)
+	}
+	if config.ReviewFindings != "" {
+		cmdArgs = append(cmdArgs, "-review-findings="+containerReviewFindings(config.ReviewFindings))
+	}
+	if config.ReviewCacheDir == "none" {
+		cmdArgs = append(cmdArgs, "-review-cache-dir=none")
+	} else {
+		cmdArgs = append(cmdArgs, "-review-cache-dir="+containerReviewCacheDir)
+	}
 
 	// Add additional docker arguments if provided
 	if config.DockerArgs != "" {
@@ -692,7 +858,8 @@ func getContainerPort(ctx context.Context, cntrName, cntrPort string) (string, e
 }
 
 // Contact the container and configure it.
-func postContainerInitConfig(ctx context.Context, localAddr string, sshAvailable bool, sshError string, sshServerIdentity, sshAuthorizedKeys, sshContainerCAKey, sshHostCertificate []byte) error {
+// If initToken is set, it authenticates the request.
+func postContainerInitConfig(ctx context.Context, localAddr, initToken string, sshAvailable bool, sshError string, sshServerIdentity, sshAuthorizedKeys, sshContainerCAKey, sshHostCertificate []byte) error {
 	localURL := "http://" + localAddr
 
 	initMsg, err := json.Marshal(
@@ -715,6 +882,9 @@ func postContainerInitConfig(ctx context.Context, localAddr string, sshAvailable
 	if err != nil {
 		return err
 	}
+	if initToken != "" {
+		req.Header.Set("Authorization", "Bearer "+initToken)
+	}
 
 	var res *http.Response
 	for i := 0; ; i++ {
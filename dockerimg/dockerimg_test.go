@@ -64,6 +64,16 @@ func TestCreateCacheKey(t *testing.T) {
 	}
 }
 
+func TestReviewCacheVolume(t *testing.T) {
+	// Each repo gets its own volume, so that sessions can't affect other repos' baselines.
+	if reviewCacheVolume("/path1") == reviewCacheVolume("/path2") {
+		t.Error("Different repos should use different code review cache volumes")
+	}
+	if reviewCacheVolume("/path1") != reviewCacheVolume("/path1") {
+		t.Error("Sessions on the same repo should share a code review cache volume")
+	}
+}
+
 // TestEnsureBaseImageExists tests the base image existence check and pull logic
 func TestEnsureBaseImageExists(t *testing.T) {
 	// This test would require Docker to be running and would make network calls
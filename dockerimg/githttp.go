@@ -5,7 +5,9 @@ import (
 	"context"
 	"crypto/subtle"
 	_ "embed"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/cgi"
@@ -13,9 +15,14 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
+
+	"sketch.dev/notify"
+	"sketch.dev/prompthistory"
+	"sketch.dev/secrets"
 )
 
 //go:embed pre-receive.sh
@@ -24,16 +31,24 @@ var preReceiveScript string
 //go:embed post-receive.sh
 var postReceiveScript string
 
+//go:embed secrets-pre-receive.sh
+var secretsPreReceiveScript string
+
 type gitHTTP struct {
 	gitRepoRoot string
 	hooksDir    string
 	pass        []byte
-	browserC    chan bool // browser launch requests
+	browserC    chan bool           // browser launch requests
+	notifyC     chan notify.Event   // desktop notification requests; nil if disabled
+	history     prompthistory.Store // prompt history for this repo; nil if unavailable
+	sketchBin   string              // sketch binary, which the pre-receive hook runs to check pushes for secrets; empty to skip the check
+	passthrough bool                // hooksDir is from setupHooksDir, for upstream passthrough, rather than setupSecretsHooksDir
 }
 
 // setupHooksDir creates a temporary directory with git hooks for this session.
 //
-// This automatically forwards pushes from refs/remotes/origin/Y to origin/Y
+// This is for upstream passthrough. It rejects pushes that add secrets (see CheckPushSecrets), and
+// automatically forwards pushes from refs/remotes/origin/Y to origin/Y
 // when users push to remote tracking refs through the git HTTP backend.
 //
 // How it works:
@@ -75,6 +90,57 @@ func setupHooksDir(upstream string) (string, error) {
 	return hooksDir, nil
 }
 
+// receiveHooks are the hooks, other than pre-receive, that git runs when receiving a push.
+var receiveHooks = []string{"update", "proc-receive", "post-receive", "post-update", "reference-transaction", "push-to-checkout"}
+
+// setupSecretsHooksDir creates a temporary directory with git hooks for a session without upstream passthrough.
+//
+// Its pre-receive hook rejects pushes that add secrets (see CheckPushSecrets).
+// Since the directory replaces the repo's hooks directory, repoHooks,
+// the pre-receive hook then runs the repo's own, and the repo's other receive hooks are linked in.
+func setupSecretsHooksDir(repoHooks string) (string, error) {
+	hooksDir, err := os.MkdirTemp("", "sketch-git-hooks-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+	tmpl, err := template.New("pre-receive").Parse(secretsPreReceiveScript)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse pre-receive template: %w", err)
+	}
+	var buf bytes.Buffer
+	// Single-quote the path for the shell.
+	quoted := "'" + strings.ReplaceAll(repoHooks, "'", `'\''`) + "'"
+	if err := tmpl.Execute(&buf, map[string]string{"RepoHooks": quoted}); err != nil {
+		return "", fmt.Errorf("failed to execute pre-receive template: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(hooksDir, "pre-receive"), buf.Bytes(), 0o755); err != nil {
+		return "", fmt.Errorf("failed to write pre-receive hook: %w", err)
+	}
+	for _, name := range receiveHooks {
+		hook := filepath.Join(repoHooks, name)
+		if fi, err := os.Stat(hook); err != nil || fi.Mode()&0o111 == 0 {
+			continue // git ignores missing and non-executable hooks
+		}
+		if err := os.Symlink(hook, filepath.Join(hooksDir, name)); err != nil {
+			return "", fmt.Errorf("failed to link %s hook: %w", name, err)
+		}
+	}
+	return hooksDir, nil
+}
+
+// repoHooksDir returns the absolute path of the hooks directory of the repo at gitRoot.
+func repoHooksDir(gitRoot string) (string, error) {
+	out, err := exec.Command("git", "-C", gitRoot, "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find git hooks directory: %w", err)
+	}
+	dir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(gitRoot, dir)
+	}
+	return dir, nil
+}
+
 func (g *gitHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -123,6 +189,34 @@ func (g *gitHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if strings.HasPrefix(r.URL.Path, "/notify") {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if g.notifyC == nil {
+			http.Error(w, "Desktop notifications are not enabled", http.StatusNotFound)
+			return
+		}
+		var ev notify.Event
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&ev); err != nil {
+			http.Error(w, "Invalid notification: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		select {
+		case g.notifyC <- ev:
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.Error(w, "Too many notification requests", http.StatusTooManyRequests)
+		}
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/history") {
+		g.serveHistory(w, r)
+		return
+	}
+
 	if runtime.GOOS == "darwin" {
 		// On the Mac, Docker connections show up from localhost. On Linux, the docker
 		// network is more arbitrary, so we don't do this additional check there.
@@ -173,10 +267,14 @@ func (g *gitHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	var args []string
 	if g.hooksDir != "" {
-		args = append(args,
-			"-c", "core.hooksPath="+g.hooksDir,
-			"-c", "receive.denyCurrentBranch=refuse",
-		)
+		args = append(args, "-c", "core.hooksPath="+g.hooksDir)
+	}
+	if g.passthrough {
+		args = append(args, "-c", "receive.denyCurrentBranch=refuse")
+	}
+	if g.sketchBin != "" {
+		// For AllowSecretsPushOption.
+		args = append(args, "-c", "receive.advertisePushOptions=true")
 	}
 	args = append(args, "http-backend")
 
@@ -196,7 +294,95 @@ func (g *gitHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			// We need to pass through the SSH auth sock to the CGI script
 			// so that we can use the user's existing SSH key infra to authenticate.
 			"SSH_AUTH_SOCK=" + os.Getenv("SSH_AUTH_SOCK"),
+			"SKETCH_CHECK_SECRETS=" + g.sketchBin,
 		},
 	}
 	h.ServeHTTP(w, r)
 }
+
+// AllowSecretsPushOption is the push option (git push -o) that allows pushes that CheckPushSecrets would reject.
+const AllowSecretsPushOption = "sketch-allow-secrets"
+
+// CheckPushSecrets is run by the pre-receive hook, in the repo being pushed to, with the hook's input:
+// lines of "<old-sha> <new-sha> <ref>".
+// It returns an error, after describing them on w, if the pushed commits add secrets,
+// unless the push has AllowSecretsPushOption.
+func CheckPushSecrets(ctx context.Context, r io.Reader, w io.Writer) error {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var args []string
+	for line := range strings.Lines(string(input)) {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.Trim(fields[1], "0") == "" {
+			continue // a deletion
+		}
+		args = append(args, fields[1])
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	// Only the commits that the repo doesn't already have.
+	args = append(args, "--not", "--all")
+	findings, err := secrets.ScanCommits(ctx, ".", args...)
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+	n, _ := strconv.Atoi(os.Getenv("GIT_PUSH_OPTION_COUNT"))
+	for i := range n {
+		if os.Getenv(fmt.Sprintf("GIT_PUSH_OPTION_%d", i)) == AllowSecretsPushOption {
+			fmt.Fprintf(w, "Warning: pushing %d apparent secrets, as allowed by -o %s\n", len(findings), AllowSecretsPushOption)
+			return nil
+		}
+	}
+	fmt.Fprintf(w, "Error: the pushed commits appear to contain secrets:\n")
+	for i, f := range findings {
+		if i == 20 {
+			fmt.Fprintf(w, "  ...and %d more\n", len(findings)-i)
+			break
+		}
+		fmt.Fprintf(w, "  %s\n", f)
+	}
+	fmt.Fprintf(w, "Remove them from the commits, mark lines that aren't secret with %q, or push with -o %s to push anyway.\n", secrets.AllowMarker, AllowSecretsPushOption)
+	return fmt.Errorf("push rejected: %d apparent secrets", len(findings))
+}
+
+// serveHistory serves the termui prompt history, which the innie keeps here
+// so that it survives the container. GET returns the entries as a JSON array,
+// and POST appends the JSON string in the request body.
+func (g *gitHTTP) serveHistory(w http.ResponseWriter, r *http.Request) {
+	if g.history == nil {
+		http.Error(w, "Prompt history is not available", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := g.history.Load()
+		if err != nil {
+			http.Error(w, "Failed to load history: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if entries == nil {
+			entries = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	case http.MethodPost:
+		var entry string
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&entry); err != nil {
+			http.Error(w, "Invalid history entry: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := g.history.Append(entry); err != nil {
+			http.Error(w, "Failed to save history: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
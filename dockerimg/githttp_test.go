@@ -1,10 +1,17 @@
 package dockerimg
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+
+	"sketch.dev/notify"
+	"sketch.dev/prompthistory"
 )
 
 func TestSetupHooksDir(t *testing.T) {
@@ -228,3 +235,191 @@ func TestPreReceiveHookExecution(t *testing.T) {
 		t.Errorf("pre-receive hook is not executable: mode = %v", mode)
 	}
 }
+
+func TestGitHTTPNotify(t *testing.T) {
+	post := func(g *gitHTTP, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/notify", strings.NewReader(body))
+		req.SetBasicAuth("sketch", "test-pass")
+		rec := httptest.NewRecorder()
+		g.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	disabled := &gitHTTP{pass: []byte("test-pass")}
+	if code := post(disabled, `{"kind":"error"}`); code != http.StatusNotFound {
+		t.Errorf("notify with desktop notifications disabled: status %d, want %d", code, http.StatusNotFound)
+	}
+
+	g := &gitHTTP{pass: []byte("test-pass"), notifyC: make(chan notify.Event, 1)}
+	if code := post(g, `{"kind":"question","title":"sketch: has a question","message":"Which one?"}`); code != http.StatusOK {
+		t.Fatalf("notify: status %d, want %d", code, http.StatusOK)
+	}
+	ev := <-g.notifyC
+	if ev.Kind != notify.KindQuestion || ev.Message != "Which one?" {
+		t.Errorf("got event %+v", ev)
+	}
+	if code := post(g, `not json`); code != http.StatusBadRequest {
+		t.Errorf("notify with bad body: status %d, want %d", code, http.StatusBadRequest)
+	}
+	post(g, `{"kind":"error"}`) // fills the channel
+	if code := post(g, `{"kind":"error"}`); code != http.StatusTooManyRequests {
+		t.Errorf("notify with full queue: status %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestGitHTTPHistory(t *testing.T) {
+	g := &gitHTTP{pass: []byte("test-pass"), history: &prompthistory.FileStore{Path: filepath.Join(t.TempDir(), "history.jsonl")}}
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+
+	// The innie reaches the history through the outtie, with the credentials in the URL.
+	store := &prompthistory.RemoteStore{URL: strings.Replace(srv.URL, "http://", "http://sketch:test-pass@", 1)}
+	entries, err := store.Load()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Load() = %q, %v; want an empty history", entries, err)
+	}
+	for _, entry := range []string{"fix the bug", "explain this:\npanic: oops"} {
+		if err := store.Append(entry); err != nil {
+			t.Fatalf("Append(%q): %v", entry, err)
+		}
+	}
+	entries, err = store.Load()
+	if err != nil || !slices.Equal(entries, []string{"fix the bug", "explain this:\npanic: oops"}) {
+		t.Errorf("Load() = %q, %v", entries, err)
+	}
+
+	unauthenticated := &prompthistory.RemoteStore{URL: srv.URL}
+	if _, err := unauthenticated.Load(); err == nil {
+		t.Errorf("Load() without credentials succeeded")
+	}
+	disabled := httptest.NewServer(&gitHTTP{pass: []byte("test-pass")})
+	defer disabled.Close()
+	store.URL = strings.Replace(disabled.URL, "http://", "http://sketch:test-pass@", 1)
+	if _, err := store.Load(); err == nil {
+		t.Errorf("Load() from a server without history succeeded")
+	}
+}
+
+func TestCheckPushSecrets(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-b", "main")
+	git("commit", "--allow-empty", "-m", "initial")
+	base := git("rev-parse", "HEAD")
+	// Make a commit that only the push has, as in the pre-receive hook's quarantine.
+	os.WriteFile(filepath.Join(dir, "config.go"), []byte("package config\n\nconst key = \"AKIA"+"Z7QPHN4KXM2JDW5V\"\n"), 0o600)
+	git("add", "config.go")
+	git("commit", "-m", "add config")
+	pushed := git("rev-parse", "HEAD")
+	git("reset", "--hard", base)
+	t.Chdir(dir)
+
+	check := func(input string) (string, error) {
+		var out strings.Builder
+		err := CheckPushSecrets(t.Context(), strings.NewReader(input), &out)
+		return out.String(), err
+	}
+	zero := strings.Repeat("0", 40)
+	out, err := check(base + " " + pushed + " refs/heads/sketch/feature\n")
+	if err == nil || !strings.Contains(out, "config.go:3: AWS access key ID") {
+		t.Errorf("push with a secret: err = %v, output:\n%s", err, out)
+	}
+	if out, err := check(zero + " " + base + " refs/heads/other\n" + base + " " + zero + " refs/heads/gone\n"); err != nil {
+		t.Errorf("push without secrets: %v\n%s", err, out)
+	}
+
+	t.Setenv("GIT_PUSH_OPTION_COUNT", "1")
+	t.Setenv("GIT_PUSH_OPTION_0", AllowSecretsPushOption)
+	if out, err := check(base + " " + pushed + " refs/heads/sketch/feature\n"); err != nil {
+		t.Errorf("push with -o %s: %v\n%s", AllowSecretsPushOption, err, out)
+	}
+}
+
+func TestPreReceiveHookChecksSecrets(t *testing.T) {
+	hooksDir, err := setupHooksDir("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(hooksDir)
+
+	// Stand in for the sketch binary, recording its input and exiting with $STUB_EXIT.
+	dir := t.TempDir()
+	stub := filepath.Join(dir, "sketch")
+	os.WriteFile(stub, []byte("#!/bin/sh\n[ \"$1\" = -check-push-secrets ] || exit 2\ncat > \"$STUB_INPUT\"\nexit $STUB_EXIT\n"), 0o755)
+	input := "1111111111111111111111111111111111111111 2222222222222222222222222222222222222222 refs/heads/sketch/x\n"
+	for _, exit := range []string{"0", "1"} {
+		cmd := exec.Command(filepath.Join(hooksDir, "pre-receive"))
+		cmd.Dir = dir
+		cmd.Stdin = strings.NewReader(input)
+		cmd.Env = append(os.Environ(), "SKETCH_CHECK_SECRETS="+stub, "STUB_INPUT="+filepath.Join(dir, "input"), "STUB_EXIT="+exit)
+		out, err := cmd.CombinedOutput()
+		if (err == nil) != (exit == "0") {
+			t.Errorf("with the check exiting %s, the hook's err = %v\n%s", exit, err, out)
+		}
+		if got, _ := os.ReadFile(filepath.Join(dir, "input")); string(got) != input {
+			t.Errorf("the check's input = %q, want %q", got, input)
+		}
+	}
+}
+
+func TestSetupSecretsHooksDir(t *testing.T) {
+	// The repo's own hooks, which the secrets hooks dir must keep running.
+	repoHooks := t.TempDir()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(repoHooks, "pre-receive"), []byte("#!/bin/sh\ncat > \"$REPO_HOOK_INPUT\"\n"), 0o755)
+	os.WriteFile(filepath.Join(repoHooks, "post-receive"), []byte("#!/bin/sh\n"), 0o755)
+	os.WriteFile(filepath.Join(repoHooks, "update.sample"), []byte("#!/bin/sh\n"), 0o755)
+
+	hooksDir, err := setupSecretsHooksDir(repoHooks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(hooksDir)
+
+	script, err := os.ReadFile(filepath.Join(hooksDir, "pre-receive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, forwarding := range []string{"refs/remotes/origin/", "git push"} {
+		if strings.Contains(string(script), forwarding) {
+			t.Errorf("pre-receive hook contains %q; it shouldn't forward pushes without upstream passthrough", forwarding)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(hooksDir, "post-receive")); err != nil || target != filepath.Join(repoHooks, "post-receive") {
+		t.Errorf("post-receive hook links to %q, %v; want the repo's hook", target, err)
+	}
+	if _, err := os.Lstat(filepath.Join(hooksDir, "update.sample")); err == nil {
+		t.Errorf("sample hook was linked")
+	}
+
+	stub := filepath.Join(dir, "sketch")
+	os.WriteFile(stub, []byte("#!/bin/sh\n[ \"$1\" = -check-push-secrets ] || exit 2\ncat > \"$STUB_INPUT\"\nexit $STUB_EXIT\n"), 0o755)
+	input := "1111111111111111111111111111111111111111 2222222222222222222222222222222222222222 refs/heads/sketch/x\n"
+	for _, exit := range []string{"0", "1"} {
+		os.Remove(filepath.Join(dir, "repo-input"))
+		cmd := exec.Command(filepath.Join(hooksDir, "pre-receive"))
+		cmd.Dir = dir
+		cmd.Stdin = strings.NewReader(input)
+		cmd.Env = append(os.Environ(), "SKETCH_CHECK_SECRETS="+stub, "STUB_INPUT="+filepath.Join(dir, "input"), "STUB_EXIT="+exit, "REPO_HOOK_INPUT="+filepath.Join(dir, "repo-input"))
+		out, err := cmd.CombinedOutput()
+		if (err == nil) != (exit == "0") {
+			t.Errorf("with the check exiting %s, the hook's err = %v\n%s", exit, err, out)
+		}
+		if got, _ := os.ReadFile(filepath.Join(dir, "input")); string(got) != input {
+			t.Errorf("the check's input = %q, want %q", got, input)
+		}
+		got, _ := os.ReadFile(filepath.Join(dir, "repo-input"))
+		if want := map[string]string{"0": input, "1": ""}[exit]; string(got) != want {
+			t.Errorf("with the check exiting %s, the repo's pre-receive hook's input = %q, want %q", exit, got, want)
+		}
+	}
+}
@@ -46,6 +46,7 @@ type LocalSSHimmer struct {
 	serverIdentityPath string
 	containerCAPath    string
 	hostCertPath       string
+	authorizedKeysPath string
 
 	serverPublicKey      ssh.PublicKey
 	serverIdentity       []byte
@@ -93,6 +94,7 @@ func newLocalSSHimmerWithDeps(cntrName, sshHost, sshPort string, fs FileSystem,
 		containerCAPath:    filepath.Join(base, "container_ca"),
 		hostCertPath:       filepath.Join(base, "host_cert"),
 		sshConfigPath:      filepath.Join(base, "ssh_config"),
+		authorizedKeysPath: filepath.Join(base, "authorized_keys"),
 		fs:                 fs,
 		kg:                 kg,
 	}
@@ -154,6 +156,25 @@ func newLocalSSHimmerWithDeps(cntrName, sshHost, sshPort string, fs FileSystem,
 	return cst, nil
 }
 
+// AuthorizedKeys returns the authorized_keys for the container's SSH server:
+// the lines of $HOME/.config/sketch/authorized_keys, if it exists, followed by the user identity.
+// Like sshd, the container uses the first line that matches a key,
+// so that file can also restrict what the user identity may forward,
+// with options such as no-agent-forwarding or permitopen="localhost:8080".
+func (c *LocalSSHimmer) AuthorizedKeys() ([]byte, error) {
+	if _, err := c.fs.Stat(c.authorizedKeysPath); err != nil {
+		return c.userIdentity, nil
+	}
+	extra, err := c.fs.ReadFile(c.authorizedKeysPath)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %s: %w", c.authorizedKeysPath, err)
+	}
+	if len(extra) > 0 && !bytes.HasSuffix(extra, []byte("\n")) {
+		extra = append(extra, '\n')
+	}
+	return append(extra, c.userIdentity...), nil
+}
+
 func checkSSHResolve(hostname string) error {
 	cmd := exec.Command("ssh", "-T", hostname)
 	out, err := cmd.CombinedOutput()
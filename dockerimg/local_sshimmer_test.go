@@ -316,6 +316,26 @@ func TestNewLocalSSHimmerCreatesRequiredDirectories(t *testing.T) {
 	}
 }
 
+func TestAuthorizedKeys(t *testing.T) {
+	ssh, mockFS, _ := setupTestLocalSSHimmer(t)
+
+	keys, err := ssh.AuthorizedKeys()
+	if err != nil || string(keys) != string(ssh.userIdentity) {
+		t.Errorf("AuthorizedKeys() without authorized_keys = %q, %v; want the user identity", keys, err)
+	}
+
+	extra := `no-agent-forwarding,permitopen="localhost:8080" ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIEZhcmV3ZWxsIHRvIGFybXMgYW5kIHRoZSBtYW4gc2luZw`
+	mockFS.Files[ssh.authorizedKeysPath] = []byte(extra)
+	keys, err = ssh.AuthorizedKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The user's lines come first, so their options win.
+	if want := extra + "\n" + string(ssh.userIdentity); string(keys) != want {
+		t.Errorf("AuthorizedKeys() = %q, want %q", keys, want)
+	}
+}
+
 func TestCreateKeyPairIfMissing(t *testing.T) {
 	ssh, mockFS, _ := setupTestLocalSSHimmer(t)
 
@@ -0,0 +1,330 @@
+package dockerimg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sketch.dev/loop/server"
+)
+
+// defaultForwardPorts is the default set of container ports forwarded to the host: none,
+// since forwarded ports listen on the host, and concurrent sessions would compete for them.
+// Users opt in with -forward-ports.
+const defaultForwardPorts = "none"
+
+// portRange is an inclusive range of ports.
+type portRange struct{ lo, hi uint16 }
+
+// parsePortRanges parses a comma-separated list of ports and port ranges, such as "3000,8000-8999".
+// "none" and "" are the empty list.
+func parsePortRanges(s string) ([]portRange, error) {
+	if s == "" || s == "none" {
+		return nil, nil
+	}
+	var ranges []portRange
+	for field := range strings.SplitSeq(s, ",") {
+		field = strings.TrimSpace(field)
+		lo, hi, isRange := strings.Cut(field, "-")
+		if !isRange {
+			hi = lo
+		}
+		l, err := strconv.ParseUint(lo, 10, 16)
+		if err != nil || l == 0 {
+			return nil, fmt.Errorf("invalid port %q in %q", lo, s)
+		}
+		h, err := strconv.ParseUint(hi, 10, 16)
+		if err != nil || h == 0 {
+			return nil, fmt.Errorf("invalid port %q in %q", hi, s)
+		}
+		if h < l {
+			return nil, fmt.Errorf("invalid port range %q in %q", field, s)
+		}
+		ranges = append(ranges, portRange{uint16(l), uint16(h)})
+	}
+	return ranges, nil
+}
+
+func inPortRanges(ranges []portRange, port uint16) bool {
+	return slices.ContainsFunc(ranges, func(r portRange) bool { return r.lo <= port && port <= r.hi })
+}
+
+// portForwarder forwards TCP ports that open in the container to the host.
+//
+// It long-polls the container's /state, which changes whenever the container's
+// port monitor sees ports open or close. For each allowed port it listens on the
+// same port on the host's loopback interface (or, if that is taken, another port,
+// which is reused if the container port opens again). Each connection is carried
+// to the container over an HTTP upgrade of /tunnel/<port>.
+// The current forwards are reported back to the container, which shows them in /state.
+type portForwarder struct {
+	innieAddr string // address of the container's HTTP server
+	token     string // token for the container's HTTP server; "" if auth is off
+	allow     []portRange
+	deny      []portRange
+
+	mu        sync.Mutex
+	listeners map[uint16]net.Listener // by container port
+	hostPorts map[uint16]int          // host port last used for each container port
+	reported  []server.PortForward
+}
+
+// newPortForwarder returns a forwarder for the allow and deny lists, which are in the
+// format of parsePortRanges. Set innieAddr and token before calling run.
+func newPortForwarder(allow, deny string) (*portForwarder, error) {
+	allowRanges, err := parsePortRanges(allow)
+	if err != nil {
+		return nil, fmt.Errorf("-forward-ports: %w", err)
+	}
+	denyRanges, err := parsePortRanges(deny)
+	if err != nil {
+		return nil, fmt.Errorf("-forward-ports-deny: %w", err)
+	}
+	return &portForwarder{
+		allow:     allowRanges,
+		deny:      denyRanges,
+		listeners: make(map[uint16]net.Listener),
+		hostPorts: make(map[uint16]int),
+	}, nil
+}
+
+// run forwards ports until ctx is done, then closes all forwards.
+func (f *portForwarder) run(ctx context.Context) {
+	defer f.closeAll()
+	if len(f.allow) == 0 {
+		return
+	}
+	seen := -1
+	for ctx.Err() == nil {
+		state, err := f.pollState(ctx, seen)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.DebugContext(ctx, "port forwarding: polling container state", "err", err)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		seen = state.MessageCount
+		f.sync(ctx, state.OpenPorts)
+	}
+}
+
+// pollState fetches the container's state, waiting for a change if seen is not -1.
+func (f *portForwarder) pollState(ctx context.Context, seen int) (*server.State, error) {
+	u := "http://" + f.innieAddr + "/state"
+	if seen >= 0 {
+		u += "?poll=true&seen=" + strconv.Itoa(seen)
+	}
+	req, err := f.newRequest(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET /state: %s", resp.Status)
+	}
+	var state server.State
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return nil, fmt.Errorf("GET /state: %w", err)
+	}
+	return &state, nil
+}
+
+func (f *portForwarder) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if f.token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.token)
+	}
+	return req, nil
+}
+
+// wanted reports whether a port open in the container should be forwarded.
+func (f *portForwarder) wanted(p server.Port) bool {
+	// Pid 1 is sketch itself.
+	return p.Proto == "tcp" && p.Pid != 1 && inPortRanges(f.allow, p.Port) && !inPortRanges(f.deny, p.Port)
+}
+
+// sync makes the forwards match the ports open in the container.
+func (f *portForwarder) sync(ctx context.Context, open []server.Port) {
+	want := make(map[uint16]bool)
+	for _, p := range open {
+		if f.wanted(p) {
+			want[p.Port] = true
+		}
+	}
+
+	f.mu.Lock()
+	for port, ln := range f.listeners {
+		if !want[port] {
+			ln.Close()
+			delete(f.listeners, port)
+			slog.InfoContext(ctx, "stopped forwarding container port", "port", port)
+		}
+	}
+	for port := range want {
+		if f.listeners[port] != nil {
+			continue
+		}
+		ln, err := f.listen(port)
+		if err != nil {
+			slog.WarnContext(ctx, "cannot forward container port", "port", port, "err", err)
+			continue
+		}
+		f.listeners[port] = ln
+		f.hostPorts[port] = ln.Addr().(*net.TCPAddr).Port
+		slog.InfoContext(ctx, "forwarding container port", "port", port, "host_addr", ln.Addr().String())
+		go f.serve(ctx, ln, port)
+	}
+	forwards := f.forwardsLocked()
+	changed := !slices.Equal(forwards, f.reported)
+	f.mu.Unlock()
+
+	if changed {
+		if err := f.report(ctx, forwards); err != nil {
+			slog.WarnContext(ctx, "reporting port forwards to container", "err", err)
+			return
+		}
+		f.mu.Lock()
+		f.reported = forwards
+		f.mu.Unlock()
+	}
+}
+
+// listen listens on the host port used for port before, or else the same port as
+// in the container, or else any free port.
+func (f *portForwarder) listen(port uint16) (net.Listener, error) {
+	candidates := []int{int(port), 0}
+	if hp, ok := f.hostPorts[port]; ok {
+		candidates = []int{hp, 0}
+	}
+	var err error
+	for _, hp := range candidates {
+		var ln net.Listener
+		ln, err = net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(hp)))
+		if err == nil {
+			return ln, nil
+		}
+	}
+	return nil, err
+}
+
+func (f *portForwarder) forwardsLocked() []server.PortForward {
+	forwards := []server.PortForward{}
+	for port, ln := range f.listeners {
+		forwards = append(forwards, server.PortForward{Port: port, HostAddr: ln.Addr().String()})
+	}
+	slices.SortFunc(forwards, func(a, b server.PortForward) int { return int(a.Port) - int(b.Port) })
+	return forwards
+}
+
+// report tells the container about the current forwards.
+func (f *portForwarder) report(ctx context.Context, forwards []server.PortForward) error {
+	body, err := json.Marshal(server.PortForwardsRequest{Forwards: forwards})
+	if err != nil {
+		return err
+	}
+	req, err := f.newRequest(ctx, "POST", "http://"+f.innieAddr+"/api/v1/port-forwards", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("POST /api/v1/port-forwards: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (f *portForwarder) serve(ctx context.Context, ln net.Listener, port uint16) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return // closed
+		}
+		go func() {
+			defer conn.Close()
+			if err := f.tunnel(ctx, conn, port); err != nil {
+				slog.DebugContext(ctx, "forwarded connection", "port", port, "err", err)
+			}
+		}()
+	}
+}
+
+// tunnel carries conn to port in the container.
+func (f *portForwarder) tunnel(ctx context.Context, conn net.Conn, port uint16) error {
+	var d net.Dialer
+	innie, err := d.DialContext(ctx, "tcp", f.innieAddr)
+	if err != nil {
+		return err
+	}
+	defer innie.Close()
+
+	req, err := f.newRequest(ctx, "GET", fmt.Sprintf("http://%s/tunnel/%d", f.innieAddr, port), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", server.TunnelProtocol)
+	if err := req.Write(innie); err != nil {
+		return err
+	}
+	br := bufio.NewReader(innie)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return fmt.Errorf("tunnel: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	go func() {
+		io.Copy(innie, conn)
+		if tc, ok := innie.(*net.TCPConn); ok {
+			tc.CloseWrite()
+		}
+	}()
+	// Once the container side closes, the deferred Closes end the copy above.
+	_, err = io.Copy(conn, br)
+	if errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
+	return err
+}
+
+func (f *portForwarder) closeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for port, ln := range f.listeners {
+		ln.Close()
+		delete(f.listeners, port)
+	}
+}
@@ -0,0 +1,244 @@
+package dockerimg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sketch.dev/loop/server"
+)
+
+func TestParsePortRanges(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []portRange
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "none", want: nil},
+		{in: "3000", want: []portRange{{3000, 3000}}},
+		{in: "3000, 8000-8999", want: []portRange{{3000, 3000}, {8000, 8999}}},
+		{in: "1024-65535", want: []portRange{{1024, 65535}}},
+		{in: "0", wantErr: true},
+		{in: "70000", wantErr: true},
+		{in: "9000-8000", wantErr: true},
+		{in: "http", wantErr: true},
+		{in: "3000,", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePortRanges(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePortRanges(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePortRanges(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// fakeInnie serves the parts of the container's HTTP server that the port forwarder uses.
+// Its tunnels echo what they're sent, prefixed by the port.
+type fakeInnie struct {
+	mu       sync.Mutex
+	reported [][]server.PortForward
+}
+
+func (fi *fakeInnie) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer tok" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.URL.Path == "/state":
+		json.NewEncoder(w).Encode(server.State{MessageCount: 1})
+	case r.URL.Path == "/api/v1/port-forwards":
+		var req server.PortForwardsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		fi.mu.Lock()
+		fi.reported = append(fi.reported, req.Forwards)
+		fi.mu.Unlock()
+		w.Write([]byte(`{"status": "ok"}`))
+	case strings.HasPrefix(r.URL.Path, "/tunnel/"):
+		if r.Header.Get("Upgrade") != server.TunnelProtocol {
+			http.Error(w, "bad upgrade", http.StatusBadRequest)
+			return
+		}
+		conn, brw, _ := http.NewResponseController(w).Hijack()
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+		brw.Flush()
+		line, _ := brw.ReadString('\n')
+		fmt.Fprintf(conn, "%s:%s", strings.TrimPrefix(r.URL.Path, "/tunnel/"), line)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (fi *fakeInnie) lastReport() []server.PortForward {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if len(fi.reported) == 0 {
+		return nil
+	}
+	return fi.reported[len(fi.reported)-1]
+}
+
+// freePort returns a port that is free on the host, at least for now.
+func freePort(t *testing.T) uint16 {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return uint16(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func roundTrip(t *testing.T, addr, msg string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "%s\n", msg)
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(reply)
+}
+
+func TestPortForwarder(t *testing.T) {
+	fi := &fakeInnie{}
+	innie := httptest.NewServer(fi)
+	defer innie.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	free := freePort(t)
+	// taken is a container port whose number is in use on the host.
+	takenLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer takenLn.Close()
+	taken := uint16(takenLn.Addr().(*net.TCPAddr).Port)
+	denied := freePort(t)
+
+	f, err := newPortForwarder("1024-65535", fmt.Sprint(denied))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.innieAddr = strings.TrimPrefix(innie.URL, "http://")
+	f.token = "tok"
+	defer f.closeAll()
+
+	f.sync(ctx, []server.Port{
+		{Proto: "tcp", Port: free, Pid: 100},
+		{Proto: "tcp", Port: taken, Pid: 100},
+		{Proto: "tcp", Port: denied, Pid: 100},
+		{Proto: "tcp", Port: 80, Pid: 100},
+		{Proto: "tcp", Port: 2222, Pid: 1},
+	})
+	forwards := fi.lastReport()
+	if len(forwards) != 2 {
+		t.Fatalf("reported forwards %+v, want %d and %d", forwards, free, taken)
+	}
+	byPort := map[uint16]string{}
+	for _, fw := range forwards {
+		byPort[fw.Port] = fw.HostAddr
+	}
+	if want := fmt.Sprintf("127.0.0.1:%d", free); byPort[free] != want {
+		t.Errorf("port %d forwarded from %s, want %s", free, byPort[free], want)
+	}
+	takenAddr := byPort[taken]
+	if takenAddr == "" || takenAddr == takenLn.Addr().String() {
+		t.Errorf("port %d forwarded from %q, want a different free port", taken, takenAddr)
+	}
+	for port, addr := range byPort {
+		if got, want := roundTrip(t, addr, "hi"), fmt.Sprintf("%d:hi\n", port); got != want {
+			t.Errorf("via %s: got %q, want %q", addr, got, want)
+		}
+	}
+
+	// Closed ports stop being forwarded.
+	f.sync(ctx, []server.Port{{Proto: "tcp", Port: free, Pid: 100}})
+	if got := fi.lastReport(); len(got) != 1 || got[0].Port != free {
+		t.Errorf("after close, reported %+v", got)
+	}
+	if conn, err := net.Dial("tcp", takenAddr); err == nil {
+		conn.Close()
+		t.Errorf("%s still listening after its port closed", takenAddr)
+	}
+
+	// A port that opens again gets the same host port.
+	reports := len(fi.reported)
+	f.sync(ctx, []server.Port{{Proto: "tcp", Port: free, Pid: 100}, {Proto: "tcp", Port: taken, Pid: 100}})
+	for _, fw := range fi.lastReport() {
+		if fw.Port == taken && fw.HostAddr != takenAddr {
+			t.Errorf("port %d reopened on %s, want %s", taken, fw.HostAddr, takenAddr)
+		}
+	}
+
+	// Nothing is reported when nothing changes.
+	f.sync(ctx, []server.Port{{Proto: "tcp", Port: free, Pid: 100}, {Proto: "tcp", Port: taken, Pid: 100}})
+	if len(fi.reported) != reports+1 {
+		t.Errorf("made %d reports, want %d", len(fi.reported), reports+1)
+	}
+}
+
+// TestPortForwarderAuth checks that the outtie's token has the scopes that the port forwarder needs
+// from the container's HTTP server.
+func TestPortForwarderAuth(t *testing.T) {
+	srv, err := server.New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := server.ParseToken("tok:" + initTokenScopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := server.ParseToken("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetTokens([]server.Token{user, tok})
+	fi := &fakeInnie{}
+	innie := httptest.NewServer(srv.RequireAuth(fi))
+	defer innie.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f, err := newPortForwarder("1024-65535", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.innieAddr = strings.TrimPrefix(innie.URL, "http://")
+	f.token = "tok"
+	defer f.closeAll()
+
+	if _, err := f.pollState(ctx, -1); err != nil {
+		t.Fatalf("pollState: %v", err)
+	}
+	port := freePort(t)
+	f.sync(ctx, []server.Port{{Proto: "tcp", Port: port, Pid: 100}})
+	forwards := fi.lastReport()
+	if len(forwards) != 1 {
+		t.Fatalf("reported forwards %+v, want port %d", forwards, port)
+	}
+	if got, want := roundTrip(t, forwards[0].HostAddr, "hi"), fmt.Sprintf("%d:hi\n", port); got != want {
+		t.Errorf("via %s: got %q, want %q", forwards[0].HostAddr, got, want)
+	}
+}
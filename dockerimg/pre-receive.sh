@@ -43,7 +43,16 @@ run_with_timeout() {
     return $exit_code
 }
 
-# Read stdin for ref updates
+# Read the ref updates, so that all of them are checked for secrets before any are forwarded.
+updates=$(cat)
+
+# Reject pushes that add secrets, such as API keys, unless pushed with "-o sketch-allow-secrets".
+if [ -n "$SKETCH_CHECK_SECRETS" ]; then
+    if ! printf '%s\n' "$updates" | "$SKETCH_CHECK_SECRETS" -check-push-secrets; then
+        exit 1
+    fi
+fi
+
 while read oldrev newrev refname; do
     # Check if this is a push to refs/remotes/origin/Y pattern
     if [[ "$refname" =~ ^refs/remotes/origin/(.+)$ ]]; then
@@ -78,6 +87,6 @@ while read oldrev newrev refname; do
 
         echo "Successfully pushed to origin/$branch_name" >&2
     fi
-done
+done <<< "$updates"
 
 exit 0
@@ -0,0 +1,22 @@
+#!/usr/bin/env bash
+# Pre-receive hook for sketch git http server, without upstream passthrough.
+# Rejects pushes that add secrets, then runs the repo's own pre-receive hook, if any.
+
+set -e
+
+# Read the ref updates, so that the repo's own hook gets them too.
+updates=$(cat)
+
+# Reject pushes that add secrets, such as API keys, unless pushed with "-o sketch-allow-secrets".
+if [ -n "$SKETCH_CHECK_SECRETS" ]; then
+    if ! printf '%s\n' "$updates" | "$SKETCH_CHECK_SECRETS" -check-push-secrets; then
+        exit 1
+    fi
+fi
+
+hook={{.RepoHooks}}/pre-receive
+if [ -x "$hook" ]; then
+    printf '%s\n' "$updates" | "$hook" "$@"
+fi
+
+exit 0
@@ -33,6 +33,14 @@ var (
 			Name:        "clipboard",
 			Description: "Enable enhanced clipboard functionality in patch tool",
 		},
+		{
+			Name:        "llm_review",
+			Description: "Run an LLM review of the change in the codereview tool",
+		},
+		{
+			Name:        "benchmarks",
+			Description: "Report Go benchmark regressions in the codereview tool",
+		},
 	}
 	byName = map[string]*Experiment{}
 )
@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -30,15 +31,16 @@ type DiffFile struct {
 func GitRawDiff(repoDir, from, to string) ([]DiffFile, error) {
 	// Git command to generate the diff in raw format with full hashes and rename/copy detection
 	// --find-copies-harder enables more aggressive copy detection
+	// --end-of-options keeps from and to, which may come from HTTP requests, from being taken as options.
 	var rawCmd, numstatCmd *exec.Cmd
 	if to == "" {
 		// If 'to' is empty, show unstaged changes
-		rawCmd = exec.Command("git", "-C", repoDir, "diff", "--raw", "--abbrev=40", "-M", "-C", "--find-copies-harder", from)
-		numstatCmd = exec.Command("git", "-C", repoDir, "diff", "--numstat", from)
+		rawCmd = exec.Command("git", "-C", repoDir, "diff", "--raw", "--abbrev=40", "-M", "-C", "--find-copies-harder", "--end-of-options", from)
+		numstatCmd = exec.Command("git", "-C", repoDir, "diff", "--numstat", "--end-of-options", from)
 	} else {
 		// Normal diff between two refs
-		rawCmd = exec.Command("git", "-C", repoDir, "diff", "--raw", "--abbrev=40", "-M", "-C", "--find-copies-harder", from, to)
-		numstatCmd = exec.Command("git", "-C", repoDir, "diff", "--numstat", from, to)
+		rawCmd = exec.Command("git", "-C", repoDir, "diff", "--raw", "--abbrev=40", "-M", "-C", "--find-copies-harder", "--end-of-options", from, to)
+		numstatCmd = exec.Command("git", "-C", repoDir, "diff", "--numstat", "--end-of-options", from, to)
 	}
 
 	// Execute raw diff command
@@ -59,7 +61,7 @@ func GitRawDiff(repoDir, from, to string) ([]DiffFile, error) {
 
 // GitShow returns the result of git show for a specific commit hash
 func GitShow(repoDir, hash string) (string, error) {
-	cmd := exec.Command("git", "-C", repoDir, "show", hash)
+	cmd := exec.Command("git", "-C", repoDir, "show", "--end-of-options", hash)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return "", fmt.Errorf("error executing git show: %w - %s", err, string(out))
@@ -470,3 +472,71 @@ func GitGetUntrackedFiles(repoDir string) ([]string, error) {
 	}
 	return result, nil
 }
+
+// GitPushOptions describes a user-initiated git push.
+type GitPushOptions struct {
+	Remote string
+	Branch string
+	Commit string
+	DryRun bool
+	Force  bool
+	// PassthroughUpstream is set when the "upstream" remote passes through to the
+	// host's origin, so pushing to it updates refs/remotes/origin/<branch>.
+	PassthroughUpstream bool
+}
+
+// GitPush pushes opts.Commit to opts.Branch on opts.Remote and returns git's combined output.
+func GitPush(ctx context.Context, repoDir string, opts GitPushOptions) (string, error) {
+	args := []string{"push"}
+	if opts.DryRun {
+		args = append(args, "--dry-run")
+	}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+
+	// Determine the target refspec
+	var targetRef string
+	if opts.PassthroughUpstream && opts.Remote == "upstream" {
+		// Special case: upstream with passthrough-upstream pushes to refs/remotes/origin/<branch>
+		targetRef = fmt.Sprintf("refs/remotes/origin/%s", opts.Branch)
+	} else {
+		// Normal case: push to refs/heads/<branch>
+		targetRef = fmt.Sprintf("refs/heads/%s", opts.Branch)
+	}
+
+	args = append(args, opts.Remote, fmt.Sprintf("%s:%s", opts.Commit, targetRef))
+
+	slog.InfoContext(ctx, "executing git push command",
+		"command", "git",
+		"args", args,
+		"remote", opts.Remote,
+		"branch", opts.Branch,
+		"commit", opts.Commit,
+		"target_ref", targetRef,
+		"dry_run", opts.DryRun,
+		"force", opts.Force,
+		"repo_dir", repoDir)
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = repoDir
+	// Ideally we want to pass an extra HTTP header so that the
+	// server can know that this was likely a user initiated action
+	// and not an agent-initiated action. However, git push weirdly
+	// doesn't take a "-c" option, and the only handy env variable that
+	// because a header is the user agent, so we abuse it...
+	cmd.Env = append(os.Environ(), "GIT_HTTP_USER_AGENT=sketch-intentional-push")
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		slog.WarnContext(ctx, "git push command failed",
+			"error", err,
+			"output", string(output),
+			"args", args)
+	} else {
+		slog.InfoContext(ctx, "git push command completed successfully",
+			"output", string(output),
+			"args", args)
+	}
+	return string(output), err
+}
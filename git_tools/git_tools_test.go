@@ -130,6 +130,18 @@ func TestGitShow(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for invalid commit hash, got none")
 	}
+
+	// Options are not taken as options
+	outFile := filepath.Join(repoDir, "written")
+	if _, err := GitShow(repoDir, "--output="+outFile); err == nil {
+		t.Error("Expected error for an option as the hash, got none")
+	}
+	if _, err := GitRawDiff(repoDir, "--output="+outFile, commitHash); err == nil {
+		t.Error("Expected error for an option as the from commit, got none")
+	}
+	if _, err := os.Stat(outFile); err == nil {
+		t.Error("git wrote the file named by an --output option")
+	}
 }
 
 func TestParseGitLog(t *testing.T) {
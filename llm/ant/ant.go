@@ -438,6 +438,10 @@ func toLLMResponse(r *response) *llm.Response {
 
 // Do sends a request to Anthropic.
 func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error) {
+	return llm.TraceDo(ctx, "ant.Do", cmp.Or(s.Model, DefaultModel), ir, s.do)
+}
+
+func (s *Service) do(ctx context.Context, ir *llm.Request) (*llm.Response, error) {
 	request := s.fromLLMRequest(ir)
 
 	var payload []byte
@@ -472,6 +476,7 @@ func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error
 		if attempts > 0 {
 			sleep := backoff[min(attempts, len(backoff)-1)] + time.Duration(rand.Int64N(int64(time.Second)))
 			slog.WarnContext(ctx, "anthropic request sleep before retry", "sleep", sleep, "attempts", attempts)
+			llm.TraceRetry(ctx, attempts, sleep)
 			time.Sleep(sleep)
 		}
 		if s.DumpLLM {
@@ -1,6 +1,7 @@
 package conversation
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
@@ -15,10 +16,14 @@ import (
 
 	"github.com/oklog/ulid/v2"
 	"github.com/richardlehane/crock32"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"sketch.dev/llm"
 	"sketch.dev/skribe"
 )
 
+var tracer = skribe.Tracer("sketch.dev/llm/conversation")
+
 type Listener interface {
 	// TODO: Content is leaking an anthropic API; should we avoid it?
 	// TODO: Where should we include start/end time and usage?
@@ -84,6 +89,9 @@ type Convo struct {
 	Hidden bool
 	// ExtraData is extra data to make available to all tool calls.
 	ExtraData map[string]any
+	// Redact, if set, is applied to the text of tool results before they are recorded or sent to the LLM.
+	// It is inherited by sub-conversations.
+	Redact func(string) string
 
 	// messages tracks the messages so far in the conversation.
 	messages []llm.Message
@@ -150,6 +158,7 @@ func (c *Convo) SubConvo() *Convo {
 		usage:         newUsageWithSharedToolUses(c.usage),
 		mu:            c.mu,
 		Listener:      c.Listener,
+		Redact:        c.Redact,
 		ID:            id,
 		toolUseCancel: map[string]context.CancelCauseFunc{},
 		// Do not copy Budget. Each budget is independent,
@@ -169,6 +178,7 @@ func (c *Convo) SubConvoWithHistory() *Convo {
 		usage:    newUsageWithSharedToolUses(c.usage),
 		mu:       c.mu,
 		Listener: c.Listener,
+		Redact:   c.Redact,
 		ID:       id,
 		// Do not copy Budget. Each budget is independent,
 		// and OverBudget checks whether any ancestor is over budget.
@@ -296,6 +306,31 @@ func (c *Convo) insertMissingToolResults(mr *llm.Request, msg *llm.Message) {
 // SendMessage sends a message to Claude.
 // The conversation records (internally) all messages succesfully sent and received.
 func (c *Convo) SendMessage(msg llm.Message) (*llm.Response, error) {
+	return c.SendMessageContext(c.Ctx, msg)
+}
+
+// SendMessageContext is like SendMessage, but records its trace span
+// as a child of the span in ctx (if any), such as an agent turn or a tool call.
+// ctx is used only for tracing; the request itself is still bound to c.Ctx.
+func (c *Convo) SendMessageContext(ctx context.Context, msg llm.Message) (resp *llm.Response, err error) {
+	_, span := tracer.Start(ctx, "convo.SendMessage", trace.WithAttributes(
+		attribute.String("sketch.convo_id", c.ID),
+		attribute.Int("sketch.convo_depth", c.Depth()),
+	))
+	defer func() {
+		if resp != nil {
+			span.SetAttributes(
+				attribute.String("llm.stop_reason", resp.StopReason.String()),
+				attribute.Int64("llm.usage.input_tokens", int64(resp.Usage.InputTokens)),
+				attribute.Int64("llm.usage.output_tokens", int64(resp.Usage.OutputTokens)),
+				attribute.Float64("llm.usage.cost_usd", resp.Usage.CostUSD),
+			)
+		}
+		skribe.EndSpan(span, err)
+	}()
+	// Keep c.Ctx's cancellation and log attributes, but parent provider spans on ours.
+	reqCtx := trace.ContextWithSpan(c.Ctx, span)
+
 	id := ulid.Make().String()
 	mr := c.messageRequest(msg)
 	var lastMessage *llm.Message
@@ -317,7 +352,7 @@ func (c *Convo) SendMessage(msg llm.Message) (*llm.Response, error) {
 	c.Listener.OnRequest(c.Ctx, c, id, &msg)
 
 	startTime := time.Now()
-	resp, err := c.Service.Do(c.Ctx, mr)
+	resp, err = c.Service.Do(reqCtx, mr)
 	if resp != nil {
 		resp.StartTime = &startTime
 		endTime := time.Now()
@@ -452,10 +487,10 @@ func (c *Convo) ToolResultContents(ctx context.Context, resp *llm.Response) ([]l
 				content.ToolUseEndTime = &endTime
 
 				content.ToolError = true
-				content.ToolResult = []llm.Content{{
+				content.ToolResult = c.redactContents([]llm.Content{{
 					Type: llm.ContentTypeText,
 					Text: err.Error(),
-				}}
+				}})
 				c.Listener.OnToolResult(ctx, c, part.ID, part.ToolName, part.ToolInput, content, nil, err)
 				toolResultC <- content
 			}
@@ -464,11 +499,11 @@ func (c *Convo) ToolResultContents(ctx context.Context, resp *llm.Response) ([]l
 				endTime := time.Now()
 				content.ToolUseEndTime = &endTime
 
-				content.ToolResult = toolOut.LLMContent
+				content.ToolResult = c.redactContents(toolOut.LLMContent)
 				content.Display = toolOut.Display
 				var firstText string
-				if len(toolOut.LLMContent) > 0 {
-					firstText = toolOut.LLMContent[0].Text
+				if len(content.ToolResult) > 0 {
+					firstText = content.ToolResult[0].Text
 				}
 				c.Listener.OnToolResult(ctx, c, part.ID, part.ToolName, part.ToolInput, content, &firstText, nil)
 				toolResultC <- content
@@ -483,9 +518,17 @@ func (c *Convo) ToolResultContents(ctx context.Context, resp *llm.Response) ([]l
 			// cancel function so that it can be canceled individually.
 			toolUseCtx, cancel := c.newToolUseContext(ctx, part.ID)
 			defer cancel()
+			// The tool's span travels in toolUseCtx alongside its ToolCallInfo,
+			// so work the tool does on our behalf (e.g. SendMessageContext on a SubConvo) nests under it.
+			toolUseCtx, span := tracer.Start(toolUseCtx, "tool.Run", trace.WithAttributes(
+				attribute.String("sketch.tool_name", part.ToolName),
+				attribute.String("sketch.tool_use_id", part.ID),
+				attribute.String("sketch.convo_id", c.ID),
+			))
 			// TODO: move this into newToolUseContext?
 			toolUseCtx = context.WithValue(toolUseCtx, toolCallInfoKey, ToolCallInfo{ToolUseID: part.ID, Convo: c})
 			toolOut := tool.Run(toolUseCtx, part.ToolInput)
+			skribe.EndSpan(span, cmp.Or(toolOut.Error, context.Cause(toolUseCtx)))
 			if errors.Is(toolOut.Error, ErrDoNotRespond) {
 				return
 			}
@@ -513,6 +556,18 @@ func (c *Convo) ToolResultContents(ctx context.Context, resp *llm.Response) ([]l
 	return toolResults, endsTurn, nil
 }
 
+// redactContents returns contents with c.Redact applied to their text.
+func (c *Convo) redactContents(contents []llm.Content) []llm.Content {
+	if c.Redact == nil {
+		return contents
+	}
+	contents = slices.Clone(contents)
+	for i := range contents {
+		contents[i].Text = c.Redact(contents[i].Text)
+	}
+	return contents
+}
+
 func (c *Convo) incrementToolUse(name string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -3,12 +3,19 @@ package conversation
 import (
 	"cmp"
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"slices"
 	"strings"
+	"sync"
 	"testing"
 
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"sketch.dev/httprr"
 	"sketch.dev/llm"
 	"sketch.dev/llm/ant"
@@ -296,3 +303,128 @@ func TestInsertMissingToolResults(t *testing.T) {
 		})
 	}
 }
+
+// stubService replies to each request with the next canned response.
+type stubService struct {
+	mu        sync.Mutex
+	responses []*llm.Response
+}
+
+func (s *stubService) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.responses) == 0 {
+		return nil, fmt.Errorf("stubService: no responses left")
+	}
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	return resp, nil
+}
+
+func (s *stubService) TokenContextWindow() int { return 200000 }
+
+// TestTraceSpans checks that tool spans nest under the caller's span,
+// and that subconversations started by a tool nest under the tool's span.
+func TestTraceSpans(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	srv := &stubService{responses: []*llm.Response{
+		{
+			StopReason: llm.StopReasonToolUse,
+			Content:    []llm.Content{{Type: llm.ContentTypeToolUse, ID: "tu1", ToolName: "ask", ToolInput: json.RawMessage(`{}`)}},
+		},
+		{StopReason: llm.StopReasonEndTurn, Content: llm.TextContent("sub answer")},
+	}}
+	convo := New(context.Background(), srv, nil)
+	convo.Tools = []*llm.Tool{{
+		Name:        "ask",
+		InputSchema: llm.EmptySchema(),
+		Run: func(ctx context.Context, input json.RawMessage) llm.ToolOut {
+			sub := convo.SubConvo()
+			resp, err := sub.SendMessageContext(ctx, llm.UserStringMessage("question"))
+			if err != nil {
+				return llm.ErrorToolOut(err)
+			}
+			return llm.ToolOut{LLMContent: resp.Content}
+		},
+	}}
+
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+	resp, err := convo.SendMessageContext(ctx, llm.UserStringMessage("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := convo.ToolResultContents(ctx, resp); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, s := range sr.Ended() {
+		spans[s.Name()] = append(spans[s.Name()], s)
+	}
+	sends := spans["convo.SendMessage"]
+	tools := spans["tool.Run"]
+	if len(sends) != 2 || len(tools) != 1 {
+		t.Fatalf("got %d convo.SendMessage and %d tool.Run spans, want 2 and 1", len(sends), len(tools))
+	}
+	rootID := root.SpanContext().SpanID()
+	tool := tools[0]
+	if tool.Parent().SpanID() != rootID {
+		t.Errorf("tool.Run parent = %v, want root %v", tool.Parent().SpanID(), rootID)
+	}
+	var parents []trace.SpanID
+	for _, s := range sends {
+		parents = append(parents, s.Parent().SpanID())
+	}
+	if !slices.Contains(parents, rootID) || !slices.Contains(parents, tool.SpanContext().SpanID()) {
+		t.Errorf("convo.SendMessage parents = %v, want root %v and tool.Run %v", parents, rootID, tool.SpanContext().SpanID())
+	}
+}
+
+func TestRedactToolResults(t *testing.T) {
+	convo := New(context.Background(), &stubService{}, nil)
+	convo.Redact = func(s string) string { return strings.ReplaceAll(s, "hunter2", "[REDACTED]") }
+	convo.Tools = []*llm.Tool{
+		{
+			Name:        "cat",
+			InputSchema: llm.EmptySchema(),
+			Run: func(ctx context.Context, input json.RawMessage) llm.ToolOut {
+				return llm.ToolOut{LLMContent: llm.TextContent("password: hunter2")}
+			},
+		},
+		{
+			Name:        "fail",
+			InputSchema: llm.EmptySchema(),
+			Run: func(ctx context.Context, input json.RawMessage) llm.ToolOut {
+				return llm.ErrorfToolOut("bad password hunter2")
+			},
+		},
+	}
+	resp := &llm.Response{
+		StopReason: llm.StopReasonToolUse,
+		Content: []llm.Content{
+			{Type: llm.ContentTypeToolUse, ID: "tu1", ToolName: "cat", ToolInput: json.RawMessage(`{}`)},
+			{Type: llm.ContentTypeToolUse, ID: "tu2", ToolName: "fail", ToolInput: json.RawMessage(`{}`)},
+		},
+	}
+	if convo.SubConvo().Redact == nil {
+		t.Error("sub-conversation doesn't inherit Redact")
+	}
+	results, _, err := convo.ToolResultContents(context.Background(), resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	for _, r := range results {
+		if text := r.ToolResult[0].Text; strings.Contains(text, "hunter2") || !strings.Contains(text, "[REDACTED]") {
+			t.Errorf("tool result %s = %q, want it redacted", r.ToolUseID, text)
+		}
+	}
+}
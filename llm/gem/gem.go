@@ -463,6 +463,10 @@ func (s *Service) TokenContextWindow() int {
 
 // Do sends a request to Gemini.
 func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error) {
+	return llm.TraceDo(ctx, "gem.Do", cmp.Or(s.Model, DefaultModel), ir, s.do)
+}
+
+func (s *Service) do(ctx context.Context, ir *llm.Request) (*llm.Response, error) {
 	// Log the incoming request for debugging
 	slog.DebugContext(ctx, "gemini_request",
 		"message_count", len(ir.Messages),
@@ -569,6 +573,7 @@ func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error
 			random := time.Duration(rand.Int63n(int64(time.Second)))
 			sleep := backoff[attempts] + random
 			slog.WarnContext(ctx, "gemini_request_retry", "error", gemApiErr.Error(), "attempt", attempts+1, "sleep", sleep)
+			llm.TraceRetry(ctx, attempts+1, sleep)
 			time.Sleep(sleep)
 			continue
 		}
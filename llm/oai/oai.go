@@ -745,6 +745,10 @@ func (s *Service) TokenContextWindow() int {
 
 // Do sends a request to OpenAI using the go-openai package.
 func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error) {
+	return llm.TraceDo(ctx, "oai.Do", cmp.Or(s.Model, DefaultModel).ModelName, ir, s.do)
+}
+
+func (s *Service) do(ctx context.Context, ir *llm.Request) (*llm.Response, error) {
 	// Configure the OpenAI client
 	httpc := cmp.Or(s.HTTPC, http.DefaultClient)
 	model := cmp.Or(s.Model, DefaultModel)
@@ -816,6 +820,7 @@ func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error
 		if attempts > 0 {
 			sleep := backoff[min(attempts, len(backoff)-1)] + time.Duration(rand.Int64N(int64(time.Second)))
 			slog.WarnContext(ctx, "openai request sleep before retry", "sleep", sleep, "attempts", attempts)
+			llm.TraceRetry(ctx, attempts, sleep)
 			time.Sleep(sleep)
 		}
 
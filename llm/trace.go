@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"sketch.dev/skribe"
+)
+
+var tracer = skribe.Tracer("sketch.dev/llm")
+
+// TraceDo runs do, an llm.Service Do implementation, inside a trace span called name.
+// Providers wrap their Do methods with it so that every LLM call shows up in traces
+// with its model, token usage, and stop reason.
+func TraceDo(ctx context.Context, name, model string, ir *Request, do func(context.Context, *Request) (*Response, error)) (*Response, error) {
+	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("llm.model", model),
+		attribute.Int("llm.request.messages", len(ir.Messages)),
+		attribute.Int("llm.request.tools", len(ir.Tools)),
+	))
+	resp, err := do(ctx, ir)
+	if resp != nil {
+		span.SetAttributes(
+			attribute.String("llm.response.model", resp.Model),
+			attribute.String("llm.stop_reason", resp.StopReason.String()),
+			attribute.Int64("llm.usage.input_tokens", int64(resp.Usage.InputTokens)),
+			attribute.Int64("llm.usage.cache_read_input_tokens", int64(resp.Usage.CacheReadInputTokens)),
+			attribute.Int64("llm.usage.cache_creation_input_tokens", int64(resp.Usage.CacheCreationInputTokens)),
+			attribute.Int64("llm.usage.output_tokens", int64(resp.Usage.OutputTokens)),
+			attribute.Float64("llm.usage.cost_usd", resp.Usage.CostUSD),
+		)
+	}
+	skribe.EndSpan(span, err)
+	return resp, err
+}
+
+// TraceRetry notes on the span in ctx (if any) that an LLM request
+// is about to be retried after sleeping for sleep.
+func TraceRetry(ctx context.Context, attempt int, sleep time.Duration) {
+	trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+		attribute.Int("attempt", attempt),
+		attribute.String("sleep", sleep.String()),
+	))
+}
@@ -19,8 +19,11 @@ import (
 	"text/template"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"sketch.dev/browser"
 	"sketch.dev/claudetool"
+	"sketch.dev/claudetool/bashkit"
 	"sketch.dev/claudetool/browse"
 	"sketch.dev/claudetool/codereview"
 	"sketch.dev/claudetool/onstart"
@@ -29,10 +32,15 @@ import (
 	"sketch.dev/llm/ant"
 	"sketch.dev/llm/conversation"
 	"sketch.dev/mcp"
+	"sketch.dev/notify"
+	"sketch.dev/secrets"
 	"sketch.dev/skabandclient"
+	"sketch.dev/skribe"
 	"tailscale.com/portlist"
 )
 
+var tracer = skribe.Tracer("sketch.dev/loop")
+
 const (
 	userCancelMessage = "user requested agent to stop handling responses"
 )
@@ -163,6 +171,18 @@ type CodingAgent interface {
 	// GetPorts returns the cached list of open TCP ports
 	GetPorts() []portlist.Port
 
+	// GetPortProbes returns what probing found out about open TCP ports, by port number
+	GetPortProbes() map[uint16]PortProbe
+
+	// Jobs returns the background commands the agent has started
+	Jobs() []claudetool.JobInfo
+
+	// KillJob stops a background command started by the agent
+	KillJob(id int) error
+
+	// CodeReviewReport returns the findings of the most recent code review
+	CodeReviewReport() codereview.Report
+
 	// TokenContextWindow returns the TokenContextWindow size of the model the agent is using.
 	TokenContextWindow() int
 
@@ -344,6 +364,7 @@ type ConvoInterface interface {
 	ResetBudget(conversation.Budget)
 	OverBudget() error
 	SendMessage(message llm.Message) (*llm.Response, error)
+	SendMessageContext(ctx context.Context, message llm.Message) (*llm.Response, error)
 	SendUserTextMessage(s string, otherContents ...llm.Content) (*llm.Response, error)
 	GetID() string
 	ToolResultContents(ctx context.Context, resp *llm.Response) ([]llm.Content, bool, error)
@@ -444,6 +465,7 @@ type Agent struct {
 	startedAt         time.Time
 	originalBudget    conversation.Budget
 	codereview        *codereview.CodeReviewer
+	bashRules         *bashkit.Checker // checks bash commands; approvals persist across compactions
 	// State machine to track agent state
 	stateMachine *StateMachine
 	// Outside information
@@ -454,6 +476,8 @@ type Agent struct {
 	mcpManager *mcp.MCPManager
 	// Port monitor for tracking TCP ports
 	portMonitor *PortMonitor
+	// Background commands started by the bash tool
+	jobs *claudetool.Jobs
 
 	// Time when the current turn started (reset at the beginning of InnerLoop)
 	startOfTurn time.Time
@@ -751,6 +775,38 @@ func (a *Agent) GetPorts() []portlist.Port {
 	return a.portMonitor.GetPorts()
 }
 
+// Jobs returns the background commands the agent has started.
+func (a *Agent) Jobs() []claudetool.JobInfo {
+	if a.jobs == nil {
+		return nil
+	}
+	return a.jobs.List()
+}
+
+// KillJob stops a background command started by the agent.
+func (a *Agent) KillJob(id int) error {
+	if a.jobs == nil {
+		return fmt.Errorf("no job %d", id)
+	}
+	return a.jobs.Kill(id)
+}
+
+// CodeReviewReport returns the findings of the most recent code review.
+func (a *Agent) CodeReviewReport() codereview.Report {
+	if a.codereview == nil {
+		return codereview.Report{Findings: []codereview.Finding{}}
+	}
+	return a.codereview.Report()
+}
+
+// GetPortProbes returns what probing found out about open TCP ports, by port number.
+func (a *Agent) GetPortProbes() map[uint16]PortProbe {
+	if a.portMonitor == nil {
+		return nil
+	}
+	return a.portMonitor.GetProbes()
+}
+
 // BranchName returns the git branch name for the conversation.
 func (a *Agent) BranchName() string {
 	return a.gitState.BranchName(a.config.BranchPrefix)
@@ -1150,6 +1206,12 @@ type AgentConfig struct {
 	PassthroughUpstream bool
 	// FetchOnLaunch enables git fetch during initialization
 	FetchOnLaunch bool
+	// Notifier receives notifications about agent events (optional)
+	Notifier *notify.Notifier
+	// ReviewReportPath, if set, is where to write code review findings after each review (see codereview.CodeReviewer.SetReportPath)
+	ReviewReportPath string
+	// ReviewCacheDir, if set, is where code review keeps baselines across sessions (see codereview.CodeReviewer.SetCacheDir)
+	ReviewCacheDir string
 }
 
 // NewAgent creates a new Agent.
@@ -1186,6 +1248,8 @@ func NewAgent(config AgentConfig) *Agent {
 
 	// Initialize port monitor with 5-second interval
 	agent.portMonitor = NewPortMonitor(agent, 5*time.Second)
+	agent.jobs = claudetool.NewJobs()
+	agent.jobs.ListPorts = agent.GetPorts
 
 	return agent
 }
@@ -1358,9 +1422,18 @@ func (a *Agent) Init(ini AgentInit) error {
 		if err != nil {
 			return fmt.Errorf("Agent.Init: codereview.NewCodeReviewer: %w", err)
 		}
+		codereview.SetCodebase(codebase)
+		codereview.SetReportPath(a.config.ReviewReportPath)
+		codereview.SetCacheDir(a.config.ReviewCacheDir)
 		a.codereview = codereview
 
 	}
+	a.bashRules = bashkit.NewChecker(bashkit.Env{Dir: a.workingDir, RepoRoot: a.repoRoot})
+	if a.repoRoot != "" {
+		if err := a.bashRules.LoadConfig(filepath.Join(a.repoRoot, bashkit.ConfigPath)); err != nil {
+			slog.WarnContext(ctx, "invalid bash rules config", "err", err)
+		}
+	}
 	a.gitState.lastSketch = a.SketchGitBase()
 	a.convo = a.initConvo()
 	close(a.ready)
@@ -1390,6 +1463,8 @@ func (a *Agent) initConvoWithUsage(usage *conversation.CumulativeUsage) *convers
 		EnableJITInstall: claudetool.EnableBashToolJITInstall,
 		Timeouts:         a.config.BashTimeouts,
 		Pwd:              a.workingDir,
+		Jobs:             a.jobs,
+		Rules:            a.bashRules,
 	}
 	patchTool := &claudetool.PatchTool{
 		Callback:         a.patchCallback,
@@ -1417,6 +1492,7 @@ func (a *Agent) initConvoWithUsage(usage *conversation.CumulativeUsage) *convers
 
 	convo.Tools = []*llm.Tool{
 		bashTool.Tool(),
+		a.jobs.Tool(),
 		claudetool.Keyword,
 		patchTool.Tool(),
 		claudetool.Think,
@@ -1474,6 +1550,8 @@ func (a *Agent) initConvoWithUsage(usage *conversation.CumulativeUsage) *convers
 	}
 
 	convo.Listener = a
+	// Keep credentials that tools print, e.g. by reading a .env file, out of the conversation.
+	convo.Redact = secrets.Redact
 	return convo
 }
 
@@ -1616,6 +1694,10 @@ func (a *Agent) LinkToGitHub() bool {
 }
 
 func (a *Agent) UserMessage(ctx context.Context, msg string) {
+	// Commands that the model was told to ask about run only if the user explicitly approves them.
+	if a.bashRules != nil {
+		a.bashRules.Approve(msg)
+	}
 	a.pushToOutbox(ctx, AgentMessage{Type: UserMessageType, Content: msg})
 	a.inbox <- msg
 }
@@ -1694,6 +1776,12 @@ func (a *Agent) pushToOutbox(ctx context.Context, m AgentMessage) {
 		slog.InfoContext(ctx, "Turn completed", "turnDuration", turnDuration)
 	}
 
+	if a.config.Notifier != nil {
+		if ev, ok := a.notificationFor(m); ok {
+			a.config.Notifier.Notify(ctx, ev)
+		}
+	}
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	m.Idx = len(a.history)
@@ -1706,6 +1794,56 @@ func (a *Agent) pushToOutbox(ctx context.Context, m AgentMessage) {
 	}
 }
 
+// notificationFor returns the notification, if any, that m warrants.
+func (a *Agent) notificationFor(m AgentMessage) (notify.Event, bool) {
+	if m.HideOutput {
+		return notify.Event{}, false
+	}
+	ev := notify.Event{
+		SessionID: a.config.SessionID,
+		Slug:      a.Slug(),
+		URL:       a.URL(),
+		Time:      m.Timestamp,
+	}
+	title := func(s string) string {
+		if ev.Slug != "" {
+			return "sketch " + ev.Slug + ": " + s
+		}
+		return "sketch: " + s
+	}
+	switch m.Type {
+	case AgentMessageType:
+		if !m.EndOfTurn {
+			return notify.Event{}, false
+		}
+		ev.Message = strings.TrimSpace(m.Content)
+		if strings.HasSuffix(ev.Message, "?") {
+			ev.Kind, ev.Title = notify.KindQuestion, title("has a question")
+		} else {
+			ev.Kind, ev.Title = notify.KindEndOfTurn, title("finished its turn")
+		}
+	case ErrorMessageType:
+		ev.Kind, ev.Title, ev.Message = notify.KindError, title("error"), m.Content
+	case BudgetMessageType:
+		ev.Kind, ev.Title, ev.Message = notify.KindBudget, title("budget exceeded"), m.Content
+	case CommitMessageType:
+		var pushed []string
+		for _, c := range m.Commits {
+			if c.PushedBranch != "" {
+				pushed = append(pushed, c.PushedBranch)
+			}
+		}
+		if len(pushed) == 0 {
+			return notify.Event{}, false
+		}
+		ev.Kind, ev.Title = notify.KindCommit, title("pushed commits")
+		ev.Message = fmt.Sprintf("%d new commit(s); pushed to %s", len(m.Commits), strings.Join(pushed, ", "))
+	default:
+		return notify.Event{}, false
+	}
+	return ev, true
+}
+
 func (a *Agent) GatherMessages(ctx context.Context, block bool) ([]llm.Content, error) {
 	var m []llm.Content
 	if block {
@@ -1727,10 +1865,18 @@ func (a *Agent) GatherMessages(ctx context.Context, block bool) ([]llm.Content,
 }
 
 // processTurn handles a single conversation turn with the user
-func (a *Agent) processTurn(ctx context.Context) error {
+func (a *Agent) processTurn(ctx context.Context) (err error) {
 	// Reset the start of turn time
 	a.startOfTurn = time.Now()
 
+	ctx, span := tracer.Start(ctx, "agent.processTurn", trace.WithAttributes(
+		attribute.String("sketch.session_id", a.config.SessionID),
+	))
+	defer func() {
+		span.SetAttributes(attribute.String("sketch.end_state", a.CurrentStateName()))
+		skribe.EndSpan(span, err)
+	}()
+
 	// Transition to waiting for user input state
 	a.stateMachine.Transition(ctx, StateWaitingForUserInput, "Starting turn")
 
@@ -1840,7 +1986,7 @@ func (a *Agent) processUserMessage(ctx context.Context) (*llm.Response, error) {
 	a.stateMachine.Transition(ctx, StateSendingToLLM, "Sending user message to LLM")
 
 	// Send message to the model
-	resp, err := a.convo.SendMessage(userMessage)
+	resp, err := a.convo.SendMessageContext(ctx, userMessage)
 	if err != nil {
 		a.stateMachine.Transition(ctx, StateError, "Error sending to LLM: "+err.Error())
 		a.pushToOutbox(ctx, errorMessage(err))
@@ -1933,11 +2079,20 @@ func (a *Agent) processGitChanges(ctx context.Context) []string {
 		return nil
 	}
 
+	var autoqualityMessages []string
+	if msg := a.checkCommitsForSecrets(ctx, newCommits); msg != "" {
+		a.pushToOutbox(ctx, AgentMessage{
+			Type:      AutoMessageType,
+			Content:   msg,
+			Timestamp: time.Now(),
+		})
+		autoqualityMessages = append(autoqualityMessages, msg)
+	}
+
 	// Run mechanical checks if there was exactly one new commit.
 	if len(newCommits) != 1 {
-		return nil
+		return autoqualityMessages
 	}
-	var autoqualityMessages []string
 	a.stateMachine.Transition(ctx, StateRunningAutoformatters, "Running mechanical checks on new commit")
 	msg := a.codereview.RunMechanicalChecks(ctx)
 	if msg != "" {
@@ -1952,6 +2107,39 @@ func (a *Agent) processGitChanges(ctx context.Context) []string {
 	return autoqualityMessages
 }
 
+// checkCommitsForSecrets scans new commits for credentials,
+// returning a message asking the agent to remove them, or the empty string if there are none.
+// Pushes of such commits to the host are rejected, so this tells the agent why, and what to do.
+func (a *Agent) checkCommitsForSecrets(ctx context.Context, commits []*GitCommit) string {
+	if len(commits) == 0 {
+		return ""
+	}
+	args := []string{"--no-walk"}
+	for _, c := range commits {
+		args = append(args, c.Hash)
+	}
+	findings, err := secrets.ScanCommits(ctx, a.repoRoot, args...)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to scan new commits for secrets", "error", err)
+		return ""
+	}
+	if len(findings) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("These commits appear to contain secrets, such as API keys or passwords:\n")
+	for i, f := range findings {
+		if i == 20 {
+			fmt.Fprintf(&b, "...and %d more\n", len(findings)-i)
+			break
+		}
+		fmt.Fprintf(&b, "- %s\n", f)
+	}
+	fmt.Fprintf(&b, "Rewrite the commits to remove them, e.g. by loading the values from the environment instead, and tell the user about any that may be real credentials that need to be revoked. "+
+		"Until then, pushes to the host are rejected. If a value is not actually secret, such as a fake key in a test fixture, add %q in a comment on its line.", secrets.AllowMarker)
+	return b.String()
+}
+
 // continueTurnWithToolResults continues the conversation with tool results
 func (a *Agent) continueTurnWithToolResults(ctx context.Context, results []llm.Content, autoqualityMessages []string, cancelled bool) (bool, *llm.Response) {
 	// Get any messages the user sent while tools were executing
@@ -1985,7 +2173,7 @@ func (a *Agent) continueTurnWithToolResults(ctx context.Context, results []llm.C
 
 	// Send the combined message to continue the conversation
 	a.stateMachine.Transition(ctx, StateSendingToolResults, "Sending tool results back to LLM")
-	resp, err := a.convo.SendMessage(llm.Message{
+	resp, err := a.convo.SendMessageContext(ctx, llm.Message{
 		Role:    llm.MessageRoleUser,
 		Content: results,
 	})
@@ -3,18 +3,25 @@ package loop
 import (
 	"cmp"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
 	"testing"
 	"time"
 
+	"sketch.dev/claudetool"
+	"sketch.dev/claudetool/bashkit"
 	"sketch.dev/httprr"
 	"sketch.dev/llm"
 	"sketch.dev/llm/ant"
 	"sketch.dev/llm/conversation"
+	"sketch.dev/notify"
 )
 
 // TestAgentLoop tests that the Agent loop functionality works correctly.
@@ -288,6 +295,10 @@ func (m *MockConvoInterface) SendMessage(message llm.Message) (*llm.Response, er
 	return nil, nil
 }
 
+func (m *MockConvoInterface) SendMessageContext(ctx context.Context, message llm.Message) (*llm.Response, error) {
+	return m.SendMessage(message)
+}
+
 func (m *MockConvoInterface) SendUserTextMessage(s string, otherContents ...llm.Content) (*llm.Response, error) {
 	if m.sendUserTextMessageFunc != nil {
 		return m.sendUserTextMessageFunc(s, otherContents...)
@@ -534,6 +545,10 @@ func (m *mockConvoInterface) SendMessage(message llm.Message) (*llm.Response, er
 	return &llm.Response{StopReason: llm.StopReasonEndTurn}, nil
 }
 
+func (m *mockConvoInterface) SendMessageContext(ctx context.Context, message llm.Message) (*llm.Response, error) {
+	return m.SendMessage(message)
+}
+
 func (m *mockConvoInterface) SendUserTextMessage(s string, otherContents ...llm.Content) (*llm.Response, error) {
 	return m.SendMessage(llm.UserStringMessage(s))
 }
@@ -953,3 +968,139 @@ func TestSystemPromptIncludesDateTime(t *testing.T) {
 		}
 	}
 }
+
+func TestNotificationFor(t *testing.T) {
+	agent := &Agent{config: AgentConfig{SessionID: "s1"}, url: "http://localhost:1234"}
+	agent.gitState.slug = "fix-bug"
+
+	tests := []struct {
+		name      string
+		msg       AgentMessage
+		wantKind  notify.Kind
+		wantTitle string
+		wantMsg   string
+		wantNone  bool
+	}{
+		{
+			name:      "end of turn",
+			msg:       AgentMessage{Type: AgentMessageType, EndOfTurn: true, Content: "All done.\n"},
+			wantKind:  notify.KindEndOfTurn,
+			wantTitle: "sketch fix-bug: finished its turn",
+			wantMsg:   "All done.",
+		},
+		{
+			name:      "question",
+			msg:       AgentMessage{Type: AgentMessageType, EndOfTurn: true, Content: "Should I use Postgres or SQLite?"},
+			wantKind:  notify.KindQuestion,
+			wantTitle: "sketch fix-bug: has a question",
+			wantMsg:   "Should I use Postgres or SQLite?",
+		},
+		{
+			name:     "mid-turn agent message",
+			msg:      AgentMessage{Type: AgentMessageType, Content: "Looking at the code?"},
+			wantNone: true,
+		},
+		{
+			name:     "hidden subconversation",
+			msg:      AgentMessage{Type: AgentMessageType, EndOfTurn: true, HideOutput: true},
+			wantNone: true,
+		},
+		{
+			name:      "error",
+			msg:       errorMessage(fmt.Errorf("boom")),
+			wantKind:  notify.KindError,
+			wantTitle: "sketch fix-bug: error",
+			wantMsg:   "boom",
+		},
+		{
+			name:      "budget",
+			msg:       budgetMessage(fmt.Errorf("over budget")),
+			wantKind:  notify.KindBudget,
+			wantTitle: "sketch fix-bug: budget exceeded",
+			wantMsg:   "over budget",
+		},
+		{
+			name:      "pushed commits",
+			msg:       AgentMessage{Type: CommitMessageType, Commits: []*GitCommit{{Hash: "a"}, {Hash: "b", PushedBranch: "sketch/fix-bug"}}},
+			wantKind:  notify.KindCommit,
+			wantTitle: "sketch fix-bug: pushed commits",
+			wantMsg:   "2 new commit(s); pushed to sketch/fix-bug",
+		},
+		{
+			name:     "unpushed commits",
+			msg:      AgentMessage{Type: CommitMessageType, Commits: []*GitCommit{{Hash: "a"}}},
+			wantNone: true,
+		},
+		{
+			name:     "tool use",
+			msg:      AgentMessage{Type: ToolUseMessageType, EndOfTurn: true},
+			wantNone: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, ok := agent.notificationFor(tt.msg)
+			if ok == tt.wantNone {
+				t.Fatalf("notificationFor ok = %v, want %v", ok, !tt.wantNone)
+			}
+			if tt.wantNone {
+				return
+			}
+			if ev.Kind != tt.wantKind || ev.Title != tt.wantTitle || ev.Message != tt.wantMsg {
+				t.Errorf("got %q %q %q, want %q %q %q", ev.Kind, ev.Title, ev.Message, tt.wantKind, tt.wantTitle, tt.wantMsg)
+			}
+			if ev.SessionID != "s1" || ev.Slug != "fix-bug" || ev.URL != "http://localhost:1234" {
+				t.Errorf("event missing session info: %+v", ev)
+			}
+		})
+	}
+}
+
+// TestUserMessageApprovesCommands checks that a command that needs approval stays blocked
+// until the user's reply explicitly approves it.
+func TestUserMessageApprovesCommands(t *testing.T) {
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-b", "main"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "--allow-empty", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "f.txt"), []byte("one\n"), 0o600)
+	if out, err := exec.Command("git", "-C", dir, "add", "f.txt").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+
+	agent := &Agent{
+		inbox:     make(chan string, 10),
+		bashRules: bashkit.NewChecker(bashkit.Env{Dir: dir, RepoRoot: dir}),
+	}
+	bash := &claudetool.BashTool{Rules: agent.bashRules, Pwd: dir}
+	run := func() llm.ToolOut {
+		return bash.Tool().Run(context.Background(), json.RawMessage(`{"command": "git reset --hard"}`))
+	}
+
+	out := run()
+	if out.Error == nil {
+		t.Fatal("git reset --hard over uncommitted changes ran without approval")
+	}
+	code := regexp.MustCompile(`approve ([0-9a-f]{6})`).FindStringSubmatch(out.Error.Error())
+	if code == nil {
+		t.Fatalf("error doesn't say how to approve: %v", out.Error)
+	}
+
+	agent.UserMessage(context.Background(), "no, don't do that")
+	if out := run(); out.Error == nil {
+		t.Fatal("the command ran after the user declined")
+	}
+
+	agent.UserMessage(context.Background(), "OK, approve "+code[1])
+	if out := run(); out.Error != nil {
+		t.Fatalf("the command didn't run after the user approved it: %v", out.Error)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "f.txt")); !os.IsNotExist(err) {
+		t.Errorf("git reset --hard didn't run: f.txt err = %v", err)
+	}
+}
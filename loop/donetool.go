@@ -3,6 +3,7 @@ package loop
 import (
 	"context"
 	"encoding/json"
+	"strings"
 
 	"sketch.dev/claudetool/codereview"
 	"sketch.dev/llm"
@@ -33,6 +34,16 @@ func makeDoneTool(codereview *codereview.CodeReviewer) *llm.Tool {
 				if needsReview {
 					return llm.ErrorfToolOut("codereview tool has not been run for commit %v", head)
 				}
+				if open := codereview.OpenFindings(head); len(open) > 0 {
+					ids := make([]string, len(open))
+					for i, f := range open {
+						ids[i] = f.ID
+					}
+					return llm.ErrorfToolOut("semantic review findings %s are open: fix them, or dismiss them with the codereview tool", strings.Join(ids, ", "))
+				}
+				if failing := codereview.BlockingFailures(head); len(failing) > 0 {
+					return llm.ErrorfToolOut("these code review steps must pass before you are done: %s. Fix the issues they reported, commit, and run the codereview tool again", strings.Join(failing, ", "))
+				}
 			}
 			return llm.ToolOut{LLMContent: llm.TextContent("Please ask the user to review your work. Be concise - users are more likely to read shorter comments.")}
 		},
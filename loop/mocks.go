@@ -133,6 +133,11 @@ func (m *MockConvo) SendMessage(message llm.Message) (*llm.Response, error) {
 	return exp.result[0].(*llm.Response), retErr
 }
 
+// SendMessageContext is recorded and matched as SendMessage; ctx only carries trace parentage.
+func (m *MockConvo) SendMessageContext(ctx context.Context, message llm.Message) (*llm.Response, error) {
+	return m.SendMessage(message)
+}
+
 func (m *MockConvo) SendUserTextMessage(message string, otherContents ...llm.Content) (*llm.Response, error) {
 	m.recordCall("SendUserTextMessage", message, otherContents)
 	exp, ok := m.findMatchingExpectation("SendUserTextMessage", message, otherContents)
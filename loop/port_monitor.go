@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"sort"
 	"strings"
@@ -17,7 +18,8 @@ import (
 // to an Agent when ports are detected or removed.
 type PortMonitor struct {
 	mu       sync.RWMutex
-	ports    []portlist.Port // cached list of current ports
+	ports    []portlist.Port      // cached list of current ports
+	probes   map[uint16]PortProbe // what's listening on each port, by port number
 	poller   *portlist.Poller
 	agent    *Agent
 	ctx      context.Context
@@ -89,6 +91,14 @@ func (pm *PortMonitor) Stop() {
 	pm.poller.Close()
 }
 
+// GetProbes returns what probing found out about the open ports, by port number.
+// Ports that are filtered out of notifications are not probed.
+func (pm *PortMonitor) GetProbes() map[uint16]PortProbe {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return maps.Clone(pm.probes)
+}
+
 // GetPorts returns the cached list of open ports.
 func (pm *PortMonitor) GetPorts() []portlist.Port {
 	pm.mu.RLock()
@@ -118,6 +128,8 @@ func (pm *PortMonitor) initialScan() error {
 func (pm *PortMonitor) monitor() {
 	defer pm.wg.Done()
 
+	pm.probeAdded(pm.GetPorts(), nil)
+
 	for {
 		select {
 		case <-pm.ctx.Done():
@@ -162,6 +174,7 @@ func (pm *PortMonitor) checkPorts() error {
 	// Find added and removed ports
 	addedPorts := findAddedPorts(previousPorts, currentTCPPorts)
 	removedPorts := findRemovedPorts(previousPorts, currentTCPPorts)
+	pm.probeAdded(addedPorts, removedPorts)
 
 	// Send batch notifications for changes
 	pm.sendBatchPortNotification(addedPorts, removedPorts)
@@ -169,6 +182,40 @@ func (pm *PortMonitor) checkPorts() error {
 	return nil
 }
 
+// probeAdded probes the added ports, and forgets the probes of the removed ones.
+func (pm *PortMonitor) probeAdded(addedPorts, removedPorts []portlist.Port) {
+	toProbe := make(map[uint16]int)
+	for _, port := range pm.filterPorts(addedPorts) {
+		toProbe[port.Port] = port.Pid
+	}
+	probes := probePorts(pm.ctx, toProbe)
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.probes == nil {
+		pm.probes = make(map[uint16]PortProbe)
+	}
+	for _, port := range removedPorts {
+		delete(pm.probes, port.Port)
+	}
+	maps.Copy(pm.probes, probes)
+}
+
+// describePort describes a port for notifications, e.g. `tcp:3000 (node) [pid:42] HTTP 200 "My App"`.
+func (pm *PortMonitor) describePort(port portlist.Port, probes map[uint16]PortProbe) string {
+	portDesc := fmt.Sprintf("%s:%d", port.Proto, port.Port)
+	if port.Process != "" {
+		portDesc += fmt.Sprintf(" (%s)", port.Process)
+	}
+	if port.Pid != 0 {
+		portDesc += fmt.Sprintf(" [pid:%d]", port.Pid)
+	}
+	if label := probes[port.Port].Label(); label != "" {
+		portDesc += " " + label
+	}
+	return portDesc
+}
+
 // sendBatchPortNotification sends a single notification with all port changes to the agent.
 func (pm *PortMonitor) sendBatchPortNotification(addedPorts, removedPorts []portlist.Port) {
 	if pm.agent == nil {
@@ -185,19 +232,15 @@ func (pm *PortMonitor) sendBatchPortNotification(addedPorts, removedPorts []port
 	}
 
 	var contentParts []string
+	probes := pm.GetProbes()
+	event := PortEvent{}
 
 	// Add opened ports to the message
 	if len(filteredAdded) > 0 {
 		var openedPorts []string
 		for _, port := range filteredAdded {
-			portDesc := fmt.Sprintf("%s:%d", port.Proto, port.Port)
-			if port.Process != "" {
-				portDesc += fmt.Sprintf(" (%s)", port.Process)
-			}
-			if port.Pid != 0 {
-				portDesc += fmt.Sprintf(" [pid:%d]", port.Pid)
-			}
-			openedPorts = append(openedPorts, portDesc)
+			openedPorts = append(openedPorts, pm.describePort(port, probes))
+			event.Opened = append(event.Opened, PortEventPort{Proto: port.Proto, Port: port.Port, Process: port.Process, Pid: port.Pid, PortProbe: probes[port.Port]})
 		}
 		if len(openedPorts) == 1 {
 			contentParts = append(contentParts, fmt.Sprintf("Port opened: %s", openedPorts[0]))
@@ -210,14 +253,8 @@ func (pm *PortMonitor) sendBatchPortNotification(addedPorts, removedPorts []port
 	if len(filteredRemoved) > 0 {
 		var closedPorts []string
 		for _, port := range filteredRemoved {
-			portDesc := fmt.Sprintf("%s:%d", port.Proto, port.Port)
-			if port.Process != "" {
-				portDesc += fmt.Sprintf(" (%s)", port.Process)
-			}
-			if port.Pid != 0 {
-				portDesc += fmt.Sprintf(" [pid:%d]", port.Pid)
-			}
-			closedPorts = append(closedPorts, portDesc)
+			closedPorts = append(closedPorts, pm.describePort(port, nil))
+			event.Closed = append(event.Closed, PortEventPort{Proto: port.Proto, Port: port.Port, Process: port.Process, Pid: port.Pid})
 		}
 		if len(closedPorts) == 1 {
 			contentParts = append(contentParts, fmt.Sprintf("Port closed: %s", closedPorts[0]))
@@ -232,11 +269,27 @@ func (pm *PortMonitor) sendBatchPortNotification(addedPorts, removedPorts []port
 		Type:       PortMessageType,
 		Content:    content,
 		HideOutput: true,
+		Display:    event,
 	}
 
 	pm.agent.pushToOutbox(pm.ctx, msg)
 }
 
+// PortEvent is the Display of a PortMessageType message.
+type PortEvent struct {
+	Opened []PortEventPort `json:"opened,omitempty"`
+	Closed []PortEventPort `json:"closed,omitempty"`
+}
+
+// PortEventPort is a port that opened or closed, with what probing found out about it.
+type PortEventPort struct {
+	Proto   string `json:"proto"`
+	Port    uint16 `json:"port"`
+	Process string `json:"process,omitempty"`
+	Pid     int    `json:"pid,omitempty"`
+	PortProbe
+}
+
 // filterPorts filters out ports that should be ignored.
 func (pm *PortMonitor) filterPorts(ports []portlist.Port) []portlist.Port {
 	var filtered []portlist.Port
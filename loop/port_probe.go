@@ -0,0 +1,182 @@
+package loop
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// PortProbe describes what is listening on a port, as far as probing it can tell.
+type PortProbe struct {
+	// Kind is the protocol the port speaks: "http", "grpc", "postgres", or "" if unknown.
+	// Any server that speaks HTTP/2 without TLS is reported as "grpc".
+	Kind string `json:"kind,omitempty"`
+	// HTTPStatus is the status code of GET / for HTTP ports.
+	HTTPStatus int `json:"http_status,omitempty"`
+	// Title is the <title> of the page served at / for HTTP ports.
+	Title string `json:"title,omitempty"`
+	// Cmdline is the command line of the process listening on the port.
+	Cmdline string `json:"cmdline,omitempty"`
+}
+
+// Label is a short description of the probe results, such as `HTTP 200 "My App"`.
+func (p PortProbe) Label() string {
+	switch p.Kind {
+	case "http":
+		label := fmt.Sprintf("HTTP %d", p.HTTPStatus)
+		if p.Title != "" {
+			label += fmt.Sprintf(" %q", p.Title)
+		}
+		return label
+	case "grpc":
+		return "gRPC"
+	case "postgres":
+		return "Postgres"
+	}
+	return ""
+}
+
+// probeTimeout bounds each of the protocol checks in probePort,
+// and portProbeTimeout all of them, so that a port that never answers doesn't hold up port monitoring.
+const (
+	probeTimeout     = 500 * time.Millisecond
+	portProbeTimeout = time.Second
+)
+
+// probeHTTPClient talks to local ports directly, ignoring any proxy configured in the environment.
+var probeHTTPClient = &http.Client{
+	Transport: &http.Transport{Proxy: nil, DisableKeepAlives: true},
+	Timeout:   probeTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// probePort identifies the protocol spoken on a local port, and the command line of pid, which owns it.
+// Protocols are tried from most to least common; each attempt uses a new connection.
+func probePort(ctx context.Context, port uint16, pid int) PortProbe {
+	probe := PortProbe{Cmdline: processCmdline(pid)}
+	addr := net.JoinHostPort("localhost", strconv.Itoa(int(port)))
+
+	if status, title, ok := probeHTTP(ctx, addr); ok {
+		probe.Kind, probe.HTTPStatus, probe.Title = "http", status, title
+	} else if probeConn(ctx, addr, http2Preface, 9, isHTTP2Settings) {
+		probe.Kind = "grpc"
+	} else if probeConn(ctx, addr, postgresSSLRequest, 1, isPostgresSSLResponse) {
+		probe.Kind = "postgres"
+	}
+	return probe
+}
+
+// probePorts probes ports concurrently, each for at most portProbeTimeout.
+func probePorts(ctx context.Context, ports map[uint16]int) map[uint16]PortProbe {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	probes := make(map[uint16]PortProbe, len(ports))
+	for port, pid := range ports {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, portProbeTimeout)
+			defer cancel()
+			probe := probePort(ctx, port, pid)
+			mu.Lock()
+			probes[port] = probe
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return probes
+}
+
+var titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// probeHTTP requests / from addr, returning the status and the page title, if any.
+func probeHTTP(ctx context.Context, addr string) (status int, title string, ok bool) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+addr+"/", nil)
+	if err != nil {
+		return 0, "", false
+	}
+	req.Header.Set("User-Agent", "sketch-port-monitor")
+	resp, err := probeHTTPClient.Do(req)
+	if err != nil {
+		return 0, "", false
+	}
+	defer resp.Body.Close()
+	if strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if m := titleRe.FindSubmatch(body); m != nil {
+			title = truncateRunes(strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " "), 100)
+		}
+	}
+	return resp.StatusCode, title, true
+}
+
+// http2Preface is the HTTP/2 client connection preface followed by an empty SETTINGS frame.
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n\x00\x00\x00\x04\x00\x00\x00\x00\x00")
+
+// isHTTP2Settings reports whether reply starts with an HTTP/2 SETTINGS frame,
+// which is what an HTTP/2 server sends first.
+func isHTTP2Settings(reply []byte) bool {
+	return len(reply) >= 9 && reply[3] == 0x04
+}
+
+// postgresSSLRequest asks a Postgres server whether it supports SSL.
+var postgresSSLRequest = []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}
+
+// isPostgresSSLResponse reports whether reply is a Postgres server's answer to postgresSSLRequest.
+func isPostgresSSLResponse(reply []byte) bool {
+	return len(reply) == 1 && (reply[0] == 'S' || reply[0] == 'N')
+}
+
+// probeConn sends hello to addr and reports whether match accepts the reply,
+// once at least minReply bytes of it have arrived.
+func probeConn(ctx context.Context, addr string, hello []byte, minReply int, match func(reply []byte) bool) bool {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(hello); err != nil {
+		return false
+	}
+	reply := make([]byte, 64)
+	n, err := io.ReadAtLeast(conn, reply, minReply)
+	return err == nil && match(reply[:n])
+}
+
+// processCmdline returns the command line of pid, or "" if it can't be read.
+func processCmdline(pid int) string {
+	if pid <= 0 {
+		return ""
+	}
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+	return truncateRunes(strings.ReplaceAll(string(bytes.TrimRight(b, "\x00")), "\x00", " "), 200)
+}
+
+// truncateRunes shortens s to at most n runes, marking where it was cut.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
@@ -0,0 +1,170 @@
+package loop
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/portlist"
+)
+
+// fakeServer listens on a local port and answers each connection with handle.
+func fakeServer(t *testing.T, handle func(conn net.Conn)) uint16 {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return uint16(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func httptestPort(t *testing.T, h http.HandlerFunc) uint16 {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return uint16(port)
+}
+
+func TestProbePort(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("http", func(t *testing.T) {
+		port := httptestPort(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, "<html><head><TITLE>\n  My &amp; App\n</TITLE></head></html>")
+		})
+		got := probePort(ctx, port, os.Getpid())
+		if got.Kind != "http" || got.HTTPStatus != 200 || got.Title != "My & App" {
+			t.Errorf("probe = %+v", got)
+		}
+		if got.Label() != `HTTP 200 "My & App"` {
+			t.Errorf("label = %q", got.Label())
+		}
+		if !strings.Contains(got.Cmdline, os.Args[0]) {
+			t.Errorf("cmdline = %q, want it to contain %q", got.Cmdline, os.Args[0])
+		}
+	})
+
+	t.Run("http redirect", func(t *testing.T) {
+		port := httptestPort(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/login", http.StatusFound)
+		})
+		if got := probePort(ctx, port, 0); got.Kind != "http" || got.HTTPStatus != http.StatusFound {
+			t.Errorf("probe = %+v", got)
+		}
+	})
+
+	t.Run("grpc", func(t *testing.T) {
+		// Like an HTTP/2 server, this closes connections that don't start with the preface,
+		// and answers the preface with a SETTINGS frame.
+		port := fakeServer(t, func(conn net.Conn) {
+			buf := make([]byte, len(http2Preface))
+			if _, err := io.ReadFull(conn, buf); err != nil || !strings.HasPrefix(string(buf), "PRI * HTTP/2.0") {
+				return
+			}
+			conn.Write([]byte{0, 0, 6, 0x04, 0, 0, 0, 0, 0, 0, 0x03, 0, 0, 0, 100})
+		})
+		if got := probePort(ctx, port, 0); got.Kind != "grpc" || got.Label() != "gRPC" {
+			t.Errorf("probe = %+v", got)
+		}
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		port := fakeServer(t, func(conn net.Conn) {
+			buf := make([]byte, 8)
+			if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != string(postgresSSLRequest) {
+				return
+			}
+			conn.Write([]byte("N"))
+			io.Copy(io.Discard, conn) // wait for the startup message
+		})
+		if got := probePort(ctx, port, 0); got.Kind != "postgres" {
+			t.Errorf("probe = %+v", got)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		port := fakeServer(t, func(conn net.Conn) {
+			conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+		})
+		if got := probePort(ctx, port, 0); got.Kind != "" || got.Label() != "" {
+			t.Errorf("probe = %+v", got)
+		}
+	})
+}
+
+func TestProbePortsTimeout(t *testing.T) {
+	// Servers that accept connections but never answer, so every check waits for its timeout.
+	silent := func(conn net.Conn) { io.Copy(io.Discard, conn) }
+	ports := make(map[uint16]int)
+	for range 5 {
+		ports[fakeServer(t, silent)] = 0
+	}
+	httpPort := httptestPort(t, func(w http.ResponseWriter, r *http.Request) {})
+	ports[httpPort] = 0
+
+	start := time.Now()
+	probes := probePorts(context.Background(), ports)
+	if elapsed := time.Since(start); elapsed > 2*portProbeTimeout {
+		t.Errorf("probing took %v, want at most about %v, with the ports probed concurrently", elapsed, portProbeTimeout)
+	}
+	if len(probes) != len(ports) {
+		t.Errorf("got %d probes, want %d", len(probes), len(ports))
+	}
+	for port, probe := range probes {
+		if want := map[bool]string{true: "http"}[port == httpPort]; probe.Kind != want {
+			t.Errorf("port %d: probe = %+v, want kind %q", port, probe, want)
+		}
+	}
+}
+
+func TestPortMonitor_ProbeNotification(t *testing.T) {
+	agent := createTestAgent(t)
+	pm := NewPortMonitor(agent, 0)
+	port := httptestPort(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "starting up", http.StatusServiceUnavailable)
+	})
+	opened := []portlist.Port{{Proto: "tcp", Port: port, Process: "server", Pid: 1234}}
+
+	pm.probeAdded(opened, nil)
+	if got := pm.GetProbes()[port]; got.Kind != "http" || got.HTTPStatus != http.StatusServiceUnavailable {
+		t.Errorf("probe = %+v", got)
+	}
+	pm.sendBatchPortNotification(opened, nil)
+	msg := agent.history[len(agent.history)-1]
+	if !strings.HasSuffix(msg.Content, "[pid:1234] HTTP 503") {
+		t.Errorf("notification %q doesn't describe the probe", msg.Content)
+	}
+	event, ok := msg.Display.(PortEvent)
+	if !ok || len(event.Opened) != 1 || event.Opened[0].HTTPStatus != http.StatusServiceUnavailable {
+		t.Errorf("notification display = %#v", msg.Display)
+	}
+
+	pm.probeAdded(nil, opened)
+	if _, ok := pm.GetProbes()[port]; ok {
+		t.Errorf("probe of closed port %d not forgotten", port)
+	}
+}
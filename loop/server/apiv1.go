@@ -0,0 +1,615 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"sketch.dev/claudetool"
+	"sketch.dev/claudetool/codereview"
+	"sketch.dev/git_tools"
+	"sketch.dev/loop"
+)
+
+// The /api/v1 endpoints are the stable, scriptable surface of the sketch HTTP server.
+// Unlike the ad hoc endpoints used by the bundled web UI, they always speak JSON
+// (including errors), and changes to them are backwards compatible.
+// Every route is declared in apiV1Routes, which also drives the OpenAPI document
+// served at /api/v1/openapi.json.
+
+const apiV1Prefix = "/api/v1"
+
+// APIError is the body of every /api/v1 error response.
+type APIError struct {
+	Error APIErrorDetail `json:"error"`
+}
+
+// APIErrorDetail describes an /api/v1 error.
+type APIErrorDetail struct {
+	// Code is a stable, machine-readable error code, such as "bad_request" or "not_found".
+	Code string `json:"code"`
+	// Message is a human-readable description of the error.
+	Message string `json:"message"`
+}
+
+// MessagesPage is a page of conversation messages.
+type MessagesPage struct {
+	Messages []loop.AgentMessage `json:"messages"`
+	// Start is the index of the first message in Messages.
+	Start int `json:"start"`
+	// Total is the total number of messages in the conversation.
+	Total int `json:"total"`
+	// NextStart is the start index of the next page, if there are more messages.
+	NextStart *int `json:"next_start,omitempty"`
+}
+
+// ChatRequest is the body of POST /api/v1/chat.
+type ChatRequest struct {
+	Message string `json:"message"`
+}
+
+// CancelRequest is the body of POST /api/v1/cancel.
+type CancelRequest struct {
+	// Reason is recorded as the cause of the cancellation.
+	Reason string `json:"reason,omitempty"`
+	// ToolCallID, if set, cancels only that tool call instead of the whole turn.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// EndRequest is the body of POST /api/v1/end.
+type EndRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// StatusResponse acknowledges a request that changes agent state.
+type StatusResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// DiffResponse is the response of GET /api/v1/diff.
+type DiffResponse struct {
+	// Diff is a unified diff.
+	Diff string `json:"diff"`
+}
+
+// GitShowResponse is the response of GET /api/v1/git/show.
+type GitShowResponse struct {
+	Hash   string `json:"hash"`
+	Output string `json:"output"`
+}
+
+const (
+	defaultMessagesPageSize = 100
+	maxMessagesPageSize     = 1000
+)
+
+// apiParam documents a query parameter of an /api/v1 route.
+type apiParam struct {
+	Name        string
+	Type        string // OpenAPI primitive type: "string", "integer", or "boolean"
+	Required    bool
+	Description string
+}
+
+// apiRoute is a single /api/v1 endpoint.
+type apiRoute struct {
+	Method  string
+	Path    string // relative to apiV1Prefix
+	Summary string
+	Params  []apiParam
+	// Request and Response are zero values of the request and response body types, or nil for none.
+	Request  any
+	Response any
+	// Status is the success status code; if zero, http.StatusOK.
+	Status int
+	// Scope is the auth scope required to call the route; if empty, that of defaultScope.
+	// Routes other than GET must declare one, of ScopeChat or above.
+	Scope Scope
+	// Handle returns the response body, or an error.
+	// Errors of type *apiStatusError are reported with their status and code;
+	// other errors are reported as internal errors.
+	Handle func(s *Server, r *http.Request) (any, error)
+}
+
+// apiStatusError is an error with an HTTP status and an APIErrorDetail code.
+type apiStatusError struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *apiStatusError) Error() string { return e.msg }
+
+func apiErrorf(status int, code, format string, args ...any) error {
+	return &apiStatusError{status: status, code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+func badRequestf(format string, args ...any) error {
+	return apiErrorf(http.StatusBadRequest, "bad_request", format, args...)
+}
+
+// apiV1Routes lists every /api/v1 endpoint.
+func apiV1Routes() []apiRoute {
+	return []apiRoute{
+		{
+			Method:   http.MethodGet,
+			Path:     "/state",
+			Summary:  "Get the current agent and session state.",
+			Response: State{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				return s.getState(), nil
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/messages",
+			Summary: "List conversation messages, oldest first, a page at a time.",
+			Params: []apiParam{
+				{Name: "start", Type: "integer", Description: "Index of the first message to return. Defaults to 0."},
+				{Name: "limit", Type: "integer", Description: fmt.Sprintf("Maximum number of messages to return. Defaults to %d, at most %d.", defaultMessagesPageSize, maxMessagesPageSize)},
+			},
+			Response: MessagesPage{},
+			Handle:   (*Server).apiMessages,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/chat",
+			Scope:    ScopeChat,
+			Summary:  "Send a message to the agent. The agent processes it asynchronously.",
+			Request:  ChatRequest{},
+			Response: StatusResponse{},
+			Status:   http.StatusAccepted,
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				var req ChatRequest
+				if err := decodeAPIBody(r, &req); err != nil {
+					return nil, err
+				}
+				if req.Message == "" {
+					return nil, badRequestf("message cannot be empty")
+				}
+				s.agent.UserMessage(r.Context(), req.Message)
+				return StatusResponse{Status: "queued"}, nil
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/cancel",
+			Scope:    ScopeChat,
+			Summary:  "Cancel the current turn, or a single tool call.",
+			Request:  CancelRequest{},
+			Response: StatusResponse{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				var req CancelRequest
+				if err := decodeAPIBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+					return nil, err
+				}
+				reason := "user requested cancellation"
+				if req.Reason != "" {
+					reason = req.Reason
+				}
+				if req.ToolCallID != "" {
+					if err := s.agent.CancelToolUse(req.ToolCallID, errors.New(reason)); err != nil {
+						return nil, apiErrorf(http.StatusNotFound, "not_found", "%v", err)
+					}
+				} else {
+					s.agent.CancelTurn(errors.New(reason))
+				}
+				return StatusResponse{Status: "cancelled", Reason: reason}, nil
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/end",
+			Scope:    ScopeAdmin,
+			Summary:  "End the session, shutting down the sketch process.",
+			Request:  EndRequest{},
+			Response: StatusResponse{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				var req EndRequest
+				if err := decodeAPIBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+					return nil, err
+				}
+				reason := "user requested end of session"
+				if req.Reason != "" {
+					reason = req.Reason
+				}
+				slog.InfoContext(r.Context(), "Ending session", "reason", reason)
+				// Give the response a moment to be sent before exiting.
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					os.Exit(0)
+				}()
+				return StatusResponse{Status: "ending", Reason: reason}, nil
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/diff",
+			Summary: "Get the unified diff of all changes since the session started, or of a single commit.",
+			Params: []apiParam{
+				{Name: "commit", Type: "string", Description: "Full commit SHA. If set, only this commit's changes are returned."},
+			},
+			Response: DiffResponse{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				var commit *string
+				if c := r.URL.Query().Get("commit"); c != "" {
+					if !isValidGitSHA(c) {
+						return nil, badRequestf("invalid git commit SHA format: %s", c)
+					}
+					commit = &c
+				}
+				diff, err := s.agent.Diff(commit)
+				if err != nil {
+					return nil, err
+				}
+				return DiffResponse{Diff: diff}, nil
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/git/rawdiff",
+			Summary: "List files changed between two commits, or by a single commit.",
+			Params: []apiParam{
+				{Name: "commit", Type: "string", Description: "Commit SHA whose changes to list. Overrides from and to."},
+				{Name: "from", Type: "string", Description: "Base commit SHA. Required unless commit is set."},
+				{Name: "to", Type: "string", Description: "Target commit SHA. If empty, the working tree is used."},
+			},
+			Response: []git_tools.DiffFile{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				q := r.URL.Query()
+				from, to, commit := q.Get("from"), q.Get("to"), q.Get("commit")
+				for _, c := range []string{from, to, commit} {
+					if c != "" && !isValidGitSHA(c) {
+						return nil, badRequestf("invalid git commit SHA format: %s", c)
+					}
+				}
+				if commit != "" {
+					from, to = commit+"^", commit
+				}
+				if from == "" {
+					return nil, badRequestf("missing required parameter: either 'commit' or at least 'from'")
+				}
+				return git_tools.GitRawDiff(s.agent.RepoRoot(), from, to)
+			},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/git/log",
+			Summary:  "List recent commits, including those made during the session.",
+			Response: []git_tools.GitLogEntry{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				return git_tools.GitRecentLog(s.agent.RepoRoot(), s.agent.SketchGitBaseRef())
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/git/show",
+			Summary: "Show a commit, as `git show` does.",
+			Params: []apiParam{
+				{Name: "hash", Type: "string", Required: true, Description: "SHA of the commit or other object to show."},
+			},
+			Response: GitShowResponse{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				hash := r.URL.Query().Get("hash")
+				if hash == "" {
+					return nil, badRequestf("missing required parameter: hash")
+				}
+				if !isValidGitSHA(hash) {
+					return nil, badRequestf("invalid git SHA format: %s", hash)
+				}
+				out, err := git_tools.GitShow(s.agent.RepoRoot(), hash)
+				if err != nil {
+					return nil, err
+				}
+				return GitShowResponse{Hash: hash, Output: out}, nil
+			},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/git/pushinfo",
+			Summary:  "Get the HEAD commit and the remotes it can be pushed to.",
+			Response: GitPushInfoResponse{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				return s.gitPushInfo()
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/git/push",
+			Scope:    ScopeGitWrite,
+			Summary:  "Push a commit to a branch of a remote. A failed push is reported in the response body.",
+			Request:  GitPushRequest{},
+			Response: GitPushResponse{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				var req GitPushRequest
+				if err := decodeAPIBody(r, &req); err != nil {
+					return nil, err
+				}
+				if req.Remote == "" || req.Branch == "" || req.Commit == "" {
+					return nil, badRequestf("missing required parameters: remote, branch, and commit")
+				}
+				return s.gitPush(r.Context(), req), nil
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/share",
+			Scope:    ScopeAdmin,
+			Summary:  "Create a signed, expiring link that gives read-only access to the session. Requires -auth-token.",
+			Request:  ShareRequest{},
+			Response: ShareResponse{},
+			Handle:   (*Server).apiShare,
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     "/share",
+			Scope:    ScopeAdmin,
+			Summary:  "Revoke every share link created so far.",
+			Response: StatusResponse{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				s.revokeShareLinks()
+				return StatusResponse{Status: "revoked"}, nil
+			},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/terminals",
+			Scope:    ScopeTerminal,
+			Summary:  "List terminal sessions.",
+			Response: []TerminalInfo{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				return s.listTerminals(), nil
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/terminals",
+			Scope:    ScopeTerminal,
+			Summary:  "Start a terminal session. Stream its output from /terminal/events/{id}, and send it input at /terminal/input/{id}.",
+			Request:  CreateTerminalRequest{},
+			Response: TerminalInfo{},
+			Status:   http.StatusCreated,
+			Handle:   (*Server).apiCreateTerminal,
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/terminals",
+			Scope:   ScopeTerminal,
+			Summary: "Kill a terminal session.",
+			Params: []apiParam{
+				{Name: "id", Type: "string", Required: true, Description: "ID of the terminal session."},
+			},
+			Response: StatusResponse{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				id := r.URL.Query().Get("id")
+				if id == "" {
+					return nil, badRequestf("missing required parameter: id")
+				}
+				if !s.killTerminal(id) {
+					return nil, apiErrorf(http.StatusNotFound, "not_found", "no terminal session %q", id)
+				}
+				return StatusResponse{Status: "killed"}, nil
+			},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/jobs",
+			Summary:  "List the background commands the agent has started, oldest first.",
+			Response: []claudetool.JobInfo{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				jobs := s.agent.Jobs()
+				if jobs == nil {
+					jobs = []claudetool.JobInfo{}
+				}
+				return jobs, nil
+			},
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/jobs",
+			Scope:   ScopeTerminal,
+			Summary: "Stop a background command, and everything it started.",
+			Params: []apiParam{
+				{Name: "id", Type: "integer", Required: true, Description: "ID of the job."},
+			},
+			Response: StatusResponse{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				id, err := strconv.Atoi(r.URL.Query().Get("id"))
+				if err != nil {
+					return nil, badRequestf("invalid or missing parameter: id")
+				}
+				i := slices.IndexFunc(s.agent.Jobs(), func(j claudetool.JobInfo) bool { return j.ID == id })
+				if i < 0 {
+					return nil, apiErrorf(http.StatusNotFound, "not_found", "no job %d", id)
+				}
+				if err := s.agent.KillJob(id); err != nil {
+					return nil, apiErrorf(http.StatusConflict, "not_running", "%v", err)
+				}
+				return StatusResponse{Status: "killed"}, nil
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/codereview/findings",
+			Summary: "Get the findings of the most recent code review, as JSON or as a SARIF 2.1.0 log.",
+			Params: []apiParam{
+				{Name: "format", Type: "string", Description: `"json" (the default) or "sarif".`},
+			},
+			Response: codereview.Report{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				report := s.agent.CodeReviewReport()
+				switch format := r.URL.Query().Get("format"); format {
+				case "", "json":
+					return report, nil
+				case "sarif":
+					sarif, err := report.SARIF()
+					if err != nil {
+						return nil, err
+					}
+					return json.RawMessage(sarif), nil
+				default:
+					return nil, badRequestf("unknown format %q", format)
+				}
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/port-forwards",
+			Scope:    ScopeAdmin,
+			Summary:  "Replace the list of container ports forwarded to the host. Used by the sketch process outside the container.",
+			Request:  PortForwardsRequest{},
+			Response: StatusResponse{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				var req PortForwardsRequest
+				if err := decodeAPIBody(r, &req); err != nil {
+					return nil, err
+				}
+				s.setPortForwards(req.Forwards)
+				return StatusResponse{Status: "ok"}, nil
+			},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/openapi.json",
+			Summary:  "Get the OpenAPI document describing this API.",
+			Response: map[string]any{},
+			Handle: func(s *Server, r *http.Request) (any, error) {
+				return OpenAPI(), nil
+			},
+		},
+	}
+}
+
+// registerAPIV1 adds the /api/v1 routes to s.mux.
+func (s *Server) registerAPIV1() {
+	byPath := make(map[string][]apiRoute)
+	for _, route := range apiV1Routes() {
+		byPath[route.Path] = append(byPath[route.Path], route)
+	}
+	for path, routes := range byPath {
+		s.mux.HandleFunc(apiV1Prefix+path, func(w http.ResponseWriter, r *http.Request) {
+			i := slices.IndexFunc(routes, func(route apiRoute) bool { return route.Method == r.Method })
+			if i < 0 {
+				var allow []string
+				for _, route := range routes {
+					allow = append(allow, route.Method)
+				}
+				w.Header().Set("Allow", strings.Join(allow, ", "))
+				writeAPIError(w, r, apiErrorf(http.StatusMethodNotAllowed, "method_not_allowed", "%s %s: method not allowed", r.Method, r.URL.Path))
+				return
+			}
+			s.serveAPIRoute(w, r, routes[i])
+		})
+	}
+	s.mux.HandleFunc(apiV1Prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, r, apiErrorf(http.StatusNotFound, "not_found", "%s: no such endpoint", r.URL.Path))
+	})
+}
+
+func (s *Server) serveAPIRoute(w http.ResponseWriter, r *http.Request, route apiRoute) {
+	defer func() {
+		if err := recover(); err != nil {
+			slog.ErrorContext(r.Context(), "api panic", "path", r.URL.Path, slog.Any("recovered_err", err))
+			writeAPIError(w, r, fmt.Errorf("panic: %v", err))
+		}
+	}()
+	resp, err := route.Handle(s, r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeAPIJSON(w, cmp.Or(route.Status, http.StatusOK), resp)
+}
+
+// apiMessages serves GET /api/v1/messages.
+func (s *Server) apiMessages(r *http.Request) (any, error) {
+	q := r.URL.Query()
+	start, err := intParam(q.Get("start"), 0)
+	if err != nil || start < 0 {
+		return nil, badRequestf("invalid 'start' parameter %q", q.Get("start"))
+	}
+	limit, err := intParam(q.Get("limit"), defaultMessagesPageSize)
+	if err != nil || limit <= 0 {
+		return nil, badRequestf("invalid 'limit' parameter %q", q.Get("limit"))
+	}
+	limit = min(limit, maxMessagesPageSize)
+
+	total := s.agent.MessageCount()
+	start = min(start, total)
+	end := min(start+limit, total)
+	page := MessagesPage{
+		Messages: s.agent.Messages(start, end),
+		Start:    start,
+		Total:    total,
+	}
+	if page.Messages == nil {
+		page.Messages = []loop.AgentMessage{}
+	}
+	if end < total {
+		page.NextStart = &end
+	}
+	return page, nil
+}
+
+// intParam parses an optional integer query parameter.
+func intParam(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// decodeAPIBody decodes the JSON request body into v.
+// It returns io.EOF (unwrapped) if the body is empty,
+// for endpoints where the body is optional.
+func decodeAPIBody(r *http.Request, v any) error {
+	defer r.Body.Close()
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return badRequestError{io.EOF}
+		}
+		return badRequestf("invalid request body: %v", err)
+	}
+	return nil
+}
+
+// badRequestError reports a missing request body.
+// It unwraps to io.EOF so that endpoints with optional bodies can ignore it.
+type badRequestError struct{ err error }
+
+func (e badRequestError) Error() string { return "missing request body" }
+func (e badRequestError) Unwrap() error { return e.err }
+
+func writeAPIJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v) // can't do anything useful with errors anyway
+}
+
+// writeAPIError reports err as an APIError.
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := http.StatusInternalServerError, "internal"
+	var se *apiStatusError
+	switch {
+	case errors.As(err, &se):
+		status, code = se.status, se.code
+	case errors.As(err, new(badRequestError)):
+		status, code = http.StatusBadRequest, "bad_request"
+	}
+	slog.ErrorContext(r.Context(), "HTTP error", "method", r.Method, "path", r.URL.Path, "message", err.Error(), "code", status)
+	writeAPIJSON(w, status, APIError{Error: APIErrorDetail{Code: code, Message: err.Error()}})
+}
@@ -0,0 +1,237 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"sketch.dev/claudetool"
+	"sketch.dev/claudetool/codereview"
+	"sketch.dev/loop"
+	"sketch.dev/loop/server"
+)
+
+func newAPITestServer(t *testing.T, numMessages int) *server.Server {
+	t.Helper()
+	agent := &mockAgent{sessionID: "test-session", workingDir: t.TempDir()}
+	for i := range numMessages {
+		agent.AddMessage(loop.AgentMessage{Type: loop.AgentMessageType, Content: strings.Repeat("x", i)})
+	}
+	srv, err := server.New(agent, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func doAPI(t *testing.T, srv http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: Content-Type = %q, want application/json", method, path, ct)
+	}
+	return rr
+}
+
+func TestAPIV1MessagesPagination(t *testing.T) {
+	srv := newAPITestServer(t, 5)
+
+	var starts []int
+	next := "/api/v1/messages?limit=2"
+	for next != "" {
+		rr := doAPI(t, srv, "GET", next, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d: %s", next, rr.Code, rr.Body)
+		}
+		var page server.MessagesPage
+		if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 5 {
+			t.Errorf("total = %d, want 5", page.Total)
+		}
+		for i, m := range page.Messages {
+			if m.Idx != page.Start+i {
+				t.Errorf("message %d has idx %d", page.Start+i, m.Idx)
+			}
+		}
+		starts = append(starts, page.Start)
+		next = ""
+		if page.NextStart != nil {
+			next = "/api/v1/messages?limit=2&start=" + strconv.Itoa(*page.NextStart)
+		}
+	}
+	if want := []int{0, 2, 4}; !slices.Equal(starts, want) {
+		t.Errorf("page starts = %v, want %v", starts, want)
+	}
+
+	// Past the end is an empty page, not an error.
+	rr := doAPI(t, srv, "GET", "/api/v1/messages?start=10", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"messages": []`) {
+		t.Errorf("start past end: status %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestAPIV1Errors(t *testing.T) {
+	srv := newAPITestServer(t, 0)
+	tests := []struct {
+		method, path, body string
+		wantStatus         int
+		wantCode           string
+	}{
+		{"GET", "/api/v1/nope", "", http.StatusNotFound, "not_found"},
+		{"DELETE", "/api/v1/state", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"GET", "/api/v1/messages?limit=-1", "", http.StatusBadRequest, "bad_request"},
+		{"GET", "/api/v1/messages?start=x", "", http.StatusBadRequest, "bad_request"},
+		{"POST", "/api/v1/chat", "", http.StatusBadRequest, "bad_request"},
+		{"POST", "/api/v1/chat", `{"message":""}`, http.StatusBadRequest, "bad_request"},
+		{"POST", "/api/v1/chat", `{"msg":"hi"}`, http.StatusBadRequest, "bad_request"},
+		{"GET", "/api/v1/diff?commit=zzz", "", http.StatusBadRequest, "bad_request"},
+		{"GET", "/api/v1/git/show", "", http.StatusBadRequest, "bad_request"},
+		{"GET", "/api/v1/git/show?hash=--output=/tmp/x", "", http.StatusBadRequest, "bad_request"},
+		{"GET", "/api/v1/git/rawdiff?commit=--output=/tmp/x", "", http.StatusBadRequest, "bad_request"},
+		{"GET", "/api/v1/git/rawdiff?from=--output=/tmp/x", "", http.StatusBadRequest, "bad_request"},
+		{"GET", "/api/v1/git/rawdiff?from=abc1234&to=-p", "", http.StatusBadRequest, "bad_request"},
+	}
+	for _, tt := range tests {
+		rr := doAPI(t, srv, tt.method, tt.path, tt.body)
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, rr.Code, tt.wantStatus)
+		}
+		var apiErr server.APIError
+		if err := json.Unmarshal(rr.Body.Bytes(), &apiErr); err != nil {
+			t.Errorf("%s %s: error body is not JSON: %s", tt.method, tt.path, rr.Body)
+			continue
+		}
+		if apiErr.Error.Code != tt.wantCode || apiErr.Error.Message == "" {
+			t.Errorf("%s %s: error = %+v, want code %q", tt.method, tt.path, apiErr.Error, tt.wantCode)
+		}
+	}
+}
+
+func TestAPIV1Chat(t *testing.T) {
+	srv := newAPITestServer(t, 0)
+	rr := doAPI(t, srv, "POST", "/api/v1/chat", `{"message":"hello"}`)
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("chat: status %d: %s", rr.Code, rr.Body)
+	}
+	rr = doAPI(t, srv, "POST", "/api/v1/cancel", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"cancelled"`) {
+		t.Errorf("cancel: status %d: %s", rr.Code, rr.Body)
+	}
+}
+
+// TestOpenAPIDocUpToDate checks that docs/openapi.json matches the Go types.
+// If it fails, run go generate ./loop/server.
+func TestOpenAPIDocUpToDate(t *testing.T) {
+	want, err := json.MarshalIndent(server.OpenAPI(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, '\n')
+	got, err := os.ReadFile("../../docs/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("docs/openapi.json is out of date; run go generate ./loop/server")
+	}
+
+	srv := newAPITestServer(t, 0)
+	rr := doAPI(t, srv, "GET", "/api/v1/openapi.json", "")
+	var doc map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	paths, _ := doc["paths"].(map[string]any)
+	for _, p := range []string{"/state", "/messages", "/chat", "/git/push"} {
+		if paths[p] == nil {
+			t.Errorf("OpenAPI document is missing path %s", p)
+		}
+	}
+}
+
+func TestJobsAPI(t *testing.T) {
+	jobs := claudetool.NewJobs()
+	srv, err := server.New(&mockAgent{sessionID: "test-session", workingDir: t.TempDir(), jobs: jobs}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bash := &claudetool.BashTool{Jobs: jobs}
+	if out := bash.Run(context.Background(), json.RawMessage(`{"command": "sleep 60", "background": true}`)); out.Error != nil {
+		t.Fatal(out.Error)
+	}
+
+	rr := doAPI(t, srv, "GET", "/api/v1/jobs", "")
+	var list []claudetool.JobInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Command != "sleep 60" || list[0].Status != "running" {
+		t.Fatalf("jobs = %+v", list)
+	}
+
+	if rr := doAPI(t, srv, "DELETE", "/api/v1/jobs?id=1", ""); rr.Code != http.StatusOK {
+		t.Errorf("kill job: status %d: %s", rr.Code, rr.Body)
+	}
+	if rr := doAPI(t, srv, "DELETE", "/api/v1/jobs?id=1", ""); rr.Code != http.StatusConflict {
+		t.Errorf("kill job twice: status %d, want 409", rr.Code)
+	}
+	if rr := doAPI(t, srv, "DELETE", "/api/v1/jobs?id=2", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("kill unknown job: status %d, want 404", rr.Code)
+	}
+	rr = doAPI(t, srv, "GET", "/state", "")
+	if !strings.Contains(rr.Body.String(), `"status": "killed"`) {
+		t.Errorf("state doesn't show the killed job: %s", rr.Body)
+	}
+}
+
+func TestCodeReviewFindingsAPI(t *testing.T) {
+	review := codereview.Report{Commit: "abc123", Findings: []codereview.Finding{
+		{Tool: "Go vet", Severity: codereview.SeverityWarning, File: "p.go", Line: 4, Message: "bad printf"},
+	}}
+	srv, err := server.New(&mockAgent{sessionID: "test-session", workingDir: t.TempDir(), review: review}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := doAPI(t, srv, "GET", "/api/v1/codereview/findings", "")
+	var got codereview.Report
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Commit != "abc123" || len(got.Findings) != 1 || got.Findings[0].File != "p.go" {
+		t.Errorf("findings = %+v", got)
+	}
+
+	rr = doAPI(t, srv, "GET", "/api/v1/codereview/findings?format=sarif", "")
+	var sarif struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Results []struct {
+				Message struct {
+					Text string `json:"text"`
+				} `json:"message"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &sarif); err != nil {
+		t.Fatal(err)
+	}
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 || sarif.Runs[0].Results[0].Message.Text != "bad printf" {
+		t.Errorf("SARIF = %s", rr.Body)
+	}
+
+	if rr := doAPI(t, srv, "GET", "/api/v1/codereview/findings?format=xml", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: status %d, want 400", rr.Code)
+	}
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// A Scope is a permission granted by an auth token.
+type Scope string
+
+const (
+	ScopeView     Scope = "view"      // read-only access: the web UI, messages, diffs, logs of the conversation
+	ScopeChat     Scope = "chat"      // send messages to the agent, cancel it, upload files
+	ScopeTerminal Scope = "terminal"  // run commands in terminals and reach forwarded ports
+	ScopeGitWrite Scope = "git-write" // edit files via /git/save and push to the host
+	ScopeAdmin    Scope = "admin"     // initialize and end the session, debug endpoints
+)
+
+// AllScopes lists every Scope. A token without an explicit scope list has all of them.
+var AllScopes = []Scope{ScopeView, ScopeChat, ScopeTerminal, ScopeGitWrite, ScopeAdmin}
+
+// A Token grants its bearer the listed scopes.
+type Token struct {
+	Secret string
+	Scopes []Scope
+}
+
+// Has reports whether t grants scope.
+func (t Token) Has(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// ParseToken parses a token specification, as given to the -auth-token flag:
+// "secret" grants all scopes, and "secret:view,chat" grants only the listed ones.
+// The view scope is implied by every other scope except admin.
+func ParseToken(spec string) (Token, error) {
+	secret, list, hasList := strings.Cut(spec, ":")
+	if secret == "" {
+		return Token{}, fmt.Errorf("auth token %q: empty secret", spec)
+	}
+	if !hasList {
+		return Token{Secret: secret, Scopes: AllScopes}, nil
+	}
+	var scopes []Scope
+	for name := range strings.SplitSeq(list, ",") {
+		scope := Scope(strings.TrimSpace(name))
+		if scope == "all" {
+			return Token{Secret: secret, Scopes: AllScopes}, nil
+		}
+		if !slices.Contains(AllScopes, scope) {
+			return Token{}, fmt.Errorf("auth token: unknown scope %q (want one of view, chat, terminal, git-write, admin)", scope)
+		}
+		if scope != ScopeAdmin && !slices.Contains(scopes, ScopeView) {
+			scopes = append(scopes, ScopeView)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return Token{Secret: secret, Scopes: scopes}, nil
+}
+
+// NewSecret returns a random token secret.
+func NewSecret() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// authCookie holds the token secret for browsers, which cannot set
+// an Authorization header on page loads, EventSource streams, or proxied ports.
+const authCookie = "sketch_token"
+
+// SetTokens configures the tokens accepted by s.
+// With no tokens (the default), every request is allowed.
+func (s *Server) SetTokens(tokens []Token) {
+	s.tokens = tokens
+}
+
+// scopeFor reports the scope needed to serve r.
+func (s *Server) scopeFor(r *http.Request) Scope {
+	if s.ParsePortProxyHost(r.Host) != "" {
+		return ScopeTerminal
+	}
+	path := r.URL.Path
+	if rest, ok := strings.CutPrefix(path, apiV1Prefix); ok {
+		for _, route := range apiV1Routes() {
+			if route.Path == rest && route.Method == r.Method {
+				return cmp.Or(route.Scope, defaultScope(r))
+			}
+		}
+		return defaultScope(r)
+	}
+	for _, p := range scopePaths {
+		if path == p.path || strings.HasSuffix(p.path, "/") && strings.HasPrefix(path, p.path) {
+			return p.scope
+		}
+	}
+	return defaultScope(r)
+}
+
+// defaultScope is the scope needed for endpoints without one of their own:
+// ScopeView to read, and ScopeChat for any other method, so that an endpoint that changes something
+// is never open to view-only tokens, such as share links, by omission.
+func defaultScope(r *http.Request) Scope {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ScopeView
+	}
+	return ScopeChat
+}
+
+// scopePaths maps the non-API endpoints that need more than defaultScope to their scope.
+// Paths ending in "/" match as prefixes.
+var scopePaths = []struct {
+	path  string
+	scope Scope
+}{
+	{"/init", ScopeAdmin},
+	{"/end", ScopeAdmin},
+	{"/debug/", ScopeAdmin},
+	{"/chat", ScopeChat},
+	{"/cancel", ScopeChat},
+	{"/external", ScopeChat},
+	{"/upload", ScopeChat},
+	{"/terminal/", ScopeTerminal},
+	{"/tunnel/", ScopeTerminal},
+	{"/git/save", ScopeGitWrite},
+	{"/git/push", ScopeGitWrite},
+}
+
+// authorize checks r against s's tokens, writing an error response and
+// returning false if the request may not proceed.
+//
+// A token may be given as an "Authorization: Bearer" header, a cookie, or a
+// "token" query parameter. The query parameter form sets the cookie and
+// redirects to the same URL without the token, so that links can carry the
+// token without it lingering in the address bar or browser history.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if len(s.tokens) == 0 {
+		return true
+	}
+	if secret := r.URL.Query().Get("token"); secret != "" && r.Method == http.MethodGet {
+		if _, ok := s.lookupToken(secret); !ok {
+			httpError(w, r, "invalid token", http.StatusUnauthorized)
+			return false
+		}
+		cookie := &http.Cookie{
+			Name:     authCookie,
+			Value:    secret,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		}
+		if exp, ok := s.checkShareToken(secret); ok {
+			cookie.Expires = exp
+		}
+		http.SetCookie(w, cookie)
+		u := *r.URL
+		q := u.Query()
+		q.Del("token")
+		u.RawQuery = q.Encode()
+		http.Redirect(w, r, u.RequestURI(), http.StatusFound)
+		return false
+	}
+
+	var secret string
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		secret = bearer
+	} else if c, err := r.Cookie(authCookie); err == nil {
+		secret = c.Value
+	}
+	if secret == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sketch"`)
+		s.authError(w, r, http.StatusUnauthorized, "unauthorized", "authentication required")
+		return false
+	}
+	tok, ok := s.lookupToken(secret)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sketch", error="invalid_token"`)
+		s.authError(w, r, http.StatusUnauthorized, "unauthorized", "invalid token")
+		return false
+	}
+	if scope := s.scopeFor(r); !tok.Has(scope) {
+		s.authError(w, r, http.StatusForbidden, "forbidden", fmt.Sprintf("token lacks the %q scope", scope))
+		return false
+	}
+	return true
+}
+
+// RequireAuth returns a handler that checks requests against s's tokens, as s does, before passing them to next.
+// It lets stand-ins for s, such as test servers, enforce the same scopes.
+func (s *Server) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.authorize(w, r) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// lookupToken returns the token with the given secret.
+// Share link tokens grant ScopeView until they expire.
+func (s *Server) lookupToken(secret string) (Token, bool) {
+	if _, ok := s.checkShareToken(secret); ok {
+		return Token{Secret: secret, Scopes: []Scope{ScopeView}}, true
+	}
+	for _, tok := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(tok.Secret), []byte(secret)) == 1 {
+			return tok, true
+		}
+	}
+	return Token{}, false
+}
+
+// authError reports an authentication failure, as JSON for /api/v1 requests.
+func (s *Server) authError(w http.ResponseWriter, r *http.Request, status int, code, msg string) {
+	if strings.HasPrefix(r.URL.Path, apiV1Prefix+"/") && s.ParsePortProxyHost(r.Host) == "" {
+		writeAPIError(w, r, apiErrorf(status, code, "%s", msg))
+		return
+	}
+	httpError(w, r, msg, status)
+}
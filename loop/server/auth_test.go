@@ -0,0 +1,128 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"sketch.dev/loop/server"
+)
+
+func TestParseToken(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []server.Scope
+		wantErr bool
+	}{
+		{spec: "s3cret", want: server.AllScopes},
+		{spec: "s3cret:all", want: server.AllScopes},
+		{spec: "s3cret:view", want: []server.Scope{server.ScopeView}},
+		{spec: "s3cret:chat, terminal", want: []server.Scope{server.ScopeView, server.ScopeChat, server.ScopeTerminal}},
+		{spec: "s3cret:admin", want: []server.Scope{server.ScopeAdmin}},
+		{spec: ":view", wantErr: true},
+		{spec: "s3cret:root", wantErr: true},
+	}
+	for _, tt := range tests {
+		tok, err := server.ParseToken(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseToken(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if tok.Secret != "s3cret" || !slices.Equal(tok.Scopes, tt.want) {
+			t.Errorf("ParseToken(%q) = %+v, want scopes %v", tt.spec, tok, tt.want)
+		}
+	}
+}
+
+func TestAuthScopes(t *testing.T) {
+	srv := newAPITestServer(t, 1)
+	var tokens []server.Token
+	for _, spec := range []string{"viewer:view", "chatter:chat", "root"} {
+		tok, err := server.ParseToken(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, tok)
+	}
+	srv.SetTokens(tokens)
+
+	do := func(method, host, path, token string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"message": "hi"}`))
+		if host != "" {
+			req.Host = host
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	tests := []struct {
+		method, host, path, token string
+		want                      int
+	}{
+		{"GET", "", "/api/v1/state", "", http.StatusUnauthorized},
+		{"GET", "", "/api/v1/state", "bogus", http.StatusUnauthorized},
+		{"GET", "", "/api/v1/state", "viewer", http.StatusOK},
+		{"POST", "", "/api/v1/chat", "viewer", http.StatusForbidden},
+		{"POST", "", "/api/v1/chat", "chatter", http.StatusAccepted},
+		{"POST", "", "/chat", "viewer", http.StatusForbidden},
+		{"POST", "", "/terminal/input/1", "chatter", http.StatusForbidden},
+		{"POST", "", "/git/save", "chatter", http.StatusForbidden},
+		{"GET", "", "/api/v1/messages", "viewer", http.StatusOK},
+		{"GET", "", "/debug/", "chatter", http.StatusForbidden},
+		{"GET", "", "/debug/", "root", http.StatusOK},
+		{"GET", "p8000.localhost:1234", "/", "viewer", http.StatusForbidden},
+		{"GET", "p8000.localhost:1234", "/", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := do(tt.method, tt.host, tt.path, tt.token); got != tt.want {
+			t.Errorf("%s %s%s with token %q: status %d, want %d", tt.method, tt.host, tt.path, tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestAuthTokenQueryParam(t *testing.T) {
+	srv := newAPITestServer(t, 0)
+	tok, err := server.ParseToken("viewer:view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetTokens([]server.Token{tok})
+
+	// ?token= sets a cookie and redirects to the URL without the token.
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/state?token=viewer&x=1", nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("status %d, want %d", rr.Code, http.StatusFound)
+	}
+	if loc := rr.Header().Get("Location"); loc != "/api/v1/state?x=1" {
+		t.Errorf("Location = %q, want /api/v1/state?x=1", loc)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "viewer" || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %v, want one HttpOnly token cookie", cookies)
+	}
+
+	// The cookie authenticates later requests.
+	req := httptest.NewRequest("GET", "/api/v1/state", nil)
+	req.AddCookie(cookies[0])
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("with cookie: status %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/?token=wrong", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("bad token: status %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
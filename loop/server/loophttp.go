@@ -5,7 +5,6 @@ import (
 	"context"
 	"crypto/rand"
 	"embed"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -28,7 +27,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/creack/pty"
+	"sketch.dev/claudetool"
 	"sketch.dev/claudetool/browse"
 	"sketch.dev/embedded"
 	"sketch.dev/git_tools"
@@ -101,27 +100,6 @@ func simplifyGitHubURL(url string) (string, bool) {
 	return url, false
 }
 
-// terminalSession represents a terminal session with its PTY and the event channel
-type terminalSession struct {
-	pty                *os.File
-	eventsClients      map[chan []byte]bool
-	lastEventClientID  int
-	eventsClientsMutex sync.Mutex
-	cmd                *exec.Cmd
-}
-
-// TerminalMessage represents a message sent from the client for terminal resize events
-type TerminalMessage struct {
-	Type string `json:"type"`
-	Cols uint16 `json:"cols"`
-	Rows uint16 `json:"rows"`
-}
-
-// TerminalResponse represents the response for a new terminal creation
-type TerminalResponse struct {
-	SessionID string `json:"sessionId"`
-}
-
 // TodoItem represents a single todo item for task management
 type TodoItem struct {
 	ID     string `json:"id"`
@@ -170,6 +148,8 @@ type State struct {
 	DiffLinesAdded       int                           `json:"diff_lines_added"`                // Lines added from sketch-base to HEAD
 	DiffLinesRemoved     int                           `json:"diff_lines_removed"`              // Lines removed from sketch-base to HEAD
 	OpenPorts            []Port                        `json:"open_ports,omitempty"`            // Currently open TCP ports
+	PortForwards         []PortForward                 `json:"port_forwards,omitempty"`         // Container ports forwarded to the host
+	Jobs                 []claudetool.JobInfo          `json:"jobs,omitempty"`                  // Background commands started by the agent
 	TokenContextWindow   int                           `json:"token_context_window,omitempty"`
 	Model                string                        `json:"model,omitempty"` // Name of the model being used
 	SessionEnded         bool                          `json:"session_ended,omitempty"`
@@ -179,10 +159,14 @@ type State struct {
 
 // Port represents an open TCP port
 type Port struct {
-	Proto   string `json:"proto"`   // "tcp" or "udp"
-	Port    uint16 `json:"port"`    // port number
-	Process string `json:"process"` // optional process name
-	Pid     int    `json:"pid"`     // process ID
+	Proto      string `json:"proto"`                 // "tcp" or "udp"
+	Port       uint16 `json:"port"`                  // port number
+	Process    string `json:"process"`               // optional process name
+	Pid        int    `json:"pid"`                   // process ID
+	Kind       string `json:"kind,omitempty"`        // protocol found by probing: "http", "grpc", "postgres", or "" if unknown
+	HTTPStatus int    `json:"http_status,omitempty"` // status of GET / for HTTP ports
+	Title      string `json:"title,omitempty"`       // <title> of the page at / for HTTP ports
+	Cmdline    string `json:"cmdline,omitempty"`     // command line of the process
 }
 
 type InitRequest struct {
@@ -209,9 +193,20 @@ type Server struct {
 	terminalSessions map[string]*terminalSession
 	sshAvailable     bool
 	sshError         string
+	tokens           []Token // if empty, no authentication is required
+	// shareKey signs read-only share links; see share.go.
+	shareMu  sync.Mutex
+	shareKey []byte
+	// portForwards are the container ports the outtie forwards to the host; see portforward.go.
+	portForwardsMu sync.Mutex
+	portForwards   []PortForward
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r) {
+		return
+	}
+
 	// Check if Host header matches "p<port>.localhost" pattern and proxy to that port
 	if port := s.ParsePortProxyHost(r.Host); port != "" {
 		s.proxyToPort(w, r, port)
@@ -244,7 +239,10 @@ func (s *Server) ParsePortProxyHost(host string) string {
 	return ""
 }
 
-// proxyToPort proxies the request to localhost:<port>
+// proxyToPort proxies the request to localhost:<port>.
+// WebSocket upgrades are passed through, and streaming responses
+// (server-sent events, and chunked responses without a Content-Length) are flushed as they arrive,
+// so dev servers with hot reloading, notebooks and the like work through the proxy.
 func (s *Server) proxyToPort(w http.ResponseWriter, r *http.Request, port string) {
 	// Create a reverse proxy to localhost:<port>
 	target, err := url.Parse(fmt.Sprintf("http://localhost:%s", port))
@@ -252,23 +250,33 @@ func (s *Server) proxyToPort(w http.ResponseWriter, r *http.Request, port string
 		httpError(w, r, "Failed to parse proxy target", http.StatusInternalServerError)
 		return
 	}
-
-	proxy := httputil.NewSingleHostReverseProxy(target)
-
-	// Customize the Director to modify the request
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
-		// Set the target host
-		req.URL.Host = target.Host
-		req.URL.Scheme = target.Scheme
-		req.Host = target.Host
+	proxyOrigin := "http://" + r.Host
+	if r.TLS != nil {
+		proxyOrigin = "https://" + r.Host
 	}
 
-	// Handle proxy errors
-	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		slog.Error("Proxy error", "error", err, "target", target.String(), "port", port)
-		httpError(w, r, "Proxy error: "+err.Error(), http.StatusBadGateway)
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			// Servers that check WebSocket origins (Jupyter, Vite) compare Origin with Host,
+			// which is now the target's, so make pages served through the proxy look same-origin.
+			if pr.In.Header.Get("Origin") == proxyOrigin {
+				pr.Out.Header.Set("Origin", target.Scheme+"://"+target.Host)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			// Keep redirects to the target's own address on the proxy.
+			if loc := resp.Header.Get("Location"); strings.HasPrefix(loc, target.String()) {
+				resp.Header.Set("Location", proxyOrigin+strings.TrimPrefix(loc, target.String()))
+			}
+			return nil
+		},
+		// Handle proxy errors
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Error("Proxy error", "error", err, "target", target.String(), "port", port)
+			httpError(w, r, "Proxy error: "+err.Error(), http.StatusBadGateway)
+		},
 	}
 
 	proxy.ServeHTTP(w, r)
@@ -284,6 +292,7 @@ func New(agent loop.CodingAgent, logFile *os.File) (*Server, error) {
 		terminalSessions: make(map[string]*terminalSession),
 		sshAvailable:     false,
 		sshError:         "",
+		shareKey:         newShareKey(),
 	}
 
 	s.mux.HandleFunc("/stream", s.handleSSEStream)
@@ -556,8 +565,8 @@ func New(agent loop.CodingAgent, logFile *os.File) (*Server, error) {
 
 	s.mux.Handle("/static/", http.StripPrefix("/static/", gzhandler.New(embedded.WebUIFS())))
 
-	// Terminal WebSocket handler
-	// Terminal endpoints - predefined terminals 1-9
+	// Terminal endpoints. Terminals 1-9 are created on demand when a client connects;
+	// others are created with POST /api/v1/terminals. See terminal.go.
 	// TODO: The UI doesn't actually know how to use terminals 2-9!
 	s.mux.HandleFunc("/terminal/events/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -571,15 +580,11 @@ func New(agent loop.CodingAgent, logFile *os.File) (*Server, error) {
 		}
 
 		sessionID := pathParts[3]
-		// Validate that the terminal ID is between 1-9
-		if len(sessionID) != 1 || sessionID[0] < '1' || sessionID[0] > '9' {
-			httpError(w, r, "Terminal ID must be between 1 and 9", http.StatusBadRequest)
-			return
-		}
-
 		s.handleTerminalEvents(w, r, sessionID)
 	})
 
+	s.mux.HandleFunc("/tunnel/", s.handleTunnel)
+
 	s.mux.HandleFunc("/terminal/input/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
@@ -887,6 +892,9 @@ func New(agent loop.CodingAgent, logFile *os.File) (*Server, error) {
 		}()
 	})
 
+	// Stable, versioned API for scripts and other tools
+	s.registerAPIV1()
+
 	debugMux := initDebugMux(agent)
 	s.mux.HandleFunc("/debug/", func(w http.ResponseWriter, r *http.Request) {
 		debugMux.ServeHTTP(w, r)
@@ -912,225 +920,6 @@ func getWorkingDir() string {
 	return wd
 }
 
-// createTerminalSession creates a new terminal session with the given ID
-func (s *Server) createTerminalSession(sessionID string) (*terminalSession, error) {
-	// Start a new shell process
-	shellPath := getShellPath()
-	cmd := exec.Command(shellPath)
-
-	// Get working directory from the agent if possible
-	workDir := getWorkingDir()
-	cmd.Dir = workDir
-
-	// Set up environment
-	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
-
-	// Start the command with a pty
-	ptmx, err := pty.Start(cmd)
-	if err != nil {
-		slog.Error("Failed to start pty", "error", err)
-		return nil, err
-	}
-
-	// Create the terminal session
-	session := &terminalSession{
-		pty:           ptmx,
-		eventsClients: make(map[chan []byte]bool),
-		cmd:           cmd,
-	}
-
-	// Start goroutine to read from pty and broadcast to all connected SSE clients
-	go s.readFromPtyAndBroadcast(sessionID, session)
-
-	return session, nil
-}
-
-// handleTerminalEvents handles SSE connections for terminal output
-func (s *Server) handleTerminalEvents(w http.ResponseWriter, r *http.Request, sessionID string) {
-	// Check if the session exists, if not, create it
-	s.ptyMutex.Lock()
-	session, exists := s.terminalSessions[sessionID]
-
-	if !exists {
-		// Create a new terminal session
-		var err error
-		session, err = s.createTerminalSession(sessionID)
-		if err != nil {
-			s.ptyMutex.Unlock()
-			httpError(w, r, fmt.Sprintf("Failed to create terminal: %v", err), http.StatusInternalServerError)
-			return
-		}
-
-		// Store the new session
-		s.terminalSessions[sessionID] = session
-	}
-	s.ptyMutex.Unlock()
-
-	// Set headers for SSE
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	// Create a channel for this client
-	events := make(chan []byte, 4096) // Buffer to prevent blocking
-
-	// Register this client's channel
-	session.eventsClientsMutex.Lock()
-	clientID := session.lastEventClientID + 1
-	session.lastEventClientID = clientID
-	session.eventsClients[events] = true
-	session.eventsClientsMutex.Unlock()
-
-	// When the client disconnects, remove their channel
-	defer func() {
-		session.eventsClientsMutex.Lock()
-		delete(session.eventsClients, events)
-		close(events)
-		session.eventsClientsMutex.Unlock()
-	}()
-
-	// Flush to send headers to client immediately
-	if f, ok := w.(http.Flusher); ok {
-		f.Flush()
-	}
-
-	// Send events to the client as they arrive
-	for {
-		select {
-		case <-r.Context().Done():
-			return
-		case data := <-events:
-			// Format as SSE with base64 encoding
-			fmt.Fprintf(w, "data: %s\n\n", base64.StdEncoding.EncodeToString(data))
-
-			// Flush the data immediately
-			if f, ok := w.(http.Flusher); ok {
-				f.Flush()
-			}
-		}
-	}
-}
-
-// handleTerminalInput processes input to the terminal
-func (s *Server) handleTerminalInput(w http.ResponseWriter, r *http.Request, sessionID string) {
-	// Check if the session exists
-	s.ptyMutex.Lock()
-	session, exists := s.terminalSessions[sessionID]
-	s.ptyMutex.Unlock()
-
-	if !exists {
-		httpError(w, r, "Terminal session not found", http.StatusNotFound)
-		return
-	}
-
-	// Read the request body (terminal input or resize command)
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		httpError(w, r, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
-	// Check if it's a resize message
-	if len(body) > 0 && body[0] == '{' {
-		var msg TerminalMessage
-		if err := json.Unmarshal(body, &msg); err == nil && msg.Type == "resize" {
-			if msg.Cols > 0 && msg.Rows > 0 {
-				pty.Setsize(session.pty, &pty.Winsize{
-					Cols: msg.Cols,
-					Rows: msg.Rows,
-				})
-
-				// Respond with success
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-		}
-	}
-
-	// Regular terminal input
-	_, err = session.pty.Write(body)
-	if err != nil {
-		slog.Error("Failed to write to pty", "error", err)
-		httpError(w, r, "Failed to write to terminal", http.StatusInternalServerError)
-		return
-	}
-
-	// Respond with success
-	w.WriteHeader(http.StatusOK)
-}
-
-// readFromPtyAndBroadcast reads output from the PTY and broadcasts it to all connected clients
-func (s *Server) readFromPtyAndBroadcast(sessionID string, session *terminalSession) {
-	buf := make([]byte, 4096)
-	defer func() {
-		// Clean up when done
-		s.ptyMutex.Lock()
-		delete(s.terminalSessions, sessionID)
-		s.ptyMutex.Unlock()
-
-		// Close the PTY
-		session.pty.Close()
-
-		// Ensure process is terminated
-		if session.cmd.Process != nil {
-			session.cmd.Process.Kill()
-		}
-		session.cmd.Wait()
-
-		// Close all client channels
-		session.eventsClientsMutex.Lock()
-		for ch := range session.eventsClients {
-			delete(session.eventsClients, ch)
-			close(ch)
-		}
-		session.eventsClientsMutex.Unlock()
-	}()
-
-	for {
-		n, err := session.pty.Read(buf)
-		if err != nil {
-			if err != io.EOF {
-				slog.Error("Failed to read from pty", "error", err)
-			}
-			break
-		}
-
-		// Make a copy of the data for each client
-		data := make([]byte, n)
-		copy(data, buf[:n])
-
-		// Broadcast to all connected clients
-		session.eventsClientsMutex.Lock()
-		for ch := range session.eventsClients {
-			// Try to send, but don't block if channel is full
-			select {
-			case ch <- data:
-			default:
-				// Channel is full, drop the message for this client
-			}
-		}
-		session.eventsClientsMutex.Unlock()
-	}
-}
-
-// getShellPath returns the path to the shell to use
-func getShellPath() string {
-	// Try to use the user's preferred shell
-	shell := os.Getenv("SHELL")
-	if shell != "" {
-		return shell
-	}
-
-	// Default to bash on Unix-like systems
-	if _, err := os.Stat("/bin/bash"); err == nil {
-		return "/bin/bash"
-	}
-
-	// Fall back to sh
-	return "/bin/sh"
-}
-
 func initDebugMux(agent loop.CodingAgent) *http.ServeMux {
 	mux := http.NewServeMux()
 	build := "unknown build"
@@ -1364,6 +1153,12 @@ func isValidGitSHA(sha string) bool {
 	return true
 }
 
+// isValidGitRev reports whether rev, a revision from a request, such as HEAD~1 or a SHA, can be passed to git.
+// Revisions starting with "-" would be taken as options, such as --output, which writes files.
+func isValidGitRev(rev string) bool {
+	return !strings.HasPrefix(rev, "-")
+}
+
 // /stream?from=N endpoint for Server-Sent Events
 func (s *Server) handleSSEStream(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/event-stream")
@@ -1582,6 +1377,8 @@ func (s *Server) getState() State {
 		DiffLinesAdded:       diffAdded,
 		DiffLinesRemoved:     diffRemoved,
 		OpenPorts:            s.getOpenPorts(),
+		PortForwards:         s.getPortForwards(),
+		Jobs:                 s.agent.Jobs(),
 		TokenContextWindow:   s.agent.TokenContextWindow(),
 		Model:                s.agent.ModelName(),
 	}
@@ -1594,13 +1391,19 @@ func (s *Server) getOpenPorts() []Port {
 		return nil
 	}
 
+	probes := s.agent.GetPortProbes()
 	result := make([]Port, len(ports))
 	for i, port := range ports {
+		probe := probes[port.Port]
 		result[i] = Port{
-			Proto:   port.Proto,
-			Port:    port.Port,
-			Process: port.Process,
-			Pid:     port.Pid,
+			Proto:      port.Proto,
+			Port:       port.Port,
+			Process:    port.Process,
+			Pid:        port.Pid,
+			Kind:       probe.Kind,
+			HTTPStatus: probe.HTTPStatus,
+			Title:      probe.Title,
+			Cmdline:    probe.Cmdline,
 		}
 	}
 	return result
@@ -1632,6 +1435,12 @@ func (s *Server) handleGitRawDiff(w http.ResponseWriter, r *http.Request) {
 		httpError(w, r, "Missing required parameter: either 'commit' or at least 'from'", http.StatusBadRequest)
 		return
 	}
+	for _, rev := range []string{from, to} {
+		if !isValidGitRev(rev) {
+			httpError(w, r, fmt.Sprintf("Invalid git revision: %s", rev), http.StatusBadRequest)
+			return
+		}
+	}
 	// Note: 'to' can be empty to indicate working directory (unstaged changes)
 
 	// Call the git_tools function
@@ -1664,6 +1473,10 @@ func (s *Server) handleGitShow(w http.ResponseWriter, r *http.Request) {
 		httpError(w, r, "Missing required parameter: 'hash'", http.StatusBadRequest)
 		return
 	}
+	if !isValidGitRev(hash) {
+		httpError(w, r, fmt.Sprintf("Invalid git revision: %s", hash), http.StatusBadRequest)
+		return
+	}
 
 	// Call the git_tools function
 	show, err := git_tools.GitShow(repoDir, hash)
@@ -1830,6 +1643,18 @@ func (s *Server) handleGitPushInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	response, err := s.gitPushInfo()
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// gitPushInfo returns the current HEAD commit info and remotes for push dialog
+func (s *Server) gitPushInfo() (*GitPushInfoResponse, error) {
 	repoDir := s.agent.RepoRoot()
 
 	// Get the current HEAD commit hash and subject in one command
@@ -1837,14 +1662,12 @@ func (s *Server) handleGitPushInfo(w http.ResponseWriter, r *http.Request) {
 	cmd.Dir = repoDir
 	output, err := cmd.Output()
 	if err != nil {
-		httpError(w, r, fmt.Sprintf("Error getting HEAD commit: %v", err), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("Error getting HEAD commit: %v", err)
 	}
 
 	parts := strings.Split(strings.TrimSpace(string(output)), "\x00")
 	if len(parts) != 2 {
-		httpError(w, r, "Unexpected git log output format", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("Unexpected git log output format")
 	}
 	hash := parts[0]
 	subject := parts[1]
@@ -1854,8 +1677,7 @@ func (s *Server) handleGitPushInfo(w http.ResponseWriter, r *http.Request) {
 	cmd.Dir = repoDir
 	output, err = cmd.Output()
 	if err != nil {
-		httpError(w, r, fmt.Sprintf("Error getting remotes: %v", err), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("Error getting remotes: %v", err)
 	}
 
 	remoteNames := strings.Fields(strings.TrimSpace(string(output)))
@@ -1896,13 +1718,11 @@ func (s *Server) handleGitPushInfo(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	response := GitPushInfoResponse{
+	return &GitPushInfoResponse{
 		Hash:    hash,
 		Subject: subject,
 		Remotes: remotes,
-	}
-	_ = json.NewEncoder(w).Encode(response)
+	}, nil
 }
 
 // handleGitPush handles git push operations
@@ -1926,74 +1746,32 @@ func (s *Server) handleGitPush(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repoDir := s.agent.RepoRoot()
-
-	// Build the git push command
-	args := []string{"push"}
-	if requestBody.DryRun {
-		args = append(args, "--dry-run")
-	}
-	if requestBody.Force {
-		args = append(args, "--force")
-	}
-
-	// Determine the target refspec
-	var targetRef string
-	if s.agent.PassthroughUpstream() && requestBody.Remote == "upstream" {
-		// Special case: upstream with passthrough-upstream pushes to refs/remotes/origin/<branch>
-		targetRef = fmt.Sprintf("refs/remotes/origin/%s", requestBody.Branch)
-	} else {
-		// Normal case: push to refs/heads/<branch>
-		targetRef = fmt.Sprintf("refs/heads/%s", requestBody.Branch)
-	}
-
-	args = append(args, requestBody.Remote, fmt.Sprintf("%s:%s", requestBody.Commit, targetRef))
-
-	// Log the git push command being executed
-	slog.InfoContext(r.Context(), "executing git push command",
-		"command", "git",
-		"args", args,
-		"remote", requestBody.Remote,
-		"branch", requestBody.Branch,
-		"commit", requestBody.Commit,
-		"target_ref", targetRef,
-		"dry_run", requestBody.DryRun,
-		"force", requestBody.Force,
-		"repo_dir", repoDir)
+	response := s.gitPush(r.Context(), requestBody)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
 
-	cmd := exec.Command("git", args...)
-	cmd.Dir = repoDir
-	// Ideally we want to pass an extra HTTP header so that the
-	// server can know that this was likely a user initiated action
-	// and not an agent-initiated action. However, git push weirdly
-	// doesn't take a "-c" option, and the only handy env variable that
-	// because a header is the user agent, so we abuse it...
-	cmd.Env = append(os.Environ(), "GIT_HTTP_USER_AGENT=sketch-intentional-push")
-	output, err := cmd.CombinedOutput()
-
-	// Log the result of the git push command
-	if err != nil {
-		slog.WarnContext(r.Context(), "git push command failed",
-			"error", err,
-			"output", string(output),
-			"args", args)
-	} else {
-		slog.InfoContext(r.Context(), "git push command completed successfully",
-			"output", string(output),
-			"args", args)
-	}
+// gitPush runs the git push described by requestBody.
+// Failures of git push itself are reported in the response, not as an error.
+func (s *Server) gitPush(ctx context.Context, requestBody GitPushRequest) GitPushResponse {
+	output, err := git_tools.GitPush(ctx, s.agent.RepoRoot(), git_tools.GitPushOptions{
+		Remote:              requestBody.Remote,
+		Branch:              requestBody.Branch,
+		Commit:              requestBody.Commit,
+		DryRun:              requestBody.DryRun,
+		Force:               requestBody.Force,
+		PassthroughUpstream: s.agent.PassthroughUpstream(),
+	})
 
 	// Prepare response
 	response := GitPushResponse{
 		Success: err == nil,
-		Output:  string(output),
+		Output:  output,
 		DryRun:  requestBody.DryRun,
 	}
 
 	if err != nil {
 		response.Error = err.Error()
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(response)
+	return response
 }
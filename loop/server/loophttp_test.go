@@ -3,15 +3,20 @@ package server_test
 import (
 	"bufio"
 	"context"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"slices"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"sketch.dev/claudetool"
+	"sketch.dev/claudetool/codereview"
 	"sketch.dev/llm/conversation"
 	"sketch.dev/loop"
 	"sketch.dev/loop/server"
@@ -36,6 +41,8 @@ type mockAgent struct {
 	retryNumber              int
 	skabandAddr              string
 	model                    string
+	jobs                     *claudetool.Jobs
+	review                   codereview.Report
 }
 
 // ExternalMessage implements loop.CodingAgent.
@@ -291,6 +298,30 @@ func (m *mockAgent) GetPorts() []portlist.Port {
 	}
 }
 
+func (m *mockAgent) Jobs() []claudetool.JobInfo {
+	if m.jobs == nil {
+		return nil
+	}
+	return m.jobs.List()
+}
+
+func (m *mockAgent) KillJob(id int) error {
+	if m.jobs == nil {
+		return fmt.Errorf("no job %d", id)
+	}
+	return m.jobs.Kill(id)
+}
+
+func (m *mockAgent) CodeReviewReport() codereview.Report {
+	return m.review
+}
+
+func (m *mockAgent) GetPortProbes() map[uint16]loop.PortProbe {
+	return map[uint16]loop.PortProbe{
+		8080: {Kind: "http", HTTPStatus: 200, Title: "Test Server", Cmdline: "test-server -port 8080"},
+	}
+}
+
 // TestSSEStream tests the SSE stream endpoint
 func TestSSEStream(t *testing.T) {
 	// Create a mock agent with initial messages
@@ -481,6 +512,17 @@ func TestGitRawDiffHandler(t *testing.T) {
 	if resp.StatusCode != http.StatusInternalServerError {
 		t.Errorf("Expected status 500, got: %d", resp.StatusCode)
 	}
+
+	// Test that options are rejected
+	for _, query := range []string{"commit=--output=/tmp/x", "from=--output=/tmp/x", "from=HEAD&to=-p"} {
+		resp, err = http.Get(testServer.URL + "/git/rawdiff?" + query)
+		if err != nil {
+			t.Fatalf("Failed to make HTTP request: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status bad request, got: %d", query, resp.StatusCode)
+		}
+	}
 }
 
 func TestGitShowHandler(t *testing.T) {
@@ -519,6 +561,15 @@ func TestGitShowHandler(t *testing.T) {
 	if resp.StatusCode != http.StatusInternalServerError {
 		t.Errorf("Expected status 500, got: %d", resp.StatusCode)
 	}
+
+	// Test that options are rejected
+	resp, err = http.Get(testServer.URL + "/git/show?hash=--output=/tmp/x")
+	if err != nil {
+		t.Fatalf("Failed to make HTTP request: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status bad request, got: %d", resp.StatusCode)
+	}
 }
 
 func TestCompactHandler(t *testing.T) {
@@ -690,6 +741,10 @@ func TestStateEndpointIncludesPorts(t *testing.T) {
 		t.Error("Response should contain process name 'nginx'")
 	}
 
+	if !strings.Contains(responseBody, `"title": "Test Server"`) || !strings.Contains(responseBody, `"http_status": 200`) {
+		t.Error("Response should contain the probe results for port 8080")
+	}
+
 	if !strings.Contains(responseBody, `"proto": "tcp"`) {
 		t.Error("Response should contain protocol 'tcp'")
 	}
@@ -825,3 +880,147 @@ func TestGitPushInfoHandler(t *testing.T) {
 		t.Errorf("Expected status 405, got: %d", resp.StatusCode)
 	}
 }
+
+// backendPort returns the port of a test server, as used in p<port>.localhost.
+func backendPort(t *testing.T, backend *httptest.Server) string {
+	t.Helper()
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Port()
+}
+
+func TestPortProxyWebSocket(t *testing.T) {
+	// The backend accepts the upgrade and echoes whatever it's sent, as a WebSocket echo server would.
+	// The proxy only moves bytes after the handshake, so no framing is needed.
+	gotHeaders := make(chan http.Header, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "want websocket", http.StatusBadRequest)
+			return
+		}
+		h := r.Header.Clone()
+		h.Set("Host", r.Host)
+		gotHeaders <- h
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+	defer backend.Close()
+	port := backendPort(t, backend)
+
+	srv := httptest.NewServer(newAPITestServer(t, 0))
+	defer srv.Close()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	proxyHost := "p" + port + ".localhost:8000"
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: %s\r\nOrigin: http://%s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", proxyHost, proxyHost)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade through proxy: status %s", resp.Status)
+	}
+
+	h := <-gotHeaders
+	if want := "localhost:" + port; h.Get("Host") != want || h.Get("Origin") != "http://"+want {
+		t.Errorf("backend saw Host %q, Origin %q; want both for %s", h.Get("Host"), h.Get("Origin"), want)
+	}
+	if h.Get("X-Forwarded-Host") != proxyHost {
+		t.Errorf("backend saw X-Forwarded-Host %q, want %q", h.Get("X-Forwarded-Host"), proxyHost)
+	}
+
+	for _, msg := range []string{"hello", "again"} {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(br, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != msg {
+			t.Errorf("echo = %q, want %q", buf, msg)
+		}
+	}
+}
+
+func TestPortProxyStreaming(t *testing.T) {
+	for _, contentType := range []string{"text/event-stream", "application/x-ndjson"} {
+		t.Run(contentType, func(t *testing.T) {
+			// The backend sends the second chunk only once the client has seen the first,
+			// so the test hangs unless the proxy streams.
+			firstSeen := make(chan struct{})
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", contentType)
+				io.WriteString(w, "data: one\n\n")
+				w.(http.Flusher).Flush()
+				select {
+				case <-firstSeen:
+				case <-time.After(5 * time.Second):
+					return
+				}
+				io.WriteString(w, "data: two\n\n")
+			}))
+			defer backend.Close()
+
+			srv := httptest.NewServer(newAPITestServer(t, 0))
+			defer srv.Close()
+			req, _ := http.NewRequest("GET", srv.URL+"/events", nil)
+			req.Host = "p" + backendPort(t, backend) + ".localhost"
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.ContentLength != -1 {
+				t.Errorf("ContentLength = %d, want a streamed response", resp.ContentLength)
+			}
+
+			br := bufio.NewReader(resp.Body)
+			line, err := br.ReadString('\n')
+			if err != nil || line != "data: one\n" {
+				t.Fatalf("first line = %q, %v", line, err)
+			}
+			close(firstSeen)
+			rest, err := io.ReadAll(br)
+			if err != nil || string(rest) != "\ndata: two\n\n" {
+				t.Errorf("rest = %q, %v", rest, err)
+			}
+		})
+	}
+}
+
+func TestPortProxyRedirect(t *testing.T) {
+	var backend *httptest.Server
+	backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, backend.URL+"/login?next=/", http.StatusFound)
+	}))
+	defer backend.Close()
+	port := backendPort(t, backend)
+	// The backend's URL uses 127.0.0.1; the proxy targets localhost.
+	backend.URL = "http://localhost:" + port
+
+	srv := newAPITestServer(t, 0)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "p" + port + ".localhost:8000"
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if want := "http://p" + port + ".localhost:8000/login?next=/"; rr.Header().Get("Location") != want {
+		t.Errorf("Location = %q, want %q", rr.Header().Get("Location"), want)
+	}
+}
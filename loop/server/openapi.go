@@ -0,0 +1,241 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"sketch.dev/loop"
+)
+
+//go:generate go run ../../cmd/openapi -o ../../docs/openapi.json
+
+// OpenAPI returns the OpenAPI 3.1 document describing the /api/v1 endpoints.
+//
+// Schemas are derived by reflection from the Go request and response types
+// (much as cmd/go2ts derives the web UI's TypeScript types),
+// so the document describes exactly what the server sends.
+func OpenAPI() map[string]any {
+	g := &schemaGen{
+		schemas: make(map[string]any),
+		names:   make(map[string]reflect.Type),
+	}
+	errorResponse := map[string]any{
+		"description": "Error",
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": g.schema(reflect.TypeFor[APIError]())},
+		},
+	}
+
+	paths := make(map[string]any)
+	for _, route := range apiV1Routes() {
+		op := map[string]any{
+			"summary":     route.Summary,
+			"description": fmt.Sprintf("Requires the %q scope when the server has auth tokens.", cmp.Or(route.Scope, ScopeView)),
+			"operationId": operationID(route),
+		}
+		var params []any
+		for _, p := range route.Params {
+			params = append(params, map[string]any{
+				"name":        p.Name,
+				"in":          "query",
+				"required":    p.Required,
+				"description": p.Description,
+				"schema":      map[string]any{"type": p.Type},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if route.Request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(route.Request))},
+				},
+			}
+		}
+		success := map[string]any{"description": "Success"}
+		if route.Response != nil {
+			success["content"] = map[string]any{
+				"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(route.Response))},
+			}
+		}
+		status := cmp.Or(route.Status, http.StatusOK)
+		op["responses"] = map[string]any{
+			strconv.Itoa(status): success,
+			"default":            errorResponse,
+		}
+
+		item, _ := paths[route.Path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[route.Path] = item
+		}
+		item[strings.ToLower(route.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":       "sketch API",
+			"version":     "1",
+			"description": "The stable HTTP API of a sketch session. All errors are reported as JSON APIError bodies.",
+		},
+		"servers": []any{map[string]any{"url": apiV1Prefix}},
+		// Authentication is optional: sketch started without -auth-token accepts every request.
+		"security": []any{map[string]any{"bearerAuth": []any{}}, map[string]any{}},
+		"paths":    paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A token given to sketch with -auth-token. Each token grants a set of scopes: view, chat, terminal, git-write, admin.",
+				},
+			},
+		},
+	}
+}
+
+// operationID derives an OpenAPI operationId such as "getGitLog" from route.
+func operationID(route apiRoute) string {
+	id := strings.ToLower(route.Method)
+	for part := range strings.FieldsFuncSeq(route.Path, func(r rune) bool { return r == '/' || r == '.' || r == '_' }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// enumValues lists the allowed values of string enum types that appear in the API.
+var enumValues = map[reflect.Type][]string{
+	reflect.TypeFor[loop.CodingAgentMessageType](): {
+		string(loop.UserMessageType),
+		string(loop.AgentMessageType),
+		string(loop.ErrorMessageType),
+		string(loop.BudgetMessageType),
+		string(loop.ToolUseMessageType),
+		string(loop.CommitMessageType),
+		string(loop.AutoMessageType),
+		string(loop.PortMessageType),
+		string(loop.CompactMessageType),
+		string(loop.SlugMessageType),
+		string(loop.ExternalMessageType),
+	},
+}
+
+// schemaGen builds JSON schemas for Go types, following encoding/json's rules.
+// Named struct types become shared components.
+type schemaGen struct {
+	schemas map[string]any          // components/schemas
+	names   map[string]reflect.Type // component name -> type, to detect collisions
+}
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeFor[time.Duration]():
+		return map[string]any{"type": "integer", "format": "int64", "description": "Duration in nanoseconds."}
+	case reflect.TypeFor[json.RawMessage]():
+		return map[string]any{}
+	}
+	if values, ok := enumValues[t]; ok {
+		return map[string]any{"type": "string", "enum": values}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := g.componentName(t)
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = map[string]any{} // placeholder, for recursive types
+			g.schemas[name] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	// Interfaces and anything else: any JSON value.
+	return map[string]any{}
+}
+
+// componentName returns a unique component name for the named type t.
+func (g *schemaGen) componentName(t reflect.Type) string {
+	name := t.Name()
+	if prev, ok := g.names[name]; ok && prev != t {
+		// Qualify with the package name, e.g. loop.State vs server.State.
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = pkg + "." + name
+	}
+	g.names[name] = t
+	return name
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	var required []string
+	g.addFields(t, props, &required)
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// addFields adds the JSON properties of struct type t to props,
+// flattening embedded structs as encoding/json does.
+func (g *schemaGen) addFields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(ft, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			*required = append(*required, name)
+		}
+	}
+}
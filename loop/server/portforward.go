@@ -0,0 +1,92 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// When sketch runs in a container, the outtie forwards ports that open in the container
+// to the host (see dockerimg/portforward.go). Each forwarded connection is carried by
+// a /tunnel/<port> request, which this server upgrades to a raw TCP connection to that port.
+// The outtie reports its forwards back with POST /api/v1/port-forwards, so they show in /state.
+
+// TunnelProtocol is the Upgrade protocol of /tunnel/<port> requests.
+const TunnelProtocol = "sketch-tcp"
+
+// PortForward is a container port that the outtie forwards to the host.
+type PortForward struct {
+	// Port is the port in the container.
+	Port uint16 `json:"port"`
+	// HostAddr is the address on the host that forwards to Port, such as "127.0.0.1:3000".
+	HostAddr string `json:"host_addr"`
+}
+
+// PortForwardsRequest is the body of POST /api/v1/port-forwards.
+type PortForwardsRequest struct {
+	// Forwards replaces the current list of forwards.
+	Forwards []PortForward `json:"forwards"`
+}
+
+// setPortForwards records the forwards reported by the outtie.
+func (s *Server) setPortForwards(forwards []PortForward) {
+	forwards = slices.Clone(forwards)
+	slices.SortFunc(forwards, func(a, b PortForward) int { return int(a.Port) - int(b.Port) })
+	s.portForwardsMu.Lock()
+	defer s.portForwardsMu.Unlock()
+	s.portForwards = forwards
+}
+
+func (s *Server) getPortForwards() []PortForward {
+	s.portForwardsMu.Lock()
+	defer s.portForwardsMu.Unlock()
+	return slices.Clone(s.portForwards)
+}
+
+// handleTunnel serves /tunnel/<port>: it connects to localhost:<port>,
+// and turns the request's connection into a two-way pipe to it.
+func (s *Server) handleTunnel(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/tunnel/"), 10, 16)
+	if err != nil || port == 0 {
+		httpError(w, r, "Invalid port", http.StatusBadRequest)
+		return
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), TunnelProtocol) {
+		httpError(w, r, "Expected Upgrade: "+TunnelProtocol, http.StatusBadRequest)
+		return
+	}
+
+	target, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", strconv.FormatUint(port, 10)), 5*time.Second)
+	if err != nil {
+		httpError(w, r, "Failed to connect: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer target.Close()
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		httpError(w, r, "Failed to hijack connection: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: " + TunnelProtocol + "\r\nConnection: Upgrade\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		return
+	}
+
+	go func() {
+		io.Copy(target, brw) // brw may hold bytes the client sent after the request
+		if tc, ok := target.(*net.TCPConn); ok {
+			tc.CloseWrite()
+		}
+	}()
+	// Once the target closes, the deferred Closes end the copy above.
+	if _, err := io.Copy(conn, target); err != nil {
+		slog.DebugContext(r.Context(), "tunnel closed", "port", port, "error", err)
+	}
+}
@@ -0,0 +1,104 @@
+package server_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sketch.dev/loop/server"
+)
+
+// echoPort starts a TCP server that echoes what it's sent, and returns its port.
+func echoPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestTunnel(t *testing.T) {
+	port := echoPort(t)
+	srv := httptest.NewServer(newAPITestServer(t, 0))
+	defer srv.Close()
+
+	resp, err := http.Get(fmt.Sprintf("%s/tunnel/%d", srv.URL, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("tunnel without upgrade: status %d, want 400", resp.StatusCode)
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Bytes sent right after the request, before the response, must not be lost.
+	fmt.Fprintf(conn, "GET /tunnel/%d HTTP/1.1\r\nHost: sketch\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\nearly ", port, server.TunnelProtocol)
+	br := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("tunnel: status %d, want 101", resp.StatusCode)
+	}
+	fmt.Fprint(conn, "late\n")
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "early late\n" {
+		t.Errorf("echoed %q, want %q", line, "early late\n")
+	}
+}
+
+func TestPortForwardsState(t *testing.T) {
+	srv := newAPITestServer(t, 0)
+	body := `{"forwards": [{"port": 8080, "host_addr": "127.0.0.1:41234"}, {"port": 3000, "host_addr": "127.0.0.1:3000"}]}`
+	if rr := doAPI(t, srv, "POST", "/api/v1/port-forwards", body); rr.Code != http.StatusOK {
+		t.Fatalf("POST /api/v1/port-forwards: status %d: %s", rr.Code, rr.Body)
+	}
+
+	var state server.State
+	rr := doAPI(t, srv, "GET", "/state", "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &state); err != nil {
+		t.Fatal(err)
+	}
+	want := []server.PortForward{{Port: 3000, HostAddr: "127.0.0.1:3000"}, {Port: 8080, HostAddr: "127.0.0.1:41234"}}
+	if fmt.Sprint(state.PortForwards) != fmt.Sprint(want) {
+		t.Errorf("port_forwards = %+v, want %+v", state.PortForwards, want)
+	}
+
+	doAPI(t, srv, "POST", "/api/v1/port-forwards", `{"forwards": []}`)
+	rr = doAPI(t, srv, "GET", "/state", "")
+	if strings.Contains(rr.Body.String(), "port_forwards") {
+		t.Errorf("state still has port_forwards: %s", rr.Body)
+	}
+}
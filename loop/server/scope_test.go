@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAPIV1RouteScopes checks that every /api/v1 route that isn't a GET declares a scope above ScopeView,
+// so that view-only tokens, such as share links, can't change anything.
+func TestAPIV1RouteScopes(t *testing.T) {
+	for _, route := range apiV1Routes() {
+		if route.Method == http.MethodGet {
+			continue
+		}
+		if route.Scope == "" || route.Scope == ScopeView {
+			t.Errorf("%s %s%s has scope %q; want chat or above", route.Method, apiV1Prefix, route.Path, route.Scope)
+		}
+	}
+}
+
+func TestDefaultScope(t *testing.T) {
+	s := &Server{}
+	tests := []struct {
+		method, path string
+		want         Scope
+	}{
+		{"GET", "/api/v1/nope", ScopeView},
+		{"POST", "/api/v1/nope", ScopeChat},
+		{"GET", "/git/show", ScopeView},
+		{"POST", "/git/show", ScopeChat},
+		{"DELETE", "/messages", ScopeChat},
+		{"POST", "/git/save", ScopeGitWrite},
+	}
+	for _, tt := range tests {
+		if got := s.scopeFor(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.want {
+			t.Errorf("scopeFor(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Share links give read-only access to a session for a limited time.
+// A share token is "share.<unix expiry>.<signature>", signed with a key
+// that lives only in this process: links stop working when the session ends,
+// or when the key is rotated to revoke them all.
+
+const (
+	sharePrefix     = "share."
+	defaultShareTTL = 24 * time.Hour
+	maxShareTTL     = 7 * 24 * time.Hour
+)
+
+// ShareRequest is the body of POST /api/v1/share.
+type ShareRequest struct {
+	// TTL is how long the link works, as a Go duration such as "2h". Defaults to 24h, at most 168h.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// ShareResponse is the response to POST /api/v1/share.
+type ShareResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newShareKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+// shareSignature signs payload with the current share key.
+func (s *Server) shareSignature(payload string) []byte {
+	s.shareMu.Lock()
+	key := s.shareKey
+	s.shareMu.Unlock()
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// newShareToken returns a share token that expires at exp.
+func (s *Server) newShareToken(exp time.Time) string {
+	payload := sharePrefix + strconv.FormatInt(exp.Unix(), 10)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.shareSignature(payload))
+}
+
+// checkShareToken reports the expiry of secret, if it is a valid, unexpired share token.
+func (s *Server) checkShareToken(secret string) (time.Time, bool) {
+	if !strings.HasPrefix(secret, sharePrefix) {
+		return time.Time{}, false
+	}
+	i := strings.LastIndex(secret, ".")
+	payload, sig := secret[:i], secret[i+1:]
+	unix, err := strconv.ParseInt(strings.TrimPrefix(payload, sharePrefix), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.shareSignature(payload)) {
+		return time.Time{}, false
+	}
+	exp := time.Unix(unix, 0)
+	if !time.Now().Before(exp) {
+		return time.Time{}, false
+	}
+	return exp, true
+}
+
+// revokeShareLinks invalidates every share link minted so far.
+func (s *Server) revokeShareLinks() {
+	s.shareMu.Lock()
+	s.shareKey = newShareKey()
+	s.shareMu.Unlock()
+}
+
+// apiShare serves POST /api/v1/share.
+func (s *Server) apiShare(r *http.Request) (any, error) {
+	if len(s.tokens) == 0 {
+		// Without tokens every request has full access, so a read-only link means nothing.
+		return nil, apiErrorf(http.StatusConflict, "auth_disabled", "share links need authentication; start sketch with -auth-token")
+	}
+	var req ShareRequest
+	if err := decodeAPIBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	ttl := defaultShareTTL
+	if req.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, badRequestf("invalid ttl %q: want a positive duration such as 2h", req.TTL)
+		}
+		if ttl > maxShareTTL {
+			return nil, badRequestf("ttl %v is longer than the maximum of %v", ttl, maxShareTTL)
+		}
+	}
+	exp := time.Now().Add(ttl).Truncate(time.Second)
+	u := url.URL{
+		Scheme:   "http",
+		Host:     r.Host,
+		Path:     "/",
+		RawQuery: url.Values{"token": {s.newShareToken(exp)}}.Encode(),
+	}
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		u.Scheme = "https"
+	}
+	return ShareResponse{URL: u.String(), ExpiresAt: exp.UTC()}, nil
+}
@@ -0,0 +1,88 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"sketch.dev/loop/server"
+)
+
+func TestShareLinks(t *testing.T) {
+	srv := newAPITestServer(t, 1)
+
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Host = "sketch.example:8080"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Without auth, a read-only link would grant full access, so none is made.
+	if rr := do("POST", "/api/v1/share", "", ""); rr.Code != http.StatusConflict {
+		t.Errorf("share without auth: status %d, want %d", rr.Code, http.StatusConflict)
+	}
+
+	tok, err := server.ParseToken("owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetTokens([]server.Token{tok})
+
+	if rr := do("POST", "/api/v1/share", `{"ttl": "1000h"}`, "owner"); rr.Code != http.StatusBadRequest {
+		t.Errorf("share with long ttl: status %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	rr := do("POST", "/api/v1/share", `{"ttl": "2h"}`, "owner")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("share: status %d: %s", rr.Code, rr.Body)
+	}
+	var resp server.ShareResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(resp.ExpiresAt); d < time.Hour || d > 2*time.Hour {
+		t.Errorf("expires in %v, want about 2h", d)
+	}
+	u, err := url.Parse(resp.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "sketch.example:8080" {
+		t.Errorf("share URL host = %q, want the request's host", u.Host)
+	}
+	share := u.Query().Get("token")
+
+	// The share token can watch, but not act.
+	if rr := do("GET", "/api/v1/messages", "", share); rr.Code != http.StatusOK {
+		t.Errorf("share token GET messages: status %d, want %d", rr.Code, http.StatusOK)
+	}
+	for _, path := range []string{"/api/v1/chat", "/api/v1/cancel", "/api/v1/git/push", "/api/v1/share", "/git/save", "/terminal/input/1"} {
+		if rr := do("POST", path, "{}", share); rr.Code != http.StatusForbidden {
+			t.Errorf("share token POST %s: status %d, want %d", path, rr.Code, http.StatusForbidden)
+		}
+	}
+
+	// Tampering with the expiry invalidates the signature.
+	parts := strings.Split(share, ".")
+	parts[1] = "99999999999"
+	if rr := do("GET", "/api/v1/messages", "", strings.Join(parts, ".")); rr.Code != http.StatusUnauthorized {
+		t.Errorf("tampered share token: status %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	// Revoking invalidates existing links.
+	if rr := do("DELETE", "/api/v1/share", "", "owner"); rr.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d: %s", rr.Code, rr.Body)
+	}
+	if rr := do("GET", "/api/v1/messages", "", share); rr.Code != http.StatusUnauthorized {
+		t.Errorf("revoked share token: status %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
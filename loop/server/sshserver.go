@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 	"unsafe"
@@ -24,16 +28,24 @@ func setWinsize(f *os.File, w, h int) {
 		uintptr(unsafe.Pointer(&struct{ h, w, x, y uint16 }{uint16(h), uint16(w), 0, 0})))
 }
 
+// ServeSSH serves SSH on port 22 to the authorized keys, and to certificates signed by containerCAKey.
+// Each line of authorizedKeys may restrict what its key can forward with OpenSSH authorized_keys options;
+// see forwardingPermissions.
 func (s *Server) ServeSSH(ctx context.Context, hostKey, authorizedKeys []byte, containerCAKey, hostCertificate []byte) error {
 	// Parse all authorized keys
-	allowedKeys := make([]ssh.PublicKey, 0)
+	type authorizedKey struct {
+		key   ssh.PublicKey
+		perms forwardingPermissions
+	}
+	allowedKeys := make([]authorizedKey, 0)
 	rest := authorizedKeys
 	var err error
 
 	// Continue parsing as long as there are bytes left
 	for len(rest) > 0 {
 		var key ssh.PublicKey
-		key, _, _, rest, err = ssh.ParseAuthorizedKey(rest)
+		var options []string
+		key, _, options, rest, err = ssh.ParseAuthorizedKey(rest)
 		if err != nil {
 			// If we hit an error, check if we have more lines to try
 			if i := bytes.IndexByte(rest, '\n'); i >= 0 {
@@ -44,7 +56,13 @@ func (s *Server) ServeSSH(ctx context.Context, hostKey, authorizedKeys []byte, c
 			// No more lines and we hit an error, so stop parsing
 			break
 		}
-		allowedKeys = append(allowedKeys, key)
+		perms, err := parseForwardingOptions(options)
+		if err != nil {
+			// Don't fall back to an unrestricted key.
+			slog.WarnContext(ctx, "ServeSSH: skipping authorized key with bad options", slog.String("err", err.Error()))
+			continue
+		}
+		allowedKeys = append(allowedKeys, authorizedKey{key: key, perms: perms})
 	}
 	if len(allowedKeys) == 0 {
 		return fmt.Errorf("ServeSSH: no valid authorized keys found")
@@ -85,20 +103,40 @@ func (s *Server) ServeSSH(ctx context.Context, hostKey, authorizedKeys []byte, c
 
 	server := ssh.Server{
 		LocalPortForwardingCallback: ssh.LocalPortForwardingCallback(func(ctx ssh.Context, dhost string, dport uint32) bool {
+			if !permissionsFrom(ctx).allowOpen(dhost, dport) {
+				slog.InfoContext(ctx, "Denied local forward", slog.String("host", dhost), slog.Any("port", dport))
+				return false
+			}
 			return true
 		}),
 		ReversePortForwardingCallback: ssh.ReversePortForwardingCallback(func(ctx ssh.Context, bindHost string, bindPort uint32) bool {
+			if !permissionsFrom(ctx).allowListen(bindHost, bindPort) {
+				slog.InfoContext(ctx, "Denied reverse forward", slog.String("bindHost", bindHost), slog.Any("bindPort", bindPort))
+				return false
+			}
 			slog.DebugContext(ctx, "Accepted reverse forward", slog.Any("bindHost", bindHost), slog.Any("bindPort", bindPort))
 			return true
 		}),
 		Addr:            ":22",
 		ChannelHandlers: ssh.DefaultChannelHandlers,
 		Handler: ssh.Handler(func(s ssh.Session) {
+			var env []string
+			if ssh.AgentRequested(s) && permissionsFrom(s.Context()).agentForwarding {
+				l, err := ssh.NewAgentListener()
+				if err != nil {
+					slog.ErrorContext(ctx, "ServeSSH: agent forwarding", slog.String("err", err.Error()))
+				} else {
+					defer os.RemoveAll(filepath.Dir(l.Addr().String()))
+					defer l.Close()
+					go ssh.ForwardAgentConnections(l, s)
+					env = append(env, "SSH_AUTH_SOCK="+l.Addr().String())
+				}
+			}
 			ptyReq, winCh, isPty := s.Pty()
 			if isPty {
-				handlePTYSession(ctx, s, ptyReq, winCh)
+				handlePTYSession(ctx, s, ptyReq, winCh, env)
 			} else {
-				handleSession(ctx, s)
+				handleSession(ctx, s, env)
 			}
 		}),
 		RequestHandlers: map[string]ssh.RequestHandler{
@@ -124,6 +162,7 @@ func (s *Server) ServeSSH(ctx context.Context, hostKey, authorizedKeys []byte, c
 							// Check if the certificate has the right principal
 							if sliceContains(cert.ValidPrincipals, "root") {
 								slog.InfoContext(ctx, "SSH client authenticated with valid certificate")
+								ctx.SetValue(forwardingPermissionsKey, certForwardingPermissions(cert))
 								return true
 							}
 							slog.WarnContext(ctx, "Certificate lacks root principal",
@@ -139,9 +178,11 @@ func (s *Server) ServeSSH(ctx context.Context, hostKey, authorizedKeys []byte, c
 			}
 
 			// Standard key-based authentication fallback
+			// Like sshd, the first matching line's options apply.
 			for _, allowedKey := range allowedKeys {
-				if ssh.KeysEqual(key, allowedKey) {
+				if ssh.KeysEqual(key, allowedKey.key) {
 					slog.DebugContext(ctx, "ServeSSH: allow key", slog.String("key", string(key.Marshal())))
+					ctx.SetValue(forwardingPermissionsKey, allowedKey.perms)
 					return true
 				}
 			}
@@ -177,11 +218,12 @@ func handleSftp(ctx context.Context, sess ssh.Session) {
 	}
 }
 
-func handlePTYSession(ctx context.Context, s ssh.Session, ptyReq ssh.Pty, winCh <-chan ssh.Window) {
+func handlePTYSession(ctx context.Context, s ssh.Session, ptyReq ssh.Pty, winCh <-chan ssh.Window, env []string) {
 	cmd := exec.CommandContext(ctx, "/bin/bash")
 	slog.DebugContext(ctx, "handlePTYSession", slog.Any("ptyReq", ptyReq))
 
 	cmd.Env = append(os.Environ(), fmt.Sprintf("TERM=%s", ptyReq.Term))
+	cmd.Env = append(cmd.Env, env...)
 	f, err := pty.Start(cmd)
 	if err != nil {
 		fmt.Fprintf(s, "PTY requested, but unable to start due to error: %v", err)
@@ -207,7 +249,7 @@ func handlePTYSession(ctx context.Context, s ssh.Session, ptyReq ssh.Pty, winCh
 	}
 }
 
-func handleSession(ctx context.Context, s ssh.Session) {
+func handleSession(ctx context.Context, s ssh.Session, env []string) {
 	var cmd *exec.Cmd
 	slog.DebugContext(ctx, "handleSession", slog.Any("s.Command", s.Command()))
 	if len(s.Command()) == 0 {
@@ -215,6 +257,9 @@ func handleSession(ctx context.Context, s ssh.Session) {
 	} else {
 		cmd = exec.CommandContext(ctx, s.Command()[0], s.Command()[1:]...)
 	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	stdinPipe, err := cmd.StdinPipe()
 	if err != nil {
 		slog.ErrorContext(ctx, "handleSession: cmd.StdinPipe", slog.Any("err", err.Error()))
@@ -271,3 +316,131 @@ func handleSession(ctx context.Context, s ssh.Session) {
 func sliceContains(slice []string, value string) bool {
 	return slices.Contains(slice, value)
 }
+
+// forwardingPermissions say what an SSH client may forward.
+// For authorized keys, they come from the key's authorized_keys options, as in sshd:
+//
+//   - restrict disables port and agent forwarding;
+//     port-forwarding and agent-forwarding re-enable them.
+//   - no-port-forwarding and no-agent-forwarding disable one kind of forwarding.
+//   - permitopen="host:port" limits ssh -L to the listed destinations.
+//   - permitlisten="[host:]port" limits ssh -R to the listed listen addresses.
+//
+// In permitopen and permitlisten, host or port may be "*", and "none" permits nothing.
+// Certificates may forward what their permit-port-forwarding and permit-agent-forwarding extensions allow.
+type forwardingPermissions struct {
+	portForwarding  bool
+	agentForwarding bool
+	permitOpen      []string // nil permits any destination
+	permitListen    []string // nil permits any listen address
+}
+
+var fullForwardingPermissions = forwardingPermissions{portForwarding: true, agentForwarding: true}
+
+type forwardingPermissionsKeyType struct{}
+
+var forwardingPermissionsKey forwardingPermissionsKeyType
+
+// permissionsFrom returns the forwarding permissions of the client authenticated on ctx.
+func permissionsFrom(ctx ssh.Context) forwardingPermissions {
+	perms, ok := ctx.Value(forwardingPermissionsKey).(forwardingPermissions)
+	if !ok {
+		return forwardingPermissions{}
+	}
+	return perms
+}
+
+// parseForwardingOptions reads the forwarding permissions from authorized_keys options.
+// Other options are ignored.
+func parseForwardingOptions(options []string) (forwardingPermissions, error) {
+	perms := fullForwardingPermissions
+	for _, opt := range options {
+		name, value, hasValue := strings.Cut(opt, "=")
+		if hasValue {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return perms, fmt.Errorf("option %s: bad value %s", name, value)
+			}
+			value = unquoted
+		}
+		switch strings.ToLower(name) {
+		case "restrict":
+			perms.portForwarding, perms.agentForwarding = false, false
+		case "port-forwarding":
+			perms.portForwarding = true
+		case "agent-forwarding":
+			perms.agentForwarding = true
+		case "no-port-forwarding":
+			perms.portForwarding = false
+		case "no-agent-forwarding":
+			perms.agentForwarding = false
+		case "permitopen":
+			if _, _, err := splitForwardSpec(value, true); err != nil {
+				return perms, fmt.Errorf("option permitopen: %w", err)
+			}
+			perms.permitOpen = append(perms.permitOpen, value)
+		case "permitlisten":
+			if _, _, err := splitForwardSpec(value, false); err != nil {
+				return perms, fmt.Errorf("option permitlisten: %w", err)
+			}
+			perms.permitListen = append(perms.permitListen, value)
+		}
+	}
+	return perms, nil
+}
+
+// certForwardingPermissions returns the forwarding permissions granted by a certificate's extensions.
+func certForwardingPermissions(cert *gossh.Certificate) forwardingPermissions {
+	_, port := cert.Permissions.Extensions["permit-port-forwarding"]
+	_, agent := cert.Permissions.Extensions["permit-agent-forwarding"]
+	return forwardingPermissions{portForwarding: port, agentForwarding: agent}
+}
+
+// allowOpen reports whether the client may open a connection to host:port (ssh -L).
+func (p forwardingPermissions) allowOpen(host string, port uint32) bool {
+	return p.portForwarding && matchForwardSpecs(p.permitOpen, host, port, true)
+}
+
+// allowListen reports whether the client may listen on host:port (ssh -R).
+func (p forwardingPermissions) allowListen(host string, port uint32) bool {
+	return p.portForwarding && matchForwardSpecs(p.permitListen, host, port, false)
+}
+
+func matchForwardSpecs(specs []string, host string, port uint32, needHost bool) bool {
+	if specs == nil {
+		return true
+	}
+	for _, spec := range specs {
+		if spec == "none" {
+			continue
+		}
+		specHost, specPort, err := splitForwardSpec(spec, needHost)
+		if err != nil {
+			continue
+		}
+		if (specHost == "*" || strings.EqualFold(specHost, host)) &&
+			(specPort == "*" || specPort == strconv.FormatUint(uint64(port), 10)) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitForwardSpec splits a permitopen "host:port" or permitlisten "[host:]port" spec.
+// A permitlisten spec without a host matches any host.
+func splitForwardSpec(spec string, needHost bool) (host, port string, err error) {
+	if spec == "none" {
+		return "", "", nil
+	}
+	if !needHost && !strings.Contains(spec, ":") {
+		host, port = "*", spec
+	} else if host, port, err = net.SplitHostPort(spec); err != nil {
+		return "", "", err
+	}
+	if port != "*" {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return "", "", fmt.Errorf("bad port in %q", spec)
+		}
+	}
+	return host, port, nil
+}
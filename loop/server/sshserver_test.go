@@ -0,0 +1,89 @@
+package server
+
+import (
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestParseForwardingOptions(t *testing.T) {
+	type check struct {
+		open   bool // whether host:port can be opened
+		listen bool // whether host:port can be listened on
+		host   string
+		port   uint32
+	}
+	tests := []struct {
+		options []string
+		agent   bool
+		checks  []check
+	}{
+		{
+			options: nil,
+			agent:   true,
+			checks:  []check{{open: true, listen: true, host: "example.com", port: 443}},
+		},
+		{
+			options: []string{"no-port-forwarding", "no-pty"},
+			agent:   true,
+			checks:  []check{{host: "localhost", port: 8080}},
+		},
+		{
+			options: []string{"restrict", "agent-forwarding"},
+			agent:   true,
+			checks:  []check{{host: "localhost", port: 8080}},
+		},
+		{
+			options: []string{"restrict", "port-forwarding", `permitopen="localhost:8080"`, `permitopen="db:*"`, `permitlisten="9000"`},
+			checks: []check{
+				{open: true, host: "localhost", port: 8080},
+				{open: true, host: "LOCALHOST", port: 8080},
+				{host: "localhost", port: 8081},
+				{open: true, host: "db", port: 5432},
+				{listen: true, host: "0.0.0.0", port: 9000},
+			},
+		},
+		{
+			options: []string{"no-agent-forwarding", `permitopen="none"`, `permitlisten="localhost:*"`},
+			checks: []check{
+				{listen: true, host: "localhost", port: 8080},
+				{host: "0.0.0.0", port: 8080},
+			},
+		},
+	}
+	for _, tt := range tests {
+		perms, err := parseForwardingOptions(tt.options)
+		if err != nil {
+			t.Errorf("parseForwardingOptions(%q): %v", tt.options, err)
+			continue
+		}
+		if perms.agentForwarding != tt.agent {
+			t.Errorf("parseForwardingOptions(%q): agent forwarding %v, want %v", tt.options, perms.agentForwarding, tt.agent)
+		}
+		for _, c := range tt.checks {
+			if got := perms.allowOpen(c.host, c.port); got != c.open {
+				t.Errorf("options %q: allowOpen(%s, %d) = %v, want %v", tt.options, c.host, c.port, got, c.open)
+			}
+			if got := perms.allowListen(c.host, c.port); got != c.listen {
+				t.Errorf("options %q: allowListen(%s, %d) = %v, want %v", tt.options, c.host, c.port, got, c.listen)
+			}
+		}
+	}
+
+	for _, bad := range []string{`permitopen="localhost"`, `permitopen="localhost:http"`, `permitlisten="x:99999"`, `permitopen=localhost:80`} {
+		if _, err := parseForwardingOptions([]string{bad}); err == nil {
+			t.Errorf("parseForwardingOptions(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestCertForwardingPermissions(t *testing.T) {
+	cert := &gossh.Certificate{Permissions: gossh.Permissions{Extensions: map[string]string{"permit-pty": "", "permit-agent-forwarding": ""}}}
+	perms := certForwardingPermissions(cert)
+	if !perms.agentForwarding || perms.allowOpen("localhost", 80) {
+		t.Errorf("certForwardingPermissions = %+v; want agent forwarding only", perms)
+	}
+	if perms := (forwardingPermissions{}); perms.allowOpen("localhost", 80) || perms.allowListen("localhost", 80) {
+		t.Errorf("zero forwardingPermissions allow forwarding")
+	}
+}
@@ -0,0 +1,588 @@
+package server
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/creack/pty"
+)
+
+// Terminal sessions are shells running in PTYs, shown by the web UI's terminal tab.
+// A session lives until its shell exits or it is killed, not just while a client
+// is connected: output is kept in a scrollback buffer and replayed to each client
+// that connects, so that reloading the page doesn't lose it.
+
+// terminalScrollbackSize is the number of bytes of output kept for replay to new clients.
+const terminalScrollbackSize = 256 << 10
+
+// terminalSession represents a terminal session with its PTY and the event channel
+type terminalSession struct {
+	id      string
+	name    string
+	cwd     string
+	created time.Time
+
+	pty                *os.File
+	eventsClients      map[chan []byte]bool
+	lastEventClientID  int
+	eventsClientsMutex sync.Mutex // also protects scrollback and recording
+	scrollback         *ringBuffer
+	recording          *asciicastWriter // nil if not recording
+	cmd                *exec.Cmd
+}
+
+// terminalOptions configures a new terminal session.
+type terminalOptions struct {
+	Name   string
+	Cwd    string // if empty, the working directory of the sketch process
+	Record bool   // record the session to an asciicast file
+}
+
+// TerminalMessage represents a message sent from the client for terminal resize events
+type TerminalMessage struct {
+	Type string `json:"type"`
+	Cols uint16 `json:"cols"`
+	Rows uint16 `json:"rows"`
+}
+
+// TerminalResponse represents the response for a new terminal creation
+type TerminalResponse struct {
+	SessionID string `json:"sessionId"`
+}
+
+// TerminalInfo describes a terminal session.
+type TerminalInfo struct {
+	// ID identifies the session in /terminal/events/{id} and /terminal/input/{id}.
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Cwd       string    `json:"cwd"`
+	Pid       int       `json:"pid"`
+	CreatedAt time.Time `json:"created_at"`
+	// Clients is the number of clients receiving the session's output.
+	Clients int `json:"clients"`
+	// Recording is the path of the session's asciicast recording, if it is being recorded.
+	Recording string `json:"recording,omitempty"`
+}
+
+// CreateTerminalRequest is the body of POST /api/v1/terminals.
+type CreateTerminalRequest struct {
+	Name string `json:"name,omitempty"`
+	// Cwd is the shell's working directory. Relative paths are relative to the repository root.
+	Cwd string `json:"cwd,omitempty"`
+	// Record records the session in asciicast v2 format, for playback with asciinema.
+	Record bool `json:"record,omitempty"`
+}
+
+func (session *terminalSession) info() TerminalInfo {
+	session.eventsClientsMutex.Lock()
+	defer session.eventsClientsMutex.Unlock()
+	info := TerminalInfo{
+		ID:        session.id,
+		Name:      session.name,
+		Cwd:       session.cwd,
+		CreatedAt: session.created,
+		Clients:   len(session.eventsClients),
+	}
+	if session.cmd.Process != nil {
+		info.Pid = session.cmd.Process.Pid
+	}
+	if session.recording != nil {
+		info.Recording = session.recording.path
+	}
+	return info
+}
+
+// isLegacyTerminalID reports whether id is one of the terminals 1-9,
+// which the web UI creates on demand by connecting to them.
+func isLegacyTerminalID(id string) bool {
+	return len(id) == 1 && id[0] >= '1' && id[0] <= '9'
+}
+
+// createTerminalSession creates a new terminal session with the given ID.
+// s.ptyMutex must be held.
+func (s *Server) createTerminalSession(sessionID string, opts terminalOptions) (*terminalSession, error) {
+	// Start a new shell process
+	shellPath := getShellPath()
+	cmd := exec.Command(shellPath)
+
+	// Get working directory from the agent if possible
+	workDir := getWorkingDir()
+	if opts.Cwd != "" {
+		workDir = opts.Cwd
+	}
+	cmd.Dir = workDir
+
+	// Set up environment
+	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+
+	// Start the command with a pty
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		slog.Error("Failed to start pty", "error", err)
+		return nil, err
+	}
+
+	// Create the terminal session
+	session := &terminalSession{
+		id:            sessionID,
+		name:          cmp.Or(opts.Name, "Terminal "+sessionID),
+		cwd:           workDir,
+		created:       time.Now(),
+		pty:           ptmx,
+		eventsClients: make(map[chan []byte]bool),
+		scrollback:    newRingBuffer(terminalScrollbackSize),
+		cmd:           cmd,
+	}
+	if opts.Record {
+		session.recording, err = newAsciicastWriter(session, shellPath)
+		if err != nil {
+			ptmx.Close()
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil, fmt.Errorf("failed to start recording: %w", err)
+		}
+	}
+	s.terminalSessions[sessionID] = session
+
+	// Start goroutine to read from pty and broadcast to all connected SSE clients
+	go s.readFromPtyAndBroadcast(sessionID, session)
+
+	return session, nil
+}
+
+// newTerminalID returns the smallest unused terminal ID. s.ptyMutex must be held.
+func (s *Server) newTerminalID() string {
+	for i := 1; ; i++ {
+		id := strconv.Itoa(i)
+		if _, exists := s.terminalSessions[id]; !exists {
+			return id
+		}
+	}
+}
+
+// listTerminals returns the terminal sessions, ordered by ID.
+func (s *Server) listTerminals() []TerminalInfo {
+	s.ptyMutex.Lock()
+	sessions := make([]*terminalSession, 0, len(s.terminalSessions))
+	for _, session := range s.terminalSessions {
+		sessions = append(sessions, session)
+	}
+	s.ptyMutex.Unlock()
+
+	infos := make([]TerminalInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, session.info())
+	}
+	slices.SortFunc(infos, func(a, b TerminalInfo) int {
+		if len(a.ID) != len(b.ID) {
+			return len(a.ID) - len(b.ID)
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return infos
+}
+
+// apiCreateTerminal serves POST /api/v1/terminals.
+func (s *Server) apiCreateTerminal(r *http.Request) (any, error) {
+	var req CreateTerminalRequest
+	if err := decodeAPIBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	opts := terminalOptions{Name: req.Name, Cwd: req.Cwd, Record: req.Record}
+	if opts.Cwd != "" {
+		if !filepath.IsAbs(opts.Cwd) {
+			opts.Cwd = filepath.Join(cmp.Or(s.agent.RepoRoot(), getWorkingDir()), opts.Cwd)
+		}
+		if fi, err := os.Stat(opts.Cwd); err != nil || !fi.IsDir() {
+			return nil, badRequestf("cwd %q is not a directory", req.Cwd)
+		}
+	}
+
+	s.ptyMutex.Lock()
+	session, err := s.createTerminalSession(s.newTerminalID(), opts)
+	s.ptyMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return session.info(), nil
+}
+
+// killTerminal ends the terminal session id. It reports whether the session existed.
+// Connected clients see their event streams end.
+func (s *Server) killTerminal(id string) bool {
+	s.ptyMutex.Lock()
+	session, exists := s.terminalSessions[id]
+	delete(s.terminalSessions, id)
+	s.ptyMutex.Unlock()
+	if !exists {
+		return false
+	}
+	// readFromPtyAndBroadcast notices the PTY closing, and cleans up.
+	if session.cmd.Process != nil {
+		session.cmd.Process.Kill()
+	}
+	session.pty.Close()
+	return true
+}
+
+// handleTerminalEvents handles SSE connections for terminal output.
+// New clients first receive the session's scrollback.
+func (s *Server) handleTerminalEvents(w http.ResponseWriter, r *http.Request, sessionID string) {
+	// Check if the session exists, if not, create it
+	s.ptyMutex.Lock()
+	session, exists := s.terminalSessions[sessionID]
+
+	if !exists {
+		if !isLegacyTerminalID(sessionID) {
+			s.ptyMutex.Unlock()
+			httpError(w, r, "Terminal session not found", http.StatusNotFound)
+			return
+		}
+		// Create a new terminal session
+		var err error
+		session, err = s.createTerminalSession(sessionID, terminalOptions{})
+		if err != nil {
+			s.ptyMutex.Unlock()
+			httpError(w, r, fmt.Sprintf("Failed to create terminal: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	s.ptyMutex.Unlock()
+
+	// Set headers for SSE
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	// Create a channel for this client
+	events := make(chan []byte, 4096) // Buffer to prevent blocking
+
+	// Register this client's channel, and take the scrollback,
+	// together, so that no output is missed or sent twice.
+	session.eventsClientsMutex.Lock()
+	clientID := session.lastEventClientID + 1
+	session.lastEventClientID = clientID
+	session.eventsClients[events] = true
+	replay := session.scrollback.Bytes()
+	session.eventsClientsMutex.Unlock()
+
+	// When the client disconnects, remove their channel,
+	// unless the session already closed it when it ended.
+	defer func() {
+		session.eventsClientsMutex.Lock()
+		if session.eventsClients[events] {
+			delete(session.eventsClients, events)
+			close(events)
+		}
+		session.eventsClientsMutex.Unlock()
+	}()
+
+	if len(replay) > 0 {
+		fmt.Fprintf(w, "data: %s\n\n", base64.StdEncoding.EncodeToString(replay))
+	}
+
+	// Flush to send headers to client immediately
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	// Send events to the client as they arrive
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data, ok := <-events:
+			if !ok {
+				return // the session ended
+			}
+			// Format as SSE with base64 encoding
+			fmt.Fprintf(w, "data: %s\n\n", base64.StdEncoding.EncodeToString(data))
+
+			// Flush the data immediately
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+	}
+}
+
+// handleTerminalInput processes input to the terminal
+func (s *Server) handleTerminalInput(w http.ResponseWriter, r *http.Request, sessionID string) {
+	// Check if the session exists
+	s.ptyMutex.Lock()
+	session, exists := s.terminalSessions[sessionID]
+	s.ptyMutex.Unlock()
+
+	if !exists {
+		httpError(w, r, "Terminal session not found", http.StatusNotFound)
+		return
+	}
+
+	// Read the request body (terminal input or resize command)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		httpError(w, r, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	// Check if it's a resize message
+	if len(body) > 0 && body[0] == '{' {
+		var msg TerminalMessage
+		if err := json.Unmarshal(body, &msg); err == nil && msg.Type == "resize" {
+			if msg.Cols > 0 && msg.Rows > 0 {
+				pty.Setsize(session.pty, &pty.Winsize{
+					Cols: msg.Cols,
+					Rows: msg.Rows,
+				})
+				session.eventsClientsMutex.Lock()
+				if session.recording != nil {
+					session.recording.resize(msg.Cols, msg.Rows)
+				}
+				session.eventsClientsMutex.Unlock()
+
+				// Respond with success
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+	}
+
+	// Regular terminal input
+	_, err = session.pty.Write(body)
+	if err != nil {
+		slog.Error("Failed to write to pty", "error", err)
+		httpError(w, r, "Failed to write to terminal", http.StatusInternalServerError)
+		return
+	}
+
+	// Respond with success
+	w.WriteHeader(http.StatusOK)
+}
+
+// readFromPtyAndBroadcast reads output from the PTY and broadcasts it to all connected clients
+func (s *Server) readFromPtyAndBroadcast(sessionID string, session *terminalSession) {
+	buf := make([]byte, 4096)
+	defer func() {
+		// Clean up when done, unless the ID has been reused by a new session.
+		s.ptyMutex.Lock()
+		if s.terminalSessions[sessionID] == session {
+			delete(s.terminalSessions, sessionID)
+		}
+		s.ptyMutex.Unlock()
+
+		// Close the PTY
+		session.pty.Close()
+
+		// Ensure process is terminated
+		if session.cmd.Process != nil {
+			session.cmd.Process.Kill()
+		}
+		session.cmd.Wait()
+
+		// Close all client channels
+		session.eventsClientsMutex.Lock()
+		for ch := range session.eventsClients {
+			delete(session.eventsClients, ch)
+			close(ch)
+		}
+		if session.recording != nil {
+			if err := session.recording.Close(); err != nil {
+				slog.Error("Failed to finish terminal recording", "error", err)
+			}
+		}
+		session.eventsClientsMutex.Unlock()
+	}()
+
+	for {
+		n, err := session.pty.Read(buf)
+		if err != nil {
+			if err != io.EOF {
+				slog.Debug("PTY read ended", "error", err)
+			}
+			break
+		}
+
+		// Make a copy of the data for each client
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		// Broadcast to all connected clients
+		session.eventsClientsMutex.Lock()
+		session.scrollback.Write(data)
+		if session.recording != nil {
+			session.recording.output(data)
+		}
+		for ch := range session.eventsClients {
+			// Try to send, but don't block if channel is full
+			select {
+			case ch <- data:
+			default:
+				// Channel is full, drop the message for this client
+			}
+		}
+		session.eventsClientsMutex.Unlock()
+	}
+}
+
+// getShellPath returns the path to the shell to use
+func getShellPath() string {
+	// Try to use the user's preferred shell
+	shell := os.Getenv("SHELL")
+	if shell != "" {
+		return shell
+	}
+
+	// Default to bash on Unix-like systems
+	if _, err := os.Stat("/bin/bash"); err == nil {
+		return "/bin/bash"
+	}
+
+	// Fall back to sh
+	return "/bin/sh"
+}
+
+// ringBuffer keeps the last size bytes written to it.
+type ringBuffer struct {
+	buf     []byte
+	pos     int // where the next byte goes
+	wrapped bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{buf: make([]byte, size)}
+}
+
+func (b *ringBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if n >= len(b.buf) {
+		copy(b.buf, p[n-len(b.buf):])
+		b.pos, b.wrapped = 0, true
+		return n, nil
+	}
+	c := copy(b.buf[b.pos:], p)
+	if c < n {
+		copy(b.buf, p[c:])
+		b.wrapped = true
+	}
+	b.pos = (b.pos + n) % len(b.buf)
+	if b.pos == 0 {
+		b.wrapped = true
+	}
+	return n, nil
+}
+
+// Bytes returns a copy of the buffered bytes, oldest first.
+// Once the buffer has wrapped, it starts at a line boundary if it can,
+// to avoid replaying half a line or escape sequence.
+func (b *ringBuffer) Bytes() []byte {
+	if !b.wrapped {
+		return slices.Clone(b.buf[:b.pos])
+	}
+	out := append(slices.Clone(b.buf[b.pos:]), b.buf[:b.pos]...)
+	if i := slices.Index(out, '\n'); i >= 0 && i < len(out)/2 {
+		out = out[i+1:]
+	}
+	return out
+}
+
+// asciicastWriter records a terminal session in asciicast v2 format.
+// See https://docs.asciinema.org/manual/asciicast/v2/.
+type asciicastWriter struct {
+	path    string
+	f       *os.File
+	start   time.Time
+	partial []byte // incomplete UTF-8 sequence at the end of the last output
+}
+
+// terminalRecordingDir is where terminal recordings are written.
+func terminalRecordingDir() string {
+	return filepath.Join(os.TempDir(), "sketch-terminals")
+}
+
+func newAsciicastWriter(session *terminalSession, shell string) (*asciicastWriter, error) {
+	dir := terminalRecordingDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.cast", session.created.Format("20060102-150405"), session.id))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	header := map[string]any{
+		"version":   2,
+		"width":     80, // the web UI resizes the terminal as soon as it connects
+		"height":    24,
+		"timestamp": session.created.Unix(),
+		"title":     session.name,
+		"env":       map[string]string{"SHELL": shell, "TERM": "xterm-256color"},
+	}
+	line, _ := json.Marshal(header)
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &asciicastWriter{path: path, f: f, start: session.created}, nil
+}
+
+func (a *asciicastWriter) event(code, data string) {
+	line, _ := json.Marshal([]any{time.Since(a.start).Seconds(), code, data})
+	if _, err := a.f.Write(append(line, '\n')); err != nil {
+		slog.Debug("Failed to write terminal recording", "path", a.path, "error", err)
+	}
+}
+
+// output records terminal output. asciicast events are JSON strings,
+// so a UTF-8 sequence split between reads is held back until it is complete.
+func (a *asciicastWriter) output(data []byte) {
+	data = append(a.partial, data...)
+	a.partial = nil
+	if i := incompleteUTF8Suffix(data); i < len(data) {
+		a.partial = slices.Clone(data[i:])
+		data = data[:i]
+	}
+	if len(data) > 0 {
+		a.event("o", string(data))
+	}
+}
+
+func (a *asciicastWriter) resize(cols, rows uint16) {
+	a.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (a *asciicastWriter) Close() error {
+	if len(a.partial) > 0 {
+		a.event("o", string(a.partial))
+	}
+	return a.f.Close()
+}
+
+// incompleteUTF8Suffix returns the index at which an incomplete UTF-8 sequence
+// ends b, or len(b) if b ends with a complete rune.
+func incompleteUTF8Suffix(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-3; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(b)
+}
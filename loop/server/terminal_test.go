@@ -0,0 +1,147 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"sketch.dev/loop/server"
+)
+
+// terminalReplay connects to a terminal's event stream and returns the first event,
+// which is the replayed scrollback if there is any.
+func terminalReplay(t *testing.T, baseURL, id string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", baseURL+"/terminal/events/"+id, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			b, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(b)
+		}
+	}
+	return ""
+}
+
+// waitForReplay waits until a new client of terminal id is replayed output containing want.
+func waitForReplay(t *testing.T, baseURL, id, want string) string {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		replay := terminalReplay(t, baseURL, id)
+		if strings.Contains(replay, want) {
+			return replay
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("terminal %s never replayed %q; last replay %q", id, want, replay)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestTerminalSessions(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	t.Setenv("TMPDIR", t.TempDir()) // recordings go here
+	srv := newAPITestServer(t, 0)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	rr := doAPI(t, srv, "POST", "/api/v1/terminals", `{"name": "tests", "cwd": ".", "record": true}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create terminal: status %d: %s", rr.Code, rr.Body)
+	}
+	var info server.TerminalInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.ID == "" || info.Name != "tests" || info.Pid == 0 || info.Recording == "" {
+		t.Errorf("created terminal %+v", info)
+	}
+	if rr := doAPI(t, srv, "POST", "/api/v1/terminals", `{"cwd": "no/such/dir"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("create terminal with bad cwd: status %d, want 400", rr.Code)
+	}
+
+	// Output produced with no client connected is replayed to clients that connect later.
+	resp, err := http.Post(ts.URL+"/terminal/input/"+info.ID, "text/plain", strings.NewReader("echo hello-$((6*7))\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	waitForReplay(t, ts.URL, info.ID, "hello-42")
+
+	// The scrollback is bounded, and starts on a line boundary once full.
+	input := "head -c 400000 /dev/zero | tr '\\0' x | fold -w 99; echo done-$((1+1))\n"
+	resp, err = http.Post(ts.URL+"/terminal/input/"+info.ID, "text/plain", strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	replay := waitForReplay(t, ts.URL, info.ID, "done-2")
+	if len(replay) > 256<<10 || !strings.HasPrefix(replay, strings.Repeat("x", 99)) {
+		t.Errorf("replay is %d bytes, starting %q", len(replay), replay[:min(len(replay), 20)])
+	}
+
+	rr = doAPI(t, srv, "GET", "/api/v1/terminals", "")
+	var list []server.TerminalInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != info.ID || list[0].Cwd != info.Cwd {
+		t.Errorf("terminals = %+v", list)
+	}
+
+	if rr := doAPI(t, srv, "DELETE", "/api/v1/terminals?id="+info.ID, ""); rr.Code != http.StatusOK {
+		t.Errorf("kill terminal: status %d: %s", rr.Code, rr.Body)
+	}
+	if rr := doAPI(t, srv, "DELETE", "/api/v1/terminals?id="+info.ID, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("kill terminal twice: status %d, want 404", rr.Code)
+	}
+	rr = doAPI(t, srv, "GET", "/api/v1/terminals", "")
+	if strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("terminals after kill = %s", rr.Body)
+	}
+
+	// Only terminals 1-9 are created by connecting to them.
+	resp, err = http.Get(ts.URL + "/terminal/events/tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("events for unknown terminal: status %d, want 404", resp.StatusCode)
+	}
+
+	cast, err := os.ReadFile(info.Recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, events, _ := strings.Cut(string(cast), "\n")
+	var h struct {
+		Version int    `json:"version"`
+		Title   string `json:"title"`
+	}
+	if err := json.Unmarshal([]byte(header), &h); err != nil || h.Version != 2 || h.Title != "tests" {
+		t.Errorf("recording header %q: %+v, %v", header, h, err)
+	}
+	if !strings.Contains(events, "hello-42") {
+		t.Errorf("recording does not contain the session's output")
+	}
+}
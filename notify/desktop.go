@@ -0,0 +1,30 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// Desktop shows events as native desktop notifications:
+// osascript on macOS and notify-send on Linux and other Unix-like systems.
+type Desktop struct{}
+
+func (Desktop) Notify(ctx context.Context, ev Event) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(ev.Message), strconv.Quote(ev.Title))
+		cmd = exec.CommandContext(ctx, "osascript", "-e", script)
+	case "windows":
+		return fmt.Errorf("desktop notifications are not supported on windows")
+	default: // Linux and other Unix-like systems
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name=sketch", ev.Title, ev.Message)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("desktop notification failed: %w: %s", err, out)
+	}
+	return nil
+}
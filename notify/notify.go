@@ -0,0 +1,207 @@
+// Package notify delivers notifications about agent events
+// (end of turn, errors, pushed commits, ...) to webhooks, Slack, and the desktop.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Kind identifies the type of event a notification is about.
+type Kind string
+
+const (
+	KindEndOfTurn Kind = "end_of_turn" // the agent finished its turn and is waiting for the user
+	KindQuestion  Kind = "question"    // the agent finished its turn by asking the user a question
+	KindError     Kind = "error"       // the agent hit an error
+	KindBudget    Kind = "budget"      // the agent ran out of budget
+	KindCommit    Kind = "commit"      // new commits were pushed to the host
+)
+
+// AllKinds lists every Kind, in the order they are documented.
+var AllKinds = []Kind{KindEndOfTurn, KindQuestion, KindError, KindBudget, KindCommit}
+
+// An Event is a single notification.
+type Event struct {
+	Kind      Kind      `json:"kind"`
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	SessionID string    `json:"session_id,omitempty"`
+	Slug      string    `json:"slug,omitempty"`
+	URL       string    `json:"url,omitempty"` // link to the sketch UI, if known
+	Time      time.Time `json:"time"`
+}
+
+// A Sink delivers events somewhere.
+type Sink interface {
+	Notify(ctx context.Context, ev Event) error
+}
+
+// Webhook POSTs each event as JSON to URL.
+type Webhook struct {
+	URL   string
+	HTTPC *http.Client // if nil, a client with a short timeout is used
+}
+
+func (w *Webhook) Notify(ctx context.Context, ev Event) error {
+	return postJSON(ctx, w.HTTPC, w.URL, ev)
+}
+
+// Slack POSTs each event to a Slack-compatible incoming webhook URL.
+type Slack struct {
+	URL   string
+	HTTPC *http.Client // if nil, a client with a short timeout is used
+}
+
+func (s *Slack) Notify(ctx context.Context, ev Event) error {
+	return postJSON(ctx, s.HTTPC, s.URL, map[string]string{"text": slackText(ev)})
+}
+
+// slackText renders ev using Slack's mrkdwn format.
+func slackText(ev Event) string {
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "*%s*", ev.Title)
+	if ev.Message != "" {
+		fmt.Fprintf(buf, "\n%s", ev.Message)
+	}
+	if ev.URL != "" {
+		fmt.Fprintf(buf, "\n<%s|Open sketch>", ev.URL)
+	}
+	return buf.String()
+}
+
+// Outtie forwards events to the sketch process running on the host,
+// which shows them as desktop notifications.
+// URL is the outtie's HTTP address, as passed to the innie in -outside-http.
+type Outtie struct {
+	URL   string
+	HTTPC *http.Client // if nil, a client with a short timeout is used
+}
+
+func (o *Outtie) Notify(ctx context.Context, ev Event) error {
+	return postJSON(ctx, o.HTTPC, o.URL+"/notify", ev)
+}
+
+func postJSON(ctx context.Context, httpc *http.Client, url string, v any) error {
+	if httpc == nil {
+		httpc = &http.Client{Timeout: 10 * time.Second}
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("notification POST failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// ParseSink parses a sink specification, as given to the -notify flag:
+//
+//	webhook:<url>  POST JSON events to url
+//	slack:<url>    POST Slack-formatted messages to an incoming webhook url
+//	desktop        show a desktop notification
+//
+// When running inside a container, outsideHTTP is the outtie's HTTP address,
+// and desktop notifications are forwarded to it.
+func ParseSink(spec, outsideHTTP string) (Sink, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "webhook", "slack":
+		if arg == "" {
+			return nil, fmt.Errorf("notify sink %q: missing URL", spec)
+		}
+		if kind == "slack" {
+			return &Slack{URL: arg}, nil
+		}
+		return &Webhook{URL: arg}, nil
+	case "desktop":
+		if outsideHTTP != "" {
+			return &Outtie{URL: outsideHTTP}, nil
+		}
+		return Desktop{}, nil
+	}
+	return nil, fmt.Errorf("unknown notify sink %q (want webhook:<url>, slack:<url>, or desktop)", spec)
+}
+
+// ParseKinds parses a comma-separated list of event kinds.
+// The empty string and "all" select every kind.
+func ParseKinds(s string) ([]Kind, error) {
+	if s == "" || s == "all" {
+		return AllKinds, nil
+	}
+	var kinds []Kind
+	for name := range strings.SplitSeq(s, ",") {
+		k := Kind(strings.TrimSpace(name))
+		if !slices.Contains(AllKinds, k) {
+			return nil, fmt.Errorf("unknown notification event %q", k)
+		}
+		kinds = append(kinds, k)
+	}
+	return kinds, nil
+}
+
+// maxMessageLen bounds Event.Message; notifications are a nudge, not a transcript.
+const maxMessageLen = 500
+
+// A Notifier fans events out to sinks.
+// A nil *Notifier is valid and drops all events.
+type Notifier struct {
+	sinks []Sink
+	kinds []Kind
+}
+
+// New returns a Notifier that sends events of the given kinds to sinks.
+// It returns nil if there are no sinks.
+func New(sinks []Sink, kinds []Kind) *Notifier {
+	if len(sinks) == 0 {
+		return nil
+	}
+	return &Notifier{sinks: sinks, kinds: kinds}
+}
+
+// Wants reports whether n delivers events of kind k.
+func (n *Notifier) Wants(k Kind) bool {
+	return n != nil && slices.Contains(n.kinds, k)
+}
+
+// Notify delivers ev to all sinks in the background, if n wants events of its kind.
+// Delivery errors are logged, not returned: notifications are best-effort.
+func (n *Notifier) Notify(ctx context.Context, ev Event) {
+	if !n.Wants(ev.Kind) {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if len(ev.Message) > maxMessageLen {
+		ev.Message = strings.ToValidUTF8(ev.Message[:maxMessageLen], "") + "…"
+	}
+	ctx = context.WithoutCancel(ctx)
+	for _, sink := range n.sinks {
+		go func() {
+			if err := sink.Notify(ctx, ev); err != nil {
+				slog.WarnContext(ctx, "notification failed", "kind", ev.Kind, "sink", fmt.Sprintf("%T", sink), "err", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSink(t *testing.T) {
+	tests := []struct {
+		spec        string
+		outsideHTTP string
+		want        Sink
+		wantErr     bool
+	}{
+		{spec: "webhook:https://example.com/hook", want: &Webhook{URL: "https://example.com/hook"}},
+		{spec: "slack:https://hooks.slack.com/services/x", want: &Slack{URL: "https://hooks.slack.com/services/x"}},
+		{spec: "desktop", want: Desktop{}},
+		{spec: "desktop", outsideHTTP: "http://sketch:pw@host.docker.internal:1234", want: &Outtie{URL: "http://sketch:pw@host.docker.internal:1234"}},
+		{spec: "webhook", wantErr: true},
+		{spec: "email:me@example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSink(tt.spec, tt.outsideHTTP)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSink(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSink(%q) = %#v, want %#v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseKinds(t *testing.T) {
+	for _, s := range []string{"", "all"} {
+		got, err := ParseKinds(s)
+		if err != nil || !slices.Equal(got, AllKinds) {
+			t.Errorf("ParseKinds(%q) = %v, %v; want all kinds", s, got, err)
+		}
+	}
+	got, err := ParseKinds("error, question")
+	if err != nil || !slices.Equal(got, []Kind{KindError, KindQuestion}) {
+		t.Errorf("ParseKinds(error, question) = %v, %v", got, err)
+	}
+	if _, err := ParseKinds("error,nope"); err == nil {
+		t.Errorf("ParseKinds(error,nope) succeeded, want error")
+	}
+}
+
+func TestWebhookAndSlack(t *testing.T) {
+	bodies := make(chan map[string]any, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding body: %v", err)
+		}
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	ev := Event{Kind: KindQuestion, Title: "sketch: has a question", Message: "Which database?", URL: "http://localhost:8080"}
+	ctx := context.Background()
+
+	if err := (&Webhook{URL: srv.URL}).Notify(ctx, ev); err != nil {
+		t.Fatal(err)
+	}
+	got := <-bodies
+	if got["kind"] != "question" || got["message"] != "Which database?" {
+		t.Errorf("webhook body = %v", got)
+	}
+
+	if err := (&Slack{URL: srv.URL}).Notify(ctx, ev); err != nil {
+		t.Fatal(err)
+	}
+	got = <-bodies
+	want := "*sketch: has a question*\nWhich database?\n<http://localhost:8080|Open sketch>"
+	if got["text"] != want {
+		t.Errorf("slack text = %q, want %q", got["text"], want)
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	err := (&Webhook{URL: srv.URL}).Notify(context.Background(), Event{Kind: KindError})
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("Notify error = %v, want 403 nope", err)
+	}
+}
+
+type recordingSink chan Event
+
+func (r recordingSink) Notify(ctx context.Context, ev Event) error {
+	r <- ev
+	return nil
+}
+
+func TestNotifier(t *testing.T) {
+	var nilNotifier *Notifier
+	nilNotifier.Notify(context.Background(), Event{Kind: KindError}) // must not panic
+	if New(nil, AllKinds) != nil {
+		t.Errorf("New with no sinks should return nil")
+	}
+
+	rec := make(recordingSink, 4)
+	n := New([]Sink{rec}, []Kind{KindError})
+	n.Notify(context.Background(), Event{Kind: KindEndOfTurn, Message: "filtered out"})
+	n.Notify(context.Background(), Event{Kind: KindError, Message: strings.Repeat("x", 2*maxMessageLen)})
+
+	select {
+	case ev := <-rec:
+		if ev.Kind != KindError {
+			t.Errorf("got kind %q, want %q", ev.Kind, KindError)
+		}
+		if len(ev.Message) > maxMessageLen+len("…") || !strings.HasSuffix(ev.Message, "…") {
+			t.Errorf("message not truncated: len %d", len(ev.Message))
+		}
+		if ev.Time.IsZero() {
+			t.Errorf("event time not set")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+	select {
+	case ev := <-rec:
+		t.Errorf("unexpected notification %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,153 @@
+// Package prompthistory stores the prompts typed into termui, per repository,
+// so that they can be recalled in later sessions.
+// It is separate from termui so that the outtie, which keeps the history for containers, needn't depend on termui.
+package prompthistory
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MaxEntries bounds the number of prompts kept in the history.
+const MaxEntries = 1000
+
+// A Store persists history entries.
+type Store interface {
+	// Load returns the stored entries, oldest first.
+	Load() ([]string, error)
+	// Append stores a new entry.
+	Append(entry string) error
+}
+
+// Path returns the file that holds the prompt history for the repository at repoRoot.
+func Path(repoRoot string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(repoRoot))
+	name := fmt.Sprintf("%s-%s.jsonl", filepath.Base(repoRoot), hex.EncodeToString(sum[:6]))
+	return filepath.Join(homeDir, ".cache", "sketch", "history", name), nil
+}
+
+// FileStore stores history entries in a file, one JSON string per line.
+type FileStore struct {
+	Path string
+}
+
+func (s *FileStore) Load() ([]string, error) {
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var entry string
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // skip damaged lines
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return entries, err
+	}
+	if len(entries) > 2*MaxEntries {
+		// Compact the file, so it doesn't grow without bound.
+		entries = entries[len(entries)-MaxEntries:]
+		if err := s.rewrite(entries); err != nil {
+			return entries, err
+		}
+	}
+	return entries, nil
+}
+
+func (s *FileStore) rewrite(entries []string) error {
+	buf := new(bytes.Buffer)
+	for _, entry := range entries {
+		line, _ := json.Marshal(entry)
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+func (s *FileStore) Append(entry string) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	line, _ := json.Marshal(entry)
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RemoteStore keeps the history on the host, via the outtie's /history endpoint,
+// so that it outlives the container.
+// URL is the outtie's HTTP address, as passed to the innie in -outside-http.
+type RemoteStore struct {
+	URL   string
+	HTTPC *http.Client // if nil, a client with a short timeout is used
+}
+
+func (s *RemoteStore) client() *http.Client {
+	if s.HTTPC != nil {
+		return s.HTTPC
+	}
+	return &http.Client{Timeout: 5 * time.Second}
+}
+
+func (s *RemoteStore) Load() ([]string, error) {
+	resp, err := s.client().Get(s.URL + "/history")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("GET /history: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var entries []string
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("GET /history: %w", err)
+	}
+	return entries, nil
+}
+
+func (s *RemoteStore) Append(entry string) error {
+	body, _ := json.Marshal(entry)
+	resp, err := s.client().Post(s.URL+"/history", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("POST /history: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package prompthistory
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	store := &FileStore{Path: filepath.Join(t.TempDir(), "sub", "history.jsonl")}
+	if entries, err := store.Load(); err != nil || entries != nil {
+		t.Fatalf("Load() of a missing file = %q, %v", entries, err)
+	}
+	for _, entry := range []string{"first", "line one\nline two"} {
+		if err := store.Append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := store.Load()
+	if want := []string{"first", "line one\nline two"}; err != nil || !slices.Equal(entries, want) {
+		t.Errorf("Load() = %q, %v; want %q", entries, err, want)
+	}
+}
+
+func TestPath(t *testing.T) {
+	a, err := Path("/src/one/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := Path("/src/two/app")
+	if a == b || !strings.HasPrefix(filepath.Base(a), "app-") {
+		t.Errorf("Path gave %q and %q for different repos", a, b)
+	}
+}
@@ -0,0 +1,111 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CommitFinding is a secret added by a git commit.
+type CommitFinding struct {
+	Commit string // the commit's SHA
+	File   string
+	Line   int // line number in the commit's version of File
+	Kind   string
+}
+
+func (f CommitFinding) String() string {
+	return fmt.Sprintf("%.12s %s:%d: %s", f.Commit, f.File, f.Line, f.Kind)
+}
+
+// ScanCommits returns the secrets in the lines added by the commits that git log selects with args,
+// e.g. ["--no-walk", sha] or [newrev, "--not", "--all"], in the repo at dir.
+// In addition to what Scan finds, every value set in a committed .env file is reported.
+func ScanCommits(ctx context.Context, dir string, args ...string) ([]CommitFinding, error) {
+	gitArgs := append([]string{"log", "-p", "-U0", "--no-color", "--no-ext-diff", "--no-textconv", "--format=%x00%H"}, args...)
+	cmd := exec.CommandContext(ctx, "git", gitArgs...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log: %w\n%s", err, stderr.Bytes())
+	}
+
+	var (
+		findings []CommitFinding
+		commit   string
+		file     string
+		line     int
+	)
+	s := bufio.NewScanner(bytes.NewReader(out))
+	s.Buffer(nil, 64<<20)
+	for s.Scan() {
+		text := s.Text()
+		switch {
+		case strings.HasPrefix(text, "\x00"):
+			commit, file = text[1:], ""
+		case strings.HasPrefix(text, "+++ "):
+			file = strings.TrimPrefix(text[4:], "b/")
+			if file == "/dev/null" {
+				file = ""
+			}
+		case strings.HasPrefix(text, "@@ "):
+			line = hunkStart(text)
+		case strings.HasPrefix(text, "+") && file != "":
+			added := text[1:]
+			kinds := scanKinds(added)
+			if len(kinds) == 0 && envFile(file) && envValueRE.MatchString(added) && !strings.Contains(added, AllowMarker) {
+				kinds = []string{"value in a .env file"}
+			}
+			for _, kind := range kinds {
+				findings = append(findings, CommitFinding{Commit: commit, File: file, Line: line, Kind: kind})
+			}
+			line++
+		}
+	}
+	return findings, s.Err()
+}
+
+func scanKinds(text string) []string {
+	var kinds []string
+	for _, f := range Scan(text) {
+		kinds = append(kinds, f.Kind)
+	}
+	return kinds
+}
+
+var hunkRE = regexp.MustCompile(`^@@ -\S+ \+(\d+)`)
+
+// hunkStart returns the first line number in the new file of the hunk with header h.
+func hunkStart(h string) int {
+	m := hunkRE.FindStringSubmatch(h)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// envValueRE matches a line of a .env file that sets a variable to a non-empty value.
+var envValueRE = regexp.MustCompile(`^\s*(?:export\s+)?[A-Za-z_][A-Za-z0-9_]*\s*=\s*[^\s#]`)
+
+// envFile reports whether name is a .env file, but not an example of one, such as .env.example.
+func envFile(name string) bool {
+	base := path.Base(name)
+	if base != ".env" && !strings.HasPrefix(base, ".env.") {
+		return false
+	}
+	for _, ext := range []string{".example", ".sample", ".template", ".dist", ".defaults"} {
+		if strings.HasSuffix(base, ext) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestScanCommits(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(files map[string]string) string {
+		t.Helper()
+		for name, content := range files {
+			os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600)
+		}
+		git("add", "-A")
+		git("commit", "-m", "change")
+		return git("rev-parse", "HEAD")
+	}
+
+	git("init", "-b", "main")
+	base := commit(map[string]string{
+		"config.go": "package config\n\nconst region = \"us-east-1\"\n",
+	})
+	leak := commit(map[string]string{
+		"config.go":    "package config\n\nconst region = \"us-east-1\"\n\nconst key = \"AKIA" + "Z7QPHN4KXM2JDW5V\"\n",
+		".env":         "# local settings\nPORT=8080\nEMPTY=\n",
+		".env.example": "PORT=8080\n",
+		"fixture.txt":  "AKIA" + "Z7QPHN4KXM2JDW5V " + AllowMarker + "\n",
+	})
+
+	findings, err := ScanCommits(context.Background(), dir, "HEAD", "^"+base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range findings {
+		if f.Commit != leak {
+			t.Errorf("finding %v is in commit %s, want %s", f, f.Commit, leak)
+		}
+		got = append(got, strings.TrimPrefix(f.String(), leak[:12]+" "))
+	}
+	want := []string{".env:2: value in a .env file", "config.go:5: AWS access key ID"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ScanCommits() = %q, want %q", got, want)
+	}
+
+	if findings, err := ScanCommits(context.Background(), dir, "--no-walk", base); err != nil || len(findings) != 0 {
+		t.Errorf("ScanCommits(base) = %v, %v; want nothing", findings, err)
+	}
+}
@@ -0,0 +1,184 @@
+// Package secrets finds credentials, such as API keys, private keys and passwords, in text and in git commits,
+// so that they can be redacted before they reach the LLM, and kept out of pushes.
+//
+// Like bashkit's checks, the detection is heuristic, and has both false positives and false negatives.
+// Lines that contain AllowMarker are never reported, e.g. for test fixtures with fake keys.
+package secrets
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// AllowMarker marks a line whose apparent secrets are known not to be secret.
+const AllowMarker = "sketch:allow-secret"
+
+// Finding is a secret found by Scan.
+type Finding struct {
+	Kind       string // what was found, e.g. "AWS access key ID"
+	Line       int    // 1-based line number
+	Start, End int    // byte offsets of the secret in the text
+}
+
+// pattern is a kind of secret with a well-known format.
+// If the regexp has a group, the secret is the first group; otherwise it's the whole match.
+type pattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+// patterns are checked in order; a match that overlaps an earlier one is ignored.
+var patterns = []pattern{
+	{"private key", regexp.MustCompile(`-----BEGIN[A-Z ]*PRIVATE KEY(?: BLOCK)?-----(?s:.*?)(?:-----END[A-Z ]*PRIVATE KEY(?: BLOCK)?-----|\z)`)},
+	{"AWS access key ID", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"Anthropic API key", regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{"OpenAI API key", regexp.MustCompile(`\bsk-(?:proj-|svcacct-)?[A-Za-z0-9_-]{32,}`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"Stripe key", regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{20,}`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{"JSON web token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"password in URL", regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s:/@'"]+:([^\s:/@'"]+)@`)},
+	// Assignments to secret-sounding names, as in .env files, shell, YAML and most programming languages.
+	// The value must look like a literal: os.Getenv("TOKEN") or ${{ secrets.TOKEN }} isn't a secret.
+	{"secret value", regexp.MustCompile(`(?i)[A-Z0-9_.-]*(?:secret|passw(?:or)?d|token|api_?key|access_?key|private_?key|credentials?)[A-Z0-9_]*["']?\s*[:=]\s*["']?([A-Za-z0-9+/_.=~!@%^*-]{8,})(?:["'\s,;]|$)`)},
+}
+
+// tokenRE matches candidates for high-entropy tokens: words of token characters,
+// delimited by whitespace, quotes and the like, so that paths, URLs and most base64 data don't match.
+var tokenRE = regexp.MustCompile(`(?:^|[\s"'=:,;(\[{<>])([A-Za-z0-9_-]{32,})(?:$|[\s"',;)\]}<>])`)
+
+// checksumPrefixes precede checksums, which look random, but aren't secret.
+var checksumPrefixes = []string{"h1:", "sha1-", "sha256-", "sha384-", "sha512-", "sha256:"}
+
+// Scan returns the secrets in text, in order.
+func Scan(text string) []Finding {
+	var found []Finding
+	overlaps := func(start, end int) bool {
+		for _, f := range found {
+			if start < f.End && f.Start < end {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(kind string, start, end int) {
+		if overlaps(start, end) || allowed(text, start) {
+			return
+		}
+		found = append(found, Finding{Kind: kind, Line: strings.Count(text[:start], "\n") + 1, Start: start, End: end})
+	}
+
+	for _, p := range patterns {
+		for _, m := range p.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if len(m) > 2 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			if p.kind == "secret value" && !literalSecret(text[start:end]) || strings.ContainsAny(text[start:start+1], "%${<") {
+				continue // not a literal, e.g. a format verb or a variable
+			}
+			add(p.kind, start, end)
+		}
+	}
+	for _, m := range tokenRE.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[2], m[3]
+		if randomToken(text[start:end]) && !afterChecksumPrefix(text[:start]) {
+			add("high-entropy token", start, end)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Start < found[j].Start })
+	return found
+}
+
+// Redact returns text with the secrets that Scan finds replaced by a description of what was there.
+func Redact(text string) string {
+	found := Scan(text)
+	if len(found) == 0 {
+		return text
+	}
+	var b strings.Builder
+	prev := 0
+	for _, f := range found {
+		b.WriteString(text[prev:f.Start])
+		b.WriteString("[REDACTED " + f.Kind + "]")
+		prev = f.End
+	}
+	b.WriteString(text[prev:])
+	return b.String()
+}
+
+// allowed reports whether the line containing offset i of text has AllowMarker.
+func allowed(text string, i int) bool {
+	start := strings.LastIndexByte(text[:i], '\n') + 1
+	end := strings.IndexByte(text[i:], '\n')
+	if end < 0 {
+		end = len(text)
+	} else {
+		end += i
+	}
+	return strings.Contains(text[start:end], AllowMarker)
+}
+
+// placeholders are words in values that are examples, not real secrets.
+var placeholders = []string{"example", "changeme", "change_me", "placeholder", "redacted", "xxxx", "your_", "your-", "dummy", "<", "${"}
+
+// literalSecret reports whether v, the value in a secret-sounding assignment, looks like a real secret,
+// rather than a placeholder or an identifier, such as config.Password.
+func literalSecret(v string) bool {
+	lower := strings.ToLower(v)
+	for _, p := range placeholders {
+		if strings.Contains(lower, p) {
+			return false
+		}
+	}
+	switch lower {
+	case "true", "false", "null", "none", "password", "required", "optional":
+		return false
+	}
+	return strings.ContainsAny(v, "0123456789") && strings.IndexFunc(v, isLetter) >= 0 && entropy(v) >= 2.5
+}
+
+// randomToken reports whether a word looks like a randomly generated token:
+// long, mixing letters and digits, not a hex string, such as a git SHA or a UUID, and with high entropy.
+func randomToken(s string) bool {
+	if !strings.ContainsAny(s, "0123456789") || strings.IndexFunc(s, isLetter) < 0 {
+		return false
+	}
+	if strings.Trim(s, "0123456789abcdefABCDEF-") == "" {
+		return false
+	}
+	return entropy(s) >= 4.3
+}
+
+func afterChecksumPrefix(before string) bool {
+	for _, p := range checksumPrefixes {
+		if strings.HasSuffix(before, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLetter(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+}
+
+// entropy returns the Shannon entropy of s, in bits per byte.
+func entropy(s string) float64 {
+	var counts [256]int
+	for i := range len(s) {
+		counts[s[i]]++
+	}
+	var h float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(len(s))
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
@@ -0,0 +1,71 @@
+package secrets
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The fake secrets in these tests are split with + so that the file itself doesn't contain any.
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string // kinds of the findings
+	}{
+		{"nothing to see here", nil},
+		{"aws_access_key_id = AKIA" + "Z7QPHN4KXM2JDW5V", []string{"AWS access key ID"}},
+		{"export GITHUB_TOKEN=ghp_" + "x8Kd0fPq3LmN7sT2" + "vW9yZ1aB4cE6gH5jR0uQ", []string{"GitHub token"}},
+		{"ANTHROPIC_API_KEY=sk-ant-" + "api03-q7Wm2Xk9Lp4Rt8Yv3Bn6Hj1", []string{"Anthropic API key"}},
+		{"key: sk-proj-" + "Q2w3E4r5T6y7U8i9" + "O0pA1sD2fG3hJ4kL5zX6", []string{"OpenAI API key"}},
+		{"SLACK=xoxb-" + "123456789012-abcdefABCDEF", []string{"Slack token"}},
+		{"stripe.Key = \"sk_live_" + "4eC39HqLyjWDarjtT1zdp7dc\"", []string{"Stripe key"}},
+		{"-----BEGIN RSA " + "PRIVATE KEY-----\nMIIEpAIBAAKCAQEA\n-----END RSA PRIVATE KEY-----\n", []string{"private key"}},
+		{"-----BEGIN OPENSSH " + "PRIVATE KEY-----\nb3BlbnNzaC1rZXktdjEA", []string{"private key"}}, // truncated
+		{"DATABASE_URL=postgres://app:" + "s3cr3tPassw0rd@db.internal:5432/app", []string{"password in URL"}},
+		{"DB_PASSWORD=" + "hunter2hunter2x", []string{"secret value"}},
+		{`"client_secret": "` + `9f8Kq2LmZx7Vb3Nw1"`, []string{"secret value"}},
+		{"PORT=8080\nDEBUG=true", nil},
+		{`password := os.Getenv("DB_PASSWORD")`, nil},
+		{"token: ${{ secrets.GITHUB_TOKEN }}", nil},
+		{"API_KEY=your_api_key_here", nil},
+		{"password: config.Password", nil},
+		{`"input_tokens": 12345678`, nil},
+		{"session " + "Zq8vN2pL7xK4mR9t" + "W3yB6cH1dF5gJ0sA", []string{"high-entropy token"}},
+		{"commit 9fceb02d0ae598e95dc970b74767f19372d61af8", nil},
+		{"id 123e4567-e89b-12d3-a456-426614174000", nil},
+		{"golang.org/x/mod v0.17.0 h1:" + "zY54UmvipHiNd+pm+m0x9KhZ9hl1/7QNMyxXbc6ICqA=", nil},
+		{"TestCodeReviewerRunsGoplsOnChangedFiles", nil},
+		{"/usr/lib/x86_64-linux-gnu/libstdc++.so.6.0.30", nil},
+		{`_State_name = "StateUnknownStateReadyStateWaitingForUserInputStateGatheringAdditionalMessages-12"`, nil},
+		{`fmt.Sprintf("https://%s:%s@host/", user, pass)`, nil},
+		{"AKIA" + "Z7QPHN4KXM2JDW5V // " + AllowMarker, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, f := range Scan(tt.text) {
+			got = append(got, f.Kind)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Scan(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	text := "line one\nAWS_SECRET_ACCESS_KEY=" + "wJalrXUtnFEMI/K7MDENG/bPxRfiCY3a9Zq1\nGH=ghp_" + "x8Kd0fPq3LmN7sT2" + "vW9yZ1aB4cE6gH5jR0uQ done\n"
+	want := "line one\nAWS_SECRET_ACCESS_KEY=[REDACTED secret value]\nGH=[REDACTED GitHub token] done\n"
+	if got := Redact(text); got != want {
+		t.Errorf("Redact() = %q, want %q", got, want)
+	}
+	found := Scan(text)
+	if len(found) != 2 || found[0].Line != 2 || found[1].Line != 3 {
+		t.Errorf("Scan() = %+v, want findings on lines 2 and 3", found)
+	}
+	if plain := "no secrets\n"; Redact(plain) != plain {
+		t.Errorf("Redact(%q) changed it", plain)
+	}
+	if strings.Contains(Redact("-----BEGIN EC "+"PRIVATE KEY-----\nMHcCAQEE\n-----END EC PRIVATE KEY-----"), "MHcCAQEE") {
+		t.Error("Redact() left the body of a private key")
+	}
+}
@@ -47,6 +47,7 @@ type augmentHandler struct {
 func (h *augmentHandler) Handle(ctx context.Context, r slog.Record) error {
 	attrs := Attrs(ctx)
 	r.AddAttrs(attrs...)
+	r.AddAttrs(traceAttrs(ctx)...)
 	return h.Handler.Handle(ctx, r)
 }
 
@@ -0,0 +1,110 @@
+package skribe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingConfig configures OpenTelemetry trace export.
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP collector endpoint, e.g. "http://localhost:4318".
+	// A bare host:port is treated as http. If the URL has no path, /v1/traces is used.
+	// If empty, tracing is disabled.
+	Endpoint string
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+	// SessionID is reported as the sketch.session_id resource attribute.
+	SessionID string
+}
+
+// SetupTracing installs a global OpenTelemetry tracer provider that exports
+// spans via OTLP/HTTP to cfg.Endpoint.
+//
+// If cfg.Endpoint is empty, SetupTracing does nothing,
+// leaving the default no-op tracer provider in place.
+// The returned shutdown func flushes any buffered spans; it is always non-nil.
+func SetupTracing(ctx context.Context, cfg TracingConfig) (shutdown func(context.Context) error, err error) {
+	noop := func(context.Context) error { return nil }
+	if cfg.Endpoint == "" {
+		return noop, nil
+	}
+	endpoint, err := OTLPTracesURL(cfg.Endpoint)
+	if err != nil {
+		return noop, err
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return noop, fmt.Errorf("SetupTracing: %w", err)
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("service.name", cfg.ServiceName),
+	}
+	if cfg.SessionID != "" {
+		attrs = append(attrs, attribute.String("sketch.session_id", cfg.SessionID))
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attrs...)),
+	)
+	otel.SetTracerProvider(tp)
+	slog.InfoContext(ctx, "tracing enabled", "endpoint", endpoint)
+	return tp.Shutdown, nil
+}
+
+// OTLPTracesURL normalizes a user-supplied collector endpoint into a full OTLP/HTTP traces URL,
+// as SetupTracing does with TracingConfig.Endpoint.
+func OTLPTracesURL(endpoint string) (string, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid tracing endpoint %q: %w", endpoint, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid tracing endpoint %q: missing host", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// Tracer returns a tracer for the named instrumentation scope,
+// typically the import path of the calling package.
+// It uses the global tracer provider, so it is safe to call before SetupTracing.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// EndSpan records err (if any) on span and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceAttrs returns slog attributes identifying the span in ctx, if any.
+func traceAttrs(ctx context.Context) []slog.Attr {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []slog.Attr{
+		slog.String("trace_id", sc.TraceID().String()),
+		slog.String("span_id", sc.SpanID().String()),
+	}
+}
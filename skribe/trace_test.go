@@ -0,0 +1,117 @@
+package skribe
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestOTLPTracesURL(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "localhost:4318", want: "http://localhost:4318/v1/traces"},
+		{in: "http://collector:4318", want: "http://collector:4318/v1/traces"},
+		{in: "https://collector.example.com/", want: "https://collector.example.com/v1/traces"},
+		{in: "https://collector.example.com/custom/path", want: "https://collector.example.com/custom/path"},
+		{in: "http://", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := OTLPTracesURL(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("OTLPTracesURL(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("OTLPTracesURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSetupTracingExportsSpans(t *testing.T) {
+	// A minimal OTLP/HTTP receiver, recording what's posted to it.
+	var (
+		mu     sync.Mutex
+		paths  []string
+		bodies [][]byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		bodies = append(bodies, body)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer srv.Close()
+
+	prev := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(prev)
+
+	ctx := context.Background()
+	// A bare host:port, as users pass to -otel-endpoint.
+	shutdown, err := SetupTracing(ctx, TracingConfig{
+		Endpoint:    strings.TrimPrefix(srv.URL, "http://"),
+		ServiceName: "sketch-test",
+		SessionID:   "test-session",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := Tracer("sketch.dev/skribe").Start(ctx, "exported-span")
+	span.End()
+	if err := shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(paths) == 0 {
+		t.Fatal("no spans were exported")
+	}
+	for _, p := range paths {
+		if p != "POST /v1/traces" {
+			t.Errorf("exporter sent %s, want POST /v1/traces", p)
+		}
+	}
+	all := bytes.Join(bodies, nil)
+	for _, want := range []string{"exported-span", "sketch-test", "test-session"} {
+		if !bytes.Contains(all, []byte(want)) {
+			t.Errorf("exported spans don't contain %q", want)
+		}
+	}
+}
+
+func TestLogTraceAttrs(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := slog.New(AttrsWrap(slog.NewTextHandler(buf, nil)))
+
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "op")
+	defer span.End()
+
+	logger.InfoContext(context.Background(), "untraced")
+	if strings.Contains(buf.String(), "trace_id") {
+		t.Errorf("untraced log line has trace_id: %s", buf)
+	}
+	buf.Reset()
+
+	logger.InfoContext(ctx, "traced")
+	sc := span.SpanContext()
+	for _, want := range []string{"trace_id=" + sc.TraceID().String(), "span_id=" + sc.SpanID().String()} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log line %q missing %q", buf, want)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package termui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"sketch.dev/claudetool"
+	"sketch.dev/git_tools"
+)
+
+// A slashCommand is a "/name args" command typed at the termui prompt.
+// They mirror actions available in the web UI.
+type slashCommand struct {
+	name  string
+	usage string // argument synopsis, e.g. "[commit]"
+	help  string
+	run   func(ui *TermUI, ctx context.Context, args []string)
+	// complete returns candidates for argument number n (0-based), if any.
+	complete func(ui *TermUI, n int) []string
+}
+
+// slashCommands lists the slash commands, in the order help shows them.
+var slashCommands = []slashCommand{
+	{name: "diff", usage: "[commit]", help: "Show changes since the session started, or of one commit", run: (*TermUI).cmdDiff, complete: (*TermUI).completeCommit},
+	{name: "log", help: "Show commits made during the session", run: (*TermUI).cmdLog},
+	{name: "push", usage: "<remote> <branch> [--force] [--dry-run]", help: "Push HEAD to a branch of a remote", run: (*TermUI).cmdPush, complete: (*TermUI).completePush},
+	{name: "todo", help: "Show the agent's todo list", run: (*TermUI).cmdTodo},
+	{name: "ports", help: "Show open TCP ports in the container", run: (*TermUI).cmdPorts},
+	{name: "compact", help: "Summarize the conversation to free up context", run: (*TermUI).cmdCompact},
+	{name: "edit", usage: "[text]", help: "Write a message in $EDITOR", run: (*TermUI).cmdEdit},
+}
+
+// plainCommands are the original prompt commands; they also work with a leading slash
+// and are offered by tab completion.
+var plainCommands = []string{"help", "budget", "usage", "cost", "browser", "open", "stop", "cancel", "abort", "exit", "quit"}
+
+func lookupSlashCommand(name string) *slashCommand {
+	i := slices.IndexFunc(slashCommands, func(c slashCommand) bool { return c.name == name })
+	if i < 0 {
+		return nil
+	}
+	return &slashCommands[i]
+}
+
+// slashCommandHelp returns the help text for the slash commands.
+func slashCommandHelp() string {
+	buf := new(strings.Builder)
+	for _, c := range slashCommands {
+		fmt.Fprintf(buf, "- %-20s: %s\n", strings.TrimSpace("/"+c.name+" "+shortUsage(c.usage)), c.help)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// shortUsage trims optional flags from usage, to keep help aligned.
+func shortUsage(usage string) string {
+	before, _, _ := strings.Cut(usage, " [--")
+	return before
+}
+
+// runSlashCommand runs line, which starts with "/".
+// It reports whether line was a slash command.
+func (ui *TermUI) runSlashCommand(ctx context.Context, line string) bool {
+	fields := strings.Fields(strings.TrimPrefix(line, "/"))
+	if len(fields) == 0 {
+		return false
+	}
+	c := lookupSlashCommand(fields[0])
+	if c == nil {
+		return false
+	}
+	c.run(ui, ctx, fields[1:])
+	return true
+}
+
+// autoComplete is the terminal's AutoCompleteCallback.
+// On tab, it completes slash command names and their arguments.
+func (ui *TermUI) autoComplete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || pos != len(line) || !strings.HasPrefix(line, "/") {
+		return "", 0, false
+	}
+	completed, candidates := ui.completeLine(line)
+	if len(candidates) > 1 {
+		ui.AppendSystemMessage("%s", strings.Join(candidates, "  "))
+	}
+	if completed == line {
+		return "", 0, false
+	}
+	return completed, len(completed), true
+}
+
+// completeLine completes the last word of line.
+// It returns the completed line and the candidates for the last word.
+func (ui *TermUI) completeLine(line string) (string, []string) {
+	fields := strings.Fields(line)
+	if strings.HasSuffix(line, " ") {
+		fields = append(fields, "")
+	}
+	word := fields[len(fields)-1]
+
+	var candidates []string
+	if len(fields) == 1 {
+		for _, c := range slashCommands {
+			candidates = append(candidates, "/"+c.name)
+		}
+		for _, name := range plainCommands {
+			candidates = append(candidates, "/"+name)
+		}
+	} else if c := lookupSlashCommand(strings.TrimPrefix(fields[0], "/")); c != nil && c.complete != nil {
+		candidates = c.complete(ui, len(fields)-2)
+	}
+	candidates = slices.DeleteFunc(candidates, func(s string) bool { return !strings.HasPrefix(s, word) })
+	if len(candidates) == 0 {
+		return line, nil
+	}
+
+	completion := candidates[0]
+	for _, c := range candidates[1:] {
+		completion = completion[:commonPrefixLen(completion, c)]
+	}
+	if len(candidates) == 1 {
+		completion += " "
+	}
+	return line[:len(line)-len(word)] + completion, candidates
+}
+
+func commonPrefixLen(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func (ui *TermUI) completeCommit(n int) []string {
+	if n != 0 {
+		return nil
+	}
+	log, err := git_tools.GitRecentLog(ui.agent.RepoRoot(), ui.agent.SketchGitBaseRef())
+	if err != nil {
+		return nil
+	}
+	var hashes []string
+	for _, entry := range log {
+		hashes = append(hashes, entry.Hash[:min(len(entry.Hash), 8)])
+	}
+	return hashes
+}
+
+func (ui *TermUI) completePush(n int) []string {
+	switch n {
+	case 0:
+		out, err := exec.Command("git", "-C", ui.agent.RepoRoot(), "remote").Output()
+		if err != nil {
+			return nil
+		}
+		return strings.Fields(string(out))
+	case 1:
+		return []string{strings.TrimSuffix(ui.agent.BranchPrefix(), "/") + "/" + ui.agent.Slug()}
+	}
+	return []string{"--force", "--dry-run"}
+}
+
+func (ui *TermUI) cmdDiff(ctx context.Context, args []string) {
+	var commit *string
+	if len(args) > 0 {
+		out, err := exec.Command("git", "-C", ui.agent.RepoRoot(), "rev-parse", "--verify", args[0]+"^{commit}").Output()
+		if err != nil {
+			ui.AppendSystemMessage("❌ Unknown commit %q", args[0])
+			return
+		}
+		hash := strings.TrimSpace(string(out))
+		commit = &hash
+	}
+	diff, err := ui.agent.Diff(commit)
+	if err != nil {
+		ui.AppendSystemMessage("❌ Diff failed: %v", err)
+		return
+	}
+	if strings.TrimSpace(diff) == "" {
+		ui.AppendSystemMessage("No changes")
+		return
+	}
+	ui.AppendSystemMessage("%s", colorizeDiff(diff))
+}
+
+// colorizeDiff colors a unified diff the way git does.
+func colorizeDiff(diff string) string {
+	var (
+		meta  = color.New(color.Bold)
+		hunk  = color.New(color.FgCyan)
+		added = color.New(color.FgGreen)
+		gone  = color.New(color.FgRed)
+	)
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "diff --git"), strings.HasPrefix(line, "index "),
+			strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+			lines[i] = meta.Sprint(line)
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = hunk.Sprint(line)
+		case strings.HasPrefix(line, "+"):
+			lines[i] = added.Sprint(line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = gone.Sprint(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (ui *TermUI) cmdLog(ctx context.Context, args []string) {
+	log, err := git_tools.GitRecentLog(ui.agent.RepoRoot(), ui.agent.SketchGitBaseRef())
+	if err != nil {
+		ui.AppendSystemMessage("❌ Log failed: %v", err)
+		return
+	}
+	if len(log) == 0 {
+		ui.AppendSystemMessage("No commits")
+		return
+	}
+	yellow := color.New(color.FgYellow).SprintFunc()
+	buf := new(strings.Builder)
+	for _, entry := range log {
+		fmt.Fprintf(buf, "%s ", yellow(entry.Hash[:min(len(entry.Hash), 8)]))
+		if len(entry.Refs) > 0 {
+			fmt.Fprintf(buf, "(%s) ", strings.Join(entry.Refs, ", "))
+		}
+		fmt.Fprintf(buf, "%s\n", entry.Subject)
+	}
+	ui.AppendSystemMessage("%s", strings.TrimSuffix(buf.String(), "\n"))
+}
+
+func (ui *TermUI) cmdPush(ctx context.Context, args []string) {
+	opts := git_tools.GitPushOptions{PassthroughUpstream: ui.agent.PassthroughUpstream()}
+	var positional []string
+	for _, arg := range args {
+		switch arg {
+		case "--force", "-f":
+			opts.Force = true
+		case "--dry-run", "-n":
+			opts.DryRun = true
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) != 2 {
+		ui.AppendSystemMessage("usage: /push <remote> <branch> [--force] [--dry-run]")
+		return
+	}
+	opts.Remote, opts.Branch = positional[0], positional[1]
+
+	out, err := exec.Command("git", "-C", ui.agent.RepoRoot(), "rev-parse", "HEAD").Output()
+	if err != nil {
+		ui.AppendSystemMessage("❌ Cannot find HEAD: %v", err)
+		return
+	}
+	opts.Commit = strings.TrimSpace(string(out))
+
+	ui.AppendSystemMessage("🔄 Pushing %s to %s %s...", opts.Commit[:min(len(opts.Commit), 8)], opts.Remote, opts.Branch)
+	go func() {
+		output, err := git_tools.GitPush(ctx, ui.agent.RepoRoot(), opts)
+		if output = strings.TrimSpace(output); output != "" {
+			ui.AppendSystemMessage("%s", output)
+		}
+		if err != nil {
+			ui.AppendSystemMessage("❌ Push failed: %v", err)
+			return
+		}
+		if opts.DryRun {
+			ui.AppendSystemMessage("✅ Dry run succeeded")
+			return
+		}
+		ui.AppendSystemMessage("✅ Pushed to %s %s", opts.Remote, opts.Branch)
+	}()
+}
+
+func (ui *TermUI) cmdTodo(ctx context.Context, args []string) {
+	content := ui.agent.CurrentTodoContent()
+	if content == "" {
+		ui.AppendSystemMessage("📋 No todo list")
+		return
+	}
+	var list claudetool.TodoList
+	if err := json.Unmarshal([]byte(content), &list); err != nil {
+		ui.AppendSystemMessage("❌ Cannot read todo list: %v", err)
+		return
+	}
+	ui.AppendSystemMessage("%s", formatTodoList(list))
+}
+
+// formatTodoList renders list with the same status icons as the todo_write tool.
+func formatTodoList(list claudetool.TodoList) string {
+	if len(list.Items) == 0 {
+		return "📋 No todo items"
+	}
+	buf := new(strings.Builder)
+	buf.WriteString("📋 Todo list:")
+	for _, item := range list.Items {
+		icon := "⚪"
+		switch item.Status {
+		case "in-progress":
+			icon = "🦉"
+		case "completed":
+			icon = "✅"
+		}
+		fmt.Fprintf(buf, "\n%s %s", icon, item.Task)
+	}
+	return buf.String()
+}
+
+func (ui *TermUI) cmdPorts(ctx context.Context, args []string) {
+	ports := ui.agent.GetPorts()
+	probes := ui.agent.GetPortProbes()
+	if len(ports) == 0 {
+		ui.AppendSystemMessage("🔌 No open ports")
+		return
+	}
+	buf := new(strings.Builder)
+	buf.WriteString("🔌 Open ports:")
+	for _, p := range ports {
+		fmt.Fprintf(buf, "\n- %s %d", p.Proto, p.Port)
+		if p.Process != "" {
+			fmt.Fprintf(buf, " (%s", p.Process)
+			if p.Pid != 0 {
+				fmt.Fprintf(buf, ", pid %d", p.Pid)
+			}
+			buf.WriteString(")")
+		}
+		if label := probes[p.Port].Label(); label != "" {
+			buf.WriteString(" " + label)
+		}
+	}
+	ui.AppendSystemMessage("%s", buf.String())
+}
+
+func (ui *TermUI) cmdCompact(ctx context.Context, args []string) {
+	ui.AppendSystemMessage("🗜️  Compacting conversation...")
+	go func() {
+		if err := ui.agent.CompactConversation(ctx); err != nil {
+			ui.AppendSystemMessage("❌ Compaction failed: %v", err)
+			return
+		}
+		ui.AppendSystemMessage("✅ Conversation compacted")
+	}()
+}
@@ -0,0 +1,82 @@
+package termui
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"sketch.dev/claudetool"
+)
+
+func TestCompleteLine(t *testing.T) {
+	ui := &TermUI{}
+	tests := []struct {
+		line           string
+		want           string
+		wantCandidates []string
+	}{
+		{line: "/di", want: "/diff ", wantCandidates: []string{"/diff"}},
+		{line: "/co", want: "/co", wantCandidates: []string{"/compact", "/cost"}},
+		{line: "/com", want: "/compact ", wantCandidates: []string{"/compact"}},
+		{line: "/b", want: "/b", wantCandidates: []string{"/budget", "/browser"}},
+		{line: "/ex", want: "/exit ", wantCandidates: []string{"/exit"}},
+		{line: "/nope", want: "/nope"},
+		{line: "/todo ", want: "/todo "}, // no argument completion
+	}
+	for _, tt := range tests {
+		got, candidates := ui.completeLine(tt.line)
+		if got != tt.want || !slices.Equal(candidates, tt.wantCandidates) {
+			t.Errorf("completeLine(%q) = %q, %q; want %q, %q", tt.line, got, candidates, tt.want, tt.wantCandidates)
+		}
+	}
+}
+
+func TestAutoCompleteIgnoresOtherKeys(t *testing.T) {
+	ui := &TermUI{}
+	if _, _, ok := ui.autoComplete("/di", 3, 'x'); ok {
+		t.Errorf("autoComplete handled a non-tab key")
+	}
+	if _, _, ok := ui.autoComplete("hello", 5, '\t'); ok {
+		t.Errorf("autoComplete handled a non-command line")
+	}
+	line, pos, ok := ui.autoComplete("/lo", 3, '\t')
+	if !ok || line != "/log " || pos != len(line) {
+		t.Errorf("autoComplete(/lo) = %q, %d, %v", line, pos, ok)
+	}
+}
+
+func TestColorizeDiff(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = false
+
+	diff := "diff --git a/x b/x\n--- a/x\n+++ b/x\n@@ -1 +1 @@\n-old\n+new\n context\n"
+	got := strings.Split(colorizeDiff(diff), "\n")
+	want := []string{
+		color.New(color.Bold).Sprint("diff --git a/x b/x"),
+		color.New(color.Bold).Sprint("--- a/x"),
+		color.New(color.Bold).Sprint("+++ b/x"),
+		color.New(color.FgCyan).Sprint("@@ -1 +1 @@"),
+		color.New(color.FgRed).Sprint("-old"),
+		color.New(color.FgGreen).Sprint("+new"),
+		" context",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("colorizeDiff:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestFormatTodoList(t *testing.T) {
+	list := claudetool.TodoList{Items: []claudetool.TodoItem{
+		{ID: "1", Task: "write code", Status: "completed"},
+		{ID: "2", Task: "test it", Status: "in-progress"},
+		{ID: "3", Task: "ship it", Status: "queued"},
+	}}
+	want := "📋 Todo list:\n✅ write code\n🦉 test it\n⚪ ship it"
+	if got := formatTodoList(list); got != want {
+		t.Errorf("formatTodoList = %q, want %q", got, want)
+	}
+	if got := formatTodoList(claudetool.TodoList{}); got != "📋 No todo items" {
+		t.Errorf("formatTodoList(empty) = %q", got)
+	}
+}
@@ -0,0 +1,120 @@
+package termui
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// composeDelimiter, on a line by itself, starts and ends a multi-line message.
+const composeDelimiter = `"""`
+
+// A composer assembles multi-line messages from the lines read at the prompt.
+// Lines between two composeDelimiter lines make up one message,
+// as do the lines of a bracketed paste together with the line that ends it.
+type composer struct {
+	lines     []string
+	delimited bool // inside a """ block
+}
+
+// feed processes a line read at the prompt; pasted reports whether it came from a paste.
+// It reports whether the composer consumed the line, and returns the message if the line completed one.
+func (c *composer) feed(line string, pasted bool) (msg string, consumed bool) {
+	switch {
+	case c.delimited:
+		if strings.TrimSpace(line) == composeDelimiter {
+			return c.finish(), true
+		}
+		c.lines = append(c.lines, line)
+		return "", true
+	case pasted:
+		c.lines = append(c.lines, line)
+		return "", true
+	case len(c.lines) > 0:
+		// The user pressed enter after a paste.
+		c.lines = append(c.lines, line)
+		return c.finish(), true
+	case strings.TrimSpace(line) == composeDelimiter:
+		c.delimited = true
+		return "", true
+	}
+	return "", false
+}
+
+// active reports whether a message is being composed.
+func (c *composer) active() bool {
+	return c.delimited || len(c.lines) > 0
+}
+
+func (c *composer) finish() string {
+	msg := strings.TrimSpace(strings.Join(c.lines, "\n"))
+	c.lines = nil
+	c.delimited = false
+	return msg
+}
+
+// sendComposed sends a message assembled from several lines, or written in an editor.
+func (ui *TermUI) sendComposed(ctx context.Context, msg string) {
+	if msg == "" {
+		ui.AppendSystemMessage("Empty message, not sent")
+		return
+	}
+	ui.history.Add(msg)
+	ui.agent.UserMessage(ctx, msg)
+}
+
+func (ui *TermUI) cmdEdit(ctx context.Context, args []string) {
+	msg, err := ui.editMessage(strings.Join(args, " "))
+	if err != nil {
+		ui.AppendSystemMessage("❌ Editor failed: %v", err)
+		return
+	}
+	ui.sendComposed(ctx, msg)
+}
+
+// editMessage opens $VISUAL or $EDITOR on a file holding initial,
+// and returns the file's contents once the editor exits.
+func (ui *TermUI) editMessage(initial string) (string, error) {
+	f, err := os.CreateTemp("", "sketch-message-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if initial != "" {
+		initial += "\n"
+	}
+	if _, err := f.WriteString(initial); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	// Hand the terminal over to the editor, holding output until it exits.
+	ui.outputMu.Lock()
+	defer ui.outputMu.Unlock()
+	fd := int(ui.stdin.Fd())
+	if err := term.Restore(fd, ui.oldState); err != nil {
+		return "", err
+	}
+	defer term.MakeRaw(fd)
+
+	editor := cmp.Or(os.Getenv("VISUAL"), os.Getenv("EDITOR"), "vi")
+	// Run the editor through the shell, so that editors with arguments, like "code --wait", work.
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = ui.stdin, ui.stdout, ui.stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w", editor, err)
+	}
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
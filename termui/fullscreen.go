@@ -0,0 +1,879 @@
+package termui
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+	"golang.org/x/text/width"
+	"sketch.dev/git_tools"
+	"sketch.dev/loop"
+)
+
+// approveMessage is sent to the agent by the approve keybinding,
+// typically in answer to "Shall I go ahead?".
+const approveMessage = "Yes, that looks good. Please go ahead."
+
+// fullScreenHelp is shown in the status bar.
+const fullScreenHelp = "^C cancel  ^K compact  ^Y approve  ^T details  ^D quit"
+
+// FullScreen is a full-screen terminal UI, an alternative to the line-based TermUI
+// for working without a browser, e.g. over ssh.
+//
+// The screen has a scrollable timeline, a collapsible detail pane for the
+// selected tool call, a pane with the session's diff and commits, a prompt,
+// and a status bar.
+type FullScreen struct {
+	stdin   *os.File
+	stdout  *os.File
+	agent   loop.CodingAgent
+	httpURL string
+
+	redrawC chan struct{}
+	gitC    chan struct{}
+
+	// protects following
+	mu        sync.Mutex
+	oldState  *term.State
+	width     int
+	height    int
+	entries   []entry
+	scroll    int  // timeline lines scrolled back from the bottom; 0 follows new messages
+	pageLines int  // height of the timeline at the last redraw, for page up/down
+	selected  int  // index into entries of the selected tool call, or -1
+	reveal    bool // scroll the selected tool call into view at the next redraw
+	detail    bool // whether the tool call detail pane is open
+	input     []rune
+	thinking  bool
+	notice    string // transient message shown in the status bar
+	git       gitSummary
+}
+
+// An entry is one item in the timeline.
+type entry struct {
+	text  string
+	style string             // ANSI SGR parameters, e.g. "2" for dim; empty for plain
+	tool  *loop.AgentMessage // set for tool calls
+}
+
+// gitSummary is what the side pane shows about the session's changes.
+type gitSummary struct {
+	added, removed int
+	files          []git_tools.DiffFile
+	commits        []git_tools.GitLogEntry
+	err            error
+}
+
+// statusInfo is the agent state shown in the status bar.
+type statusInfo struct {
+	state string
+	slug  string
+	cost  float64
+	ports []uint16
+}
+
+// NewFullScreen returns a full-screen UI for agent.
+// httpURL is the web UI's URL, shown in the timeline on startup.
+func NewFullScreen(agent loop.CodingAgent, httpURL string) *FullScreen {
+	return &FullScreen{
+		stdin:    os.Stdin,
+		stdout:   os.Stdout,
+		agent:    agent,
+		httpURL:  httpURL,
+		redrawC:  make(chan struct{}, 1),
+		gitC:     make(chan struct{}, 1),
+		selected: -1,
+	}
+}
+
+// Run shows the UI until the user quits or ctx is done.
+func (f *FullScreen) Run(ctx context.Context) error {
+	if !term.IsTerminal(int(f.stdin.Fd())) {
+		return fmt.Errorf("this command requires terminal I/O when termui=true")
+	}
+	w, h, err := term.GetSize(int(f.stdout.Fd()))
+	if err != nil {
+		return fmt.Errorf("get terminal size: %v", err)
+	}
+	oldState, err := term.MakeRaw(int(f.stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.oldState = oldState
+	f.width, f.height = w, h
+	f.mu.Unlock()
+	// Switch to the alternate screen, so the shell's scrollback survives.
+	fmt.Fprint(f.stdout, "\033[?1049h\033[2J")
+	if f.httpURL != "" {
+		f.AppendSystemMessage("🌐 %s/", f.httpURL)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go f.receiveMessagesLoop(ctx)
+	go f.gitLoop(ctx)
+	go f.drawLoop(ctx)
+	go f.resizeLoop(ctx)
+
+	keysC := make(chan []key)
+	go f.readKeys(keysC)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case keys, ok := <-keysC:
+			if !ok {
+				return nil
+			}
+			for _, k := range keys {
+				if quit := f.handleKey(ctx, k); quit {
+					return nil
+				}
+			}
+			f.requestRedraw()
+		}
+	}
+}
+
+// RestoreOldState leaves the alternate screen and restores the terminal mode.
+func (f *FullScreen) RestoreOldState() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.oldState == nil {
+		return nil
+	}
+	fmt.Fprint(f.stdout, "\033[?25h\033[?1049l")
+	totalUsage := f.agent.TotalUsage()
+	err := term.Restore(int(f.stdin.Fd()), f.oldState)
+	fmt.Fprintf(f.stdout, "💰 Total cost: $%0.2f\n", totalUsage.TotalCostUSD)
+	return err
+}
+
+// AppendSystemMessage adds a system message to the timeline.
+func (f *FullScreen) AppendSystemMessage(fmtString string, args ...any) {
+	f.appendEntry(entry{text: fmt.Sprintf(fmtString, args...), style: "2"})
+}
+
+func (f *FullScreen) appendEntry(e entry) {
+	f.mu.Lock()
+	if f.scroll > 0 {
+		// Keep the view still while the user reads back.
+		f.scroll += len(wrapEntry(e, f.timelineWidth()))
+	}
+	f.entries = append(f.entries, e)
+	f.mu.Unlock()
+	f.requestRedraw()
+}
+
+func (f *FullScreen) requestRedraw() {
+	select {
+	case f.redrawC <- struct{}{}:
+	default:
+	}
+}
+
+func (f *FullScreen) receiveMessagesLoop(ctx context.Context) {
+	it := f.agent.NewIterator(ctx, 0)
+	for {
+		resp := it.Next()
+		if resp == nil {
+			return
+		}
+		if resp.HideOutput {
+			continue
+		}
+		f.mu.Lock()
+		f.thinking = !(resp.EndOfTurn && resp.ParentConversationID == nil)
+		f.mu.Unlock()
+
+		switch resp.Type {
+		case loop.AgentMessageType:
+			if strings.TrimSpace(resp.Content) != "" {
+				f.appendEntry(entry{text: "🕴️ " + resp.Content})
+			}
+		case loop.UserMessageType:
+			f.appendEntry(entry{text: "🦸 " + resp.Content, style: "1"})
+		case loop.ToolUseMessageType:
+			f.appendEntry(entry{text: toolSummary(resp, f.agent.BranchPrefix()), tool: resp})
+		case loop.ErrorMessageType:
+			f.appendEntry(entry{text: "❌ " + resp.Content, style: "31"})
+		case loop.BudgetMessageType:
+			f.appendEntry(entry{text: "💰 " + resp.Content, style: "33"})
+		case loop.AutoMessageType:
+			f.appendEntry(entry{text: "🧐 " + resp.Content, style: "2"})
+		case loop.CommitMessageType:
+			for _, commit := range resp.Commits {
+				text := fmt.Sprintf("🔄 new commit: [%s] %s", commit.Hash[:min(len(commit.Hash), 8)], commit.Subject)
+				if commit.PushedBranch != "" {
+					text += "\npushed to: " + commit.PushedBranch
+				}
+				f.appendEntry(entry{text: text, style: "32"})
+			}
+			f.refreshGitSoon()
+		case loop.PortMessageType:
+			f.appendEntry(entry{text: "🔌 " + resp.Content, style: "2"})
+		case loop.CompactMessageType:
+			f.appendEntry(entry{text: "🗜️  Conversation compacted", style: "2"})
+		case loop.SlugMessageType:
+			// Shown in the status bar.
+		default:
+			if resp.Content != "" {
+				f.appendEntry(entry{text: resp.Content, style: "2"})
+			}
+		}
+		if resp.EndOfTurn {
+			f.refreshGitSoon()
+		}
+	}
+}
+
+// toolSummary describes a tool call in one line, as the line-based UI does.
+func toolSummary(msg *loop.AgentMessage, branchPrefix string) string {
+	var input map[string]any
+	json.Unmarshal([]byte(msg.ToolInput), &input)
+	buf := new(bytes.Buffer)
+	if err := toolUseTmpl.Execute(buf, map[string]any{"msg": msg, "input": input, "output": msg.ToolResult, "branch_prefix": branchPrefix}); err != nil || strings.TrimSpace(buf.String()) == "" {
+		return "🛠️  " + msg.ToolName
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+func (f *FullScreen) refreshGitSoon() {
+	select {
+	case f.gitC <- struct{}{}:
+	default:
+	}
+}
+
+// gitLoop keeps the side pane's diff and commits up to date.
+func (f *FullScreen) gitLoop(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		repo, base := f.agent.RepoRoot(), f.agent.SketchGitBaseRef()
+		var g gitSummary
+		g.added, g.removed = f.agent.DiffStats()
+		g.files, g.err = git_tools.GitRawDiff(repo, base, "")
+		if g.err == nil {
+			g.commits, g.err = git_tools.GitRecentLog(repo, base)
+		}
+		f.mu.Lock()
+		f.git = g
+		f.mu.Unlock()
+		f.requestRedraw()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-f.gitC:
+		}
+	}
+}
+
+func (f *FullScreen) resizeLoop(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGWINCH)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+		}
+		w, h, err := term.GetSize(int(f.stdout.Fd()))
+		if err != nil {
+			continue
+		}
+		f.mu.Lock()
+		f.width, f.height = w, h
+		f.mu.Unlock()
+		f.requestRedraw()
+	}
+}
+
+// drawLoop redraws the screen on request, and every second for the status bar.
+func (f *FullScreen) drawLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-f.redrawC:
+		case <-ticker.C:
+		}
+		st := statusInfo{
+			state: f.agent.CurrentStateName(),
+			slug:  f.agent.Slug(),
+			cost:  f.agent.TotalUsage().TotalCostUSD,
+		}
+		for _, p := range f.agent.GetPorts() {
+			st.ports = append(st.ports, p.Port)
+		}
+		f.mu.Lock()
+		if f.oldState != nil {
+			f.stdout.WriteString(f.render(st))
+		}
+		f.mu.Unlock()
+	}
+}
+
+// readKeys sends batches of keys read from stdin to keysC, until stdin is closed.
+func (f *FullScreen) readKeys(keysC chan<- []key) {
+	defer close(keysC)
+	buf := make([]byte, 1024)
+	var pending []byte
+	for {
+		n, err := f.stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		var keys []key
+		keys, pending = parseKeys(append(pending, buf[:n]...))
+		if len(keys) > 0 {
+			keysC <- keys
+		}
+	}
+}
+
+// handleKey acts on k. It reports whether the user asked to quit.
+func (f *FullScreen) handleKey(ctx context.Context, k key) (quit bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notice = ""
+	switch k.name {
+	case "":
+		f.input = append(f.input, k.r)
+	case "backspace":
+		if len(f.input) > 0 {
+			f.input = f.input[:len(f.input)-1]
+		}
+	case "ctrl-u":
+		f.input = nil
+	case "enter":
+		line := strings.TrimSpace(string(f.input))
+		f.input = nil
+		switch line {
+		case "":
+		case "exit", "quit":
+			return true
+		default:
+			f.scroll = 0
+			go f.agent.UserMessage(ctx, line)
+		}
+	case "ctrl-d":
+		if len(f.input) == 0 {
+			return true
+		}
+	case "ctrl-c":
+		f.agent.CancelTurn(fmt.Errorf("user canceled the operation"))
+		f.notice = "cancelled"
+	case "ctrl-k":
+		f.notice = "compacting conversation..."
+		go func() {
+			if err := f.agent.CompactConversation(ctx); err != nil {
+				f.AppendSystemMessage("❌ Compaction failed: %v", err)
+			}
+		}()
+	case "ctrl-y":
+		if f.thinking {
+			f.notice = "the agent is busy"
+			break
+		}
+		f.scroll = 0
+		go f.agent.UserMessage(ctx, approveMessage)
+	case "ctrl-t":
+		f.detail = !f.detail
+		if f.detail && f.selected < 0 {
+			f.selectTool(len(f.entries), -1)
+		}
+	case "esc":
+		f.detail = false
+	case "tab":
+		f.selectTool(f.selected, +1)
+	case "shift-tab":
+		start := f.selected
+		if start < 0 {
+			start = len(f.entries)
+		}
+		f.selectTool(start, -1)
+	case "up":
+		f.scroll++
+	case "down":
+		f.scroll = max(0, f.scroll-1)
+	case "pgup":
+		f.scroll += max(1, f.pageLines-1)
+	case "pgdn":
+		f.scroll = max(0, f.scroll-max(1, f.pageLines-1))
+	case "home":
+		f.scroll = len(f.entries) * 1000 // clamped by render
+	case "end":
+		f.scroll = 0
+	case "ctrl-l":
+		f.stdout.WriteString("\033[2J")
+	}
+	return false
+}
+
+// selectTool selects the next tool call entry after (dir > 0) or before (dir < 0) index from,
+// and opens the detail pane. It does nothing if there is none.
+func (f *FullScreen) selectTool(from, dir int) {
+	for i := from + dir; i >= 0 && i < len(f.entries); i += dir {
+		if f.entries[i].tool != nil {
+			f.selected = i
+			f.detail = true
+			f.reveal = true
+			return
+		}
+	}
+}
+
+// timelineWidth is the width of the timeline, left of the side pane.
+func (f *FullScreen) timelineWidth() int {
+	if sw := sidePaneWidth(f.width); sw > 0 {
+		return f.width - sw - 1
+	}
+	return f.width
+}
+
+// sidePaneWidth returns the width of the diff/commits pane for a screen width w,
+// or 0 if the screen is too narrow to show it.
+func sidePaneWidth(w int) int {
+	if w < 80 {
+		return 0
+	}
+	return max(30, w/3)
+}
+
+// render returns the escape sequences that draw the whole screen.
+func (f *FullScreen) render(st statusInfo) string {
+	w, h := f.width, f.height
+	if w < 10 || h < 4 {
+		return ""
+	}
+	bodyH := h - 2 // the prompt and status bar take the last two rows
+	leftW := f.timelineWidth()
+
+	// Left column: the timeline, then the detail pane if it is open.
+	timelineH := bodyH
+	var detail []styledLine
+	if f.detail && f.selected >= 0 {
+		detailH := max(3, bodyH/3)
+		timelineH = bodyH - detailH - 1
+		msg := f.entries[f.selected].tool
+		detail = append(detail, styledLine{text: rule("─ "+msg.ToolName+" ", leftW), style: "2"})
+		for _, line := range toolDetail(msg, leftW) {
+			detail = append(detail, styledLine{text: line})
+		}
+		detail = detail[:min(len(detail), detailH+1)]
+	}
+	var lines []styledLine
+	selStart, selEnd := -1, -1
+	for i, e := range f.entries {
+		if i == f.selected {
+			selStart = len(lines)
+		}
+		style := e.style
+		if i == f.selected {
+			style = "7"
+		}
+		for _, text := range wrapEntry(e, leftW) {
+			lines = append(lines, styledLine{text: text, style: style})
+		}
+		if i == f.selected {
+			selEnd = len(lines)
+		}
+	}
+	maxScroll := max(0, len(lines)-timelineH)
+	if f.reveal && selStart >= 0 {
+		// Scroll just enough to show the selected entry.
+		top := len(lines) - timelineH - f.scroll
+		if selStart < top {
+			f.scroll = len(lines) - timelineH - selStart
+		} else if selEnd > top+timelineH {
+			f.scroll = len(lines) - selEnd
+		}
+		f.reveal = false
+	}
+	f.scroll = min(max(f.scroll, 0), maxScroll)
+	f.pageLines = timelineH
+	start := max(0, len(lines)-timelineH-f.scroll)
+	left := lines[start:min(len(lines), start+timelineH)]
+	for len(left) < timelineH {
+		left = append(left, styledLine{})
+	}
+	left = append(left, detail...)
+
+	// Right column: the diff and commits.
+	var right []styledLine
+	if sw := sidePaneWidth(w); sw > 0 {
+		right = f.git.lines(sw)
+	}
+
+	buf := new(strings.Builder)
+	buf.WriteString("\033[?25l\033[H")
+	for row := range bodyH {
+		var l styledLine
+		if row < len(left) {
+			l = left[row]
+		}
+		buf.WriteString(l.render(leftW))
+		if sw := sidePaneWidth(w); sw > 0 {
+			buf.WriteString("\033[2m│\033[0m")
+			var r styledLine
+			if row < len(right) {
+				r = right[row]
+			}
+			buf.WriteString(r.render(sw))
+		}
+		buf.WriteString("\r\n")
+	}
+
+	// The prompt. Long input scrolls horizontally to keep the cursor in view.
+	prompt := st.slug
+	if f.thinking {
+		prompt += " *"
+	}
+	prompt += "> "
+	input := string(f.input)
+	for displayWidth(prompt)+displayWidth(input) >= w && input != "" {
+		_, size := utf8.DecodeRuneInString(input)
+		input = input[size:]
+	}
+	buf.WriteString(styledLine{text: prompt + input}.render(w))
+	buf.WriteString("\r\n")
+
+	// The status bar.
+	status := []string{cmp.Or(st.state, "starting"), fmt.Sprintf("$%0.2f", st.cost)}
+	if len(st.ports) > 0 {
+		var ports []string
+		for _, p := range st.ports {
+			ports = append(ports, fmt.Sprint(p))
+		}
+		status = append(status, "ports "+strings.Join(ports, ","))
+	}
+	if f.scroll > 0 {
+		status = append(status, fmt.Sprintf("↑%d", f.scroll))
+	}
+	if f.notice != "" {
+		status = append(status, f.notice)
+	}
+	left0 := " " + strings.Join(status, " │ ")
+	gap := w - displayWidth(left0) - displayWidth(fullScreenHelp) - 1
+	bar := left0
+	if gap > 0 {
+		bar += strings.Repeat(" ", gap) + fullScreenHelp
+	}
+	buf.WriteString(styledLine{text: bar, style: "7"}.render(w))
+
+	// Leave the cursor at the end of the input.
+	fmt.Fprintf(buf, "\033[%d;%dH\033[?25h", h-1, min(w, displayWidth(prompt)+displayWidth(input)+1))
+	return buf.String()
+}
+
+// lines renders the side pane, w columns wide.
+func (g gitSummary) lines(w int) []styledLine {
+	if g.err != nil {
+		return []styledLine{{text: " Diff", style: "1"}, {text: " " + g.err.Error(), style: "31"}}
+	}
+	lines := []styledLine{{text: fmt.Sprintf(" Diff  +%d -%d", g.added, g.removed), style: "1"}}
+	if len(g.files) == 0 {
+		lines = append(lines, styledLine{text: " no changes", style: "2"})
+	}
+	for _, file := range g.files {
+		stat := fmt.Sprintf(" +%d -%d", file.Additions, file.Deletions)
+		path := file.Path
+		if room := w - 3 - displayWidth(stat); displayWidth(path) > room && room > 1 {
+			path = "…" + truncateLeft(path, room-1)
+		}
+		text := " " + file.Status + " " + path
+		text += strings.Repeat(" ", max(0, w-displayWidth(text)-displayWidth(stat))) + stat
+		lines = append(lines, styledLine{text: text})
+	}
+	lines = append(lines, styledLine{}, styledLine{text: " Commits", style: "1"})
+	if len(g.commits) == 0 {
+		lines = append(lines, styledLine{text: " none yet", style: "2"})
+	}
+	for _, c := range g.commits {
+		lines = append(lines, styledLine{text: fmt.Sprintf(" \033[33m%s\033[0m %s", c.Hash[:min(len(c.Hash), 7)], c.Subject)})
+	}
+	return lines
+}
+
+// toolDetail renders the input and result of a tool call, wrapped to w columns.
+func toolDetail(msg *loop.AgentMessage, w int) []string {
+	input := msg.ToolInput
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, []byte(input), "", "  ") == nil {
+		input = pretty.String()
+	}
+	var lines []string
+	lines = append(lines, "input:")
+	lines = append(lines, wrap("  "+input, w, "  ")...)
+	if msg.ToolError {
+		lines = append(lines, "error:")
+	} else {
+		lines = append(lines, "result:")
+	}
+	if msg.ToolResult == "" {
+		lines = append(lines, "  (pending)")
+	} else {
+		lines = append(lines, wrap("  "+msg.ToolResult, w, "  ")...)
+	}
+	return lines
+}
+
+// wrapEntry returns the lines of e, wrapped to w columns.
+func wrapEntry(e entry, w int) []string {
+	return wrap(e.text, w, "   ")
+}
+
+// A styledLine is one row of a pane.
+type styledLine struct {
+	text  string // may contain ANSI color sequences, which take no space
+	style string // ANSI SGR parameters applied to the whole row
+}
+
+// render returns l, truncated or padded to exactly w columns.
+func (l styledLine) render(w int) string {
+	text := truncate(l.text, w)
+	text += strings.Repeat(" ", w-displayWidth(text))
+	if l.style == "" {
+		return text + "\033[0m"
+	}
+	return "\033[" + l.style + "m" + strings.ReplaceAll(text, "\033[0m", "\033[0;"+l.style+"m") + "\033[0m"
+}
+
+// rule returns title followed by a horizontal line, w columns wide.
+func rule(title string, w int) string {
+	return title + strings.Repeat("─", max(0, w-displayWidth(title)))
+}
+
+// wrap splits s into lines of at most w columns.
+// Every line but the first is prefixed with indent.
+func wrap(s string, w int, indent string) []string {
+	s = sanitize(s)
+	var lines []string
+	for i, para := range strings.Split(s, "\n") {
+		prefix := ""
+		if i > 0 {
+			prefix = indent
+		}
+		for {
+			line := prefix
+			used := displayWidth(line)
+			cut := len(para)
+			for j, r := range para {
+				rw := runeWidth(r)
+				if used+rw > w {
+					cut = j
+					break
+				}
+				used += rw
+			}
+			if cut == 0 && para != "" {
+				// The indent alone fills the line; drop it rather than loop forever.
+				_, cut = utf8.DecodeRuneInString(para)
+				line = ""
+			}
+			// Prefer breaking at a space.
+			if cut < len(para) {
+				if sp := strings.LastIndexByte(para[:cut], ' '); sp > 0 {
+					cut = sp + 1
+				}
+			}
+			lines = append(lines, line+strings.TrimRight(para[:cut], " "))
+			para = para[cut:]
+			if para == "" {
+				break
+			}
+			prefix = indent
+		}
+	}
+	return lines
+}
+
+// sanitize expands tabs and removes control characters and escape sequences,
+// which would corrupt the screen.
+func sanitize(s string) string {
+	s = strings.ReplaceAll(s, "\t", "    ")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || !unicode.IsControl(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// displayWidth returns the number of columns s takes in a terminal, ignoring ANSI color sequences.
+func displayWidth(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\033' {
+			i += ansiLen(s[i:])
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		n += runeWidth(r)
+		i += size
+	}
+	return n
+}
+
+// truncate returns the longest prefix of s that fits in w columns, keeping ANSI sequences whole.
+func truncate(s string, w int) string {
+	n := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\033' {
+			i += ansiLen(s[i:])
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if n+runeWidth(r) > w {
+			return s[:i]
+		}
+		n += runeWidth(r)
+		i += size
+	}
+	return s
+}
+
+// truncateLeft returns the longest suffix of s that fits in w columns.
+func truncateLeft(s string, w int) string {
+	n := 0
+	for i := len(s); i > 0; {
+		r, size := utf8.DecodeLastRuneInString(s[:i])
+		if n+runeWidth(r) > w {
+			return s[i:]
+		}
+		n += runeWidth(r)
+		i -= size
+	}
+	return s
+}
+
+// ansiLen returns the length of the ANSI CSI sequence at the start of s.
+func ansiLen(s string) int {
+	if len(s) < 2 || s[1] != '[' {
+		return 1
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// runeWidth returns the number of columns r takes in a terminal.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0x200d || (r >= 0xfe00 && r <= 0xfe0f) || unicode.Is(unicode.Mn, r):
+		return 0 // zero-width joiners, variation selectors, combining marks
+	case r >= 0x1f300 && r <= 0x1faff:
+		return 2 // emoji
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// A key is a key press: either a character (name == "") or a named key such as "up" or "ctrl-c".
+type key struct {
+	name string
+	r    rune
+}
+
+var controlKeys = map[byte]string{
+	0x03: "ctrl-c",
+	0x04: "ctrl-d",
+	0x08: "backspace",
+	0x09: "tab",
+	0x0b: "ctrl-k",
+	0x0c: "ctrl-l",
+	0x0d: "enter",
+	0x0a: "enter",
+	0x14: "ctrl-t",
+	0x15: "ctrl-u",
+	0x19: "ctrl-y",
+	0x7f: "backspace",
+}
+
+var escapeKeys = map[string]string{
+	"[A":  "up",
+	"[B":  "down",
+	"[5~": "pgup",
+	"[6~": "pgdn",
+	"[H":  "home",
+	"[1~": "home",
+	"OH":  "home",
+	"[F":  "end",
+	"[4~": "end",
+	"OF":  "end",
+	"[Z":  "shift-tab",
+}
+
+// parseKeys decodes the keys in buf. It returns any trailing bytes
+// that may be the start of an incomplete key, to be parsed with the next read.
+func parseKeys(buf []byte) (keys []key, rest []byte) {
+	for i := 0; i < len(buf); {
+		b := buf[i]
+		switch {
+		case b == 0x1b:
+			if i+1 == len(buf) {
+				keys = append(keys, key{name: "esc"})
+				i++
+				continue
+			}
+			if buf[i+1] != '[' && buf[i+1] != 'O' {
+				// Alt+key or a lone escape: treat as escape.
+				keys = append(keys, key{name: "esc"})
+				i++
+				continue
+			}
+			end := -1
+			for j := i + 2; j < len(buf); j++ {
+				if buf[j] >= 0x40 && buf[j] <= 0x7e {
+					end = j
+					break
+				}
+			}
+			if end < 0 {
+				return keys, buf[i:]
+			}
+			if name, ok := escapeKeys[string(buf[i+1:end+1])]; ok {
+				keys = append(keys, key{name: name})
+			}
+			i = end + 1
+		case controlKeys[b] != "":
+			keys = append(keys, key{name: controlKeys[b]})
+			i++
+		case b < 0x20:
+			i++ // other control characters are ignored
+		default:
+			if !utf8.FullRune(buf[i:]) {
+				return keys, buf[i:]
+			}
+			r, size := utf8.DecodeRune(buf[i:])
+			keys = append(keys, key{r: r})
+			i += size
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,178 @@
+package termui
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"sketch.dev/git_tools"
+	"sketch.dev/loop"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys, rest := parseKeys([]byte("hé\x1b[A\x1b[6~\x03\r\x1b[Z\x7f\x1b"))
+	want := []key{{r: 'h'}, {r: 'é'}, {name: "up"}, {name: "pgdn"}, {name: "ctrl-c"}, {name: "enter"}, {name: "shift-tab"}, {name: "backspace"}, {name: "esc"}}
+	if !slices.Equal(keys, want) || rest != nil {
+		t.Errorf("parseKeys = %v, %q; want %v", keys, rest, want)
+	}
+
+	// Incomplete sequences are kept for the next read.
+	keys, rest = parseKeys([]byte("a\x1b[5"))
+	if !slices.Equal(keys, []key{{r: 'a'}}) || string(rest) != "\x1b[5" {
+		t.Errorf("parseKeys(partial escape) = %v, %q", keys, rest)
+	}
+	keys, rest = parseKeys([]byte("\xc3"))
+	if len(keys) != 0 || string(rest) != "\xc3" {
+		t.Errorf("parseKeys(partial rune) = %v, %q", keys, rest)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		s    string
+		w    int
+		want []string
+	}{
+		{s: "hello world", w: 20, want: []string{"hello world"}},
+		{s: "hello world", w: 8, want: []string{"hello", "  world"}},
+		{s: "one\ntwo", w: 8, want: []string{"one", "  two"}},
+		{s: "abcdefghij", w: 4, want: []string{"abcd", "  ef", "  gh", "  ij"}},
+		{s: "🦸 hi", w: 3, want: []string{"🦸", "  h", "  i"}},
+		{s: "tab\there\x1b[31m", w: 20, want: []string{"tab    here[31m"}},
+	}
+	for _, tt := range tests {
+		got := wrap(tt.s, tt.w, "  ")
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("wrap(%q, %d) = %q, want %q", tt.s, tt.w, got, tt.want)
+		}
+		for _, line := range got {
+			if displayWidth(line) > tt.w {
+				t.Errorf("wrap(%q, %d): line %q is too wide", tt.s, tt.w, line)
+			}
+		}
+	}
+}
+
+func TestDisplayWidth(t *testing.T) {
+	tests := map[string]int{
+		"abc":                3,
+		"🕴️ hi":              5,
+		"日本":                 4,
+		"\033[33mabc\033[0m": 3,
+		"✅ done":             7,
+	}
+	for s, want := range tests {
+		if got := displayWidth(s); got != want {
+			t.Errorf("displayWidth(%q) = %d, want %d", s, got, want)
+		}
+	}
+	if got := truncate("\033[1mabcdef", 3); got != "\033[1mabc" {
+		t.Errorf("truncate = %q", got)
+	}
+}
+
+var ansiRE = regexp.MustCompile("\033\\[[0-9;?]*[a-zA-Z]")
+
+// screenRows returns the rows drawn by render, without escape sequences.
+func screenRows(frame string) []string {
+	return strings.Split(ansiRE.ReplaceAllString(frame, ""), "\r\n")
+}
+
+func newTestFullScreen(w, h int) *FullScreen {
+	f := &FullScreen{width: w, height: h, selected: -1}
+	f.entries = []entry{
+		{text: "🦸 please fix the bug"},
+		{text: "🕴️ looking"},
+		{text: "🛠️  bash: go test ./...", tool: &loop.AgentMessage{ToolName: "bash", ToolInput: `{"command":"go test ./..."}`, ToolResult: "ok"}},
+		{text: "🕴️ all fixed"},
+	}
+	f.git = gitSummary{
+		added: 3, removed: 1,
+		files:   []git_tools.DiffFile{{Path: "main.go", Status: "M", Additions: 3, Deletions: 1}},
+		commits: []git_tools.GitLogEntry{{Hash: "0123456789abcdef", Subject: "Fix the bug"}},
+	}
+	return f
+}
+
+func TestRender(t *testing.T) {
+	f := newTestFullScreen(100, 12)
+	rows := screenRows(f.render(statusInfo{state: "WaitingForUserInput", slug: "fix-bug", cost: 1.5, ports: []uint16{8000}}))
+	if len(rows) != 12 {
+		t.Fatalf("got %d rows, want 12", len(rows))
+	}
+	for i, row := range rows {
+		if w := displayWidth(row); w != 100 {
+			t.Errorf("row %d is %d columns wide, want 100: %q", i, w, row)
+		}
+	}
+	if !strings.HasPrefix(rows[0], "🦸 please fix the bug") || !strings.Contains(rows[0], "│ Diff  +3 -1") {
+		t.Errorf("row 0 = %q", rows[0])
+	}
+	if !strings.Contains(rows[1], "M main.go") {
+		t.Errorf("row 1 = %q", rows[1])
+	}
+	if !strings.Contains(rows[4], "0123456 Fix the bug") {
+		t.Errorf("row 4 = %q", rows[4])
+	}
+	if !strings.HasPrefix(rows[10], "fix-bug> ") {
+		t.Errorf("prompt row = %q", rows[10])
+	}
+	for _, want := range []string{"WaitingForUserInput", "$1.50", "ports 8000", "^Y approve"} {
+		if !strings.Contains(rows[11], want) {
+			t.Errorf("status bar %q does not contain %q", rows[11], want)
+		}
+	}
+
+	// Narrow screens drop the side pane.
+	f = newTestFullScreen(60, 8)
+	rows = screenRows(f.render(statusInfo{}))
+	if strings.Contains(strings.Join(rows, "\n"), "│ Diff") {
+		t.Errorf("side pane shown on a narrow screen")
+	}
+}
+
+func TestToolDetailPane(t *testing.T) {
+	f := newTestFullScreen(100, 20)
+	ctx := context.Background()
+	f.handleKey(ctx, key{name: "tab"})
+	if f.selected != 2 || !f.detail {
+		t.Fatalf("after tab: selected %d, detail %v; want tool call 2 selected", f.selected, f.detail)
+	}
+	screen := strings.Join(screenRows(f.render(statusInfo{})), "\n")
+	for _, want := range []string{"─ bash ─", `"command": "go test ./..."`, "result:", "  ok"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("detail pane does not contain %q:\n%s", want, screen)
+		}
+	}
+
+	f.handleKey(ctx, key{name: "esc"})
+	screen = strings.Join(screenRows(f.render(statusInfo{})), "\n")
+	if strings.Contains(screen, "─ bash ─") {
+		t.Errorf("detail pane still shown after esc")
+	}
+}
+
+func TestScroll(t *testing.T) {
+	f := newTestFullScreen(60, 5) // three timeline rows for four entries
+	ctx := context.Background()
+	rows := screenRows(f.render(statusInfo{}))
+	if !strings.HasPrefix(rows[0], "🕴️ looking") {
+		t.Errorf("timeline should follow the bottom; row 0 = %q", rows[0])
+	}
+	f.handleKey(ctx, key{name: "up"})
+	rows = screenRows(f.render(statusInfo{}))
+	if !strings.HasPrefix(rows[0], "🦸 please") || !strings.Contains(rows[4], "↑1") {
+		t.Errorf("after scrolling up: rows = %q", rows)
+	}
+	f.handleKey(ctx, key{name: "pgup"})
+	f.render(statusInfo{})
+	if f.scroll != 1 {
+		t.Errorf("scroll = %d, want it clamped to 1", f.scroll)
+	}
+	f.handleKey(ctx, key{name: "end"})
+	if f.scroll != 0 {
+		t.Errorf("scroll after end = %d, want 0", f.scroll)
+	}
+}
@@ -0,0 +1,78 @@
+package termui
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+
+	"sketch.dev/prompthistory"
+)
+
+// newlineMarker stands in for newlines when a multi-line history entry
+// is recalled into the single-line prompt. Sending the line turns it back into newlines.
+const newlineMarker = " ⏎ "
+
+// History is the prompt history. It implements term.History,
+// and persists entries to a prompthistory.Store so that they survive across sessions.
+type History struct {
+	mu      sync.Mutex
+	entries []string // oldest first
+	store   prompthistory.Store
+}
+
+// NewHistory returns a History backed by store, which may be nil.
+// Failing to load the stored history is not fatal: the history starts empty.
+func NewHistory(store prompthistory.Store) *History {
+	h := &History{store: store}
+	if store != nil {
+		entries, err := store.Load()
+		if err != nil {
+			slog.Warn("failed to load prompt history", "err", err)
+		}
+		h.entries = entries[max(0, len(entries)-prompthistory.MaxEntries):]
+	}
+	return h
+}
+
+// Add records entry as the most recent prompt.
+// Empty entries and repeats of the most recent entry are not recorded.
+func (h *History) Add(entry string) {
+	entry = strings.ReplaceAll(entry, newlineMarker, "\n")
+	if strings.TrimSpace(entry) == "" {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n := len(h.entries); n > 0 && h.entries[n-1] == entry {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > prompthistory.MaxEntries {
+		h.entries = h.entries[len(h.entries)-prompthistory.MaxEntries:]
+	}
+	if h.store != nil {
+		if err := h.store.Append(entry); err != nil {
+			slog.Warn("failed to save prompt history", "err", err)
+		}
+	}
+}
+
+// Len returns the number of entries.
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.entries)
+}
+
+// At returns the entry idx back from the most recent, as it should appear in the prompt.
+func (h *History) At(idx int) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return strings.ReplaceAll(h.entries[len(h.entries)-1-idx], "\n", newlineMarker)
+}
+
+// recallOnly gives the terminal access to a History without letting it add entries:
+// the terminal adds every line it reads, but only complete prompts belong in the history.
+type recallOnly struct{ *History }
+
+func (recallOnly) Add(string) {}
@@ -0,0 +1,182 @@
+package termui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/term"
+	"sketch.dev/llm/conversation"
+	"sketch.dev/loop"
+	"sketch.dev/prompthistory"
+)
+
+func TestHistory(t *testing.T) {
+	store := &prompthistory.FileStore{Path: filepath.Join(t.TempDir(), "sub", "history.jsonl")}
+	h := NewHistory(store)
+	for _, entry := range []string{"first", "", "second", "second", "line one\nline two"} {
+		h.Add(entry)
+	}
+	if h.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3 (empty entries and repeats are skipped)", h.Len())
+	}
+	if got := h.At(0); got != "line one"+newlineMarker+"line two" {
+		t.Errorf("At(0) = %q", got)
+	}
+	if got := h.At(2); got != "first" {
+		t.Errorf("At(2) = %q", got)
+	}
+
+	// A new session sees the same history.
+	h = NewHistory(store)
+	if h.Len() != 3 || h.At(1) != "second" {
+		t.Errorf("reloaded history has %d entries, At(1) = %q", h.Len(), h.At(1))
+	}
+
+	// Recalled multi-line entries are stored with their newlines.
+	h.Add("a" + newlineMarker + "b")
+	entries, err := store.Load()
+	if err != nil || entries[len(entries)-1] != "a\nb" {
+		t.Errorf("Load() = %q, %v", entries, err)
+	}
+
+	// The terminal can't add to the history.
+	recallOnly{h}.Add("typed")
+	if h.Len() != 4 {
+		t.Errorf("recallOnly.Add changed the history")
+	}
+}
+
+func TestHistoryBounded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store := &prompthistory.FileStore{Path: path}
+	for i := range 2*prompthistory.MaxEntries + 1 {
+		if err := store.Append(fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewHistory(store)
+	if h.Len() != prompthistory.MaxEntries || h.At(0) != fmt.Sprint(2*prompthistory.MaxEntries) {
+		t.Errorf("Len() = %d, At(0) = %q", h.Len(), h.At(0))
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "\n"); n != prompthistory.MaxEntries {
+		t.Errorf("history file has %d lines after compaction, want %d", n, prompthistory.MaxEntries)
+	}
+}
+
+func TestComposer(t *testing.T) {
+	type input struct {
+		line   string
+		pasted bool
+	}
+	tests := []struct {
+		name  string
+		lines []input
+		want  []string // messages sent
+	}{
+		{
+			name:  "plain lines are not composed",
+			lines: []input{{line: "hello"}},
+		},
+		{
+			name:  "delimited",
+			lines: []input{{line: `"""`}, {line: "fix this:"}, {line: ""}, {line: "  panic: oops"}, {line: ` """ `}},
+			want:  []string{"fix this:\n\n  panic: oops"},
+		},
+		{
+			name:  "paste",
+			lines: []input{{line: "panic: oops", pasted: true}, {line: "\tmain.go:12", pasted: true}, {line: "why?"}},
+			want:  []string{"panic: oops\n\tmain.go:12\nwhy?"},
+		},
+		{
+			name:  "paste inside delimiters",
+			lines: []input{{line: `"""`}, {line: "a", pasted: true}, {line: `"""`, pasted: true}},
+			want:  []string{"a"},
+		},
+		{
+			name:  "empty",
+			lines: []input{{line: `"""`}, {line: `"""`}},
+			want:  []string{""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c composer
+			var sent []string
+			consumed := 0
+			for _, in := range tt.lines {
+				msg, ok := c.feed(in.line, in.pasted)
+				if !ok {
+					continue
+				}
+				consumed++
+				if !c.active() {
+					sent = append(sent, msg)
+				}
+			}
+			if !slices.Equal(sent, tt.want) {
+				t.Errorf("sent %q, want %q", sent, tt.want)
+			}
+			if tt.want == nil && consumed != 0 {
+				t.Errorf("composer consumed %d plain lines", consumed)
+			}
+			if c.active() {
+				t.Errorf("composer still active")
+			}
+		})
+	}
+}
+
+// promptAgent records the messages sent to the agent.
+type promptAgent struct {
+	loop.CodingAgent
+	msgs []string
+}
+
+func (a *promptAgent) UserMessage(ctx context.Context, msg string) { a.msgs = append(a.msgs, msg) }
+
+func (a *promptAgent) TotalUsage() conversation.CumulativeUsage {
+	return conversation.CumulativeUsage{}
+}
+
+func (a *promptAgent) Slug() string { return "" }
+
+func TestInputLoopHistory(t *testing.T) {
+	agent := &promptAgent{}
+	ui := New(agent, "")
+	ui.SetHistory(NewHistory(nil))
+	input := "help\r/cost\r!true\rfix the bug\r\"\"\"\rline one\rline two\r\"\"\"\r"
+	ui.trm = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(input), io.Discard}, "")
+	go func() {
+		for range ui.termLogCh {
+			ui.messageWaitGroup.Done()
+		}
+	}()
+
+	// At the end of the input, the loop exits as if "exit" was typed.
+	if err := ui.inputLoop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := ui.history.Len() - 1; i >= 0; i-- {
+		got = append(got, ui.history.At(i))
+	}
+	if want := []string{"fix the bug", "line one" + newlineMarker + "line two"}; !slices.Equal(got, want) {
+		t.Errorf("history = %q, want only the prompts sent to the agent, %q", got, want)
+	}
+	if len(agent.msgs) != 2 {
+		t.Errorf("agent got %q, want the two prompts", agent.msgs)
+	}
+}
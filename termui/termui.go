@@ -11,8 +11,10 @@ import (
 	"os/exec"
 	"os/signal"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"text/template"
 	"time"
@@ -40,7 +42,9 @@ var (
 {{else if eq .msg.ToolName "keyword_search" -}}
  🔍 {{ .input.query}}: {{.input.search_terms -}}
 {{else if eq .msg.ToolName "bash" -}}
- 🖥️  {{if .input.background}}🥷  {{end}}{{if .input.slow_ok}}🐢  {{end}}{{ .input.command -}}
+ 🖥️  {{if .input.background}}🥷  {{end}}{{if .input.interactive}}⌨️  {{end}}{{if .input.slow_ok}}🐢  {{end}}{{ .input.command -}}
+{{else if eq .msg.ToolName "jobs" -}}
+ ⚙️  {{.input.action}}{{if .input.input}} {{printf "%q" .input.input}}{{end}}{{if .input.id}} job {{.input.id}}{{end}}{{if .input.pattern}} until /{{.input.pattern}}/{{end -}}
 {{else if eq .msg.ToolName "patch" -}}
  ⌨️  {{.input.path -}}
 {{else if eq .msg.ToolName "done" -}}
@@ -48,7 +52,9 @@ var (
 {{else if eq .msg.ToolName "about_sketch" -}}
 📚 About Sketch
 {{else if eq .msg.ToolName "codereview" -}}
- 🐛  Running automated code review, may be slow
+{{if .input.dismiss}} 🐛  Dismissing code review findings{{range .input.dismiss}} {{.id}}{{end}}
+{{else}} 🐛  Running automated code review, may be slow
+{{end -}}
 {{else if eq .msg.ToolName "browser_navigate" -}}
  🌐 {{.input.url -}}
 {{else if eq .msg.ToolName "browser_eval" -}}
@@ -84,6 +90,15 @@ type TermUI struct {
 
 	trm *term.Terminal
 
+	history *History
+
+	// composing is set while a multi-line message is being composed.
+	composing atomic.Bool
+
+	// outputMu is held while writing to the terminal,
+	// and while an editor has the terminal.
+	outputMu sync.Mutex
+
 	// the chatMsgCh channel is for "conversation" messages, like responses to user input
 	// from the LLM, or output from executing slash-commands issued by the user.
 	chatMsgCh chan chatMessage
@@ -122,9 +137,15 @@ func New(agent loop.CodingAgent, httpURL string) *TermUI {
 		chatMsgCh:      make(chan chatMessage, 1),
 		termLogCh:      make(chan string, 1),
 		pushedBranches: make(map[string]struct{}),
+		history:        NewHistory(nil),
 	}
 }
 
+// SetHistory sets the prompt history. It must be called before Run.
+func (ui *TermUI) SetHistory(h *History) {
+	ui.history = h
+}
+
 func (ui *TermUI) Run(ctx context.Context) error {
 	fmt.Println(`🌐 ` + ui.httpURL + `/`)
 	fmt.Println(`💬 type 'help' for help`)
@@ -221,16 +242,31 @@ func (ui *TermUI) receiveMessagesLoop(ctx context.Context) {
 }
 
 func (ui *TermUI) inputLoop(ctx context.Context) error {
+	var c composer
 	for {
 		line, err := ui.trm.ReadLine()
+		pasted := errors.Is(err, term.ErrPasteIndicator)
 		if errors.Is(err, io.EOF) {
 			ui.AppendSystemMessage("\n")
 			line = "exit"
-		} else if err != nil {
+		} else if err != nil && !pasted {
 			return err
 		}
 
+		if msg, ok := c.feed(line, pasted); ok {
+			ui.composing.Store(c.active())
+			ui.updatePrompt(false)
+			if !c.active() {
+				ui.sendComposed(ctx, msg)
+			}
+			continue
+		}
+
 		line = strings.TrimSpace(line)
+		line = strings.ReplaceAll(line, newlineMarker, "\n")
+		if name, ok := strings.CutPrefix(line, "/"); ok && slices.Contains(plainCommands, name) {
+			line = name
+		}
 
 		switch line {
 		case "?", "help":
@@ -244,7 +280,12 @@ Special commands:
 - browser, open, b    : Open current conversation in browser
 - stop, cancel, abort : Cancel the current operation
 - exit, quit, q       : Exit sketch
-- ! <command>         : Execute a shell command (e.g. !ls -la)`)
+- ! <command>         : Execute a shell command (e.g. !ls -la)
+%s
+
+Press tab to complete / commands, and up and down to recall earlier prompts.
+Start and end a multi-line message with """ on a line by itself.
+Pasted text is sent as one message when you press enter.`, slashCommandHelp())
 		case "budget":
 			originalBudget := ui.agent.OriginalBudget()
 			ui.AppendSystemMessage("💰 Budget summary:")
@@ -333,6 +374,9 @@ Special commands:
 			if line == "" {
 				continue
 			}
+			if strings.HasPrefix(line, "/") && ui.runSlashCommand(ctx, line) {
+				continue
+			}
 			if strings.HasPrefix(line, "!") {
 				// Execute as shell command
 				line = line[1:] // remove the '!' prefix
@@ -366,6 +410,8 @@ Special commands:
 			// Send it to the LLM
 			// chatMsg := chatMessage{sender: "you", content: line}
 			// ui.sendChatMessage(chatMsg)
+			// Only prompts for the agent go in the history, not commands.
+			ui.history.Add(line)
 			ui.agent.UserMessage(ctx, line)
 		}
 	}
@@ -378,6 +424,9 @@ func (ui *TermUI) updatePrompt(thinking bool) {
 		t = " *"
 	}
 	p := fmt.Sprintf("%s%s> ", ui.agent.Slug(), t)
+	if ui.composing.Load() {
+		p = "... "
+	}
 	ui.trm.SetPrompt(p)
 }
 
@@ -395,6 +444,9 @@ func (ui *TermUI) initializeTerminalUI(ctx context.Context) error {
 	}
 	ui.oldState = oldState
 	ui.trm = term.NewTerminal(ui.stdin, "")
+	ui.trm.AutoCompleteCallback = ui.autoComplete
+	ui.trm.History = recallOnly{ui.history}
+	ui.trm.SetBracketedPasteMode(true)
 	width, height, err := term.GetSize(int(ui.stdin.Fd()))
 	if err != nil {
 		return fmt.Errorf("get terminal size: %v", err)
@@ -431,6 +483,8 @@ func (ui *TermUI) initializeTerminalUI(ctx context.Context) error {
 			case msg := <-ui.chatMsgCh:
 				func() {
 					defer ui.messageWaitGroup.Done()
+					ui.outputMu.Lock()
+					defer ui.outputMu.Unlock()
 					// Update prompt before writing, because otherwise it doesn't redraw the prompt.
 					ui.updatePrompt(msg.thinking)
 					lastMsg = &msg
@@ -445,6 +499,8 @@ func (ui *TermUI) initializeTerminalUI(ctx context.Context) error {
 			case logLine := <-ui.termLogCh:
 				func() {
 					defer ui.messageWaitGroup.Done()
+					ui.outputMu.Lock()
+					defer ui.outputMu.Unlock()
 					if lastMsg != nil {
 						ui.updatePrompt(lastMsg.thinking)
 					} else {
@@ -465,6 +521,9 @@ func (ui *TermUI) RestoreOldState() error {
 	defer ui.mu.Unlock()
 	ui.setTerminalTitle("")
 	ui.popTerminalTitle()
+	if ui.trm != nil {
+		ui.trm.SetBracketedPasteMode(false)
+	}
 	return term.Restore(int(ui.stdin.Fd()), ui.oldState)
 }
 
@@ -74,6 +74,29 @@ export interface Port {
 	port: number;
 	process: string;
 	pid: number;
+	kind?: string;
+	http_status?: number;
+	title?: string;
+	cmdline?: string;
+}
+
+export interface PortForward {
+	port: number;
+	host_addr: string;
+}
+
+export interface JobInfo {
+	id: number;
+	command: string;
+	pid: number;
+	status: string;
+	exit_code?: number | null;
+	started: string;
+	finished?: string | null;
+	output_file: string;
+	ports?: number[] | null;
+	interactive?: boolean;
+	waiting_for_input?: boolean;
 }
 
 export interface State {
@@ -110,6 +133,8 @@ export interface State {
 	diff_lines_added: number;
 	diff_lines_removed: number;
 	open_ports?: Port[] | null;
+	port_forwards?: PortForward[] | null;
+	jobs?: JobInfo[] | null;
 	token_context_window?: number;
 	model?: string;
 	session_ended?: boolean;
@@ -173,6 +198,23 @@ export interface GitLogEntry {
 	subject: string;
 }
 
+export interface Finding {
+	id?: string;
+	tool: string;
+	rule?: string;
+	severity: string;
+	file?: string;
+	line?: number;
+	end_line?: number;
+	message: string;
+	dismissed?: string;
+}
+
+export interface Report {
+	commit: string;
+	findings: Finding[] | null;
+}
+
 export type CodingAgentMessageType = 'user' | 'agent' | 'error' | 'budget' | 'tool' | 'commit' | 'auto' | 'port' | 'compact' | 'slug' | 'external';
 
 export type Duration = number;
@@ -241,7 +241,11 @@ export class MobileChat extends SketchTailwindElement {
         case "bash":
           const command = input.command || "";
           const isBackground = input.background === true;
-          const bgPrefix = isBackground ? "[bg] " : "";
+          const bgPrefix = input.interactive === true
+            ? "[tty] "
+            : isBackground
+              ? "[bg] "
+              : "";
           return (
             bgPrefix +
             (command.length > 40 ? command.substring(0, 40) + "..." : command)
@@ -279,6 +283,12 @@ export class MobileChat extends SketchTailwindElement {
         case "todo_read":
           return "Read todo list";
 
+        case "jobs":
+          if (input.action === "send") {
+            return `send ${JSON.stringify(input.input || "")} to job ${input.id}`;
+          }
+          return input.id ? `${input.action} job ${input.id}` : input.action;
+
         case "done":
           return "Task completion checklist";
 
@@ -1,4 +1,4 @@
-import { State, AgentMessage, Usage, Port } from "../types";
+import { State, AgentMessage, Usage, Port, JobInfo } from "../types";
 import { html } from "lit";
 import { customElement, property, state } from "lit/decorators.js";
 import { formatNumber } from "../utils";
@@ -33,6 +33,13 @@ export class SketchContainerStatus extends SketchTailwindElement {
   @state()
   highlightedPorts: Set<number> = new Set();
 
+  @state()
+  showJobsPopup: boolean = false;
+
+  // Jobs stopped from the jobs popup; state.jobs catches up on the next update.
+  @state()
+  stoppedJobs: Set<number> = new Set();
+
   // CSS animations that can't be easily replaced with Tailwind
   connectedCallback() {
     super.connectedCallback();
@@ -71,6 +78,11 @@ export class SketchContainerStatus extends SketchTailwindElement {
         this.showPortsPopup = false;
         this.requestUpdate();
       }
+      // Close the jobs popup when clicking outside of it
+      if (this.showJobsPopup && !this.contains(event.target as Node)) {
+        this.showJobsPopup = false;
+        this.requestUpdate();
+      }
     });
   }
 
@@ -252,12 +264,32 @@ export class SketchContainerStatus extends SketchTailwindElement {
   }
 
   /**
-   * Generate URL for a port based on skaband_addr or localhost
+   * Describe what the port monitor's probe found on a port, e.g. "HTTP 200" or "gRPC"
+   */
+  portKindLabel(port: Port): string {
+    switch (port.kind) {
+      case "http":
+        return `HTTP ${port.http_status}`;
+      case "grpc":
+        return "gRPC";
+      case "postgres":
+        return "Postgres";
+      default:
+        return "";
+    }
+  }
+
+  /**
+   * Generate URL for a port based on skaband_addr, a host port forward, or localhost
    */
   getPortUrl(port: number): string {
+    const forward = this.state?.port_forwards?.find((f) => f.port === port);
     if (this.state?.skaband_addr) {
       // Use skaband proxy pattern: skabandaddr/proxy/<sessionId>/<port>
       return `${this.state.skaband_addr}/proxy/${this.state.session_id}/${port}`;
+    } else if (forward) {
+      // The port is forwarded to the host, where it works like it does in the container.
+      return `http://${forward.host_addr.replace("127.0.0.1", "localhost")}`;
     } else {
       // Use localhost pattern: http://p{port}.localhost:{sketch_port}
       // We need to extract the port from the current URL
@@ -292,6 +324,44 @@ export class SketchContainerStatus extends SketchTailwindElement {
     this.requestUpdate();
   }
 
+  /**
+   * Get the agent's background jobs that are still running
+   */
+  getRunningJobs(): JobInfo[] {
+    return (this.state?.jobs || []).filter(
+      (job) => job.status === "running" && !this.stoppedJobs.has(job.id),
+    );
+  }
+
+  /**
+   * Show running jobs popup
+   */
+  private _showJobs(event: MouseEvent): void {
+    event.preventDefault();
+    event.stopPropagation();
+    this.showJobsPopup = !this.showJobsPopup;
+    this.requestUpdate();
+  }
+
+  /**
+   * Stop a background job and everything it started
+   */
+  async stopJob(job: JobInfo, event: MouseEvent): Promise<void> {
+    event.preventDefault();
+    event.stopPropagation();
+    try {
+      const response = await fetch(`./api/v1/jobs?id=${job.id}`, {
+        method: "DELETE",
+      });
+      if (!response.ok && response.status !== 409) {
+        throw new Error(`${response.status} ${await response.text()}`);
+      }
+      this.stoppedJobs = new Set(this.stoppedJobs).add(job.id);
+    } catch (error) {
+      console.error(`Failed to stop job ${job.id}:`, error);
+    }
+  }
+
   /**
    * Update port tracking and highlight newly opened ports
    */
@@ -639,6 +709,23 @@ export class SketchContainerStatus extends SketchTailwindElement {
           `;
         })()}
 
+        <!-- Jobs section -->
+        ${(() => {
+          const jobs = this.getRunningJobs();
+          if (jobs.length === 0) {
+            return html``;
+          }
+          return html`
+            <button
+              class="ml-2 text-xs whitespace-nowrap bg-gray-100 dark:bg-neutral-800 dark:hover:bg-gray-700 hover:bg-gray-200 px-1.5 py-0.5 rounded border border-gray-300 dark:border-gray-600 cursor-pointer transition-colors"
+              @click=${(e: MouseEvent) => this._showJobs(e)}
+              title="Show ${jobs.length} background jobs"
+            >
+              ⚙️ ${jobs.length}
+            </button>
+          `;
+        })()}
+
         <!-- Push button -->
         <sketch-push-button class="ml-2"></sketch-push-button>
 
@@ -838,15 +925,50 @@ export class SketchContainerStatus extends SketchTailwindElement {
                 <button
                   class="text-xs bg-gray-100 dark:bg-neutral-800 dark:hover:bg-gray-700 hover:bg-gray-200 px-2 py-1 rounded border border-gray-300 dark:border-gray-600 cursor-pointer transition-colors flex items-center gap-2 justify-between"
                   @click=${(e: MouseEvent) => this.onPortClick(port.port, e)}
-                  title="Open ${port.process} on port ${port.port}"
+                  title="Open ${port.cmdline || port.process} on port ${port.port}"
                 >
-                  <span>${port.process}(${port.port})</span>
-                  <span>🔗</span>
+                  <span>${port.title || port.process}(${port.port})</span>
+                  <span>${this.portKindLabel(port)} 🔗</span>
                 </button>
               `,
             )}
           </div>
         </div>
+
+        <!-- Jobs popup -->
+        <div
+          class="${this.showJobsPopup
+            ? "block"
+            : "hidden"} absolute min-w-max top-full right-0 z-20 bg-white dark:bg-neutral-800 rounded-lg p-3 shadow-lg mt-1.5 border border-gray-200 dark:border-neutral-600"
+        >
+          <h3 class="text-sm font-semibold mb-2">Background Jobs</h3>
+          <div class="flex flex-col gap-1">
+            ${this.getRunningJobs().map(
+              (job) => html`
+                <div
+                  class="text-xs px-2 py-1 rounded border border-gray-300 dark:border-gray-600 flex items-center gap-2 justify-between"
+                  title="${job.command}"
+                >
+                  <span class="font-mono max-w-96 truncate"
+                    >${job.id}: ${job.command}</span
+                  >
+                  <span class="text-gray-500 dark:text-neutral-400"
+                    >${job.waiting_for_input
+                      ? "⌨️ waiting for input "
+                      : ""}${(job.ports || []).map((p) => `:${p}`).join(" ")}</span
+                  >
+                  <button
+                    class="bg-red-50 dark:bg-red-900 hover:bg-red-100 dark:hover:bg-red-800 text-red-700 dark:text-red-200 px-1.5 rounded border border-red-300 dark:border-red-700 cursor-pointer"
+                    @click=${(e: MouseEvent) => this.stopJob(job, e)}
+                    title="Stop job ${job.id} (pid ${job.pid})"
+                  >
+                    Stop
+                  </button>
+                </div>
+              `,
+            )}
+          </div>
+        </div>
       </div>
     `;
   }
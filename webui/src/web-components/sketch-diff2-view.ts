@@ -6,6 +6,7 @@ import "./sketch-diff-range-picker";
 import "./sketch-diff-empty-view";
 import { GitDiffFile, GitDataService } from "./git-data-service";
 import { DiffRange } from "./sketch-diff-range-picker";
+import { Finding, Report } from "../types";
 
 /**
  * A component that displays diffs using Monaco editor with range and file pickers
@@ -117,6 +118,10 @@ export class SketchDiff2View extends SketchTailwindElement {
   @state()
   private untrackedFiles: string[] = [];
 
+  // Findings of the most recent code review, shown inline
+  @state()
+  private findings: Finding[] = [];
+
   @state()
   private showUntrackedPopup: boolean = false;
 
@@ -438,6 +443,19 @@ export class SketchDiff2View extends SketchTailwindElement {
         this.untrackedFiles = [];
       }
 
+      // Load code review findings to show inline
+      try {
+        const response = await fetch("./api/v1/codereview/findings");
+        if (!response.ok) {
+          throw new Error(response.statusText);
+        }
+        const report: Report = await response.json();
+        this.findings = report.findings || [];
+      } catch (error) {
+        console.error("Error loading code review findings:", error);
+        this.findings = [];
+      }
+
       // Load content for all files
       if (this.files.length > 0) {
         // Initialize expand states for new files (default to collapsed)
@@ -853,6 +871,9 @@ export class SketchDiff2View extends SketchTailwindElement {
           ?editable-right="${content.editable}"
           @monaco-comment="${this.handleMonacoComment}"
           @monaco-save="${this.handleMonacoSave}"
+          .findings="${this.findings.filter(
+            (f) => f.file === selectedFileData.path,
+          )}"
           data-file-path="${selectedFileData.path}"
         ></sketch-monaco-view>
       </div>
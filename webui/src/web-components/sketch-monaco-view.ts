@@ -8,6 +8,7 @@ import { SketchTailwindElement } from "./sketch-tailwind-element.js";
 
 import type * as monaco from "monaco-editor";
 import { ThemeService } from "./theme-service.js";
+import { Finding } from "../types";
 
 // Monaco is loaded dynamically - see loadMonaco() function
 declare global {
@@ -173,6 +174,9 @@ export class CodeDiffEditor extends SketchTailwindElement {
   @property() originalFilename?: string = "original.js";
   @property() modifiedFilename?: string = "modified.js";
 
+  // Code review findings to show inline in the modified file
+  @property({ attribute: false }) findings: Finding[] = [];
+
   // Comment system state
   @state() private showCommentBox: boolean = false;
   @state() private commentText: string = "";
@@ -1284,12 +1288,53 @@ export class CodeDiffEditor extends SketchTailwindElement {
         // Add glyph decorations after setting new models
         setTimeout(() => this.setupGlyphDecorations(), 100);
       }
+      this.updateFindingMarkers();
       this.setupContentChangeListener();
     } catch (error) {
       console.error("Error updating Monaco models:", error);
     }
   }
 
+  /**
+   * Shows the code review findings as markers on the modified model.
+   * Dismissed findings are shown as hints.
+   */
+  private updateFindingMarkers() {
+    if (!this.modifiedModel || !window.monaco) return;
+    const severities = window.monaco.MarkerSeverity;
+    const lineCount = this.modifiedModel.getLineCount();
+    const markers = (this.findings || [])
+      .filter((f) => f.line && f.line <= lineCount)
+      .map((f) => {
+        const endLine = Math.min(Math.max(f.end_line || 0, f.line!), lineCount);
+        let severity = severities.Info;
+        if (f.dismissed) {
+          severity = severities.Hint;
+        } else if (f.severity === "error") {
+          severity = severities.Error;
+        } else if (f.severity === "warning") {
+          severity = severities.Warning;
+        }
+        return {
+          severity,
+          message: f.dismissed
+            ? `${f.message}\n\nDismissed: ${f.dismissed}`
+            : f.message,
+          source: f.id ? `${f.tool} ${f.id}` : f.tool,
+          code: f.rule,
+          startLineNumber: f.line!,
+          startColumn: 1,
+          endLineNumber: endLine,
+          endColumn: this.modifiedModel!.getLineMaxColumn(endLine),
+        };
+      });
+    window.monaco.editor.setModelMarkers(
+      this.modifiedModel,
+      "codereview",
+      markers,
+    );
+  }
+
   async updated(changedProperties: Map<string, any>) {
     if (changedProperties.has("theme")) {
       // Update Monaco theme if it changed
@@ -1323,6 +1368,8 @@ export class CodeDiffEditor extends SketchTailwindElement {
         await this.ensureConnectedToDocument();
         await this.initializeEditor();
       }
+    } else if (changedProperties.has("findings")) {
+      this.updateFindingMarkers();
     }
   }
 
@@ -78,9 +78,13 @@ export class SketchToolCardBash extends SketchTailwindElement {
     const inputData = JSON.parse(this.toolCall?.input || "{}");
     const isBackground = inputData?.background === true;
     const isSlowOk = inputData?.slow_ok === true;
+    const isInteractive = inputData?.interactive === true;
     const backgroundIcon = isBackground
       ? html`<span title="Running in background">🥷</span> `
       : "";
+    const interactiveIcon = isInteractive
+      ? html`<span title="Interactive">⌨️</span> `
+      : "";
     const slowIcon = isSlowOk
       ? html`<span title="Extended timeouts">🐢</span> `
       : "";
@@ -93,7 +97,7 @@ export class SketchToolCardBash extends SketchTailwindElement {
     const summaryContent = html`<div
       class="max-w-full overflow-hidden text-ellipsis whitespace-nowrap"
     >
-      ${backgroundIcon}${slowIcon}${displayCommand}
+      ${backgroundIcon}${interactiveIcon}${slowIcon}${displayCommand}
     </div>`;
 
     const inputContent = html`<div
@@ -103,7 +107,7 @@ export class SketchToolCardBash extends SketchTailwindElement {
         <pre
           class="bg-gray-200 dark:bg-neutral-700 text-black dark:text-neutral-100 p-2 rounded whitespace-pre-wrap break-words max-w-full w-full box-border overflow-wrap-break-word w-full mb-0 rounded-t rounded-b-none box-border"
         >
-${backgroundIcon}${slowIcon}${inputData?.command}</pre
+${backgroundIcon}${interactiveIcon}${slowIcon}${inputData?.command}</pre
         >
       </div>
     </div>`;